@@ -10,6 +10,8 @@ import (
 	"syscall"
 
 	"dongstudio.live/genkit_demo/pkg/env"
+	"dongstudio.live/genkit_demo/pkg/logging"
+	"dongstudio.live/genkit_demo/pkg/tracing"
 	"github.com/firebase/genkit/go/ai"
 	"github.com/firebase/genkit/go/core/logger"
 	"github.com/firebase/genkit/go/genkit"
@@ -18,6 +20,7 @@ import (
 
 func main() {
 	env.MustLoadEnv()
+	logging.Setup() // JSON 格式日誌（輸出到 stderr，不影響 stdio 上的 MCP 協定），等級由 LOG_LEVEL 設定
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer cancel()
 
@@ -27,6 +30,14 @@ func main() {
 		os.Exit(1)
 	}
 
+	// 設定 OpenTelemetry 追蹤匯出（TRACE_EXPORTER=otlp 或 file）
+	shutdownTracing, err := tracing.Setup(ctx, g, "mcp-server")
+	if err != nil {
+		logger.FromContext(ctx).Error("Failed to set up tracing", "error", err)
+		os.Exit(1)
+	}
+	defer shutdownTracing(context.Background())
+
 	// 定義工具
 	getWeatherTool := genkit.DefineTool(g, "getWeather", "天氣查詢工具，可以查詢指定地點的天氣，查詢時必須翻譯成英文",
 		func(ctx *ai.ToolContext, input struct {
@@ -1,11 +1,14 @@
 // AI 對話服務 - 基於 Firebase Genkit 的聊天機器人
-// 支援對話歷史記錄和多會話管理
+// 支援對話歷史記錄和多會話管理，所有 API 皆需驗證並只能存取自己的會話
 package main
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
@@ -13,13 +16,24 @@ import (
 	"syscall"
 	"time"
 
+	"dongstudio.live/genkit_demo/pkg/auth"
 	"dongstudio.live/genkit_demo/pkg/env"
+	"dongstudio.live/genkit_demo/pkg/health"
+	"dongstudio.live/genkit_demo/pkg/logging"
+	"dongstudio.live/genkit_demo/pkg/metrics"
+	"dongstudio.live/genkit_demo/pkg/rageval"
+	"dongstudio.live/genkit_demo/pkg/ratelimit"
+	"dongstudio.live/genkit_demo/pkg/tracing"
+	"dongstudio.live/genkit_demo/pkg/usage"
 	"github.com/firebase/genkit/go/ai"
 	"github.com/firebase/genkit/go/genkit"
 	"github.com/firebase/genkit/go/plugins/googlegenai"
 	"github.com/gin-gonic/gin"
 )
 
+// modelName 為聊天使用的模型，同時用於用量計費
+const modelName = "googleai/gemini-2.5-flash"
+
 // Message 表示一條對話訊息
 type Message struct {
 	ID        string    `json:"id"`        // 訊息唯一識別碼
@@ -31,6 +45,7 @@ type Message struct {
 // ChatSession 表示一個聊天會話，包含該會話的所有訊息
 type ChatSession struct {
 	ID       string       `json:"id"`       // 會話唯一識別碼
+	Owner    string       `json:"owner"`    // 會話擁有者的使用者ID
 	Messages []Message    `json:"messages"` // 會話中的所有訊息
 	mutex    sync.RWMutex // 讀寫鎖，保護訊息列表的並發存取
 }
@@ -60,33 +75,86 @@ func NewChatManager() *ChatManager {
 	}
 }
 
-// GetSession 獲取或創建指定的聊天會話
-// 使用雙重檢查鎖定模式確保線程安全
-func (cm *ChatManager) GetSession(sessionID string) *ChatSession {
-	// 首次檢查：使用讀鎖查找已存在的會話
+// Count 回傳目前的會話數
+func (cm *ChatManager) Count() int {
 	cm.mutex.RLock()
-	if session, exists := cm.sessions[sessionID]; exists {
-		cm.mutex.RUnlock()
-		return session
-	}
-	cm.mutex.RUnlock()
+	defer cm.mutex.RUnlock()
+	return len(cm.sessions)
+}
 
-	// 如果會話不存在，獲取寫鎖創建新會話
-	cm.mutex.Lock()
-	defer cm.mutex.Unlock()
+// newSessionID 產生不可猜測的會話ID（128 位元隨機數）
+func newSessionID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "session_" + hex.EncodeToString(b), nil
+}
 
-	// 第二次檢查：防止在獲取寫鎖期間其他goroutine已經創建了會話
-	if session, exists := cm.sessions[sessionID]; exists {
-		return session
+// CreateSession 為指定使用者創建一個新的聊天會話
+func (cm *ChatManager) CreateSession(owner string) (*ChatSession, error) {
+	sessionID, err := newSessionID()
+	if err != nil {
+		return nil, err
 	}
 
-	// 創建新的聊天會話
+	// 創建新的聊天會話並記錄擁有者
 	session := &ChatSession{
 		ID:       sessionID,
+		Owner:    owner,
 		Messages: make([]Message, 0), // 初始化空的訊息列表
 	}
+
+	cm.mutex.Lock()
+	defer cm.mutex.Unlock()
 	cm.sessions[sessionID] = session
-	return session
+	return session, nil
+}
+
+// GetSession 獲取指定的聊天會話，會話不存在時回傳 ErrSessionNotFound，
+// 不屬於該使用者時回傳 ErrSessionForbidden
+func (cm *ChatManager) GetSession(sessionID, owner string) (*ChatSession, error) {
+	cm.mutex.RLock()
+	session, exists := cm.sessions[sessionID]
+	cm.mutex.RUnlock()
+
+	if !exists {
+		return nil, ErrSessionNotFound
+	}
+	if session.Owner != owner {
+		return nil, ErrSessionForbidden
+	}
+	return session, nil
+}
+
+// DeleteSession 刪除指定使用者擁有的聊天會話
+func (cm *ChatManager) DeleteSession(sessionID, owner string) error {
+	cm.mutex.Lock()
+	defer cm.mutex.Unlock()
+
+	session, exists := cm.sessions[sessionID]
+	if !exists {
+		return ErrSessionNotFound
+	}
+	if session.Owner != owner {
+		return ErrSessionForbidden
+	}
+	delete(cm.sessions, sessionID)
+	return nil
+}
+
+// 會話存取錯誤
+var (
+	ErrSessionNotFound  = errors.New("會話不存在")
+	ErrSessionForbidden = errors.New("無權存取此會話")
+)
+
+// sessionErrorStatus 將會話存取錯誤轉換為 HTTP 狀態碼
+func sessionErrorStatus(err error) int {
+	if errors.Is(err, ErrSessionForbidden) {
+		return http.StatusForbidden
+	}
+	return http.StatusNotFound
 }
 
 // AddMessage 向聊天會話添加一條新訊息
@@ -141,23 +209,87 @@ func buildContextFromHistory(messages []Message) string {
 func main() {
 	// 載入環境變數（會自動向上搜尋到根目錄的 .env）
 	env.MustLoadEnv()
+	logging.Setup() // JSON 格式日誌，等級由 LOG_LEVEL 設定
 	ctx := context.Background()
 
 	// 初始化 Firebase Genkit，配置 Google AI 插件和默認模型
 	g, err := genkit.Init(ctx,
-		genkit.WithPlugins(&googlegenai.GoogleAI{}),          // 使用 Google AI 插件
-		genkit.WithDefaultModel("googleai/gemini-2.5-flash"), // 設置默認模型
+		genkit.WithPlugins(&googlegenai.GoogleAI{}), // 使用 Google AI 插件
+		genkit.WithDefaultModel(modelName),          // 設置默認模型
 	)
 	if err != nil {
-		log.Fatalf("無法初始化 Genkit: %v", err)
+		logging.Fatal("無法初始化 Genkit", "error", err)
+	}
+
+	// 設定 OpenTelemetry 追蹤匯出（TRACE_EXPORTER=otlp 或 file）
+	shutdownTracing, err := tracing.Setup(ctx, g, "chat-server")
+	if err != nil {
+		logging.Fatal("無法設定追蹤", "error", err)
+	}
+	defer shutdownTracing(context.Background())
+
+	// 讀取驗證設定（API Key 與 JWT 密鑰）
+	authConfig, err := auth.ConfigFromEnv()
+	if err != nil {
+		logging.Fatal("無法讀取驗證設定", "error", err)
+	}
+	authenticator, err := auth.NewAuthenticator(authConfig)
+	if err != nil {
+		logging.Fatal("無法初始化驗證", "error", err)
+	}
+
+	// 速率限制與每日配額（設定檔變更時會自動重新載入）
+	limiter, err := ratelimit.NewFromEnv(ctx)
+	if err != nil {
+		logging.Fatal("無法載入速率限制設定", "error", err)
+	}
+
+	// 用量與費用記錄（依使用者、會話與模型統計）
+	accountant, err := usage.NewFromEnv()
+	if err != nil {
+		logging.Fatal("無法初始化用量記錄", "error", err)
+	}
+	defer accountant.Close()
+
+	// 註冊回答評估的 evaluator（rageval/answer_relevance 等），可在開發介面中以含回答的資料集評估對話品質
+	judge, err := rageval.JudgeFromEnv(g, modelName)
+	if err != nil {
+		logging.Fatal("無法建立回答評審", "error", err)
+	}
+	judge.Middleware = []ai.ModelMiddleware{metrics.ModelMiddleware(judge.Model), logging.ModelMiddleware(judge.Model)}
+	judge.OnUsage = func(ctx context.Context, u *ai.GenerationUsage) { accountant.Record(ctx, judge.Model, "judge", u) }
+	if _, err := judge.DefineEvaluators(); err != nil {
+		logging.Fatal("無法註冊回答評估", "error", err)
 	}
 
 	// 創建聊天管理器和HTTP路由器
 	chatManager := NewChatManager()
-	router := gin.Default() // 使用默認的Gin路由器
+	metrics.RegisterActiveSessions(chatManager.Count)
+
+	// 就緒檢查：模型供應商可連線（會話保存在記憶體中，建立後即可使用，不需另外檢查）
+	checks := health.New()
+	checks.Register("model_provider", health.Cached(health.TCPCheck("generativelanguage.googleapis.com:443"), 30*time.Second))
+	router := gin.New()
+	// 只信任 TRUSTED_PROXIES 帶入的 X-Forwarded-For，否則用戶端可偽造來源 IP 繞過速率限制
+	if err := router.SetTrustedProxies(ratelimit.TrustedProxiesFromEnv()); err != nil {
+		logging.Fatal("TRUSTED_PROXIES 格式錯誤", "error", err)
+	}
+	router.Use(gin.Recovery())       // 發生 panic 時回應 500 而不是中斷服務
+	router.Use(tracing.Middleware()) // 為每個請求建立 span，並在回應標頭帶回 trace ID
+	router.Use(logging.Middleware()) // JSON 存取日誌，並帶上 X-Request-ID
+	router.Use(metrics.Middleware()) // 記錄每個路由的請求數與延遲
+
+	// GET /metrics - Prometheus 指標，不需驗證
+	router.GET("/metrics", metrics.Handler())
+
+	// GET /healthz、/readyz、/version - 存活、就緒與版本資訊，不需驗證
+	health.RegisterRoutes(router, checks)
+
+	// 以下API都需要通過驗證
+	api := router.Group("/", auth.Middleware(authenticator))
 
 	// POST /chat - 處理聊天請求的主要API端點
-	router.POST("/chat", func(c *gin.Context) {
+	api.POST("/chat", ratelimit.Middleware(limiter), func(c *gin.Context) {
 		var req ChatRequest
 		// 解析JSON請求體
 		if err := c.ShouldBindJSON(&req); err != nil {
@@ -165,13 +297,25 @@ func main() {
 			return
 		}
 
-		// 如果沒有提供SessionID，自動生成一個
+		// 如果沒有提供SessionID，為目前使用者創建新會話；否則只能使用自己的會話
+		user := auth.FromGin(c)
+		var (
+			session *ChatSession
+			err     error
+		)
 		if req.SessionID == "" {
-			req.SessionID = fmt.Sprintf("session_%d", time.Now().UnixNano())
+			session, err = chatManager.CreateSession(user.ID)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "無法創建會話"})
+				return
+			}
+		} else {
+			session, err = chatManager.GetSession(req.SessionID, user.ID)
+			if err != nil {
+				c.JSON(sessionErrorStatus(err), gin.H{"error": err.Error()})
+				return
+			}
 		}
-
-		// 獲取或創建聊天會話
-		session := chatManager.GetSession(req.SessionID)
 		// 將用戶訊息添加到會話歷史
 		session.AddMessage("user", req.Message)
 
@@ -183,28 +327,46 @@ func main() {
 		fullPrompt := contextPrompt + req.Message
 
 		// 調用AI模型生成回應
-		resp, err := genkit.Generate(ctx, g,
+		reqCtx := usage.WithSession(c.Request.Context(), session.ID)
+		logging.AddAttrs(reqCtx, slog.String("session_id", session.ID))
+		resp, err := genkit.Generate(reqCtx, g,
 			ai.WithPrompt(fullPrompt),
+			ai.WithMiddleware(
+				metrics.ModelMiddleware(modelName), // 記錄模型延遲與 token 指標
+				logging.ModelMiddleware(modelName), // 記錄每次模型呼叫的日誌
+			),
 		)
 		if err != nil {
+			c.Error(err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "AI 回應生成失敗"})
 			return
 		}
 
+		// 記錄用量與費用，並將本次使用的 token 數計入每日配額
+		accountant.Record(reqCtx, modelName, "chat", resp.Usage)
+		if resp.Usage != nil {
+			limiter.RecordTokens(reqCtx, resp.Usage.TotalTokens)
+		}
+
 		// 將AI回應添加到會話歷史
 		aiMessage := session.AddMessage("assistant", resp.Text())
 
 		// 返回聊天回應
 		c.JSON(http.StatusOK, ChatResponse{
-			SessionID: req.SessionID,
+			SessionID: session.ID,
 			Message:   aiMessage,
 		})
 	})
 
 	// GET /chat/:session_id/history - 獲取指定會話的對話歷史
-	router.GET("/chat/:session_id/history", func(c *gin.Context) {
+	api.GET("/chat/:session_id/history", func(c *gin.Context) {
 		sessionID := c.Param("session_id") // 從URL參數獲取會話ID
-		session := chatManager.GetSession(sessionID)
+		session, err := chatManager.GetSession(sessionID, auth.FromGin(c).ID)
+		logging.AddAttrs(c.Request.Context(), slog.String("session_id", sessionID))
+		if err != nil {
+			c.JSON(sessionErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
 		history := session.GetHistory() // 獲取會話的所有歷史訊息
 
 		// 返回會話歷史
@@ -215,12 +377,14 @@ func main() {
 	})
 
 	// DELETE /chat/:session_id - 刪除指定的聊天會話
-	router.DELETE("/chat/:session_id", func(c *gin.Context) {
+	api.DELETE("/chat/:session_id", func(c *gin.Context) {
 		sessionID := c.Param("session_id") // 從URL參數獲取會話ID
-		// 使用寫鎖安全地刪除會話
-		chatManager.mutex.Lock()
-		delete(chatManager.sessions, sessionID)
-		chatManager.mutex.Unlock()
+		// 只有會話擁有者可以刪除
+		logging.AddAttrs(c.Request.Context(), slog.String("session_id", sessionID))
+		if err := chatManager.DeleteSession(sessionID, auth.FromGin(c).ID); err != nil {
+			c.JSON(sessionErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
 
 		// 返回刪除成功的回應
 		c.JSON(http.StatusOK, gin.H{
@@ -228,6 +392,17 @@ func main() {
 		})
 	})
 
+	// 管理者（AUTH_ADMIN_USERS）可查詢所有人的用量並調整日誌等級
+	admins := auth.AdminUsersFromEnv()
+
+	// GET /usage、GET /usage/export - 查詢與匯出用量統計
+	usage.RegisterRoutes(api, accountant, admins)
+
+	// GET/PUT /log-level - 查詢與調整日誌等級（僅限 AUTH_ADMIN_USERS）
+	opsAdmins := auth.RequireAdmin(admins)
+	api.GET("/log-level", opsAdmins, logging.LevelHandler())
+	api.PUT("/log-level", opsAdmins, logging.LevelHandler())
+
 	// 配置HTTP服務器
 	srv := &http.Server{
 		Addr:    ":8080", // 監聽8080端口
@@ -236,9 +411,9 @@ func main() {
 
 	// 在goroutine中啟動服務器，避免阻塞主線程
 	go func() {
-		log.Println("Chat server starting on :8080")
+		slog.Info("Chat server starting", "addr", srv.Addr)
 		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("listen: %s\n", err)
+			logging.Fatal("listen failed", "error", err)
 		}
 	}()
 
@@ -246,14 +421,14 @@ func main() {
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM) // 監聽Ctrl+C和終止信號
 	<-quit                                               // 阻塞直到收到信號
-	log.Println("Shutting down server...")
+	slog.Info("Shutting down server...")
 
 	// 給服務器5秒時間完成正在處理的請求
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 	if err := srv.Shutdown(ctx); err != nil {
-		log.Fatal("Server forced to shutdown:", err)
+		logging.Fatal("Server forced to shutdown", "error", err)
 	}
 
-	log.Println("Server exiting") // 服務器已優雅關閉
+	slog.Info("Server exiting") // 服務器已優雅關閉
 }
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/firebase/genkit/go/core"
+	"github.com/gin-gonic/gin"
+)
+
+// askResponse 為 /ask 的回應，也是 /ask/stream 的 done 事件
+type askResponse struct {
+	Question  string `json:"question"`
+	Namespace string `json:"namespace"`
+	*ragOutput
+}
+
+// bindAskRequest 解析並驗證問答請求，依驗證後的使用者決定 namespace，失敗時已寫入錯誤回應
+func bindAskRequest(c *gin.Context, tenants *namespaces) (ragInput, bool) {
+	var request ragInput
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request",
+			"message": err.Error(),
+		})
+		return request, false
+	}
+	if _, err := request.params(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request",
+			"message": err.Error(),
+		})
+		return request, false
+	}
+	// 不能查詢其他團隊的文件
+	ns, ok := tenants.fromRequest(c, request.Namespace, false)
+	if !ok {
+		return request, false
+	}
+	request.Namespace = ns.name
+	return request, true
+}
+
+// streamAnswer 以 Server-Sent Events 串流 rag-flow 的結果：
+//
+//	event: sources  檢索到的來源 {"sources": [...]}，在生成回答前送出
+//	event: delta    模型產生的一段回答 {"text": "..."}
+//	event: done     最終結果，內容與 /ask 的回應相同（含引用標記、被引用的來源與 token 用量）
+//	event: error    處理失敗 {"error": "...", "message": "..."}
+//
+// delta 為模型的原始輸出，整理引用標記或移除沒有依據的句子後的回答以 done 事件為準
+func streamAnswer(c *gin.Context, flow *core.Flow[ragInput, *ragOutput, ragChunk], request ragInput) {
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no") // 避免反向代理緩衝事件
+	for v, err := range flow.Stream(c.Request.Context(), request) {
+		switch {
+		case err != nil:
+			c.Error(err)
+			c.SSEvent("error", gin.H{
+				"error":   "Failed to process question",
+				"message": err.Error(),
+			})
+		case v.Done:
+			c.SSEvent("done", askResponse{request.Question, request.Namespace, v.Output})
+		case v.Stream.Sources != nil:
+			c.SSEvent("sources", gin.H{"sources": v.Stream.Sources})
+		default:
+			c.SSEvent("delta", gin.H{"text": v.Stream.Delta})
+		}
+		c.Writer.Flush()
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+
+	"dongstudio.live/genkit_demo/pkg/pineconestore"
+	"dongstudio.live/genkit_demo/pkg/vectorstore"
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/genkit"
+)
+
+// vectorBackend 為一個 namespace 使用的向量資料庫，可以是 Pinecone 或本機向量資料庫
+// 實作 ingest.Indexer，文件 ID 取自 metadata 的 "id"
+type vectorBackend struct {
+	name      string
+	retriever ai.Retriever
+	index     func(ctx context.Context, docs []*ai.Document) error
+	remove    func(ctx context.Context, ids []string) error
+	options   func(p retrievalParams) any            // 產生對應 retriever 的選項
+	count     func(ctx context.Context) (int, error) // 回傳 namespace 中的向量數
+}
+
+func (b *vectorBackend) Index(ctx context.Context, docs []*ai.Document) error {
+	return b.index(ctx, docs)
+}
+
+func (b *vectorBackend) Delete(ctx context.Context, ids []string) error {
+	return b.remove(ctx, ids)
+}
+
+// vectorStoreKind 回傳 RAG_VECTOR_STORE 設定的向量資料庫種類: "pinecone"（預設）或 "local"
+func vectorStoreKind() string {
+	if kind := os.Getenv("RAG_VECTOR_STORE"); kind != "" {
+		return kind
+	}
+	return "pinecone"
+}
+
+// newVectorBackends 依設定建立向量資料庫，回傳的函式為指定的 namespace 建立 vectorBackend，
+// 每個 namespace 只能建立一次
+//
+//	RAG_VECTOR_STORE=pinecone  使用 Pinecone 索引 rag-demo-3072，每個 namespace 對應同名的 Pinecone namespace
+//	                           （default 對應原本的空白 namespace）
+//	RAG_VECTOR_STORE=local     使用本機檔案 RAG_LOCAL_STORE_PATH（預設 data/vectorstore.json），
+//	                           其他 namespace 各自使用 RAG_NAMESPACE_DIR 下的檔案（見 [namespacePath]），
+//	                           相似度由 RAG_LOCAL_METRIC 設定（cosine 或 dot_product），
+//	                           RAG_LOCAL_INDEX=hnsw 時改用 HNSW 索引（見 [hnswConfigFromEnv]）
+func newVectorBackends(ctx context.Context, g *genkit.Genkit, embedder ai.Embedder) (func(namespace string) (*vectorBackend, error), error) {
+	switch kind := vectorStoreKind(); kind {
+	case "pinecone":
+		docStore, retriever, err := pineconestore.DefineRetriever(ctx, g, pineconestore.Config{
+			IndexID:  "rag-demo-3072",
+			Embedder: embedder,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("無法定義 pinecone retriever: %w", err)
+		}
+		return func(namespace string) (*vectorBackend, error) {
+			ns := pineconeNamespace(namespace)
+			return &vectorBackend{
+				name:      kind,
+				retriever: retriever,
+				index: func(ctx context.Context, docs []*ai.Document) error {
+					return pineconestore.Index(ctx, docs, docStore, ns)
+				},
+				remove: func(ctx context.Context, ids []string) error {
+					return pineconestore.Delete(ctx, ids, docStore, ns)
+				},
+				options: func(p retrievalParams) any {
+					return &pineconestore.RetrieverOptions{Namespace: ns, Count: p.TopK, MinScore: p.MinScore, Filter: p.Filter}
+				},
+				count: func(ctx context.Context) (int, error) {
+					stats, err := docStore.Index.Stats(ctx)
+					if err != nil {
+						return 0, err
+					}
+					return stats.Namespaces[ns].VectorCount, nil
+				},
+			}, nil
+		}, nil
+
+	case "local":
+		path := os.Getenv("RAG_LOCAL_STORE_PATH")
+		if path == "" {
+			path = "data/vectorstore.json"
+		}
+		cfg := vectorstore.Config{
+			Metric:   vectorstore.Metric(os.Getenv("RAG_LOCAL_METRIC")),
+			Embedder: embedder,
+		}
+		switch index := os.Getenv("RAG_LOCAL_INDEX"); index {
+		case "", "flat":
+		case "hnsw":
+			hnsw, err := hnswConfigFromEnv()
+			if err != nil {
+				return nil, err
+			}
+			cfg.HNSW = &hnsw
+		default:
+			return nil, fmt.Errorf("不支援的 RAG_LOCAL_INDEX: %s", index)
+		}
+		return func(namespace string) (*vectorBackend, error) {
+			cfg := cfg
+			cfg.Path = namespacePath(namespace, path, "vectorstore.json")
+			docStore, retriever, err := vectorstore.DefineRetriever(g, scopedName("rag-demo", namespace), cfg)
+			if err != nil {
+				return nil, fmt.Errorf("無法開啟本機向量資料庫: %w", err)
+			}
+			return &vectorBackend{
+				name:      kind,
+				retriever: retriever,
+				index: func(ctx context.Context, docs []*ai.Document) error {
+					return vectorstore.Index(ctx, docs, docStore)
+				},
+				remove: func(ctx context.Context, ids []string) error {
+					return docStore.Store.Delete(ids...)
+				},
+				options: func(p retrievalParams) any {
+					return &vectorstore.RetrieverOptions{K: p.TopK, MinScore: p.MinScore, Filter: p.Filter}
+				},
+				count: func(context.Context) (int, error) {
+					return docStore.Store.Len(), nil
+				},
+			}, nil
+		}, nil
+
+	default:
+		return nil, fmt.Errorf("不支援的 RAG_VECTOR_STORE: %s", kind)
+	}
+}
+
+// hnswConfigFromEnv 讀取 HNSW 參數 RAG_HNSW_M、RAG_HNSW_EF_CONSTRUCTION、RAG_HNSW_EF_SEARCH，
+// 未設定的參數使用 vectorstore.DefaultHNSWConfig 的預設值
+func hnswConfigFromEnv() (vectorstore.HNSWConfig, error) {
+	cfg := vectorstore.DefaultHNSWConfig()
+	for name, field := range map[string]*int{
+		"RAG_HNSW_M":               &cfg.M,
+		"RAG_HNSW_EF_CONSTRUCTION": &cfg.EfConstruction,
+		"RAG_HNSW_EF_SEARCH":       &cfg.EfSearch,
+	} {
+		v := os.Getenv(name)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return cfg, fmt.Errorf("無效的 %s: %s", name, v)
+		}
+		*field = n
+	}
+	return cfg, nil
+}
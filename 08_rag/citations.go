@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"dongstudio.live/genkit_demo/pkg/grounding"
+	"dongstudio.live/genkit_demo/pkg/ingest"
+	"dongstudio.live/genkit_demo/pkg/vectorstore"
+	"github.com/firebase/genkit/go/ai"
+)
+
+// snippetRunes 為來源摘要的字數上限
+const snippetRunes = 160
+
+// source 為回答引用的來源，Index 對應回答中的引用標記 [Index]
+type source struct {
+	Index      int     `json:"index"`
+	ID         string  `json:"id"`                    // 片段 ID
+	DocumentID string  `json:"document_id,omitempty"` // 片段所屬的文件 ID
+	Title      string  `json:"title,omitempty"`
+	Category   string  `json:"category,omitempty"`
+	Snippet    string  `json:"snippet"`
+	Score      float64 `json:"score"` // 重新排序後的分數，沒有重新排序時為向量相似度（只有關鍵字命中時為 0）
+	// RRFScore 為混合檢索的合併分數，只在 RAG_RETRIEVAL=hybrid 時有值
+	RRFScore float64 `json:"rrf_score,omitempty"`
+	Cited    bool    `json:"cited"` // 回答中是否引用
+}
+
+// ragOutput 為 rag-flow 的輸出
+type ragOutput struct {
+	Answer      string              `json:"answer"`
+	Sources     []source            `json:"sources"`
+	NoAnswer    bool                `json:"no_answer"`             // 檢索結果不足以回答，未呼叫模型
+	Grounded    *bool               `json:"grounded,omitempty"`    // 回答是否皆有依據，未檢查時省略
+	Unsupported []grounding.Claim   `json:"unsupported,omitempty"` // 沒有依據的句子（RAG_GROUNDING=strip 時已從回答移除）
+	Usage       *ai.GenerationUsage `json:"usage,omitempty"`       // 生成回答使用的 token 數，未呼叫模型時省略
+	Debug       *debugInfo          `json:"debug,omitempty"`       // 請求帶有 debug 時回傳
+}
+
+// ragChunk 為 rag-flow 串流的一段內容，每段只會有一個欄位
+type ragChunk struct {
+	Sources []source `json:"sources,omitempty"` // 檢索到的來源，在生成回答前送出一次
+	Delta   string   `json:"delta,omitempty"`   // 模型產生的一段回答
+}
+
+// newSources 依檢索順序為文檔編號，編號從 1 開始
+func newSources(docs []*ai.Document) []source {
+	sources := make([]source, 0, len(docs))
+	for i, doc := range docs {
+		s := source{Index: i + 1, Snippet: snippet(vectorstore.DocText(doc))}
+		s.ID, _ = doc.Metadata["id"].(string)
+		s.DocumentID, _ = doc.Metadata[ingest.MetaSourceID].(string)
+		if s.DocumentID == "" {
+			s.DocumentID = s.ID
+		}
+		s.Title, _ = doc.Metadata["title"].(string)
+		s.Category, _ = doc.Metadata["category"].(string)
+		if score, ok := doc.Metadata["rerank_score"].(float64); ok {
+			s.Score = score
+		} else {
+			s.Score, _ = doc.Metadata["score"].(float64)
+		}
+		s.RRFScore, _ = doc.Metadata["rrf_score"].(float64)
+		sources = append(sources, s)
+	}
+	return sources
+}
+
+// contextWithCitations 建構帶有編號的上下文，讓模型以 [n] 標記引用
+func contextWithCitations(docs []*ai.Document) string {
+	var sb strings.Builder
+	for i, doc := range docs {
+		title := "未知標題"
+		if t, ok := doc.Metadata["title"].(string); ok && t != "" {
+			title = t
+		}
+		fmt.Fprintf(&sb, "[%d] %s\n%s\n\n", i+1, title, vectorstore.DocText(doc))
+	}
+	return sb.String()
+}
+
+// citationMarker 比對 [1]、[1, 2]、[1，2] 等引用標記
+var citationMarker = regexp.MustCompile(`\s?\[(\d+(?:\s*[,，、]\s*\d+)*)\]`)
+
+// resolveCitations 檢查回答中的引用標記：編號都在 1 到 len(sources) 之間的標記統一為 [1][2] 的格式，
+// 並標記被引用的來源；含有範圍外編號的標記（例如 [2023]、[404]）可能是回答的內容而非引用，原樣保留
+// 回傳處理後的回答與範圍外的編號
+func resolveCitations(answer string, sources []source) (string, []int) {
+	var unknown []int
+	answer = citationMarker.ReplaceAllStringFunc(answer, func(m string) string {
+		var nums []int
+		for _, part := range strings.FieldsFunc(citationMarker.FindStringSubmatch(m)[1], func(r rune) bool {
+			return r == ',' || r == '，' || r == '、' || unicode.IsSpace(r)
+		}) {
+			n, err := strconv.Atoi(part)
+			if err != nil || n < 1 || n > len(sources) {
+				unknown = append(unknown, n)
+				return m
+			}
+			nums = append(nums, n)
+		}
+
+		var sb strings.Builder
+		if r, _ := utf8.DecodeRuneInString(m); r != '[' {
+			sb.WriteRune(r)
+		}
+		for _, n := range nums {
+			sources[n-1].Cited = true
+			fmt.Fprintf(&sb, "[%d]", n)
+		}
+		return sb.String()
+	})
+	return answer, unknown
+}
+
+// snippet 截取來源的摘要，合併空白並限制字數
+func snippet(text string) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if utf8.RuneCountInString(text) <= snippetRunes {
+		return text
+	}
+	return string([]rune(text)[:snippetRunes]) + "…"
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestResolveCitations(t *testing.T) {
+	tests := []struct {
+		name    string
+		answer  string
+		want    string
+		cited   []int // 被引用的來源編號
+		unknown []int
+	}{
+		{name: "single", answer: "台灣有小籠包 [1]。", want: "台灣有小籠包 [1]。", cited: []int{1}},
+		{name: "comma list", answer: "有小籠包與牛肉麵 [1, 2]。", want: "有小籠包與牛肉麵 [1][2]。", cited: []int{1, 2}},
+		{name: "fullwidth comma", answer: "有小籠包與牛肉麵[1，2]。", want: "有小籠包與牛肉麵[1][2]。", cited: []int{1, 2}},
+		{name: "ideographic comma", answer: "見 [2、3]", want: "見 [2][3]", cited: []int{2, 3}},
+		{name: "adjacent markers", answer: "見[3][1]。", want: "見[3][1]。", cited: []int{1, 3}},
+		{name: "out of range", answer: "見 [4]。", want: "見 [4]。", unknown: []int{4}},
+		{name: "zero", answer: "見 [0]。", want: "見 [0]。", unknown: []int{0}},
+		{name: "mixed range kept verbatim", answer: "見 [1, 5]。", want: "見 [1, 5]。", unknown: []int{5}},
+		{name: "year", answer: "在 [2023] 年發表 [2]。", want: "在 [2023] 年發表 [2]。", cited: []int{2}, unknown: []int{2023}},
+		{name: "status code", answer: "伺服器回應 [404]。", want: "伺服器回應 [404]。", unknown: []int{404}},
+		{name: "not a number", answer: "陣列 [a] 與 [1a]", want: "陣列 [a] 與 [1a]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sources := []source{{Index: 1}, {Index: 2}, {Index: 3}}
+			got, unknown := resolveCitations(tt.answer, sources)
+			if got != tt.want {
+				t.Errorf("answer = %q, want %q", got, tt.want)
+			}
+			if !slices.Equal(unknown, tt.unknown) {
+				t.Errorf("unknown = %v, want %v", unknown, tt.unknown)
+			}
+			for _, s := range sources {
+				if s.Cited != slices.Contains(tt.cited, s.Index) {
+					t.Errorf("來源 %d 的 Cited = %v", s.Index, s.Cited)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"dongstudio.live/genkit_demo/pkg/embedcache"
+	"dongstudio.live/genkit_demo/pkg/metrics"
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/genkit"
+)
+
+// embedderFromEnv 依設定以快取包裝 embedder，文件與查詢內容相同時不重複呼叫模型
+// 停用快取時回傳原本的 embedder 與 nil
+//
+//	RAG_EMBED_CACHE             disk（預設，保存在檔案）、memory（只保存在記憶體）或 off
+//	RAG_EMBED_CACHE_PATH        快取檔案路徑，預設 data/embeddings.cache
+//	RAG_EMBED_BATCH_SIZE        每次呼叫 embedding 模型的文件數上限，預設 100
+//	RAG_EMBED_CONCURRENCY       同時進行的 embedding 呼叫數上限，預設 4
+func embedderFromEnv(g *genkit.Genkit, embedder ai.Embedder) (ai.Embedder, *embedcache.Cache, error) {
+	embedder = metrics.InstrumentEmbedder(embedder)
+
+	var path string
+	switch mode := os.Getenv("RAG_EMBED_CACHE"); mode {
+	case "", "disk":
+		path = os.Getenv("RAG_EMBED_CACHE_PATH")
+		if path == "" {
+			path = "data/embeddings.cache"
+		}
+	case "memory":
+	case "off":
+		return embedder, nil, nil
+	default:
+		return nil, nil, fmt.Errorf("不支援的 RAG_EMBED_CACHE: %s", mode)
+	}
+
+	cfg := embedcache.Config{
+		Embedder: embedder,
+		OnLookup: metrics.EmbeddingCacheObserver(embedder.Name()),
+	}
+	for name, field := range map[string]*int{
+		"RAG_EMBED_BATCH_SIZE":  &cfg.BatchSize,
+		"RAG_EMBED_CONCURRENCY": &cfg.Concurrency,
+	} {
+		v := os.Getenv(name)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return nil, nil, fmt.Errorf("無效的 %s: %s", name, v)
+		}
+		*field = n
+	}
+
+	store, err := embedcache.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	cfg.Store = store
+	cache, cached, err := embedcache.DefineEmbedder(g, "rag-demo", cfg)
+	if err != nil {
+		store.Close()
+		return nil, nil, err
+	}
+	return cached, cache, nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"strconv"
+
+	"dongstudio.live/genkit_demo/pkg/grounding"
+	"dongstudio.live/genkit_demo/pkg/logging"
+	"dongstudio.live/genkit_demo/pkg/metrics"
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/genkit"
+)
+
+// noAnswerText 為沒有足夠依據時的回答
+const noAnswerText = "抱歉，現有資料中找不到足以回答這個問題的資訊。"
+
+// groundingPolicy 為 rag-flow 的 grounding 設定
+type groundingPolicy struct {
+	threshold float64 // 最佳檢索分數低於此值時直接回傳無法回答，0 表示只在沒有檢索到文檔時
+	policy    grounding.Policy
+	verifier  *grounding.Verifier
+}
+
+// groundingFromEnv 讀取 grounding 設定
+//
+//	RAG_NO_ANSWER_THRESHOLD  最佳向量相似度低於此值時不呼叫模型，直接回傳無法回答，預設 0（不限制）
+//	RAG_GROUNDING            off（預設）/ flag（標記沒有依據的句子）/ strip（移除沒有依據的句子），
+//	                         flag 與 strip 每次回答會多一次模型呼叫
+//	RAG_GROUNDING_MODEL      檢查使用的模型，預設與回答相同
+func groundingFromEnv(g *genkit.Genkit, recordUsage func(context.Context, string, *ai.GenerationUsage)) (*groundingPolicy, error) {
+	p := &groundingPolicy{}
+	if v := os.Getenv("RAG_NO_ANSWER_THRESHOLD"); v != "" {
+		t, err := strconv.ParseFloat(v, 64)
+		if err != nil || t < -1 || t > 1 {
+			return nil, fmt.Errorf("無效的 RAG_NO_ANSWER_THRESHOLD: %s", v)
+		}
+		p.threshold = t
+	}
+
+	policy, err := grounding.ParsePolicy(os.Getenv("RAG_GROUNDING"))
+	if err != nil {
+		return nil, err
+	}
+	p.policy = policy
+
+	model := os.Getenv("RAG_GROUNDING_MODEL")
+	if model == "" {
+		model = modelName
+	}
+	p.verifier = &grounding.Verifier{
+		Genkit:     g,
+		Model:      model,
+		Middleware: []ai.ModelMiddleware{metrics.ModelMiddleware(model), logging.ModelMiddleware(model)},
+		OnUsage:    func(ctx context.Context, u *ai.GenerationUsage) { recordUsage(ctx, model, u) },
+	}
+	return p, nil
+}
+
+// answerable 判斷檢索結果是否足以回答：沒有文檔，或最佳向量相似度低於門檻時回傳 false
+// 相似度取自 metadata 的 "score"（混合檢索時只有關鍵字命中的文檔沒有），
+// 設定門檻但沒有任何文檔帶有相似度時無法判斷，視為無法回答
+func (p *groundingPolicy) answerable(docs []*ai.Document) bool {
+	if len(docs) == 0 {
+		return false
+	}
+	if p.threshold == 0 {
+		return true
+	}
+	best, found := math.Inf(-1), false
+	for _, doc := range docs {
+		if score, ok := doc.Metadata["score"].(float64); ok {
+			best, found = max(best, score), true
+		}
+	}
+	return found && best >= p.threshold
+}
+
+// check 以名為 "grounding" 的 trace 步驟檢查回答，檢查失敗時回傳 nil，不影響回答
+func (p *groundingPolicy) check(ctx context.Context, contextText, answer string) *grounding.Result {
+	if p.policy == grounding.PolicyOff {
+		return nil
+	}
+	result, err := genkit.Run(ctx, "grounding", func() (*grounding.Result, error) {
+		return grounding.Check(ctx, p.verifier, p.policy, contextText, answer)
+	})
+	if err != nil {
+		slog.WarnContext(ctx, "grounding 檢查失敗，回答未經檢查", "error", err)
+		return nil
+	}
+	return result
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strconv"
+
+	"dongstudio.live/genkit_demo/pkg/hybrid"
+	"dongstudio.live/genkit_demo/pkg/ingest"
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/genkit"
+)
+
+// retrieval 為 rag-flow 使用的 retriever 與其選項
+type retrieval struct {
+	mode      string
+	retriever ai.Retriever
+	options   func(p retrievalParams) any
+}
+
+// newRetrieval 依 RAG_RETRIEVAL 建立檢索方式
+//
+//	RAG_RETRIEVAL=vector  只使用向量檢索（預設）
+//	RAG_RETRIEVAL=hybrid  向量檢索加上 BM25 關鍵字索引，以 reciprocal rank fusion 合併，
+//	                      關鍵字索引保存在 RAG_KEYWORD_INDEX_PATH（預設 data/keyword.json），
+//	                      其他 namespace 各自使用 RAG_NAMESPACE_DIR 下的檔案，
+//	                      權重由 RAG_HYBRID_VECTOR_WEIGHT、RAG_HYBRID_KEYWORD_WEIGHT 設定（預設皆為 1）
+//
+// hybrid 模式下請求的 min_score 在合併前套用於向量結果；只有關鍵字命中的文檔沒有相似度，
+// 改以 RAG_HYBRID_KEYWORD_MIN_SCORE（BM25 分數，預設 0 表示不限制）過濾
+//
+// hybrid 模式會讓 pipeline 寫入向量資料庫時同時更新關鍵字索引
+func newRetrieval(g *genkit.Genkit, namespace string, backend *vectorBackend, pipeline *ingest.Pipeline) (*retrieval, error) {
+	mode := os.Getenv("RAG_RETRIEVAL")
+	switch mode {
+	case "", "vector":
+		return &retrieval{mode: "vector", retriever: backend.retriever, options: backend.options}, nil
+
+	case "hybrid":
+		path := os.Getenv("RAG_KEYWORD_INDEX_PATH")
+		if path == "" {
+			path = "data/keyword.json"
+		}
+		keyword, err := hybrid.OpenIndex(namespacePath(namespace, path, "keyword.json"))
+		if err != nil {
+			return nil, fmt.Errorf("無法開啟關鍵字索引: %w", err)
+		}
+		if err := syncKeywordIndex(keyword, pipeline); err != nil {
+			return nil, err
+		}
+		pipeline.Indexer = &keywordIndexer{Indexer: pipeline.Indexer, keyword: keyword}
+
+		cfg := hybrid.Config{Vector: backend.retriever, Keyword: keyword}
+		for name, field := range map[string]*float64{
+			"RAG_HYBRID_VECTOR_WEIGHT":  &cfg.VectorWeight,
+			"RAG_HYBRID_KEYWORD_WEIGHT": &cfg.KeywordWeight,
+		} {
+			*field = 1
+			v := os.Getenv(name)
+			if v == "" {
+				continue
+			}
+			w, err := strconv.ParseFloat(v, 64)
+			if err != nil || w < 0 {
+				return nil, fmt.Errorf("無效的 %s: %s", name, v)
+			}
+			*field = w
+		}
+		var keywordMinScore float64
+		if v := os.Getenv("RAG_HYBRID_KEYWORD_MIN_SCORE"); v != "" {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil || f < 0 {
+				return nil, fmt.Errorf("無效的 RAG_HYBRID_KEYWORD_MIN_SCORE: %s", v)
+			}
+			keywordMinScore = f
+		}
+		retriever, err := hybrid.DefineRetriever(g, scopedName("rag-demo-hybrid", namespace), cfg)
+		if err != nil {
+			return nil, err
+		}
+		return &retrieval{
+			mode:      mode,
+			retriever: retriever,
+			options: func(p retrievalParams) any {
+				// 兩種來源各取較多候選，合併後再取 top_k
+				candidates := p
+				candidates.TopK = max(p.TopK*4, 20)
+				return &hybrid.RetrieverOptions{
+					Count:           p.TopK,
+					Candidates:      candidates.TopK,
+					Filter:          p.Filter,
+					MinScore:        p.MinScore,
+					KeywordMinScore: keywordMinScore,
+					VectorOptions:   backend.options(candidates),
+				}
+			},
+		}, nil
+
+	default:
+		return nil, fmt.Errorf("不支援的 RAG_RETRIEVAL: %s", mode)
+	}
+}
+
+// keywordIndexer 寫入向量資料庫後同步更新關鍵字索引
+type keywordIndexer struct {
+	ingest.Indexer
+	keyword *hybrid.Index
+}
+
+func (k *keywordIndexer) Index(ctx context.Context, docs []*ai.Document) error {
+	if err := k.Indexer.Index(ctx, docs); err != nil {
+		return err
+	}
+	return k.keyword.Add(docs...)
+}
+
+func (k *keywordIndexer) Delete(ctx context.Context, ids []string) error {
+	if err := k.Indexer.Delete(ctx, ids); err != nil {
+		return err
+	}
+	return k.keyword.Delete(ids...)
+}
+
+// syncKeywordIndex 讓關鍵字索引與已索引文件清單一致：
+// 補上缺少的片段（例如第一次啟用 hybrid 模式時），並移除已不在清單中的片段
+func syncKeywordIndex(keyword *hybrid.Index, pipeline *ingest.Pipeline) error {
+	known := make(map[string]bool)
+	var missing []*ai.Document
+	for _, rec := range pipeline.Registry.List() {
+		complete := true
+		for _, id := range rec.ChunkIDs {
+			known[id] = true
+			complete = complete && keyword.Has(id)
+		}
+		if !complete {
+			chunks, err := pipeline.Chunks(rec)
+			if err != nil {
+				return fmt.Errorf("讀取文件 %s 失敗: %w", rec.ID, err)
+			}
+			missing = append(missing, chunks...)
+		}
+	}
+	stale := slices.DeleteFunc(keyword.IDs(), func(id string) bool { return known[id] })
+
+	if err := keyword.Add(missing...); err != nil {
+		return fmt.Errorf("重建關鍵字索引失敗: %w", err)
+	}
+	if err := keyword.Delete(stale...); err != nil {
+		return fmt.Errorf("清理關鍵字索引失敗: %w", err)
+	}
+	if len(missing) > 0 || len(stale) > 0 {
+		slog.Info("已同步關鍵字索引", "added", len(missing), "removed", len(stale), "total", keyword.Len())
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"dongstudio.live/genkit_demo/pkg/ingest"
+	"github.com/firebase/genkit/go/ai"
+)
+
+// loadDocsFromEnv 載入 RAG_DOCS_DIR 目錄中的 Markdown、HTML、純文字與 PDF 檔案，
+// RAG_DOCS_INCLUDE 與 RAG_DOCS_EXCLUDE 為以逗號分隔的 glob；未設定 RAG_DOCS_DIR 時回傳 nil
+func loadDocsFromEnv() ([]*ai.Document, error) {
+	dir := os.Getenv("RAG_DOCS_DIR")
+	if dir == "" {
+		return nil, nil
+	}
+	return ingest.LoadDir(dir, ingest.WalkOptions{
+		Include: splitList(os.Getenv("RAG_DOCS_INCLUDE")),
+		Exclude: splitList(os.Getenv("RAG_DOCS_EXCLUDE")),
+	})
+}
+
+// dirSyncerFromEnv 在 RAG_DOCS_WATCH=true 時建立目錄同步，持續讓 jobs 的索引與 RAG_DOCS_DIR 一致；
+// 未啟用時回傳 nil
+//
+//	RAG_DOCS_WATCH_INTERVAL  掃描間隔，預設 30s
+//	RAG_DOCS_STATE_FILE      同步狀態檔，預設 data/docs_sync.json
+func dirSyncerFromEnv(jobs *ingest.JobQueue) (*ingest.DirSyncer, error) {
+	v := os.Getenv("RAG_DOCS_WATCH")
+	if v == "" {
+		return nil, nil
+	}
+	watch, err := strconv.ParseBool(v)
+	if err != nil {
+		return nil, fmt.Errorf("無效的 RAG_DOCS_WATCH: %s", v)
+	}
+	if !watch {
+		return nil, nil
+	}
+	dir := os.Getenv("RAG_DOCS_DIR")
+	if dir == "" {
+		return nil, errors.New("RAG_DOCS_WATCH 需要設定 RAG_DOCS_DIR")
+	}
+
+	s := &ingest.DirSyncer{
+		Root: dir,
+		Options: ingest.WalkOptions{
+			Include: splitList(os.Getenv("RAG_DOCS_INCLUDE")),
+			Exclude: splitList(os.Getenv("RAG_DOCS_EXCLUDE")),
+		},
+		Jobs:      jobs,
+		StatePath: "data/docs_sync.json",
+	}
+	if path := os.Getenv("RAG_DOCS_STATE_FILE"); path != "" {
+		s.StatePath = path
+	}
+	if v := os.Getenv("RAG_DOCS_WATCH_INTERVAL"); v != "" {
+		if s.Interval, err = time.ParseDuration(v); err != nil || s.Interval <= 0 {
+			return nil, fmt.Errorf("無效的 RAG_DOCS_WATCH_INTERVAL: %s", v)
+		}
+	}
+	return s, nil
+}
+
+// documentsFile 回傳文件清單的保存路徑 RAG_DOCUMENTS_FILE，預設 data/documents.json
+func documentsFile() string {
+	if path := os.Getenv("RAG_DOCUMENTS_FILE"); path != "" {
+		return path
+	}
+	return "data/documents.json"
+}
+
+// splitList 切分以逗號分隔的清單，略過空白項目
+func splitList(s string) []string {
+	var out []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// pipelineFromEnv 建立索引流程，批次大小與重試次數由 RAG_INDEX_BATCH_SIZE、RAG_INDEX_MAX_ATTEMPTS 設定
+func pipelineFromEnv(indexer ingest.Indexer, chunker ingest.Chunker, registry *ingest.Registry) (*ingest.Pipeline, error) {
+	p := &ingest.Pipeline{Indexer: indexer, Chunker: chunker, Registry: registry}
+	for name, field := range map[string]*int{
+		"RAG_INDEX_BATCH_SIZE":   &p.BatchSize,
+		"RAG_INDEX_MAX_ATTEMPTS": &p.Retry.Attempts,
+	} {
+		v := os.Getenv(name)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("無效的 %s: %s", name, v)
+		}
+		*field = n
+	}
+	return p, nil
+}
+
+// chunkerFromEnv 依設定建立文件切分策略
+//
+//	RAG_CHUNKER        none / token / sentence / paragraph / markdown / recursive（預設）
+//	RAG_CHUNK_SIZE     每個片段的 token 上限，預設 256
+//	RAG_CHUNK_OVERLAP  token 策略重疊的 token 數，sentence 策略重疊的句子數
+//
+// 回傳 nil 表示不切分，整份文件直接索引
+func chunkerFromEnv() (ingest.Chunker, error) {
+	strategy := os.Getenv("RAG_CHUNKER")
+	if strategy == "none" {
+		return nil, nil
+	}
+
+	size, overlap := ingest.DefaultMaxTokens, 0
+	for name, field := range map[string]*int{
+		"RAG_CHUNK_SIZE":    &size,
+		"RAG_CHUNK_OVERLAP": &overlap,
+	} {
+		v := os.Getenv(name)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("無效的 %s: %s", name, v)
+		}
+		*field = n
+	}
+	return ingest.NewChunker(strategy, size, overlap)
+}
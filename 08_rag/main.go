@@ -3,53 +3,76 @@ package main
 import (
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
+	"dongstudio.live/genkit_demo/pkg/auth"
 	"dongstudio.live/genkit_demo/pkg/env"
+	"dongstudio.live/genkit_demo/pkg/grounding"
+	"dongstudio.live/genkit_demo/pkg/health"
+	"dongstudio.live/genkit_demo/pkg/ingest"
+	"dongstudio.live/genkit_demo/pkg/logging"
+	"dongstudio.live/genkit_demo/pkg/metrics"
+	"dongstudio.live/genkit_demo/pkg/rageval"
+	"dongstudio.live/genkit_demo/pkg/ratelimit"
+	"dongstudio.live/genkit_demo/pkg/rerank"
+	"dongstudio.live/genkit_demo/pkg/tracing"
+	"dongstudio.live/genkit_demo/pkg/usage"
+	"dongstudio.live/genkit_demo/pkg/vectorstore"
 	"github.com/firebase/genkit/go/ai"
 	"github.com/firebase/genkit/go/genkit"
 	"github.com/firebase/genkit/go/plugins/googlegenai"
-	"github.com/firebase/genkit/go/plugins/pinecone"
 	"github.com/gin-gonic/gin"
 )
 
+// modelName 為回答問題使用的模型，同時用於用量計費
+const modelName = "googleai/gemini-2.5-flash"
+
 func main() {
 	// 使用 genkit start 啟動，可以 Debug Flow 的執行過程
-	// genkit start -- go run main.go
+	// genkit start -- go run .
 
 	// 載入 .env 檔案（會自動向上搜尋到根目錄的 .env）
 	env.MustLoadEnv()
+	logging.Setup() // JSON 格式日誌，等級由 LOG_LEVEL 設定
 
 	ctx := context.Background()
 
-	// 初始化 Genkit，包含 Google AI 和 Pinecone plugins
+	// 初始化 Genkit，包含 Google AI plugin
+	// Pinecone 由 pkg/pineconestore 直接呼叫 REST API，以支援刪除文件
 	g, err := genkit.Init(ctx,
-		genkit.WithPlugins(
-			&googlegenai.GoogleAI{},
-			// https://www.pinecone.io/
-			&pinecone.Pinecone{},
-		),
-		genkit.WithDefaultModel("googleai/gemini-2.5-flash"),
+		genkit.WithPlugins(&googlegenai.GoogleAI{}),
+		genkit.WithDefaultModel(modelName),
 	)
 	if err != nil {
-		log.Fatalf("無法初始化 Genkit: %v", err)
+		logging.Fatal("無法初始化 Genkit", "error", err)
 	}
 
-	// 建立 embedder
-	embedder := googlegenai.GoogleAIEmbedder(g, "gemini-embedding-exp-03-07")
+	// 設定 OpenTelemetry 追蹤匯出（TRACE_EXPORTER=otlp 或 file）
+	shutdownTracing, err := tracing.Setup(ctx, g, "rag-server")
+	if err != nil {
+		logging.Fatal("無法設定追蹤", "error", err)
+	}
+	defer shutdownTracing(context.Background())
 
-	// 定義 Pinecone retriever 和 indexer
-	pineconeIndexer, pineconeRetriever, err := pinecone.DefineRetriever(ctx, g, pinecone.Config{
-		IndexID:  "rag-demo-3072",
-		Embedder: embedder,
-	})
+	// 建立 embedder，依 RAG_EMBED_CACHE 快取 embedding 並分批、限制並行數呼叫模型
+	embedder, embedCache, err := embedderFromEnv(g, googlegenai.GoogleAIEmbedder(g, "gemini-embedding-exp-03-07"))
 	if err != nil {
-		log.Fatalf("無法定義 pinecone retriever: %v", err)
+		logging.Fatal("無法建立 embedder", "error", err)
+	}
+	if embedCache != nil {
+		defer embedCache.Close()
+		slog.Info("已載入 embedding 快取", "entries", embedCache.Stats().Entries)
+	}
+
+	// 依 RAG_VECTOR_STORE 定義 Pinecone 或本機向量資料庫的 retriever 和 indexer，每個 namespace 的資料彼此隔離
+	backends, err := newVectorBackends(ctx, g, embedder)
+	if err != nil {
+		logging.Fatal("無法建立向量資料庫", "error", err)
 	}
 
 	// 範例文檔資料
@@ -106,75 +129,307 @@ func main() {
 		},
 	}
 
-	// 索引文檔到 Pinecone
-	fmt.Println("正在索引文檔到 Pinecone...")
-	if err := pinecone.Index(ctx, docs, pineconeIndexer, ""); err != nil {
-		log.Printf("批量索引失敗: %v，改為逐個索引", err)
-		for _, doc := range docs {
-			if err := pinecone.Index(ctx, []*ai.Document{doc}, pineconeIndexer, ""); err != nil {
-				log.Printf("索引文檔 %v 失敗: %v", doc.Metadata["title"], err)
+	// 依 RAG_CHUNKER 將文檔切分成片段，每個片段帶有來源文檔 ID、位置與標題路徑
+	chunker, err := chunkerFromEnv()
+	if err != nil {
+		logging.Fatal("無法建立文檔切分策略", "error", err)
+	}
+
+	// 每個 namespace（團隊）有各自的文件清單、向量資料、檢索與索引工作佇列，
+	// 呼叫者可使用的 namespace 由 RAG_NAMESPACES 依驗證後的使用者決定
+	tenants, err := namespacesFromEnv(ctx, g, backends, chunker)
+	if err != nil {
+		logging.Fatal("無法讀取 namespace 設定", "error", err)
+	}
+	if err := tenants.openExisting(); err != nil {
+		logging.Fatal("無法開啟 namespace", "error", err)
+	}
+	// 範例文檔與 RAG_DOCS_DIR 的文件索引到 default namespace
+	defaultNS, err := tenants.get(defaultNamespace)
+	if err != nil {
+		logging.Fatal("無法開啟 namespace", "error", err)
+	}
+
+	// 就緒檢查：啟動索引已完成、模型供應商可連線
+	checks := health.New()
+	checks.Register("model_provider", health.Cached(health.TCPCheck("generativelanguage.googleapis.com:443"), 30*time.Second))
+	indexReady := health.NewFlag("正在索引文檔")
+	checks.Register("index", indexReady.Check())
+
+	// RAG_DOCS_WATCH=true 時持續讓索引與 RAG_DOCS_DIR 一致，否則只在啟動時同步一次
+	syncer, err := dirSyncerFromEnv(defaultNS.jobs)
+	if err != nil {
+		logging.Fatal("無法建立文檔目錄同步", "error", err)
+	}
+	if syncer != nil {
+		// 第一次同步完成前 /readyz 會回應 503；重新啟動時依狀態檔只處理停機期間變更的檔案
+		syncer.OnSync = func(run *ingest.SyncRun, err error) {
+			switch {
+			case err != nil:
+				indexReady.SetNotReady(fmt.Sprintf("同步文檔目錄失敗: %v", err))
+			case run.Report != nil && len(run.Report.Failed) > 0 &&
+				len(run.Report.Added)+len(run.Report.Updated)+len(run.Report.Skipped) == 0:
+				indexReady.SetNotReady(fmt.Sprintf("索引文檔失敗: %s", run.Report.Failed[0].Error))
+			default:
+				indexReady.SetReady()
+				if run.JobID != "" {
+					slog.Info("已同步文檔目錄", "dir", syncer.Root, "changed", run.Changed, "removed", run.Removed,
+						"job_id", run.JobID)
+				}
+			}
+		}
+		slog.Info("正在同步文檔目錄...", "dir", syncer.Root, "backend", defaultNS.backend.name,
+			"retrieval", defaultNS.search.mode, "namespaces", tenants.names(), "interval", syncer.Status().Interval)
+		// 監看目錄時不索引範例文檔，先前啟動時加入的文檔（origin 為 startup）從索引刪除
+		pruneJob, err := defaultNS.jobs.SubmitSync(nil, nil, ingest.OriginStartup)
+		if err != nil {
+			logging.Fatal("無法加入索引工作", "error", err)
+		}
+		go func() {
+			if _, err := defaultNS.jobs.Wait(ctx, pruneJob.ID); err != nil {
+				return
 			}
+			syncer.Sync(ctx)
+			syncer.Run(ctx)
+		}()
+	} else {
+		// 設定 RAG_DOCS_DIR 時改為索引目錄中的檔案
+		if loaded, err := loadDocsFromEnv(); err != nil {
+			logging.Fatal("無法載入文檔目錄", "error", err)
+		} else if loaded != nil {
+			slog.Info("已載入文檔目錄", "dir", os.Getenv("RAG_DOCS_DIR"), "documents", len(loaded))
+			docs = loaded
 		}
+
+		// 在背景同步啟動文檔，完成前 /readyz 會回應 503
+		// 內容未變更的文檔會略過，已不在啟動文檔中的文件會從索引刪除（經由 API 或目錄同步加入的文件不受影響）
+		startupJob, err := defaultNS.jobs.SubmitSync(docs, nil, ingest.OriginStartup)
+		if err != nil {
+			logging.Fatal("無法加入索引工作", "error", err)
+		}
+		slog.Info("正在索引文檔...", "backend", defaultNS.backend.name, "retrieval", defaultNS.search.mode,
+			"namespaces", tenants.names(), "documents", len(docs), "job_id", startupJob.ID)
+		go func() {
+			job, err := defaultNS.jobs.Wait(ctx, startupJob.ID)
+			if err != nil {
+				return
+			}
+			if job.Failed == job.Total && job.Total > 0 {
+				indexReady.SetNotReady(fmt.Sprintf("索引文檔失敗: %s", job.Report.Failed[0].Error))
+				return
+			}
+			indexReady.SetReady()
+			r := job.Report
+			slog.Info("Retriever 已設定完成", "backend", defaultNS.backend.name,
+				"added", len(r.Added), "updated", len(r.Updated), "skipped", len(r.Skipped),
+				"deleted", len(r.Deleted), "failed", len(r.Failed))
+		}()
 	}
-	fmt.Println("Pinecone retriever 已設定完成")
 
-	// 定義 RAG flow
-	ragFlow := genkit.DefineFlow(g, "rag-flow", func(ctx context.Context, query string) (string, error) {
-		// 檢索相關文檔
-		retrievedDocs, err := pineconeRetriever.Retrieve(ctx, &ai.RetrieverRequest{
-			Query: ai.DocumentFromText(query, nil),
-			Options: &pinecone.RetrieverOptions{
-				Count: 1,
-			},
-		})
+	// 速率限制與每日配額（設定檔變更時會自動重新載入）
+	limiter, err := ratelimit.NewFromEnv(ctx)
+	if err != nil {
+		logging.Fatal("無法載入速率限制設定", "error", err)
+	}
+
+	// 用量與費用記錄（依使用者、模型與 flow 統計）
+	accountant, err := usage.NewFromEnv()
+	if err != nil {
+		logging.Fatal("無法初始化用量記錄", "error", err)
+	}
+	defer accountant.Close()
+
+	// 記錄用量與費用，並將本次使用的 token 數計入呼叫者的每日配額
+	recordUsage := func(ctx context.Context, model string, u *ai.GenerationUsage) {
+		accountant.Record(ctx, model, "rag-flow", u)
+		if u != nil {
+			limiter.RecordTokens(ctx, u.TotalTokens)
+		}
+	}
+
+	// 依 RAG_RERANKER 在檢索後重新排序候選文檔
+	reranker, err := rerankerFromEnv(g, recordUsage)
+	if err != nil {
+		logging.Fatal("無法建立 reranker", "error", err)
+	}
+
+	// 依 RAG_NO_ANSWER_THRESHOLD 與 RAG_GROUNDING 避免沒有依據的回答
+	policy, err := groundingFromEnv(g, recordUsage)
+	if err != nil {
+		logging.Fatal("無法建立 grounding 檢查", "error", err)
+	}
+	if policy.threshold == 0 && policy.policy == grounding.PolicyOff {
+		slog.Info("未啟用 grounding，只有沒有檢索到文檔時才回應無法回答",
+			"hint", "設定 RAG_NO_ANSWER_THRESHOLD 或 RAG_GROUNDING=flag 啟用")
+	}
+
+	// 依 RAG_QUERY_EXPANSION 在檢索前改寫問題並產生多個查詢變體
+	rewriter, err := rewriterFromEnv(g, recordUsage)
+	if err != nil {
+		logging.Fatal("無法建立查詢改寫", "error", err)
+	}
+
+	// 註冊回答評估的 evaluator（rageval/faithfulness 等），可在開發介面中評估 rag-flow 的回答
+	judge, err := rageval.JudgeFromEnv(g, modelName)
+	if err != nil {
+		logging.Fatal("無法建立回答評審", "error", err)
+	}
+	judge.Middleware = []ai.ModelMiddleware{metrics.ModelMiddleware(judge.Model), logging.ModelMiddleware(judge.Model)}
+	judge.OnUsage = func(ctx context.Context, u *ai.GenerationUsage) { accountant.Record(ctx, judge.Model, "judge", u) }
+	if _, err := judge.DefineEvaluators(); err != nil {
+		logging.Fatal("無法註冊回答評估", "error", err)
+	}
+
+	// 定義 RAG flow，可以一次取得完整回答（Run），也可以串流（Stream）：
+	// 先送出檢索到的來源，再逐段送出回答；串流時 cb 不為 nil
+	ragFlow := genkit.DefineStreamingFlow(g, "rag-flow", func(ctx context.Context, input ragInput, cb func(context.Context, ragChunk) error) (*ragOutput, error) {
+		params, err := input.params()
 		if err != nil {
-			return "", fmt.Errorf("檢索失敗: %w", err)
+			return nil, err
 		}
+		query := input.Question
 
-		// 建構上下文
-		context := "根據以下相關資訊回答問題:\n\n"
-		for _, doc := range retrievedDocs.Documents {
-			title := "未知標題"
-			if titleVal, ok := doc.Metadata["title"]; ok {
-				if titleStr, ok := titleVal.(string); ok {
-					title = titleStr
+		// 只檢索呼叫者所屬 namespace 的文件
+		ns, err := tenants.get(input.Namespace)
+		if err != nil {
+			return nil, err
+		}
+
+		// 改寫問題並產生查詢變體（未啟用時只有原始問題）
+		queries := expandQuery(ctx, rewriter, query)
+		var debug *debugInfo
+		if input.Debug {
+			debug = &debugInfo{Queries: queries}
+		}
+
+		// 依相似度門檻與 metadata 條件檢索相關文檔，有 reranker 時先多取候選再保留前 top_k 份
+		// 多個查詢變體各自檢索後以 reciprocal rank fusion 合併
+		fetch := params
+		if reranker != nil {
+			fetch.TopK = max(params.TopK, reranker.candidates)
+		}
+		docs, err := retrieveAll(ctx, ns.retriever, queries, ns.search.options(fetch), fetch.TopK)
+		if err != nil {
+			return nil, fmt.Errorf("檢索失敗: %w", err)
+		}
+		if reranker != nil {
+			// 每份候選的分數與名次會記錄在 trace 的 rerank 步驟
+			if docs, err = rerank.Rerank(ctx, reranker, query, docs, params.TopK); err != nil {
+				return nil, err
+			}
+		}
+
+		if debug != nil {
+			for _, doc := range docs {
+				debug.Contexts = append(debug.Contexts, vectorstore.DocText(doc))
+			}
+		}
+
+		// 沒有檢索到文檔或最佳分數低於門檻時不呼叫模型，避免憑空回答
+		sources := newSources(docs)
+		if cb != nil {
+			if err := cb(ctx, ragChunk{Sources: sources}); err != nil {
+				return nil, err
+			}
+		}
+		if !policy.answerable(docs) {
+			grounded := true
+			if cb != nil {
+				if err := cb(ctx, ragChunk{Delta: noAnswerText}); err != nil {
+					return nil, err
 				}
 			}
-			context += fmt.Sprintf("文檔 %s:\n%s\n\n", title, doc.Content[0].Text)
+			return &ragOutput{Answer: noAnswerText, Sources: sources, NoAnswer: true, Grounded: &grounded, Debug: debug}, nil
 		}
 
+		// 建構帶有編號的上下文，回答以 [n] 標記引用的文檔
+		contextText := contextWithCitations(docs)
+		instructions := "根據以下相關資訊回答問題，每份資訊前方的 [n] 為編號；資訊不足以回答時請直接說明無法回答:\n\n" + contextText
+
 		// 生成回答
-		prompt := fmt.Sprintf("%s問題: %s\n\n請根據上述資訊提供準確的回答。", context, query)
-		response, err := genkit.Generate(ctx, g,
+		prompt := fmt.Sprintf("%s問題: %s\n\n請根據上述資訊提供準確的回答，"+
+			"並在引用資訊的句子後方標註對應的編號，例如 [1] 或 [1][2]；只能引用上方列出的編號。", instructions, query)
+		opts := []ai.GenerateOption{
 			ai.WithPrompt(prompt),
-		)
+			ai.WithMiddleware(
+				metrics.ModelMiddleware(modelName),
+				logging.ModelMiddleware(modelName),
+			),
+		}
+		if cb != nil {
+			// 模型產生的文字直接轉送，最終回答以 flow 的輸出為準（可能已整理引用標記或移除沒有依據的句子）
+			opts = append(opts, ai.WithStreaming(func(ctx context.Context, chunk *ai.ModelResponseChunk) error {
+				if text := chunk.Text(); text != "" {
+					return cb(ctx, ragChunk{Delta: text})
+				}
+				return nil
+			}))
+		}
+		response, err := genkit.Generate(ctx, g, opts...)
 		if err != nil {
-			return "", fmt.Errorf("生成回答失敗: %w", err)
+			return nil, fmt.Errorf("生成回答失敗: %w", err)
+		}
+
+		recordUsage(ctx, modelName, response.Usage)
+
+		// 逐句檢查回答是否有上下文支持，依政策標記或移除沒有依據的句子
+		output := &ragOutput{Answer: response.Text(), Sources: sources, Usage: response.Usage, Debug: debug}
+		if result := policy.check(ctx, contextText, output.Answer); result != nil {
+			output.Answer = result.Answer
+			output.Grounded = &result.Grounded
+			output.Unsupported = result.Unsupported
+			if output.Answer == "" {
+				output.Answer, output.NoAnswer = noAnswerText, true
+			}
 		}
 
-		return response.Text(), nil
+		// 統一引用標記的格式並標記被引用的來源，範圍外的編號原樣保留
+		answer, unknown := resolveCitations(output.Answer, sources)
+		if len(unknown) > 0 {
+			slog.WarnContext(ctx, "回答中有不在來源範圍內的編號，未視為引用", "numbers", unknown, "sources", len(sources))
+		}
+		output.Answer = answer
+		return output, nil
 	})
 
 	// 設置 Gin router
-	router := gin.Default()
+	router := gin.New()
+	// 只信任 TRUSTED_PROXIES 帶入的 X-Forwarded-For，否則用戶端可偽造來源 IP 繞過速率限制
+	if err := router.SetTrustedProxies(ratelimit.TrustedProxiesFromEnv()); err != nil {
+		logging.Fatal("TRUSTED_PROXIES 格式錯誤", "error", err)
+	}
+	router.Use(gin.Recovery())
+	router.Use(tracing.Middleware())
+	router.Use(logging.Middleware())
+	router.Use(metrics.Middleware())
 
-	// 定義問答 API
-	router.POST("/ask", func(c *gin.Context) {
-		var request struct {
-			Question string `json:"question" binding:"required"`
-		}
+	// Prometheus 指標，不需驗證
+	router.GET("/metrics", metrics.Handler())
 
-		if err := c.ShouldBindJSON(&request); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"error":   "Invalid request",
-				"message": err.Error(),
-			})
+	// 存活、就緒與版本資訊，不需驗證
+	health.RegisterRoutes(router, checks)
+
+	// 有設定 API Key 或 JWT 密鑰時啟用驗證，配額會依使用者計算；否則只依來源 IP 限制
+	api := router.Group("/")
+	authConfig, err := auth.ConfigFromEnv()
+	if err != nil {
+		logging.Fatal("無法讀取驗證設定", "error", err)
+	}
+	if authenticator, err := auth.NewAuthenticator(authConfig); err == nil {
+		api.Use(auth.Middleware(authenticator))
+	}
+
+	// 定義問答 API
+	api.POST("/ask", ratelimit.Middleware(limiter), func(c *gin.Context) {
+		request, ok := bindAskRequest(c, tenants)
+		if !ok {
 			return
 		}
 
 		// 使用 RAG flow 處理問題
-		answer, err := ragFlow.Run(ctx, request.Question)
+		output, err := ragFlow.Run(c.Request.Context(), request)
 		if err != nil {
+			c.Error(err)
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"error":   "Failed to process question",
 				"message": err.Error(),
@@ -182,12 +437,40 @@ func main() {
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{
-			"question": request.Question,
-			"answer":   answer,
-		})
+		c.JSON(http.StatusOK, askResponse{request.Question, request.Namespace, output})
+	})
+
+	// 串流版本的問答 API，以 Server-Sent Events 依序送出來源、回答片段與最終結果
+	api.POST("/ask/stream", ratelimit.Middleware(limiter), func(c *gin.Context) {
+		request, ok := bindAskRequest(c, tenants)
+		if !ok {
+			return
+		}
+		streamAnswer(c, ragFlow, request)
 	})
 
+	// 新增、列出、刪除文件與查詢索引工作進度，只會操作呼叫者所屬 namespace 的文件
+	ingest.RegisterScopedRoutes(api, tenants.resolver())
+
+	// 查詢各 namespace 的文件數與刪除整個 namespace
+	tenants.registerRoutes(api)
+
+	// 目錄同步狀態：上次掃描結果、等待索引與失敗的檔案
+	if syncer != nil {
+		api.GET("/sync", syncer.StatusHandler())
+	}
+
+	// 管理者（AUTH_ADMIN_USERS）可查詢所有人的用量並調整日誌等級
+	admins := auth.AdminUsersFromEnv()
+
+	// 查詢與匯出用量統計
+	usage.RegisterRoutes(api, accountant, admins)
+
+	// 查詢與調整日誌等級（僅限 AUTH_ADMIN_USERS；未啟用驗證時停用）
+	opsAdmins := auth.RequireAdmin(admins)
+	api.GET("/log-level", opsAdmins, logging.LevelHandler())
+	api.PUT("/log-level", opsAdmins, logging.LevelHandler())
+
 	// 創建 HTTP 服務器
 	srv := &http.Server{
 		Addr:    ":8080",
@@ -196,11 +479,10 @@ func main() {
 
 	// 在 goroutine 中啟動服務器
 	go func() {
-		fmt.Println("\n=== 啟動 API 服務器 ===")
-		fmt.Println("服務器正在運行於 http://localhost:8080")
+		slog.Info("服務器正在運行於 http://localhost:8080")
 
 		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("服務器啟動失敗: %v", err)
+			logging.Fatal("服務器啟動失敗", "error", err)
 		}
 	}()
 
@@ -208,7 +490,7 @@ func main() {
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
-	log.Println("正在關閉服務器...")
+	slog.Info("正在關閉服務器...")
 
 	// 創建一個 5 秒的超時 context
 	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -216,8 +498,8 @@ func main() {
 
 	// 優雅地關閉服務器
 	if err := srv.Shutdown(shutdownCtx); err != nil {
-		log.Fatal("服務器強制關閉:", err)
+		logging.Fatal("服務器強制關閉", "error", err)
 	}
 
-	log.Println("服務器已退出")
+	slog.Info("服務器已退出")
 }
@@ -0,0 +1,468 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"dongstudio.live/genkit_demo/pkg/auth"
+	"dongstudio.live/genkit_demo/pkg/ingest"
+	"dongstudio.live/genkit_demo/pkg/metrics"
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/genkit"
+	"github.com/gin-gonic/gin"
+)
+
+// defaultNamespace 為未指定 namespace 時使用的 namespace，沿用原本的檔案與 Pinecone 的空白 namespace
+const defaultNamespace = "default"
+
+// namespacePattern 限制 namespace 名稱，名稱會用於檔案路徑與 retriever 名稱
+var namespacePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// 解析 namespace 失敗時回傳的錯誤
+var (
+	errInvalidNamespace   = errors.New("namespace 只能包含英數字、- 與 _，長度不超過 64")
+	errNamespaceForbidden = errors.New("無權存取此 namespace")
+	errNamespaceNotFound  = errors.New("namespace 不存在")
+	errNamespaceDeleting  = errors.New("namespace 正在刪除，請稍後再試")
+)
+
+// namespaceDir 回傳 default 以外的 namespace 保存資料的目錄 RAG_NAMESPACE_DIR，預設 data/namespaces
+func namespaceDir() string {
+	if dir := os.Getenv("RAG_NAMESPACE_DIR"); dir != "" {
+		return dir
+	}
+	return "data/namespaces"
+}
+
+// namespacePath 回傳 namespace 的資料檔案路徑：default 使用 defaultPath，
+// 其他 namespace 為 RAG_NAMESPACE_DIR/<namespace>/<file>
+func namespacePath(namespace, defaultPath, file string) string {
+	if namespace == defaultNamespace {
+		return defaultPath
+	}
+	return filepath.Join(namespaceDir(), namespace, file)
+}
+
+// scopedName 回傳 namespace 專用的 retriever 名稱，default 沿用原本的名稱
+func scopedName(name, namespace string) string {
+	if namespace == defaultNamespace {
+		return name
+	}
+	return name + "-" + namespace
+}
+
+// pineconeNamespace 回傳 namespace 對應的 Pinecone namespace
+func pineconeNamespace(namespace string) string {
+	if namespace == defaultNamespace {
+		return ""
+	}
+	return namespace
+}
+
+// ragNamespace 為一個 namespace（例如一個團隊）的知識庫：
+// 各自的向量資料、文件清單、索引工作佇列與檢索，彼此不會看到對方的文件
+type ragNamespace struct {
+	name      string
+	backend   *vectorBackend
+	pipeline  *ingest.Pipeline
+	jobs      *ingest.JobQueue
+	search    *retrieval
+	retriever ai.Retriever       // 記錄檢索延遲與回傳文檔數的 search.retriever
+	stop      context.CancelFunc // 停止 jobs 的 worker
+}
+
+// start 啟動 namespace 的索引工作佇列，索引工作在背景依序執行，索引期間 /ask 仍可正常回應
+func (ns *ragNamespace) start(ctx context.Context) {
+	ctx, ns.stop = context.WithCancel(ctx)
+	ns.jobs = ingest.NewJobQueue(ctx, ns.pipeline)
+}
+
+// namespaceStats 為 namespace 的文件統計
+type namespaceStats struct {
+	Name      string `json:"name"`
+	Documents int    `json:"documents"`
+	Chunks    int    `json:"chunks"`
+	Vectors   *int   `json:"vectors,omitempty"` // 向量資料庫中的向量數，查詢失敗時省略
+}
+
+// stats 統計 namespace 的文件、片段與向量數
+func (ns *ragNamespace) stats(ctx context.Context) namespaceStats {
+	s := namespaceStats{Name: ns.name}
+	for _, rec := range ns.pipeline.Registry.List() {
+		s.Documents++
+		s.Chunks += len(rec.ChunkIDs)
+	}
+	if n, err := ns.backend.count(ctx); err != nil {
+		slog.WarnContext(ctx, "無法查詢向量數", "namespace", ns.name, "error", err)
+	} else {
+		s.Vectors = &n
+	}
+	return s
+}
+
+// namespaces 管理所有 namespace，第一次使用時才開啟
+//
+// 呼叫者只能使用 RAG_NAMESPACES 指定的 namespace（未列出的使用者與未啟用驗證時使用 default），
+// 管理者（AUTH_ADMIN_USERS，見 auth.AdminUsersFromEnv）可以指定任何已存在的 namespace、以 POST /documents 建立新的 namespace，
+// 並可列出與刪除 namespace
+type namespaces struct {
+	ctx      context.Context
+	g        *genkit.Genkit
+	backends func(namespace string) (*vectorBackend, error)
+	chunker  ingest.Chunker
+	members  map[string]string // 使用者 ID 對應的 namespace
+	admins   []string
+
+	mu       sync.Mutex
+	opened   map[string]*ragNamespace
+	closed   map[string]*ragNamespace // 已刪除的 namespace，retriever 已註冊，重新建立時沿用
+	deleting map[string]bool
+	failed   map[string]error // 建立失敗的 namespace，retriever 可能已註冊，不能重新建立
+}
+
+// namespacesFromEnv 讀取 namespace 權限設定
+//
+//	RAG_NAMESPACES=alice:team-a,bob:team-a,carol:team-b  使用者對應的 namespace
+//
+// 管理者與其他維運操作相同，由 AUTH_ADMIN_USERS 設定
+func namespacesFromEnv(ctx context.Context, g *genkit.Genkit, backends func(string) (*vectorBackend, error), chunker ingest.Chunker) (*namespaces, error) {
+	m := &namespaces{
+		ctx:      ctx,
+		g:        g,
+		backends: backends,
+		chunker:  chunker,
+		members:  make(map[string]string),
+		admins:   auth.AdminUsersFromEnv(),
+		opened:   make(map[string]*ragNamespace),
+		closed:   make(map[string]*ragNamespace),
+		deleting: make(map[string]bool),
+		failed:   make(map[string]error),
+	}
+	for _, pair := range splitList(os.Getenv("RAG_NAMESPACES")) {
+		userID, namespace, ok := strings.Cut(pair, ":")
+		userID, namespace = strings.TrimSpace(userID), strings.TrimSpace(namespace)
+		if !ok || userID == "" || !namespacePattern.MatchString(namespace) {
+			return nil, fmt.Errorf("RAG_NAMESPACES 格式錯誤，應為 user:namespace: %q", pair)
+		}
+		m.members[userID] = namespace
+	}
+	return m, nil
+}
+
+// get 回傳已存在的 namespace（default、RAG_NAMESPACES 中的，或 RAG_NAMESPACE_DIR 下已有資料的），
+// 尚未開啟時開啟其文件清單、向量資料與檢索，並啟動索引工作佇列；其他名稱回傳 errNamespaceNotFound
+func (m *namespaces) get(name string) (*ragNamespace, error) {
+	return m.load(name, false)
+}
+
+// create 與 get 相同，但 namespace 不存在時建立，只應在管理者的請求中呼叫
+func (m *namespaces) create(name string) (*ragNamespace, error) {
+	return m.load(name, true)
+}
+
+func (m *namespaces) load(name string, create bool) (*ragNamespace, error) {
+	if name == "" {
+		name = defaultNamespace
+	}
+	if !namespacePattern.MatchString(name) {
+		return nil, errInvalidNamespace
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if ns, ok := m.opened[name]; ok {
+		return ns, nil
+	}
+	if m.deleting[name] {
+		return nil, errNamespaceDeleting
+	}
+	if err := m.failed[name]; err != nil {
+		return nil, err
+	}
+	if !create && !m.exists(name) {
+		return nil, errNamespaceNotFound
+	}
+	ns, ok := m.closed[name]
+	if ok {
+		delete(m.closed, name)
+	} else {
+		var err error
+		if ns, err = m.open(name); err != nil {
+			err = fmt.Errorf("無法開啟 namespace %s: %w", name, err)
+			m.failed[name] = err
+			return nil, err
+		}
+	}
+	ns.start(m.ctx)
+	m.opened[name] = ns
+	return ns, nil
+}
+
+// exists 回傳尚未開啟的 namespace 是否存在：default、RAG_NAMESPACES 中的，或 RAG_NAMESPACE_DIR 下已有資料的
+func (m *namespaces) exists(name string) bool {
+	if name == defaultNamespace || slices.Contains(slices.Collect(maps.Values(m.members)), name) {
+		return true
+	}
+	info, err := os.Stat(filepath.Join(namespaceDir(), name))
+	return err == nil && info.IsDir()
+}
+
+// open 建立 namespace，會註冊 namespace 專用的 retriever（呼叫者需持有鎖）
+func (m *namespaces) open(name string) (*ragNamespace, error) {
+	// 已索引文件的清單（含內容雜湊），重新啟動時只索引新增或變更的文件，也供文件管理 API 列出與刪除
+	registry, err := ingest.OpenRegistry(namespacePath(name, documentsFile(), "documents.json"))
+	if err != nil {
+		return nil, fmt.Errorf("無法開啟文件清單: %w", err)
+	}
+	backend, err := m.backends(name)
+	if err != nil {
+		return nil, err
+	}
+	pipeline, err := pipelineFromEnv(backend, m.chunker, registry)
+	if err != nil {
+		return nil, err
+	}
+	// 依 RAG_RETRIEVAL 使用純向量檢索，或向量加上 BM25 關鍵字的混合檢索
+	search, err := newRetrieval(m.g, name, backend, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	return &ragNamespace{
+		name:      name,
+		backend:   backend,
+		pipeline:  pipeline,
+		search:    search,
+		retriever: metrics.InstrumentRetriever(search.retriever),
+	}, nil
+}
+
+// remove 經由 namespace 的索引工作佇列刪除所有文件並等待完成：
+// default 只清空文件；其他 namespace 在刪除期間不能使用，全部刪除後停止工作佇列、
+// 移除資料目錄並從已開啟的 namespace 中移除，之後需由管理者重新建立
+// 有文件刪除失敗時 namespace 保持開啟，可以重試
+func (m *namespaces) remove(ctx context.Context, name string) (*ingest.Job, error) {
+	m.mu.Lock()
+	ns, ok := m.opened[name]
+	if !ok {
+		m.mu.Unlock()
+		if m.deleting[name] {
+			return nil, errNamespaceDeleting
+		}
+		return nil, errNamespaceNotFound
+	}
+	closing := name != defaultNamespace
+	if closing {
+		delete(m.opened, name)
+		m.deleting[name] = true
+	}
+	m.mu.Unlock()
+
+	job, err := ns.jobs.SubmitDeleteAll(ingest.OriginAPI)
+	if err == nil {
+		// 呼叫者中斷連線時仍等待刪除完成，避免 namespace 停留在刪除中
+		job, err = ns.jobs.Wait(context.WithoutCancel(ctx), job.ID)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !closing {
+		return &job, err
+	}
+	delete(m.deleting, name)
+	if err != nil || job.Status != ingest.JobSucceeded {
+		m.opened[name] = ns
+		return &job, err
+	}
+	ns.stop()
+	if err := os.RemoveAll(filepath.Join(namespaceDir(), name)); err != nil {
+		slog.WarnContext(ctx, "無法移除 namespace 的資料目錄", "namespace", name, "error", err)
+	}
+	m.closed[name] = ns
+	return &job, nil
+}
+
+// openExisting 開啟所有已有資料的 namespace，讓啟動時就能發現設定或檔案的錯誤
+func (m *namespaces) openExisting() error {
+	for _, name := range m.names() {
+		if _, err := m.get(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// names 回傳已知的 namespace：default、已開啟的、RAG_NAMESPACES 中的，以及 RAG_NAMESPACE_DIR 下已有資料的
+func (m *namespaces) names() []string {
+	names := []string{defaultNamespace}
+	for _, name := range m.members {
+		names = append(names, name)
+	}
+	if entries, err := os.ReadDir(namespaceDir()); err == nil {
+		for _, e := range entries {
+			if e.IsDir() && namespacePattern.MatchString(e.Name()) {
+				names = append(names, e.Name())
+			}
+		}
+	}
+	m.mu.Lock()
+	for name := range m.opened {
+		names = append(names, name)
+	}
+	m.mu.Unlock()
+	slices.Sort(names)
+	return slices.Compact(names)
+}
+
+// isAdmin 回傳呼叫者是否可以使用任何 namespace，未啟用驗證時（p 為 nil）不是管理者
+func (m *namespaces) isAdmin(p *auth.Principal) bool {
+	return p != nil && slices.Contains(m.admins, p.ID)
+}
+
+// resolve 依呼叫者的身分決定使用的 namespace，requested 為請求指定的 namespace（可為空）
+// 一般使用者只能使用自己的 namespace，指定其他 namespace 時回傳 errNamespaceForbidden
+func (m *namespaces) resolve(p *auth.Principal, requested string) (string, error) {
+	if requested != "" && !namespacePattern.MatchString(requested) {
+		return "", errInvalidNamespace
+	}
+	own := defaultNamespace
+	if p != nil {
+		if ns, ok := m.members[p.ID]; ok {
+			own = ns
+		}
+	}
+	switch {
+	case requested == "":
+		return own, nil
+	case requested == own || m.isAdmin(p):
+		return requested, nil
+	default:
+		return "", errNamespaceForbidden
+	}
+}
+
+// fromRequest 依 X-Namespace 標頭或 namespace 查詢參數取得呼叫者可使用的 namespace，
+// create 為 true 且呼叫者為管理者時建立不存在的 namespace，失敗時已寫入錯誤回應
+func (m *namespaces) fromRequest(c *gin.Context, requested string, create bool) (*ragNamespace, bool) {
+	if requested == "" {
+		requested = c.GetHeader("X-Namespace")
+	}
+	if requested == "" {
+		requested = c.Query("namespace")
+	}
+	p := auth.FromGin(c)
+	name, err := m.resolve(p, requested)
+	if err != nil {
+		namespaceError(c, err)
+		return nil, false
+	}
+	ns, err := m.load(name, create && m.isAdmin(p))
+	if err != nil {
+		namespaceError(c, err)
+		return nil, false
+	}
+	return ns, true
+}
+
+// namespaceError 依錯誤種類寫入錯誤回應
+func namespaceError(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, errInvalidNamespace):
+		status = http.StatusBadRequest
+	case errors.Is(err, errNamespaceForbidden):
+		status = http.StatusForbidden
+	case errors.Is(err, errNamespaceNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, errNamespaceDeleting):
+		status = http.StatusConflict
+	default:
+		c.Error(err)
+	}
+	c.JSON(status, gin.H{"error": err.Error()})
+}
+
+// resolver 讓文件管理 API 操作呼叫者所屬 namespace 的文件與索引工作，
+// 管理者新增文件到不存在的 namespace 時建立該 namespace
+func (m *namespaces) resolver() ingest.Resolver {
+	return func(c *gin.Context) (*ingest.Pipeline, *ingest.JobQueue, bool) {
+		ns, ok := m.fromRequest(c, "", c.Request.Method == http.MethodPost)
+		if !ok {
+			return nil, nil, false
+		}
+		return ns.pipeline, ns.jobs, true
+	}
+}
+
+// registerRoutes 註冊 namespace 管理 API
+//
+//	GET    /namespaces        列出 namespace 與文件數（一般使用者只會看到自己的 namespace）
+//	GET    /namespaces/:name  查詢 namespace 的文件、片段與向量數
+//	DELETE /namespaces/:name  經由索引工作佇列刪除 namespace 中的所有文件並移除 namespace（僅限管理者，
+//	                          default 只清空文件）
+func (m *namespaces) registerRoutes(r gin.IRouter) {
+	r.GET("/namespaces", func(c *gin.Context) {
+		p := auth.FromGin(c)
+		names := m.names()
+		if !m.isAdmin(p) {
+			own, _ := m.resolve(p, "")
+			names = []string{own}
+		}
+		stats := make([]namespaceStats, 0, len(names))
+		for _, name := range names {
+			ns, err := m.get(name)
+			if err != nil {
+				c.Error(err)
+				continue
+			}
+			stats = append(stats, ns.stats(c.Request.Context()))
+		}
+		c.JSON(http.StatusOK, gin.H{"namespaces": stats})
+	})
+
+	r.GET("/namespaces/:name", func(c *gin.Context) {
+		ns, ok := m.fromRequest(c, c.Param("name"), false)
+		if !ok {
+			return
+		}
+		c.JSON(http.StatusOK, ns.stats(c.Request.Context()))
+	})
+
+	r.DELETE("/namespaces/:name", func(c *gin.Context) {
+		if !m.isAdmin(auth.FromGin(c)) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "只有管理者可以刪除 namespace"})
+			return
+		}
+		name := c.Param("name")
+		if _, err := m.get(name); err != nil {
+			namespaceError(c, err)
+			return
+		}
+		// 刪除排在已在佇列中的索引工作之後，那些工作加入的文件也會被刪除
+		job, err := m.remove(c.Request.Context(), name)
+		if err != nil {
+			if errors.Is(err, ingest.ErrQueueFull) || errors.Is(err, ingest.ErrQueueStopped) {
+				c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+				return
+			}
+			namespaceError(c, err)
+			return
+		}
+		deleted := len(job.Report.Deleted)
+		slog.InfoContext(c.Request.Context(), "已刪除 namespace 的文件", "namespace", name, "documents", deleted, "job_id", job.ID)
+		if job.Status != ingest.JobSucceeded {
+			c.JSON(http.StatusBadGateway, gin.H{"error": "部分文件刪除失敗", "deleted": deleted, "failed": job.Report.Failed})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"namespace": name, "deleted": deleted})
+	})
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"dongstudio.live/genkit_demo/pkg/auth"
+	"dongstudio.live/genkit_demo/pkg/ingest"
+	"github.com/firebase/genkit/go/ai"
+	"github.com/gin-gonic/gin"
+)
+
+// memoryBackend 回傳以記憶體保存片段 ID 的 vectorBackend
+func memoryBackend(string) (*vectorBackend, error) {
+	var mu sync.Mutex
+	chunks := make(map[string]bool)
+	return &vectorBackend{
+		name: "memory",
+		index: func(ctx context.Context, docs []*ai.Document) error {
+			mu.Lock()
+			defer mu.Unlock()
+			for _, d := range docs {
+				chunks[d.Metadata["id"].(string)] = true
+			}
+			return nil
+		},
+		remove: func(ctx context.Context, ids []string) error {
+			mu.Lock()
+			defer mu.Unlock()
+			for _, id := range ids {
+				delete(chunks, id)
+			}
+			return nil
+		},
+		count: func(ctx context.Context) (int, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			return len(chunks), nil
+		},
+	}, nil
+}
+
+// newTestNamespaces 建立 namespace 管理與其 API，請求的 X-User 標頭模擬驗證後的使用者
+func newTestNamespaces(t *testing.T) (*namespaces, *gin.Engine) {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("RAG_NAMESPACE_DIR", filepath.Join(dir, "namespaces"))
+	t.Setenv("RAG_DOCUMENTS_FILE", filepath.Join(dir, "documents.json"))
+	t.Setenv("RAG_NAMESPACES", "alice:team-a")
+	t.Setenv("AUTH_ADMIN_USERS", "admin")
+	t.Setenv("RAG_RETRIEVAL", "vector")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	m, err := namespacesFromEnv(ctx, nil, memoryBackend, ingest.ParagraphChunker{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		if user := c.GetHeader("X-User"); user != "" {
+			c.Request = c.Request.WithContext(auth.NewContext(c.Request.Context(), &auth.Principal{ID: user}))
+		}
+	})
+	ingest.RegisterScopedRoutes(r, m.resolver())
+	m.registerRoutes(r)
+	return m, r
+}
+
+func namespaceRequest(r http.Handler, method, target, user, namespace, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if user != "" {
+		req.Header.Set("X-User", user)
+	}
+	if namespace != "" {
+		req.Header.Set("X-Namespace", namespace)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// addDocument 新增一份文件並等待索引完成
+func addDocument(t *testing.T, m *namespaces, r http.Handler, user, namespace string) {
+	t.Helper()
+	w := namespaceRequest(r, http.MethodPost, "/documents", user, namespace, `{"documents":[{"id":"doc","content":"內容"}]}`)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("新增文件回應 %d: %s", w.Code, w.Body)
+	}
+	var job ingest.Job
+	if err := json.Unmarshal(w.Body.Bytes(), &job); err != nil {
+		t.Fatal(err)
+	}
+	ns, err := m.get(namespace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job, err = ns.jobs.Wait(context.Background(), job.ID); err != nil || job.Status != ingest.JobSucceeded {
+		t.Fatalf("索引工作 = %+v, %v", job, err)
+	}
+}
+
+func TestNamespaceAccess(t *testing.T) {
+	m, r := newTestNamespaces(t)
+	addDocument(t, m, r, "alice", "team-a")
+
+	tests := []struct {
+		name      string
+		method    string
+		target    string
+		user      string
+		namespace string
+		body      string
+		status    int
+	}{
+		{"unauthenticated uses default", http.MethodGet, "/documents", "", "", "", http.StatusOK},
+		{"unauthenticated cannot pick namespace", http.MethodGet, "/namespaces/team-a", "", "", "", http.StatusForbidden},
+		{"unauthenticated cannot delete", http.MethodDelete, "/namespaces/default", "", "", "", http.StatusForbidden},
+		{"member reads own namespace", http.MethodGet, "/namespaces/team-a", "alice", "", "", http.StatusOK},
+		{"member cannot read others", http.MethodGet, "/documents", "alice", "default", "", http.StatusForbidden},
+		{"member cannot delete", http.MethodDelete, "/namespaces/team-a", "alice", "", "", http.StatusForbidden},
+		{"admin reads unknown namespace", http.MethodGet, "/namespaces/ghost", "admin", "", "", http.StatusNotFound},
+		{"admin asks unknown namespace", http.MethodGet, "/documents", "admin", "ghost", "", http.StatusNotFound},
+		{"admin deletes unknown namespace", http.MethodDelete, "/namespaces/ghost", "admin", "", "", http.StatusNotFound},
+		{"non-admin cannot create", http.MethodPost, "/documents", "bob", "ghost", `{"documents":[{"id":"x","content":"x"}]}`, http.StatusForbidden},
+		{"invalid name", http.MethodGet, "/namespaces/bad.name", "admin", "", "", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := namespaceRequest(r, tt.method, tt.target, tt.user, tt.namespace, tt.body)
+			if w.Code != tt.status {
+				t.Errorf("%s %s 回應 %d, want %d: %s", tt.method, tt.target, w.Code, tt.status, w.Body)
+			}
+		})
+	}
+	if _, ok := m.opened["ghost"]; ok {
+		t.Error("讀取不存在的 namespace 不應建立它")
+	}
+}
+
+func TestNamespaceDelete(t *testing.T) {
+	m, r := newTestNamespaces(t)
+	addDocument(t, m, r, "admin", "team-b") // 管理者新增文件時建立 namespace
+	dataDir := filepath.Join(namespaceDir(), "team-b")
+	if _, err := os.Stat(dataDir); err != nil {
+		t.Fatalf("namespace 的資料目錄不存在: %v", err)
+	}
+
+	w := namespaceRequest(r, http.MethodDelete, "/namespaces/team-b", "admin", "", "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"deleted":1`) {
+		t.Fatalf("刪除 namespace 回應 %d: %s", w.Code, w.Body)
+	}
+	if w := namespaceRequest(r, http.MethodGet, "/namespaces/team-b", "admin", "", ""); w.Code != http.StatusNotFound {
+		t.Errorf("刪除後查詢回應 %d, want 404", w.Code)
+	}
+	if _, err := os.Stat(dataDir); !os.IsNotExist(err) {
+		t.Errorf("刪除後資料目錄仍存在: %v", err)
+	}
+
+	// 重新建立時沿用已註冊的 retriever，文件從頭開始
+	addDocument(t, m, r, "admin", "team-b")
+	ns, err := m.get("team-b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := ns.stats(context.Background()); s.Documents != 1 || s.Vectors == nil || *s.Vectors != 1 {
+		t.Errorf("重新建立後的統計 = %+v", s)
+	}
+
+	// default 只清空文件，namespace 保留
+	addDocument(t, m, r, "admin", "default")
+	if w := namespaceRequest(r, http.MethodDelete, "/namespaces/default", "admin", "", ""); w.Code != http.StatusOK {
+		t.Fatalf("清空 default 回應 %d: %s", w.Code, w.Body)
+	}
+	if w := namespaceRequest(r, http.MethodGet, "/documents", "", "", ""); w.Code != http.StatusOK ||
+		strings.Contains(w.Body.String(), `"doc"`) {
+		t.Errorf("清空後 default 的文件 = %d %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+
+	"dongstudio.live/genkit_demo/pkg/logging"
+	"dongstudio.live/genkit_demo/pkg/metrics"
+	"dongstudio.live/genkit_demo/pkg/rerank"
+	"dongstudio.live/genkit_demo/pkg/vectorstore"
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/genkit"
+)
+
+const (
+	defaultTopK = 3
+	maxTopK     = 20
+)
+
+// ragInput 為 rag-flow 的輸入，也是 /ask 的請求內容
+type ragInput struct {
+	Question string         `json:"question" binding:"required"`
+	TopK     int            `json:"top_k,omitempty"`     // 檢索的文檔數，預設 3，上限 20
+	MinScore float64        `json:"min_score,omitempty"` // 相似度門檻，低於此值的文檔不作為上下文；cosine 相似度時介於 -1 與 1 之間
+	Filter   map[string]any `json:"filter,omitempty"`    // metadata 過濾條件，例如 {"category": ["食物", "旅遊"]}
+	Debug    bool           `json:"debug,omitempty"`     // 回傳改寫後的查詢等除錯資訊
+	// Namespace 為檢索的 namespace，預設 default；經 /ask 呼叫時由驗證後的使用者決定
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// retrievalParams 為與向量資料庫無關的檢索參數，由各 backend 轉為對應的 retriever 選項
+type retrievalParams struct {
+	TopK     int
+	MinScore float64
+	Filter   vectorstore.Filter
+}
+
+// params 驗證輸入並回傳檢索參數
+func (in *ragInput) params() (retrievalParams, error) {
+	p := retrievalParams{TopK: in.TopK, MinScore: in.MinScore}
+	switch {
+	case in.Question == "":
+		return p, errors.New("question 不可為空")
+	case p.TopK < 0 || p.TopK > maxTopK:
+		return p, fmt.Errorf("top_k 必須介於 1 與 %d 之間", maxTopK)
+	case p.TopK == 0:
+		p.TopK = defaultTopK
+	}
+	if boundedScores() && (p.MinScore < -1 || p.MinScore > 1) {
+		return p, errors.New("min_score 必須介於 -1 與 1 之間")
+	}
+	filter, err := vectorstore.ParseFilter(in.Filter)
+	if err != nil {
+		return p, fmt.Errorf("filter 無效: %w", err)
+	}
+	p.Filter = filter
+	return p, nil
+}
+
+// boundedScores 回傳相似度是否介於 -1 與 1 之間：cosine 相似度有固定範圍，
+// RAG_LOCAL_METRIC=dot_product 時內積取決於向量長度，min_score 不限制範圍
+func boundedScores() bool {
+	return vectorStoreKind() != "local" || vectorstore.Metric(os.Getenv("RAG_LOCAL_METRIC")) != vectorstore.DotProduct
+}
+
+// ragReranker 為 rag-flow 使用的 reranker 與候選數
+type ragReranker struct {
+	rerank.Reranker
+	candidates int // 重新排序前檢索的候選數
+}
+
+// rerankerFromEnv 依設定建立 reranker，未啟用時回傳 nil
+//
+//	RAG_RERANKER           none（預設）/ llm / lexical
+//	RAG_RERANK_CANDIDATES  重新排序前檢索的候選數，預設 20
+//	RAG_RERANK_MODEL       llm reranker 使用的模型，預設與回答相同
+func rerankerFromEnv(g *genkit.Genkit, recordUsage func(context.Context, string, *ai.GenerationUsage)) (*ragReranker, error) {
+	model := os.Getenv("RAG_RERANK_MODEL")
+	if model == "" {
+		model = modelName
+	}
+	r, err := rerank.New(os.Getenv("RAG_RERANKER"), g, model)
+	if err != nil || r == nil {
+		return nil, err
+	}
+	if llm, ok := r.(*rerank.LLMReranker); ok {
+		llm.Middleware = []ai.ModelMiddleware{metrics.ModelMiddleware(model), logging.ModelMiddleware(model)}
+		llm.OnUsage = func(ctx context.Context, u *ai.GenerationUsage) { recordUsage(ctx, model, u) }
+	}
+
+	candidates := 20
+	if v := os.Getenv("RAG_RERANK_CANDIDATES"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("無效的 RAG_RERANK_CANDIDATES: %s", v)
+		}
+		candidates = n
+	}
+	return &ragReranker{Reranker: r, candidates: candidates}, nil
+}
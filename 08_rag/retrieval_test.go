@@ -0,0 +1,36 @@
+package main
+
+import "testing"
+
+func TestRagInputParams(t *testing.T) {
+	tests := []struct {
+		name     string
+		store    string // RAG_VECTOR_STORE
+		metric   string // RAG_LOCAL_METRIC
+		in       ragInput
+		wantTopK int
+		wantErr  bool
+	}{
+		{name: "defaults", in: ragInput{Question: "q"}, wantTopK: defaultTopK},
+		{name: "missing question", in: ragInput{}, wantErr: true},
+		{name: "top_k too large", in: ragInput{Question: "q", TopK: maxTopK + 1}, wantErr: true},
+		{name: "cosine min_score", store: "local", in: ragInput{Question: "q", TopK: 5, MinScore: 0.8}, wantTopK: 5},
+		{name: "cosine min_score out of range", store: "local", metric: "cosine", in: ragInput{Question: "q", MinScore: 1.5}, wantErr: true},
+		{name: "pinecone min_score out of range", in: ragInput{Question: "q", MinScore: -2}, wantErr: true},
+		{name: "dot product min_score", store: "local", metric: "dot_product", in: ragInput{Question: "q", MinScore: 12.5}, wantTopK: defaultTopK},
+		{name: "invalid filter", in: ragInput{Question: "q", Filter: map[string]any{"year": map[string]any{"$regex": "20"}}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("RAG_VECTOR_STORE", tt.store)
+			t.Setenv("RAG_LOCAL_METRIC", tt.metric)
+			p, err := tt.in.params()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("params() error = %v", err)
+			}
+			if !tt.wantErr && (p.TopK != tt.wantTopK || p.MinScore != tt.in.MinScore) {
+				t.Errorf("params() = %+v, want top_k %d", p, tt.wantTopK)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"strconv"
+	"sync"
+
+	"dongstudio.live/genkit_demo/pkg/logging"
+	"dongstudio.live/genkit_demo/pkg/metrics"
+	"dongstudio.live/genkit_demo/pkg/rewrite"
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/genkit"
+)
+
+// debugInfo 為 /ask 在 debug 為 true 時回傳的除錯資訊
+type debugInfo struct {
+	Queries  []rewrite.Query `json:"queries"`  // 實際用於檢索的查詢，第一個為原始問題
+	Contexts []string        `json:"contexts"` // 提供給模型的文檔全文，與 sources 順序相同，可用於回答評估
+}
+
+// rewriterFromEnv 依設定建立查詢改寫，未啟用時回傳 nil
+//
+//	RAG_QUERY_EXPANSION     以逗號分隔的變體：rewrite、paraphrase、translation、hyde，留空不改寫
+//	RAG_QUERY_PARAPHRASES   paraphrase 的數量，預設 2
+//	RAG_QUERY_REWRITE_MODEL 改寫使用的模型，預設與回答相同
+func rewriterFromEnv(g *genkit.Genkit, recordUsage func(context.Context, string, *ai.GenerationUsage)) (*rewrite.Rewriter, error) {
+	kinds, err := rewrite.ParseKinds(os.Getenv("RAG_QUERY_EXPANSION"))
+	if err != nil || len(kinds) == 0 {
+		return nil, err
+	}
+	model := os.Getenv("RAG_QUERY_REWRITE_MODEL")
+	if model == "" {
+		model = modelName
+	}
+	r := &rewrite.Rewriter{
+		Genkit:     g,
+		Model:      model,
+		Kinds:      kinds,
+		Middleware: []ai.ModelMiddleware{metrics.ModelMiddleware(model), logging.ModelMiddleware(model)},
+		OnUsage:    func(ctx context.Context, u *ai.GenerationUsage) { recordUsage(ctx, model, u) },
+	}
+	if v := os.Getenv("RAG_QUERY_PARAPHRASES"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return nil, errors.New("無效的 RAG_QUERY_PARAPHRASES: " + v)
+		}
+		r.Paraphrases = n
+	}
+	return r, nil
+}
+
+// expandQuery 以名為 "rewrite-query" 的 trace 步驟產生查詢變體，
+// 未啟用或改寫失敗時只使用原始問題
+func expandQuery(ctx context.Context, r *rewrite.Rewriter, query string) []rewrite.Query {
+	original := []rewrite.Query{{Kind: rewrite.KindOriginal, Text: query}}
+	if r == nil {
+		return original
+	}
+	queries, err := genkit.Run(ctx, "rewrite-query", func() ([]rewrite.Query, error) {
+		return r.Expand(ctx, query)
+	})
+	if err != nil {
+		slog.WarnContext(ctx, "改寫查詢失敗，只使用原始問題", "error", err)
+		return original
+	}
+	return queries
+}
+
+// retrieveAll 同時以每個查詢變體檢索，再以 reciprocal rank fusion 合併並保留前 topK 份
+// 部分變體檢索失敗時略過，全部失敗時回傳錯誤
+func retrieveAll(ctx context.Context, retriever ai.Retriever, queries []rewrite.Query, options any, topK int) ([]*ai.Document, error) {
+	results := make([][]*ai.Document, len(queries))
+	errs := make([]error, len(queries))
+	var wg sync.WaitGroup
+	for i, q := range queries {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := retriever.Retrieve(ctx, &ai.RetrieverRequest{
+				Query:   ai.DocumentFromText(q.Text, nil),
+				Options: options,
+			})
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			results[i] = resp.Documents
+		}()
+	}
+	wg.Wait()
+
+	if len(queries) == 1 {
+		return results[0], errs[0]
+	}
+	failed := 0
+	for i, err := range errs {
+		if err != nil {
+			failed++
+			slog.WarnContext(ctx, "查詢變體檢索失敗", "kind", queries[i].Kind, "error", err)
+		}
+	}
+	if failed == len(queries) {
+		return nil, errors.Join(errs...)
+	}
+	docs := rewrite.Fuse(results)
+	if len(docs) > topK {
+		docs = docs[:topK]
+	}
+	return docs, nil
+}
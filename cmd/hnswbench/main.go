@@ -0,0 +1,196 @@
+// hnswbench 以合成的 embedding 比較 HNSW 索引與精確搜尋的召回率與延遲
+//
+//	go run ./cmd/hnswbench -n 5000 -dim 3072 -ef-search 16,32,64,128,256
+//
+// 合成資料由數個群集中心加上雜訊組成，模擬真實 embedding 聚集在少數主題附近的分布
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"dongstudio.live/genkit_demo/pkg/vectorstore"
+)
+
+func main() {
+	var (
+		n        = flag.Int("n", 5000, "資料筆數")
+		dim      = flag.Int("dim", 3072, "向量維度（gemini-embedding-exp-03-07 為 3072）")
+		clusters = flag.Int("clusters", 50, "群集數")
+		noise    = flag.Float64("noise", 0.5, "群集內雜訊相對於中心的比例")
+		queries  = flag.Int("queries", 200, "查詢次數")
+		k        = flag.Int("k", 10, "每次查詢回傳的筆數")
+		m        = flag.Int("m", 16, "HNSW M")
+		efc      = flag.Int("ef-construction", 200, "HNSW efConstruction")
+		efs      = flag.String("ef-search", "16,32,64,128,256", "要比較的 efSearch，以逗號分隔")
+		metric   = flag.String("metric", "cosine", "相似度計算方式: cosine / dot_product")
+		seed     = flag.Uint64("seed", 1, "亂數種子")
+	)
+	flag.Parse()
+
+	efSearch, err := parseInts(*efs)
+	if err != nil {
+		log.Fatalf("無效的 -ef-search: %v", err)
+	}
+
+	dir, err := os.MkdirTemp("", "hnswbench")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	rng := rand.New(rand.NewPCG(*seed, *seed))
+	gen := newGenerator(rng, *dim, *clusters, *noise)
+
+	store, err := vectorstore.Open(filepath.Join(dir, "store.json"), vectorstore.Metric(*metric))
+	if err != nil {
+		log.Fatal(err)
+	}
+	entries := make([]*vectorstore.Entry, *n)
+	for i := range entries {
+		entries[i] = &vectorstore.Entry{ID: fmt.Sprintf("doc-%d", i), Vector: gen.next()}
+	}
+	if err := store.Upsert(entries...); err != nil {
+		log.Fatal(err)
+	}
+	qs := make([][]float32, *queries)
+	for i := range qs {
+		qs[i] = gen.next()
+	}
+	fmt.Printf("資料 %d 筆，維度 %d，群集 %d，查詢 %d 次，k=%d，metric=%s\n\n", *n, *dim, *clusters, *queries, *k, *metric)
+
+	// 精確搜尋作為正確答案
+	truth := make([]map[string]bool, len(qs))
+	exact := make([]time.Duration, len(qs))
+	for i, q := range qs {
+		start := time.Now()
+		results, err := store.Search(q, *k, nil)
+		exact[i] = time.Since(start)
+		if err != nil {
+			log.Fatal(err)
+		}
+		truth[i] = make(map[string]bool, len(results))
+		for _, r := range results {
+			truth[i][r.Entry.ID] = true
+		}
+	}
+
+	// 建立並保存 HNSW 索引
+	start := time.Now()
+	if err := store.UseHNSW(vectorstore.HNSWConfig{M: *m, EfConstruction: *efc}); err != nil {
+		log.Fatal(err)
+	}
+	build := time.Since(start)
+	store.Close()
+
+	// 以 mmap 載入保存的索引
+	start = time.Now()
+	index, err := vectorstore.LoadHNSW(filepath.Join(dir, "store.json.hnsw"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer index.Close()
+	load := time.Since(start)
+	fmt.Printf("HNSW 建立 %v（M=%d, efConstruction=%d），mmap 載入 %v\n\n", build.Round(time.Millisecond), *m, *efc, load.Round(time.Microsecond))
+
+	fmt.Printf("%-12s %10s %12s %12s %10s\n", "方法", "recall@k", "平均延遲", "p99 延遲", "加速")
+	exactAvg := mean(exact)
+	fmt.Printf("%-12s %10.4f %12v %12v %10s\n", "exact", 1.0, exactAvg, percentile(exact, 0.99), "1.0x")
+	for _, ef := range efSearch {
+		index.SetEfSearch(ef)
+		latencies := make([]time.Duration, len(qs))
+		var hits int
+		for i, q := range qs {
+			start := time.Now()
+			results, err := index.Search(q, *k, nil)
+			latencies[i] = time.Since(start)
+			if err != nil {
+				log.Fatal(err)
+			}
+			for _, r := range results {
+				if truth[i][r.ID] {
+					hits++
+				}
+			}
+		}
+		avg := mean(latencies)
+		recall := float64(hits) / float64(len(qs)*min(*k, *n))
+		fmt.Printf("%-12s %10.4f %12v %12v %9.1fx\n", "ef="+strconv.Itoa(ef), recall, avg, percentile(latencies, 0.99), float64(exactAvg)/float64(avg))
+	}
+}
+
+// generator 產生聚集在群集中心附近、已正規化的向量
+type generator struct {
+	rng     *rand.Rand
+	centers [][]float32
+	noise   float64
+}
+
+func newGenerator(rng *rand.Rand, dim, clusters int, noise float64) *generator {
+	g := &generator{rng: rng, noise: noise}
+	for range max(clusters, 1) {
+		c := make([]float32, dim)
+		for i := range c {
+			c[i] = float32(rng.NormFloat64())
+		}
+		g.centers = append(g.centers, normalize(c))
+	}
+	return g
+}
+
+func (g *generator) next() []float32 {
+	center := g.centers[g.rng.IntN(len(g.centers))]
+	scale := g.noise / math.Sqrt(float64(len(center)))
+	v := make([]float32, len(center))
+	for i := range v {
+		v[i] = center[i] + float32(g.rng.NormFloat64()*scale)
+	}
+	return normalize(v)
+}
+
+func normalize(v []float32) []float32 {
+	var sum float64
+	for _, x := range v {
+		sum += float64(x) * float64(x)
+	}
+	norm := float32(math.Sqrt(sum))
+	for i := range v {
+		v[i] /= norm
+	}
+	return v
+}
+
+func parseInts(s string) ([]int, error) {
+	var out []int
+	for _, f := range strings.Split(s, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(f))
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("%q", f)
+		}
+		out = append(out, n)
+	}
+	return out, nil
+}
+
+func mean(ds []time.Duration) time.Duration {
+	var sum time.Duration
+	for _, d := range ds {
+		sum += d
+	}
+	return sum / time.Duration(max(len(ds), 1))
+}
+
+func percentile(ds []time.Duration, p float64) time.Duration {
+	sorted := slices.Clone(ds)
+	slices.Sort(sorted)
+	return sorted[min(int(float64(len(sorted))*p), len(sorted)-1)]
+}
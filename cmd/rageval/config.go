@@ -0,0 +1,280 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"dongstudio.live/genkit_demo/pkg/hybrid"
+	"dongstudio.live/genkit_demo/pkg/ingest"
+	"dongstudio.live/genkit_demo/pkg/rerank"
+	"dongstudio.live/genkit_demo/pkg/vectorstore"
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/genkit"
+)
+
+// config 為一組要評估的檢索設定，欄位與 08_rag 的環境變數對應
+type config struct {
+	Name          string         `json:"name"`
+	Chunker       string         `json:"chunker,omitempty"`        // RAG_CHUNKER: none / token / sentence / paragraph / markdown / recursive
+	ChunkSize     int            `json:"chunk_size,omitempty"`     // RAG_CHUNK_SIZE
+	ChunkOverlap  int            `json:"chunk_overlap,omitempty"`  // RAG_CHUNK_OVERLAP
+	Metric        string         `json:"metric,omitempty"`         // RAG_LOCAL_METRIC: cosine / dot_product
+	Index         string         `json:"index,omitempty"`          // RAG_LOCAL_INDEX: flat / hnsw
+	Retrieval     string         `json:"retrieval,omitempty"`      // RAG_RETRIEVAL: vector / hybrid
+	VectorWeight  *float64       `json:"vector_weight,omitempty"`  // RAG_HYBRID_VECTOR_WEIGHT，預設 1
+	KeywordWeight *float64       `json:"keyword_weight,omitempty"` // RAG_HYBRID_KEYWORD_WEIGHT，預設 1
+	TopK          int            `json:"top_k,omitempty"`          // 每個問題檢索的片段數，預設為最大的 k
+	Reranker      string         `json:"reranker,omitempty"`       // RAG_RERANKER: none / lexical（離線評估不支援 llm）
+	Candidates    int            `json:"candidates,omitempty"`     // RAG_RERANK_CANDIDATES，預設 20
+	Filter        map[string]any `json:"filter,omitempty"`         // 每個問題共用的 metadata 過濾條件
+}
+
+// loadConfigs 讀取 -config 的值：JSON 檔案（單一設定或設定陣列），
+// 或以逗號分隔的 key=value，例如 "name=hybrid,retrieval=hybrid,top_k=5"
+func loadConfigs(specs []string) ([]*config, error) {
+	if len(specs) == 0 {
+		return []*config{{Name: "default"}}, nil
+	}
+	var configs []*config
+	for i, spec := range specs {
+		var data []byte
+		if strings.HasSuffix(spec, ".json") {
+			b, err := os.ReadFile(spec)
+			if err != nil {
+				return nil, err
+			}
+			data = b
+		} else {
+			b, err := inlineConfig(spec)
+			if err != nil {
+				return nil, fmt.Errorf("無效的 -config %q: %w", spec, err)
+			}
+			data = b
+		}
+
+		var loaded []*config
+		if strings.HasPrefix(strings.TrimSpace(string(data)), "[") {
+			if err := json.Unmarshal(data, &loaded); err != nil {
+				return nil, fmt.Errorf("解析 %s 失敗: %w", spec, err)
+			}
+		} else {
+			c := &config{}
+			if err := json.Unmarshal(data, c); err != nil {
+				return nil, fmt.Errorf("解析 %s 失敗: %w", spec, err)
+			}
+			loaded = append(loaded, c)
+		}
+		for j, c := range loaded {
+			if c.Name == "" {
+				c.Name = fmt.Sprintf("config-%d", i+j+1)
+			}
+		}
+		configs = append(configs, loaded...)
+	}
+	return configs, nil
+}
+
+// inlineConfig 將 key=value 清單轉為 JSON，數值與布林值保持原本的型別
+func inlineConfig(spec string) ([]byte, error) {
+	m := make(map[string]any)
+	for _, pair := range strings.Split(spec, ",") {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("%q 不是 key=value", pair)
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if n, err := strconv.ParseFloat(value, 64); err == nil {
+			m[key] = n
+		} else {
+			m[key] = value
+		}
+	}
+	return json.Marshal(m)
+}
+
+// evalRetriever 為依設定建立並完成索引的檢索
+type evalRetriever struct {
+	cfg       *config
+	retriever ai.Retriever
+	options   func(topK int) any
+	reranker  rerank.Reranker
+	chunks    int // 索引的片段數
+}
+
+// build 依設定切分與索引文件，所有資料只保存在 dir 與記憶體中
+func (c *config) build(ctx context.Context, g *genkit.Genkit, embedder ai.Embedder, docs []*ai.Document, dir string, seq int) (*evalRetriever, error) {
+	var chunker ingest.Chunker
+	if c.Chunker != "none" {
+		var err error
+		if chunker, err = ingest.NewChunker(c.Chunker, c.ChunkSize, c.ChunkOverlap); err != nil {
+			return nil, err
+		}
+	}
+	filter, err := vectorstore.ParseFilter(c.Filter)
+	if err != nil {
+		return nil, err
+	}
+
+	storeCfg := vectorstore.Config{
+		Path:     filepath.Join(dir, fmt.Sprintf("store-%d.json", seq)),
+		Metric:   vectorstore.Metric(c.Metric),
+		Embedder: embedder,
+	}
+	switch c.Index {
+	case "", "flat":
+	case "hnsw":
+		hnsw := vectorstore.DefaultHNSWConfig()
+		storeCfg.HNSW = &hnsw
+	default:
+		return nil, fmt.Errorf("不支援的 index: %s", c.Index)
+	}
+	ds, vector, err := vectorstore.DefineRetriever(g, fmt.Sprintf("rageval-%d", seq), storeCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var indexer ingest.Indexer = &storeIndexer{ds}
+	r := &evalRetriever{
+		cfg:       c,
+		retriever: vector,
+		options: func(topK int) any {
+			return &vectorstore.RetrieverOptions{K: topK, Filter: filter}
+		},
+	}
+
+	switch c.Retrieval {
+	case "", "vector":
+	case "hybrid":
+		keyword, err := hybrid.OpenIndex("")
+		if err != nil {
+			return nil, err
+		}
+		indexer = &keywordIndexer{Indexer: indexer, keyword: keyword}
+		hcfg := hybrid.Config{Vector: vector, Keyword: keyword, VectorWeight: 1, KeywordWeight: 1}
+		if c.VectorWeight != nil {
+			hcfg.VectorWeight = *c.VectorWeight
+		}
+		if c.KeywordWeight != nil {
+			hcfg.KeywordWeight = *c.KeywordWeight
+		}
+		if r.retriever, err = hybrid.DefineRetriever(g, fmt.Sprintf("rageval-hybrid-%d", seq), hcfg); err != nil {
+			return nil, err
+		}
+		r.options = func(topK int) any {
+			candidates := max(topK*4, 20)
+			return &hybrid.RetrieverOptions{
+				Count:         topK,
+				Candidates:    candidates,
+				Filter:        filter,
+				VectorOptions: &vectorstore.RetrieverOptions{K: candidates, Filter: filter},
+			}
+		}
+	default:
+		return nil, fmt.Errorf("不支援的 retrieval: %s", c.Retrieval)
+	}
+
+	switch c.Reranker {
+	case "", "none":
+	case "lexical":
+		r.reranker = rerank.LexicalReranker{}
+	default:
+		return nil, fmt.Errorf("離線評估不支援的 reranker: %s", c.Reranker)
+	}
+
+	registry, err := ingest.OpenRegistry("")
+	if err != nil {
+		return nil, err
+	}
+	pipeline := &ingest.Pipeline{Indexer: indexer, Chunker: chunker, Registry: registry}
+	report := pipeline.Sync(ctx, docs, ingest.SyncOptions{})
+	if len(report.Failed) > 0 {
+		return nil, fmt.Errorf("索引 %s 失敗: %s", report.Failed[0].DocumentID, report.Failed[0].Error)
+	}
+	r.chunks = ds.Store.Len()
+	return r, nil
+}
+
+// retrieve 檢索並回傳去除重複的文件 ID 排名（片段以 source_id 對應回文件）
+func (r *evalRetriever) retrieve(ctx context.Context, question string, topK int) ([]string, error) {
+	fetch := topK
+	if r.cfg.TopK > 0 {
+		fetch = r.cfg.TopK
+	}
+	if r.reranker != nil {
+		candidates := r.cfg.Candidates
+		if candidates <= 0 {
+			candidates = 20
+		}
+		fetch = max(fetch, candidates)
+	}
+
+	resp, err := r.retriever.Retrieve(ctx, &ai.RetrieverRequest{
+		Query:   ai.DocumentFromText(question, nil),
+		Options: r.options(fetch),
+	})
+	if err != nil {
+		return nil, err
+	}
+	docs := resp.Documents
+	if r.reranker != nil {
+		keep := topK
+		if r.cfg.TopK > 0 {
+			keep = r.cfg.TopK
+		}
+		if docs, _, err = rerank.Apply(ctx, r.reranker, question, docs, keep); err != nil {
+			return nil, err
+		}
+	}
+
+	var ranked []string
+	seen := make(map[string]bool)
+	for _, doc := range docs {
+		id, _ := doc.Metadata[ingest.MetaSourceID].(string)
+		if id == "" {
+			id, _ = doc.Metadata[ingest.MetaID].(string)
+		}
+		if id != "" && !seen[id] {
+			seen[id] = true
+			ranked = append(ranked, id)
+		}
+	}
+	return ranked, nil
+}
+
+// storeIndexer 將片段寫入本機向量資料庫
+type storeIndexer struct {
+	ds *vectorstore.DocStore
+}
+
+func (s *storeIndexer) Index(ctx context.Context, docs []*ai.Document) error {
+	return vectorstore.Index(ctx, docs, s.ds)
+}
+
+func (s *storeIndexer) Delete(_ context.Context, ids []string) error {
+	return s.ds.Store.Delete(ids...)
+}
+
+// keywordIndexer 寫入向量資料庫後同步更新關鍵字索引
+type keywordIndexer struct {
+	ingest.Indexer
+	keyword *hybrid.Index
+}
+
+func (k *keywordIndexer) Index(ctx context.Context, docs []*ai.Document) error {
+	if err := k.Indexer.Index(ctx, docs); err != nil {
+		return err
+	}
+	return k.keyword.Add(docs...)
+}
+
+func (k *keywordIndexer) Delete(ctx context.Context, ids []string) error {
+	if err := k.Indexer.Delete(ctx, ids); err != nil {
+		return err
+	}
+	return k.keyword.Delete(ids...)
+}
@@ -0,0 +1,267 @@
+// rageval 離線評估 08_rag 的檢索品質，比較不同的切分、top_k 與混合檢索設定
+//
+//	go run ./cmd/rageval -dataset cmd/rageval/example/questions.jsonl -docs cmd/rageval/example/docs \
+//	    -config cmd/rageval/example/vector.json -config cmd/rageval/example/hybrid.json
+//
+// 每組設定都會在暫存目錄建立本機向量資料庫並索引 -docs 的文件，再以資料集中的問題檢索，
+// 計算 recall@k、precision@k、MRR 與 nDCG@k；多組設定時並排比較，兩組時另列出差異
+//
+// 預設使用 feature hashing 的 embedder（-embedder hash），不需網路且結果固定；
+// 設定 -embedder googleai/<model> 時改用 Google AI 的 embedding 模型，
+// 搭配 -embed-cache 將 embedding 保存在檔案，重複比較設定時不需重新呼叫模型
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"dongstudio.live/genkit_demo/pkg/embedcache"
+	"dongstudio.live/genkit_demo/pkg/env"
+	"dongstudio.live/genkit_demo/pkg/ingest"
+	"dongstudio.live/genkit_demo/pkg/rageval"
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/genkit"
+	"github.com/firebase/genkit/go/plugins/googlegenai"
+)
+
+// listFlag 為可重複指定的 flag
+type listFlag []string
+
+func (l *listFlag) String() string     { return strings.Join(*l, " ") }
+func (l *listFlag) Set(v string) error { *l = append(*l, v); return nil }
+
+// questionResult 為單一問題在一組設定下的結果
+type questionResult struct {
+	ID       string          `json:"id"`
+	Question string          `json:"question"`
+	Expected []string        `json:"expected"`
+	Ranked   []string        `json:"ranked"`
+	Metrics  rageval.Metrics `json:"metrics"`
+}
+
+// configResult 為一組設定的評估結果
+type configResult struct {
+	Config    *config          `json:"config"`
+	Chunks    int              `json:"chunks"`
+	Mean      rageval.Metrics  `json:"mean"`
+	Questions []questionResult `json:"questions"`
+}
+
+func main() {
+	var configs listFlag
+	var (
+		dataset  = flag.String("dataset", "", "評估資料集（JSONL，每行 question 與 expected）")
+		docsDir  = flag.String("docs", "", "要索引的文件目錄（Markdown、HTML、純文字、PDF）")
+		include  = flag.String("include", "", "以逗號分隔的 glob，只索引符合的檔案")
+		exclude  = flag.String("exclude", "", "以逗號分隔的 glob，略過符合的檔案")
+		ksFlag   = flag.String("k", "1,3,5,10", "要計算的 k，以逗號分隔")
+		embedder = flag.String("embedder", "hash", "embedder: hash（離線、結果固定）或 googleai/<model>")
+		dim      = flag.Int("dim", 512, "hash embedder 的向量維度")
+		cache    = flag.String("embed-cache", "", "embedding 快取檔案，重複執行時只對新內容呼叫 embedder")
+		jsonOut  = flag.Bool("json", false, "以 JSON 輸出完整結果")
+		verbose  = flag.Bool("v", false, "列出每組設定中沒有全部找到相關文件的問題")
+	)
+	flag.Var(&configs, "config", "檢索設定：JSON 檔案或 key=value 清單，可重複指定以並排比較")
+	flag.Parse()
+	if *dataset == "" || *docsDir == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	ks, err := parseKs(*ksFlag)
+	if err != nil {
+		log.Fatalf("無效的 -k: %v", err)
+	}
+	examples, err := rageval.LoadDataset(*dataset)
+	if err != nil {
+		log.Fatal(err)
+	}
+	docs, err := ingest.LoadDir(*docsDir, ingest.WalkOptions{Include: splitList(*include), Exclude: splitList(*exclude)})
+	if err != nil {
+		log.Fatal(err)
+	}
+	cfgs, err := loadConfigs(configs)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx := context.Background()
+	g, emb, err := newEmbedder(ctx, *embedder, *dim)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var embCache *embedcache.Cache
+	if *cache != "" {
+		store, err := embedcache.Open(*cache)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if embCache, emb, err = embedcache.DefineEmbedder(g, "rageval", embedcache.Config{Embedder: emb, Store: store}); err != nil {
+			log.Fatal(err)
+		}
+		defer embCache.Close()
+	}
+
+	dir, err := os.MkdirTemp("", "rageval")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	results := make([]configResult, 0, len(cfgs))
+	for i, c := range cfgs {
+		r, err := c.build(ctx, g, emb, docs, dir, i)
+		if err != nil {
+			log.Fatalf("設定 %s: %v", c.Name, err)
+		}
+		result := configResult{Config: c, Chunks: r.chunks}
+		all := make([]rageval.Metrics, 0, len(examples))
+		for _, ex := range examples {
+			ranked, err := r.retrieve(ctx, ex.Question, slices.Max(ks))
+			if err != nil {
+				log.Fatalf("設定 %s 問題 %s: %v", c.Name, ex.ID, err)
+			}
+			m := rageval.Score(ranked, ex.Expected, ks)
+			all = append(all, m)
+			result.Questions = append(result.Questions, questionResult{
+				ID: ex.ID, Question: ex.Question, Expected: ex.Expected, Ranked: ranked, Metrics: m,
+			})
+		}
+		result.Mean = rageval.Mean(all, ks)
+		results = append(results, result)
+	}
+
+	if *jsonOut {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(results); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	fmt.Printf("資料集 %d 題，文件 %d 份，embedder %s\n", len(examples), len(docs), *embedder)
+	if embCache != nil {
+		st := embCache.Stats()
+		fmt.Printf("embedding 快取命中 %d / %d（%.0f%%）\n", st.Hits, st.Hits+st.Misses, st.HitRate()*100)
+	}
+	fmt.Println()
+	printTable(results, ks)
+	if *verbose {
+		printMisses(results, slices.Max(ks))
+	}
+}
+
+// newEmbedder 初始化 Genkit 並建立 embedder，hash 不需任何 plugin
+func newEmbedder(ctx context.Context, name string, dim int) (*genkit.Genkit, ai.Embedder, error) {
+	if name == "hash" {
+		g, err := genkit.Init(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+		return g, rageval.DefineHashEmbedder(g, "hash", dim), nil
+	}
+	model, ok := strings.CutPrefix(name, "googleai/")
+	if !ok {
+		return nil, nil, fmt.Errorf("不支援的 embedder: %s", name)
+	}
+	env.MustLoadEnv()
+	g, err := genkit.Init(ctx, genkit.WithPlugins(&googlegenai.GoogleAI{}))
+	if err != nil {
+		return nil, nil, err
+	}
+	return g, googlegenai.GoogleAIEmbedder(g, model), nil
+}
+
+// printTable 並排列出每組設定的平均指標，兩組設定時加上差異欄
+func printTable(results []configResult, ks []int) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	header := []string{"指標"}
+	for _, r := range results {
+		header = append(header, r.Config.Name)
+	}
+	compare := len(results) == 2
+	if compare {
+		header = append(header, "差異")
+	}
+	fmt.Fprintln(w, strings.Join(header, "\t")+"\t")
+
+	row := func(name string, value func(rageval.Metrics) float64) {
+		cols := []string{name}
+		for _, r := range results {
+			cols = append(cols, fmt.Sprintf("%.3f", value(r.Mean)))
+		}
+		if compare {
+			cols = append(cols, fmt.Sprintf("%+.3f", value(results[1].Mean)-value(results[0].Mean)))
+		}
+		fmt.Fprintln(w, strings.Join(cols, "\t")+"\t")
+	}
+	for _, k := range ks {
+		row(fmt.Sprintf("recall@%d", k), func(m rageval.Metrics) float64 { return m.Recall[k] })
+	}
+	for _, k := range ks {
+		row(fmt.Sprintf("precision@%d", k), func(m rageval.Metrics) float64 { return m.Precision[k] })
+	}
+	for _, k := range ks {
+		row(fmt.Sprintf("ndcg@%d", k), func(m rageval.Metrics) float64 { return m.NDCG[k] })
+	}
+	row("MRR", func(m rageval.Metrics) float64 { return m.MRR })
+
+	chunks := []string{"片段數"}
+	for _, r := range results {
+		chunks = append(chunks, strconv.Itoa(r.Chunks))
+	}
+	if compare {
+		chunks = append(chunks, "")
+	}
+	fmt.Fprintln(w, strings.Join(chunks, "\t")+"\t")
+	w.Flush()
+}
+
+// printMisses 列出前 k 份沒有找到全部相關文件的問題
+func printMisses(results []configResult, k int) {
+	for _, r := range results {
+		fmt.Printf("\n[%s] recall@%d < 1 的問題:\n", r.Config.Name, k)
+		for _, q := range r.Questions {
+			if q.Metrics.Recall[k] >= 1 {
+				continue
+			}
+			fmt.Printf("  %s %s\n    預期: %s\n    檢索: %s\n", q.ID, q.Question,
+				strings.Join(q.Expected, ", "), strings.Join(q.Ranked[:min(k, len(q.Ranked))], ", "))
+		}
+	}
+}
+
+func parseKs(s string) ([]int, error) {
+	var ks []int
+	for _, part := range splitList(s) {
+		k, err := strconv.Atoi(part)
+		if err != nil || k <= 0 {
+			return nil, fmt.Errorf("%q 不是正整數", part)
+		}
+		ks = append(ks, k)
+	}
+	if len(ks) == 0 {
+		return nil, fmt.Errorf("至少需要一個 k")
+	}
+	slices.Sort(ks)
+	return slices.Compact(ks), nil
+}
+
+// splitList 切分以逗號分隔的清單，略過空白項目
+func splitList(s string) []string {
+	var out []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
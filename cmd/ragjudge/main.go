@@ -0,0 +1,371 @@
+// ragjudge 以模型評審（LLM-as-judge）評估 08_rag 與 07_chat 的回答品質
+//
+//	go run ./cmd/ragjudge -dataset cmd/rageval/example/questions.jsonl -target rag -out results.csv
+//
+// 評估項目為忠實度（faithfulness，回答是否都有上下文依據）、切題程度（answer_relevance）
+// 與正確性（answer_correctness，與參考答案比較），每項 1–5 分並正規化到 0–1，附上評審的理由
+//
+// 資料集與 rageval 相同（JSONL），回答評估使用 question、reference，以及選填的 answer 與 contexts；
+// 沒有 answer 的問題依 -target 呼叫執行中的服務取得：rag 呼叫 /ask（帶 debug 以取得上下文），chat 呼叫 /chat
+//
+// 評審經由 Genkit evaluator 執行，與開發介面使用的相同；-judge fake 使用結果固定的離線評審模型，
+// 只適合確認資料集與評估流程，不代表真實的回答品質
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"dongstudio.live/genkit_demo/pkg/env"
+	"dongstudio.live/genkit_demo/pkg/rageval"
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/genkit"
+	"github.com/firebase/genkit/go/plugins/googlegenai"
+)
+
+// scoreResult 為一個評估項目的結果，評審失敗或缺少欄位時只有 Error
+type scoreResult struct {
+	Rating    int      `json:"rating,omitempty"`
+	Score     *float64 `json:"score,omitempty"`
+	Status    string   `json:"status"` // PASS、FAIL 或 UNKNOWN
+	Reasoning string   `json:"reasoning,omitempty"`
+	Error     string   `json:"error,omitempty"`
+}
+
+// exampleResult 為單一問題的評估結果
+type exampleResult struct {
+	ID        string                             `json:"id"`
+	Question  string                             `json:"question"`
+	Reference string                             `json:"reference,omitempty"`
+	Answer    string                             `json:"answer"`
+	Contexts  []string                           `json:"contexts,omitempty"`
+	Scores    map[rageval.Criterion]*scoreResult `json:"scores"`
+}
+
+func main() {
+	var (
+		dataset     = flag.String("dataset", "", "評估資料集（JSONL，每行 question，選填 reference、answer、contexts）")
+		target      = flag.String("target", "", "沒有 answer 時呼叫的服務：rag（/ask）或 chat（/chat）；留空只評估資料集中的回答")
+		baseURL     = flag.String("url", "http://localhost:8080", "服務的位址")
+		apiKey      = flag.String("api-key", "", "呼叫服務時帶在 X-API-Key 標頭的 API Key")
+		judgeModel  = flag.String("judge", "googleai/gemini-2.5-flash", "評審模型：googleai/<model> 或 fake（離線、結果固定）")
+		criteriaArg = flag.String("criteria", "", "以逗號分隔的評估項目：faithfulness、answer_relevance、answer_correctness，預設全部")
+		concurrency = flag.Int("concurrency", rageval.DefaultJudgeConcurrency, "同時進行的服務與評審呼叫數")
+		threshold   = flag.Float64("threshold", rageval.DefaultPassThreshold, "判定通過的最低分數（0–1）")
+		out         = flag.String("out", "", "輸出每題結果的檔案，副檔名為 .json 或 .csv")
+		verbose     = flag.Bool("v", false, "列出未通過的問題與評審理由")
+	)
+	flag.Parse()
+	if *dataset == "" || *concurrency <= 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *threshold <= 0 || *threshold > 1 {
+		log.Fatalf("無效的 -threshold: %v", *threshold)
+	}
+	if ext := filepath.Ext(*out); *out != "" && ext != ".json" && ext != ".csv" {
+		log.Fatalf("-out 的副檔名必須是 .json 或 .csv: %s", *out)
+	}
+	criteria, err := rageval.ParseCriteria(*criteriaArg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	examples, err := rageval.LoadAnswerDataset(*dataset)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if *target != "" {
+		ask, err := newAsker(*target, *baseURL, *apiKey)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fillAnswers(ctx, ask, examples, *concurrency)
+	}
+
+	g, model, err := newJudgeModel(ctx, *judgeModel)
+	if err != nil {
+		log.Fatal(err)
+	}
+	judge := &rageval.Judge{Genkit: g, Model: model, PassThreshold: *threshold, Concurrency: *concurrency}
+	evaluators, err := judge.DefineEvaluators(criteria...)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	results, err := judgeExamples(ctx, evaluators, criteria, examples)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *out != "" {
+		if err := writeResults(*out, results, criteria); err != nil {
+			log.Fatal(err)
+		}
+	}
+	fmt.Printf("資料集 %d 題，評審模型 %s，通過門檻 %.2f\n\n", len(examples), model, *threshold)
+	printSummary(results, criteria)
+	if *verbose {
+		printFailures(results, criteria)
+	}
+}
+
+// newJudgeModel 初始化 Genkit 並回傳評審模型名稱，fake 不需任何 plugin
+func newJudgeModel(ctx context.Context, name string) (*genkit.Genkit, string, error) {
+	if name == "fake" {
+		g, err := genkit.Init(ctx)
+		if err != nil {
+			return nil, "", err
+		}
+		rageval.DefineFakeJudge(g)
+		return g, rageval.FakeJudgeModel, nil
+	}
+	if !strings.HasPrefix(name, "googleai/") {
+		return nil, "", fmt.Errorf("不支援的評審模型: %s", name)
+	}
+	env.MustLoadEnv()
+	g, err := genkit.Init(ctx, genkit.WithPlugins(&googlegenai.GoogleAI{}))
+	if err != nil {
+		return nil, "", err
+	}
+	return g, name, nil
+}
+
+// judgeExamples 以 evaluators（順序與 criteria 相同）評估每個問題的回答
+func judgeExamples(ctx context.Context, evaluators []ai.Evaluator, criteria []rageval.Criterion, examples []rageval.Example) ([]*exampleResult, error) {
+	results := make([]*exampleResult, len(examples))
+	data := make([]*ai.Example, len(examples))
+	for i, ex := range examples {
+		results[i] = &exampleResult{
+			ID: ex.ID, Question: ex.Question, Reference: ex.Reference, Answer: ex.Answer, Contexts: ex.Contexts,
+			Scores: make(map[rageval.Criterion]*scoreResult, len(criteria)),
+		}
+		contexts := make([]any, len(ex.Contexts))
+		for j, c := range ex.Contexts {
+			contexts[j] = c
+		}
+		data[i] = &ai.Example{TestCaseId: ex.ID, Input: ex.Question, Output: ex.Answer, Context: contexts, Reference: ex.Reference}
+	}
+	for i, e := range evaluators {
+		resp, err := e.Evaluate(ctx, &ai.EvaluatorRequest{Dataset: data, EvaluationId: fmt.Sprintf("ragjudge-%d", time.Now().Unix())})
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", e.Name(), err)
+		}
+		for j, r := range *resp {
+			results[j].Scores[criteria[i]] = toScoreResult(r)
+		}
+	}
+	return results, nil
+}
+
+// toScoreResult 將 evaluator 的結果轉為輸出格式，每個 evaluator 只回傳一個分數
+func toScoreResult(r ai.EvaluationResult) *scoreResult {
+	if len(r.Evaluation) == 0 {
+		return &scoreResult{Status: ai.ScoreStatusUnknown.String(), Error: "evaluator 沒有回傳結果"}
+	}
+	s := r.Evaluation[0]
+	result := &scoreResult{Status: s.Status, Error: s.Error}
+	if v, ok := s.Score.(float64); ok {
+		result.Score = &v
+	}
+	result.Reasoning, _ = s.Details["reasoning"].(string)
+	switch n := s.Details["rating"].(type) {
+	case int:
+		result.Rating = n
+	case float64: // 經過 JSON 轉換時為 float64
+		result.Rating = int(n)
+	}
+	return result
+}
+
+// writeResults 依副檔名將每題結果寫成 JSON 或 CSV（每個問題與評估項目一列）
+func writeResults(path string, results []*exampleResult, criteria []rageval.Criterion) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if filepath.Ext(path) == ".json" {
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(results); err != nil {
+			return err
+		}
+		return f.Close()
+	}
+
+	w := csv.NewWriter(f)
+	w.Write([]string{"id", "question", "criterion", "rating", "score", "status", "reasoning", "error", "answer"})
+	for _, r := range results {
+		for _, c := range criteria {
+			s := r.Scores[c]
+			rating, score := "", ""
+			if s.Score != nil {
+				rating = strconv.Itoa(s.Rating)
+				score = strconv.FormatFloat(*s.Score, 'f', 2, 64)
+			}
+			w.Write([]string{r.ID, r.Question, string(c), rating, score, s.Status, s.Reasoning, s.Error, r.Answer})
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// printSummary 列出每個評估項目的平均分數與通過率，未能評估的問題不計入
+func printSummary(results []*exampleResult, criteria []rageval.Criterion) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "項目\t平均分數\t通過率\t已評估\t未評估\t")
+	for _, c := range criteria {
+		var sum float64
+		var scored, passed int
+		for _, r := range results {
+			s := r.Scores[c]
+			if s.Score == nil {
+				continue
+			}
+			scored++
+			sum += *s.Score
+			if s.Status == ai.ScoreStatusPass.String() {
+				passed++
+			}
+		}
+		mean, rate := "-", "-"
+		if scored > 0 {
+			mean = fmt.Sprintf("%.3f", sum/float64(scored))
+			rate = fmt.Sprintf("%.0f%%", float64(passed)/float64(scored)*100)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t\n", c, mean, rate, scored, len(results)-scored)
+	}
+	w.Flush()
+}
+
+// printFailures 列出未通過或未能評估的問題與原因
+func printFailures(results []*exampleResult, criteria []rageval.Criterion) {
+	fmt.Println()
+	for _, c := range criteria {
+		for _, r := range results {
+			s := r.Scores[c]
+			switch s.Status {
+			case ai.ScoreStatusFail.String():
+				fmt.Printf("[%s] %s %s（%d 分）: %s\n", c, r.ID, r.Question, s.Rating, s.Reasoning)
+			case ai.ScoreStatusUnknown.String():
+				fmt.Printf("[%s] %s %s: 未評估，%s\n", c, r.ID, r.Question, s.Error)
+			}
+		}
+	}
+}
+
+// answer 為服務的回答與使用的上下文
+type answer struct {
+	Text     string
+	Contexts []string
+}
+
+// newAsker 回傳呼叫服務取得回答的函式
+func newAsker(target, baseURL, apiKey string) (func(ctx context.Context, question string) (*answer, error), error) {
+	client := &http.Client{Timeout: 2 * time.Minute}
+	post := func(ctx context.Context, path string, body, out any) error {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(baseURL, "/")+path, bytes.NewReader(b))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if apiKey != "" {
+			req.Header.Set("X-API-Key", apiKey)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			var e struct {
+				Error string `json:"error"`
+			}
+			json.NewDecoder(resp.Body).Decode(&e)
+			return fmt.Errorf("%s 回傳 %d: %s", path, resp.StatusCode, e.Error)
+		}
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+
+	switch target {
+	case "rag":
+		return func(ctx context.Context, question string) (*answer, error) {
+			var out struct {
+				Answer string `json:"answer"`
+				Debug  struct {
+					Contexts []string `json:"contexts"`
+				} `json:"debug"`
+			}
+			if err := post(ctx, "/ask", map[string]any{"question": question, "debug": true}, &out); err != nil {
+				return nil, err
+			}
+			return &answer{Text: out.Answer, Contexts: out.Debug.Contexts}, nil
+		}, nil
+	case "chat":
+		return func(ctx context.Context, question string) (*answer, error) {
+			var out struct {
+				Message struct {
+					Content string `json:"content"`
+				} `json:"message"`
+			}
+			if err := post(ctx, "/chat", map[string]any{"message": question}, &out); err != nil {
+				return nil, err
+			}
+			return &answer{Text: out.Message.Content}, nil
+		}, nil
+	default:
+		return nil, fmt.Errorf("不支援的 -target: %s", target)
+	}
+}
+
+// fillAnswers 以最多 concurrency 個請求同時為沒有 answer 的問題取得回答
+// 失敗的問題保留空白回答，評估時會標記為未評估
+func fillAnswers(ctx context.Context, ask func(context.Context, string) (*answer, error), examples []rageval.Example, concurrency int) {
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i := range examples {
+		ex := &examples[i]
+		if ex.Answer != "" {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			a, err := ask(ctx, ex.Question)
+			if err != nil {
+				log.Printf("問題 %s 無法取得回答: %v", ex.ID, err)
+				return
+			}
+			ex.Answer = a.Text
+			if len(ex.Contexts) == 0 {
+				ex.Contexts = a.Contexts
+			}
+		}()
+	}
+	wg.Wait()
+}
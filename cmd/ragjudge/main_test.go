@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"dongstudio.live/genkit_demo/pkg/rageval"
+	"github.com/firebase/genkit/go/ai"
+)
+
+// judgeExampleDataset 以離線評審模型評估範例資料集
+func judgeExampleDataset(t *testing.T) ([]*exampleResult, []rageval.Criterion) {
+	t.Helper()
+	ctx := context.Background()
+	examples, err := rageval.LoadAnswerDataset("example/answers.jsonl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, model, err := newJudgeModel(ctx, "fake")
+	if err != nil {
+		t.Fatal(err)
+	}
+	judge := &rageval.Judge{Genkit: g, Model: model, PassThreshold: rageval.DefaultPassThreshold}
+	evaluators, err := judge.DefineEvaluators(rageval.Criteria...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := judgeExamples(ctx, evaluators, rageval.Criteria, examples)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != len(examples) {
+		t.Fatalf("評估了 %d 題，want %d", len(results), len(examples))
+	}
+	return results, rageval.Criteria
+}
+
+func TestJudgeExamples(t *testing.T) {
+	results, _ := judgeExampleDataset(t)
+	byID := make(map[string]*exampleResult)
+	for _, r := range results {
+		byID[r.ID] = r
+	}
+
+	tests := []struct {
+		id        string
+		criterion rageval.Criterion
+		status    string
+	}{
+		{"tech-3", rageval.Faithfulness, ai.ScoreStatusPass.String()},
+		{"tech-3", rageval.AnswerCorrectness, ai.ScoreStatusPass.String()},
+		{"edu-1", rageval.AnswerCorrectness, ai.ScoreStatusFail.String()},
+		// 沒有上下文與參考答案的問題只能評估切題程度
+		{"culture-2", rageval.Faithfulness, ai.ScoreStatusUnknown.String()},
+		{"culture-2", rageval.AnswerCorrectness, ai.ScoreStatusUnknown.String()},
+		{"culture-2", rageval.AnswerRelevance, ai.ScoreStatusPass.String()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.id+"/"+string(tt.criterion), func(t *testing.T) {
+			s := byID[tt.id].Scores[tt.criterion]
+			if s.Status != tt.status {
+				t.Fatalf("狀態 = %s, want %s（%+v）", s.Status, tt.status, s)
+			}
+			if tt.status == ai.ScoreStatusUnknown.String() {
+				if s.Score != nil || s.Error == "" {
+					t.Errorf("未評估的結果 = %+v，預期沒有分數並記錄原因", s)
+				}
+				return
+			}
+			if s.Score == nil || s.Rating < 1 || s.Rating > 5 || s.Reasoning == "" {
+				t.Errorf("結果 = %+v，預期有 1–5 分與理由", s)
+			}
+		})
+	}
+}
+
+func TestWriteResults(t *testing.T) {
+	results, criteria := judgeExampleDataset(t)
+	dir := t.TempDir()
+
+	t.Run("json", func(t *testing.T) {
+		path := filepath.Join(dir, "results.json")
+		if err := writeResults(path, results, criteria); err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var decoded []*exampleResult
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			t.Fatal(err)
+		}
+		if len(decoded) != len(results) {
+			t.Fatalf("JSON 有 %d 題，want %d", len(decoded), len(results))
+		}
+		for i, r := range decoded {
+			if r.ID != results[i].ID || len(r.Scores) != len(criteria) {
+				t.Errorf("第 %d 題 = %+v", i, r)
+			}
+			for c, s := range r.Scores {
+				want := results[i].Scores[c]
+				if s.Status != want.Status || s.Rating != want.Rating {
+					t.Errorf("%s %s = %+v, want %+v", r.ID, c, s, want)
+				}
+			}
+		}
+	})
+
+	t.Run("csv", func(t *testing.T) {
+		path := filepath.Join(dir, "results.csv")
+		if err := writeResults(path, results, criteria); err != nil {
+			t.Fatal(err)
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		rows, err := csv.NewReader(f).ReadAll()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := 1 + len(results)*len(criteria); len(rows) != want {
+			t.Fatalf("CSV 有 %d 列，want %d", len(rows), want)
+		}
+		header := rows[0]
+		col := make(map[string]int, len(header))
+		for i, name := range header {
+			col[name] = i
+		}
+		for _, row := range rows[1:] {
+			status, rating, score := row[col["status"]], row[col["rating"]], row[col["score"]]
+			if status == ai.ScoreStatusUnknown.String() {
+				if rating != "" || score != "" || row[col["error"]] == "" {
+					t.Errorf("未評估的列 = %q，預期沒有分數並記錄原因", row)
+				}
+				continue
+			}
+			if rating == "" || score == "" {
+				t.Errorf("已評估的列 = %q，缺少分數", row)
+			}
+		}
+	})
+}
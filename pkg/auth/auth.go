@@ -0,0 +1,249 @@
+// Package auth 提供 HTTP 服務共用的身分驗證
+// 支援 API Key 與 HMAC (HS256) 簽章的 JWT Bearer Token
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Principal 表示通過驗證的呼叫者
+type Principal struct {
+	ID     string `json:"id"`     // 使用者識別碼
+	Method string `json:"method"` // 驗證方式: "api_key" 或 "jwt"
+}
+
+// 驗證失敗時回傳的錯誤
+var (
+	ErrMissingCredentials = errors.New("缺少認證資訊")
+	ErrInvalidCredentials = errors.New("無效的認證資訊")
+	ErrTokenExpired       = errors.New("token 已過期")
+)
+
+// Config 驗證設定
+type Config struct {
+	// APIKeys 為 API Key 對應使用者 ID 的映射表
+	APIKeys map[string]string
+	// JWTSecret 為 HS256 簽章密鑰，空值表示不接受 JWT
+	JWTSecret []byte
+	// Leeway 為驗證 exp/nbf 時容許的時間誤差
+	Leeway time.Duration
+}
+
+// ConfigFromEnv 從環境變數讀取驗證設定，同一個 API Key 設定多次時回傳錯誤
+//
+//	AUTH_API_KEYS=alice:key1,bob:key2
+//	AUTH_JWT_SECRET=some-secret
+func ConfigFromEnv() (Config, error) {
+	cfg := Config{
+		APIKeys: make(map[string]string),
+		Leeway:  30 * time.Second,
+	}
+
+	if raw := strings.TrimSpace(os.Getenv("AUTH_API_KEYS")); raw != "" {
+		for _, pair := range strings.Split(raw, ",") {
+			userID, key, ok := strings.Cut(strings.TrimSpace(pair), ":")
+			userID, key = strings.TrimSpace(userID), strings.TrimSpace(key)
+			if !ok || userID == "" || key == "" {
+				return Config{}, fmt.Errorf("AUTH_API_KEYS 格式錯誤，應為 user:key: %q", pair)
+			}
+			// 同一個 Key 對應多個使用者時無法判斷呼叫者，錯誤訊息不包含 Key 本身
+			if owner, ok := cfg.APIKeys[key]; ok {
+				return Config{}, fmt.Errorf("AUTH_API_KEYS 中 %s 與 %s 的 API Key 重複", owner, userID)
+			}
+			cfg.APIKeys[key] = userID
+		}
+	}
+
+	if secret := os.Getenv("AUTH_JWT_SECRET"); secret != "" {
+		cfg.JWTSecret = []byte(secret)
+	}
+
+	return cfg, nil
+}
+
+// Authenticator 根據設定驗證請求中的認證資訊
+type Authenticator struct {
+	keys   map[[sha256.Size]byte]string // 以 API Key 雜湊值為鍵，避免逐字比對洩漏時間資訊
+	secret []byte
+	leeway time.Duration
+	now    func() time.Time
+}
+
+// NewAuthenticator 建立驗證器，至少需要設定一種驗證方式
+func NewAuthenticator(cfg Config) (*Authenticator, error) {
+	if len(cfg.APIKeys) == 0 && len(cfg.JWTSecret) == 0 {
+		return nil, errors.New("未設定任何認證方式，請設定 AUTH_API_KEYS 或 AUTH_JWT_SECRET")
+	}
+
+	a := &Authenticator{
+		keys:   make(map[[sha256.Size]byte]string, len(cfg.APIKeys)),
+		secret: cfg.JWTSecret,
+		leeway: cfg.Leeway,
+		now:    time.Now,
+	}
+	for key, userID := range cfg.APIKeys {
+		a.keys[sha256.Sum256([]byte(key))] = userID
+	}
+	return a, nil
+}
+
+// Authenticate 驗證一個認證字串（API Key 或 JWT）
+func (a *Authenticator) Authenticate(credential string) (*Principal, error) {
+	if credential == "" {
+		return nil, ErrMissingCredentials
+	}
+
+	if userID, ok := a.keys[sha256.Sum256([]byte(credential))]; ok {
+		return &Principal{ID: userID, Method: "api_key"}, nil
+	}
+
+	// 形如 header.payload.signature 的字串視為 JWT
+	if len(a.secret) > 0 && strings.Count(credential, ".") == 2 {
+		return a.verifyJWT(credential)
+	}
+
+	return nil, ErrInvalidCredentials
+}
+
+// jwtClaims 只解析驗證所需的標準欄位
+type jwtClaims struct {
+	Subject   string   `json:"sub"`
+	ExpiresAt *float64 `json:"exp"`
+	NotBefore *float64 `json:"nbf"`
+}
+
+// verifyJWT 驗證 HS256 簽章與有效期限，並以 sub 作為使用者 ID
+// token 必須帶有 exp，沒有期限的 token 外洩後無法失效，一律拒絕
+func (a *Authenticator) verifyJWT(token string) (*Principal, error) {
+	parts := strings.Split(token, ".")
+
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrInvalidCredentials
+	}
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := json.Unmarshal(headerJSON, &header); err != nil || header.Alg != "HS256" {
+		return nil, ErrInvalidCredentials
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalidCredentials
+	}
+	mac := hmac.New(sha256.New, a.secret)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return nil, ErrInvalidCredentials
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrInvalidCredentials
+	}
+	var claims jwtClaims
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Subject == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	if claims.ExpiresAt == nil {
+		return nil, ErrInvalidCredentials
+	}
+	now := a.now()
+	if now.After(unixTime(*claims.ExpiresAt).Add(a.leeway)) {
+		return nil, ErrTokenExpired
+	}
+	if claims.NotBefore != nil && now.Add(a.leeway).Before(unixTime(*claims.NotBefore)) {
+		return nil, ErrInvalidCredentials
+	}
+
+	return &Principal{ID: claims.Subject, Method: "jwt"}, nil
+}
+
+func unixTime(sec float64) time.Time {
+	return time.Unix(int64(sec), 0)
+}
+
+// credentialFromRequest 從 X-API-Key 或 Authorization: Bearer 標頭取出認證字串
+func credentialFromRequest(c *gin.Context) string {
+	if key := c.GetHeader("X-API-Key"); key != "" {
+		return key
+	}
+	scheme, token, ok := strings.Cut(c.GetHeader("Authorization"), " ")
+	if ok && strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(token)
+	}
+	return ""
+}
+
+type principalKey struct{}
+
+// Middleware 回傳 gin 驗證中介層，驗證失敗時回應 401
+func Middleware(a *Authenticator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, err := a.Authenticate(credentialFromRequest(c))
+		if err != nil {
+			c.Header("WWW-Authenticate", `Bearer realm="api"`)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+
+		// 存入 request context，方便 handler 與下游元件取用
+		c.Request = c.Request.WithContext(NewContext(c.Request.Context(), principal))
+		c.Next()
+	}
+}
+
+// AdminUsersFromEnv 讀取 AUTH_ADMIN_USERS（以逗號分隔的使用者ID），這些使用者可以執行維運操作，
+// 例如調整日誌等級、查詢所有人的用量與管理 namespace
+func AdminUsersFromEnv() []string {
+	var admins []string
+	for _, id := range strings.Split(os.Getenv("AUTH_ADMIN_USERS"), ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			admins = append(admins, id)
+		}
+	}
+	return admins
+}
+
+// RequireAdmin 回傳只允許 admins 中的使用者通過的中介層，其他人回應 403；
+// 未驗證的請求（例如服務未啟用驗證時）一律拒絕
+func RequireAdmin(admins []string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if p := FromGin(c); p == nil || !slices.Contains(admins, p.ID) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "僅限管理者"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// NewContext 回傳帶有 Principal 的 context
+func NewContext(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// FromContext 從 context 取出 Principal，未驗證時回傳 nil
+func FromContext(ctx context.Context) *Principal {
+	p, _ := ctx.Value(principalKey{}).(*Principal)
+	return p
+}
+
+// FromGin 從 gin.Context 取出 Principal，未驗證時回傳 nil
+func FromGin(c *gin.Context) *Principal {
+	return FromContext(c.Request.Context())
+}
@@ -0,0 +1,186 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var testSecret = []byte("test-secret")
+
+// signJWT 以 secret 簽署 header 與 payload（JSON 字串）
+func signJWT(secret []byte, header, payload string) string {
+	enc := base64.RawURLEncoding
+	signing := enc.EncodeToString([]byte(header)) + "." + enc.EncodeToString([]byte(payload))
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(signing))
+	return signing + "." + enc.EncodeToString(mac.Sum(nil))
+}
+
+func newTestAuthenticator(t *testing.T, now time.Time) *Authenticator {
+	t.Helper()
+	a, err := NewAuthenticator(Config{
+		APIKeys:   map[string]string{"key-alice": "alice"},
+		JWTSecret: testSecret,
+		Leeway:    30 * time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.now = func() time.Time { return now }
+	return a
+}
+
+func TestAuthenticate(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	a := newTestAuthenticator(t, now)
+	const hs256 = `{"alg":"HS256","typ":"JWT"}`
+
+	tests := []struct {
+		name       string
+		credential string
+		wantID     string
+		wantMethod string
+		wantErr    error
+	}{
+		{name: "api key", credential: "key-alice", wantID: "alice", wantMethod: "api_key"},
+		{name: "unknown api key", credential: "key-bob", wantErr: ErrInvalidCredentials},
+		{name: "missing", credential: "", wantErr: ErrMissingCredentials},
+		{name: "jwt", credential: signJWT(testSecret, hs256, `{"sub":"bob","exp":1700000600}`), wantID: "bob", wantMethod: "jwt"},
+		{name: "jwt without exp", credential: signJWT(testSecret, hs256, `{"sub":"bob"}`), wantErr: ErrInvalidCredentials},
+		{name: "expired within leeway", credential: signJWT(testSecret, hs256, `{"sub":"bob","exp":1699999980}`), wantID: "bob", wantMethod: "jwt"},
+		{name: "expired", credential: signJWT(testSecret, hs256, `{"sub":"bob","exp":1699999900}`), wantErr: ErrTokenExpired},
+		{name: "not yet valid", credential: signJWT(testSecret, hs256, `{"sub":"bob","nbf":1700000100,"exp":1700000600}`), wantErr: ErrInvalidCredentials},
+		{name: "nbf within leeway", credential: signJWT(testSecret, hs256, `{"sub":"bob","nbf":1700000020,"exp":1700000600}`), wantID: "bob", wantMethod: "jwt"},
+		{name: "wrong secret", credential: signJWT([]byte("other"), hs256, `{"sub":"bob","exp":1700000600}`), wantErr: ErrInvalidCredentials},
+		{name: "alg none", credential: signJWT(testSecret, `{"alg":"none"}`, `{"sub":"bob","exp":1700000600}`), wantErr: ErrInvalidCredentials},
+		{name: "missing sub", credential: signJWT(testSecret, hs256, `{"exp":1700000600}`), wantErr: ErrInvalidCredentials},
+		{name: "invalid exp", credential: signJWT(testSecret, hs256, `{"sub":"bob","exp":"tomorrow"}`), wantErr: ErrInvalidCredentials},
+		{name: "malformed", credential: "a.b.c", wantErr: ErrInvalidCredentials},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := a.Authenticate(tt.credential)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Authenticate() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			if p.ID != tt.wantID || p.Method != tt.wantMethod {
+				t.Errorf("Authenticate() = %+v, want %s (%s)", p, tt.wantID, tt.wantMethod)
+			}
+		})
+	}
+
+	// 只設定 API Key 時不接受 JWT
+	keysOnly, err := NewAuthenticator(Config{APIKeys: map[string]string{"k": "u"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := keysOnly.Authenticate(signJWT(testSecret, hs256, `{"sub":"bob","exp":1700000600}`)); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("未設定 JWT 密鑰時 Authenticate() error = %v", err)
+	}
+	if _, err := NewAuthenticator(Config{}); err == nil {
+		t.Error("未設定任何認證方式時應回傳錯誤")
+	}
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		keys    string
+		want    map[string]string
+		wantErr bool
+	}{
+		{name: "empty", want: map[string]string{}},
+		{name: "pairs", keys: " alice:key1 , bob:key2", want: map[string]string{"key1": "alice", "key2": "bob"}},
+		{name: "missing key", keys: "alice:", wantErr: true},
+		{name: "missing separator", keys: "alice", wantErr: true},
+		{name: "duplicate key", keys: "alice:key1,bob:key1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("AUTH_API_KEYS", tt.keys)
+			t.Setenv("AUTH_JWT_SECRET", "")
+			cfg, err := ConfigFromEnv()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ConfigFromEnv() error = %v", err)
+			}
+			if tt.wantErr {
+				return
+			}
+			if len(cfg.APIKeys) != len(tt.want) {
+				t.Fatalf("APIKeys = %v, want %v", cfg.APIKeys, tt.want)
+			}
+			for k, v := range tt.want {
+				if cfg.APIKeys[k] != v {
+					t.Errorf("APIKeys[%s] = %s, want %s", k, cfg.APIKeys[k], v)
+				}
+			}
+		})
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	a := newTestAuthenticator(t, time.Now())
+	r := gin.New()
+	r.Use(Middleware(a))
+	r.GET("/me", func(c *gin.Context) { c.String(http.StatusOK, FromGin(c).ID) })
+	admin := r.Group("/admin", RequireAdmin([]string{"alice"}))
+	admin.GET("", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+
+	token := signJWT(testSecret, `{"alg":"HS256"}`, fmt.Sprintf(`{"sub":"bob","exp":%d}`, time.Now().Add(time.Hour).Unix()))
+	tests := []struct {
+		name   string
+		path   string
+		header map[string]string
+		status int
+		body   string
+	}{
+		{name: "api key header", path: "/me", header: map[string]string{"X-API-Key": "key-alice"}, status: http.StatusOK, body: "alice"},
+		{name: "bearer token", path: "/me", header: map[string]string{"Authorization": "bearer " + token}, status: http.StatusOK, body: "bob"},
+		{name: "bearer api key", path: "/me", header: map[string]string{"Authorization": "Bearer key-alice"}, status: http.StatusOK, body: "alice"},
+		{name: "basic scheme", path: "/me", header: map[string]string{"Authorization": "Basic key-alice"}, status: http.StatusUnauthorized},
+		{name: "no credentials", path: "/me", status: http.StatusUnauthorized},
+		{name: "admin", path: "/admin", header: map[string]string{"X-API-Key": "key-alice"}, status: http.StatusNoContent},
+		{name: "non-admin", path: "/admin", header: map[string]string{"Authorization": "Bearer " + token}, status: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			for k, v := range tt.header {
+				req.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d（%s）", w.Code, tt.status, w.Body)
+			}
+			if tt.body != "" && w.Body.String() != tt.body {
+				t.Errorf("body = %q, want %q", w.Body, tt.body)
+			}
+			if w.Code == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+				t.Error("401 回應缺少 WWW-Authenticate 標頭")
+			}
+		})
+	}
+
+	// 未經驗證中介層的請求沒有 Principal，RequireAdmin 一律拒絕
+	open := gin.New()
+	open.GET("/admin", RequireAdmin([]string{"alice"}), func(c *gin.Context) { c.Status(http.StatusNoContent) })
+	w := httptest.NewRecorder()
+	open.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin", nil))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("未驗證的請求 status = %d, want 403", w.Code)
+	}
+}
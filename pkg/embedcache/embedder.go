@@ -0,0 +1,283 @@
+package embedcache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"dongstudio.live/genkit_demo/pkg/retry"
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/genkit"
+	"google.golang.org/genai"
+)
+
+const provider = "embedcache"
+
+// DefaultBatchSize 為每次呼叫 embedder 的文件數上限，與 Gemini batchEmbedContents 的上限相同
+const DefaultBatchSize = 100
+
+// DefaultConcurrency 為同時進行的批次數上限
+const DefaultConcurrency = 4
+
+// RetryPolicy 為呼叫 embedder 失敗時的重試設定，每次重試的等待時間加倍並加上隨機抖動
+type RetryPolicy struct {
+	Attempts       int           // 最多嘗試次數（含第一次），預設 5
+	InitialBackoff time.Duration // 第一次重試前的等待時間，預設 1s
+	MaxBackoff     time.Duration // 等待時間上限，預設 30s
+}
+
+// Config 為 [DefineEmbedder] 的設定
+type Config struct {
+	Embedder    ai.Embedder // 實際產生 embedding 的 embedder，必填
+	Model       string      // 快取鍵中的模型名稱，預設為 Embedder.Name()；更換模型時快取自然失效
+	Store       *Store      // 快取，為 nil 時只保存在記憶體
+	BatchSize   int         // 每次呼叫 embedder 的文件數上限，預設 DefaultBatchSize
+	Concurrency int         // 同時進行的批次數上限（所有請求共用），預設 DefaultConcurrency
+	Retry       RetryPolicy
+	// Retryable 判斷錯誤是否應重試，預設為 [IsRetryable]
+	Retryable func(error) bool
+	// OnLookup 在每次查詢快取後被呼叫，可用於記錄命中率
+	OnLookup func(hits, misses int)
+}
+
+// Stats 為快取的累計統計
+type Stats struct {
+	Hits    int64 `json:"hits"`    // 快取命中的文件數
+	Misses  int64 `json:"misses"`  // 需要呼叫 embedder 的文件數
+	Entries int   `json:"entries"` // 快取的向量數
+}
+
+// HitRate 回傳命中率，沒有任何查詢時為 0
+func (s Stats) HitRate() float64 {
+	if total := s.Hits + s.Misses; total > 0 {
+		return float64(s.Hits) / float64(total)
+	}
+	return 0
+}
+
+// Cache 為帶有快取的 embedder
+type Cache struct {
+	cfg          Config
+	store        *Store
+	sem          chan struct{} // 限制同時進行的批次數
+	hits, misses atomic.Int64
+}
+
+// DefineEmbedder 以快取包裝 cfg.Embedder 並註冊為名為 embedcache/<name> 的 Embedder，
+// 用法與原本的 embedder 相同，可直接替換
+func DefineEmbedder(g *genkit.Genkit, name string, cfg Config) (*Cache, ai.Embedder, error) {
+	if cfg.Embedder == nil {
+		return nil, nil, errors.New("embedcache: 未設定 Embedder")
+	}
+	if cfg.Model == "" {
+		cfg.Model = cfg.Embedder.Name()
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = DefaultBatchSize
+	}
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = DefaultConcurrency
+	}
+	if cfg.Retryable == nil {
+		cfg.Retryable = IsRetryable
+	}
+	c := &Cache{cfg: cfg, store: cfg.Store, sem: make(chan struct{}, cfg.Concurrency)}
+	if c.store == nil {
+		store, err := Open("")
+		if err != nil {
+			return nil, nil, fmt.Errorf("embedcache: 無法建立記憶體快取: %w", err)
+		}
+		c.store = store
+	}
+	return c, genkit.DefineEmbedder(g, provider, name, c.Embed), nil
+}
+
+// Stats 回傳累計的命中數、未命中數與快取的向量數
+func (c *Cache) Stats() Stats {
+	return Stats{Hits: c.hits.Load(), Misses: c.misses.Load(), Entries: c.store.Len()}
+}
+
+// Close 關閉快取檔案
+func (c *Cache) Close() error {
+	return c.store.Close()
+}
+
+// Embed 實作 Genkit Embedder：已快取的文件直接回傳，其餘文件分批呼叫原本的 embedder 後寫入快取
+// 同一請求中內容相同的文件只會計算一次
+func (c *Cache) Embed(ctx context.Context, req *ai.EmbedRequest) (*ai.EmbedResponse, error) {
+	options, err := json.Marshal(req.Options)
+	if err != nil {
+		return nil, fmt.Errorf("embedcache: 無法序列化選項: %w", err)
+	}
+
+	resp := &ai.EmbedResponse{Embeddings: make([]*ai.Embedding, len(req.Input))}
+	positions := make(map[string][]int) // 未快取的鍵與其在 Input 中的位置
+	var (
+		keys    []string
+		pending []*ai.Document
+	)
+	for i, doc := range req.Input {
+		key, err := c.key(doc, options)
+		if err != nil {
+			return nil, err
+		}
+		if vec, ok := c.store.Get(key); ok {
+			resp.Embeddings[i] = &ai.Embedding{Embedding: vec}
+			continue
+		}
+		if _, ok := positions[key]; !ok {
+			keys = append(keys, key)
+			pending = append(pending, doc)
+		}
+		positions[key] = append(positions[key], i)
+	}
+
+	misses := 0
+	for _, p := range positions {
+		misses += len(p)
+	}
+	c.hits.Add(int64(len(req.Input) - misses))
+	c.misses.Add(int64(misses))
+	if c.cfg.OnLookup != nil {
+		c.cfg.OnLookup(len(req.Input)-misses, misses)
+	}
+	if len(pending) == 0 {
+		return resp, nil
+	}
+
+	vectors, err := c.embedBatches(ctx, pending, req.Options)
+	if err != nil {
+		return nil, err
+	}
+	fresh := make(map[string][]float32, len(keys))
+	for j, key := range keys {
+		fresh[key] = vectors[j]
+		for _, i := range positions[key] {
+			resp.Embeddings[i] = &ai.Embedding{Embedding: vectors[j]}
+		}
+	}
+	// 寫入快取失敗不影響這次的結果，只是下次需要重新計算
+	if err := c.store.Put(fresh); err != nil {
+		slog.WarnContext(ctx, "無法寫入 embedding 快取", "error", err)
+	}
+	return resp, nil
+}
+
+// key 以模型名稱、選項與文件內容（含非文字部分）的 SHA-256 作為快取鍵
+func (c *Cache) key(doc *ai.Document, options []byte) (string, error) {
+	content, err := json.Marshal(doc.Content)
+	if err != nil {
+		return "", fmt.Errorf("embedcache: 無法序列化文件: %w", err)
+	}
+	h := sha256.New()
+	h.Write([]byte(c.cfg.Model))
+	h.Write([]byte{0})
+	h.Write(options)
+	h.Write([]byte{0})
+	h.Write(content)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// embedBatches 將文件分批呼叫 embedder，同時進行的批次數不超過 Concurrency
+// 任一批次失敗時取消其餘批次並回傳錯誤
+func (c *Cache) embedBatches(ctx context.Context, docs []*ai.Document, options any) ([][]float32, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	vectors := make([][]float32, len(docs))
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+	for start := 0; start < len(docs); start += c.cfg.BatchSize {
+		end := min(start+c.cfg.BatchSize, len(docs))
+		select {
+		case c.sem <- struct{}{}:
+		case <-ctx.Done():
+			wg.Wait()
+			if firstErr != nil {
+				return nil, firstErr
+			}
+			return nil, ctx.Err()
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-c.sem }()
+			if err := c.embedBatch(ctx, docs[start:end], options, vectors[start:end]); err != nil {
+				once.Do(func() {
+					firstErr = err
+					cancel()
+				})
+			}
+		}()
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return vectors, nil
+}
+
+// embedBatch 呼叫 embedder 並將結果寫入 out，可重試的錯誤依 RetryPolicy 重試
+func (c *Cache) embedBatch(ctx context.Context, docs []*ai.Document, options any, out [][]float32) error {
+	policy := retry.Policy{
+		Attempts:       c.cfg.Retry.Attempts,
+		InitialBackoff: c.cfg.Retry.InitialBackoff,
+		MaxBackoff:     c.cfg.Retry.MaxBackoff,
+		Retryable:      c.cfg.Retryable,
+		OnRetry: func(attempt int, wait time.Duration, err error) {
+			slog.WarnContext(ctx, "產生 embedding 失敗，稍後重試", "model", c.cfg.Model, "attempt", attempt, "wait", wait, "error", err)
+		},
+	}
+	if policy.Attempts <= 0 {
+		policy.Attempts = 5
+	}
+	if policy.InitialBackoff <= 0 {
+		policy.InitialBackoff = time.Second
+	}
+	if policy.MaxBackoff <= 0 {
+		policy.MaxBackoff = 30 * time.Second
+	}
+
+	var resp *ai.EmbedResponse
+	err := retry.Do(ctx, policy, func() (err error) {
+		resp, err = c.cfg.Embedder.Embed(ctx, &ai.EmbedRequest{Input: docs, Options: options})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if len(resp.Embeddings) != len(docs) {
+		return fmt.Errorf("embedcache: %d 份文件只產生 %d 個 embedding", len(docs), len(resp.Embeddings))
+	}
+	for i, e := range resp.Embeddings {
+		out[i] = e.Embedding
+	}
+	return nil
+}
+
+// IsRetryable 判斷錯誤是否為可重試的模型 API 錯誤：429（超過速率限制）或 5xx
+func IsRetryable(err error) bool {
+	retryable := func(code int) bool {
+		return code == http.StatusTooManyRequests || code >= http.StatusInternalServerError
+	}
+	var apiErr genai.APIError
+	if errors.As(err, &apiErr) {
+		return retryable(apiErr.Code)
+	}
+	var apiErrPtr *genai.APIError
+	if errors.As(err, &apiErrPtr) {
+		return retryable(apiErrPtr.Code)
+	}
+	return false
+}
@@ -0,0 +1,164 @@
+package embedcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/genkit"
+	"google.golang.org/genai"
+)
+
+// fakeEmbedder 以文字長度產生向量，並記錄每次呼叫的文件數與同時進行的呼叫數
+type fakeEmbedder struct {
+	mu       sync.Mutex
+	calls    []int
+	active   int
+	peak     int
+	failures []error // 依序在前幾次呼叫回傳的錯誤
+	delay    time.Duration
+}
+
+func (f *fakeEmbedder) embed(ctx context.Context, req *ai.EmbedRequest) (*ai.EmbedResponse, error) {
+	f.mu.Lock()
+	f.calls = append(f.calls, len(req.Input))
+	f.active++
+	f.peak = max(f.peak, f.active)
+	var err error
+	if len(f.failures) > 0 {
+		err, f.failures = f.failures[0], f.failures[1:]
+	}
+	f.mu.Unlock()
+	defer func() {
+		f.mu.Lock()
+		f.active--
+		f.mu.Unlock()
+	}()
+	time.Sleep(f.delay)
+	if err != nil {
+		return nil, err
+	}
+	resp := &ai.EmbedResponse{}
+	for _, doc := range req.Input {
+		resp.Embeddings = append(resp.Embeddings, &ai.Embedding{Embedding: []float32{float32(len(doc.Content[0].Text))}})
+	}
+	return resp, nil
+}
+
+func newTestCache(t *testing.T, f *fakeEmbedder, cfg Config) *Cache {
+	t.Helper()
+	g, err := genkit.Init(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Embedder = genkit.DefineEmbedder(g, "test", "fake", f.embed)
+	cfg.Retry = RetryPolicy{Attempts: 3, InitialBackoff: time.Millisecond}
+	c, _, err := DefineEmbedder(g, "test", cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func embedTexts(c *Cache, texts ...string) (*ai.EmbedResponse, error) {
+	req := &ai.EmbedRequest{}
+	for _, text := range texts {
+		req.Input = append(req.Input, ai.DocumentFromText(text, nil))
+	}
+	return c.Embed(context.Background(), req)
+}
+
+func TestCacheEmbed(t *testing.T) {
+	f := &fakeEmbedder{}
+	c := newTestCache(t, f, Config{})
+
+	resp, err := embedTexts(c, "a", "bb", "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []float32{1, 2, 1} {
+		if got := resp.Embeddings[i].Embedding[0]; got != want {
+			t.Errorf("第 %d 份的 embedding = %v, want %v", i, got, want)
+		}
+	}
+	// 同一請求中重複的內容只計算一次
+	if len(f.calls) != 1 || f.calls[0] != 2 {
+		t.Errorf("呼叫 = %v, want [2]", f.calls)
+	}
+
+	if _, err := embedTexts(c, "bb", "ccc"); err != nil {
+		t.Fatal(err)
+	}
+	if len(f.calls) != 2 || f.calls[1] != 1 {
+		t.Errorf("呼叫 = %v，已快取的文件不應再計算", f.calls)
+	}
+	if s := c.Stats(); s.Hits != 1 || s.Misses != 4 || s.Entries != 3 {
+		t.Errorf("Stats() = %+v", s)
+	}
+}
+
+func TestCacheBatching(t *testing.T) {
+	f := &fakeEmbedder{delay: 10 * time.Millisecond}
+	c := newTestCache(t, f, Config{BatchSize: 2, Concurrency: 2})
+	var texts []string
+	for i := range 7 {
+		texts = append(texts, fmt.Sprintf("doc-%d", i))
+	}
+	resp, err := embedTexts(c, texts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Embeddings) != len(texts) {
+		t.Fatalf("回傳 %d 個 embedding，want %d", len(resp.Embeddings), len(texts))
+	}
+	total := 0
+	for _, n := range f.calls {
+		if n > 2 {
+			t.Errorf("批次大小 %d 超過上限", n)
+		}
+		total += n
+	}
+	if len(f.calls) != 4 || total != len(texts) {
+		t.Errorf("呼叫 = %v，預期分成 4 批", f.calls)
+	}
+	if f.peak > 2 {
+		t.Errorf("同時進行 %d 批，超過上限 2", f.peak)
+	}
+}
+
+func TestCacheRetry(t *testing.T) {
+	tooMany := genai.APIError{Code: http.StatusTooManyRequests}
+	tests := []struct {
+		name     string
+		failures []error
+		calls    int
+		wantErr  bool
+	}{
+		{name: "retry rate limit", failures: []error{tooMany, &genai.APIError{Code: http.StatusServiceUnavailable}}, calls: 3},
+		{name: "give up after attempts", failures: []error{tooMany, tooMany, tooMany}, calls: 3, wantErr: true},
+		{name: "no retry on client error", failures: []error{genai.APIError{Code: http.StatusBadRequest}}, calls: 1, wantErr: true},
+		{name: "no retry on other errors", failures: []error{errors.New("invalid input")}, calls: 1, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &fakeEmbedder{failures: tt.failures}
+			c := newTestCache(t, f, Config{})
+			_, err := embedTexts(c, "a")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Embed() error = %v", err)
+			}
+			if len(f.calls) != tt.calls {
+				t.Errorf("呼叫 %d 次，want %d", len(f.calls), tt.calls)
+			}
+			// 失敗的結果不寫入快取
+			if tt.wantErr && c.Stats().Entries != 0 {
+				t.Error("失敗後快取了 embedding")
+			}
+		})
+	}
+}
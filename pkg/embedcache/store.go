@@ -0,0 +1,175 @@
+// Package embedcache 快取 embedding，避免相同內容重複呼叫 embedding 模型
+//
+// [DefineEmbedder] 包裝既有的 ai.Embedder：以模型名稱、embedder 選項與文件內容的雜湊為鍵查詢 [Store]，
+// 只有未快取的文件才會呼叫原本的 embedder；未快取的文件依模型上限分批，並限制同時進行的批次數，
+// 遇到 429 或 5xx 錯誤時以指數退避重試
+//
+// [Store] 將 embedding 保存在記憶體，並附加寫入磁碟檔案，重新啟動後不需重新計算
+package embedcache
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// fileMagic 為快取檔案的開頭，用於辨識格式與版本
+const fileMagic = "EMBCACHE1\n"
+
+// Store 為 embedding 快取，資料保存在記憶體並附加寫入磁碟檔案
+//
+// 檔案由 fileMagic 開頭，之後每筆紀錄依序為：鍵長度（uint32）、鍵、維度（uint32）、向量（float32），皆為 little endian；
+// 寫入中斷造成的不完整紀錄會在開啟時截斷
+type Store struct {
+	mu      sync.RWMutex
+	entries map[string][]float32
+	file    *os.File // 為 nil 時只保存在記憶體
+}
+
+// Open 開啟快取檔案並載入所有紀錄，檔案不存在時建立新檔；path 為空字串時只保存在記憶體
+func Open(path string) (*Store, error) {
+	s := &Store{entries: make(map[string][]float32)}
+	if path == "" {
+		return s, nil
+	}
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, err
+		}
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.load(f); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("無法讀取 embedding 快取 %s: %w", path, err)
+	}
+	s.file = f
+	return s, nil
+}
+
+// load 讀取所有完整的紀錄，並截斷結尾不完整的紀錄
+func (s *Store) load(f *os.File) error {
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() == 0 {
+		_, err := f.WriteString(fileMagic)
+		return err
+	}
+
+	r := bufio.NewReader(f)
+	magic := make([]byte, len(fileMagic))
+	if _, err := io.ReadFull(r, magic); err != nil || string(magic) != fileMagic {
+		return errors.New("不是 embedding 快取檔案")
+	}
+	offset := int64(len(fileMagic))
+	for {
+		key, vec, n, err := readRecord(r)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// 最後一筆紀錄不完整（例如寫入時程式中斷），截斷後從該位置繼續寫入
+			if err := f.Truncate(offset); err != nil {
+				return err
+			}
+			break
+		}
+		s.entries[key] = vec
+		offset += n
+	}
+	_, err = f.Seek(offset, io.SeekStart)
+	return err
+}
+
+// readRecord 讀取一筆紀錄並回傳其長度（byte），檔案剛好結束時回傳 io.EOF
+func readRecord(r io.Reader) (string, []float32, int64, error) {
+	var keyLen uint32
+	if err := binary.Read(r, binary.LittleEndian, &keyLen); err != nil {
+		if err == io.EOF {
+			return "", nil, 0, io.EOF
+		}
+		return "", nil, 0, io.ErrUnexpectedEOF
+	}
+	key := make([]byte, keyLen)
+	if _, err := io.ReadFull(r, key); err != nil {
+		return "", nil, 0, io.ErrUnexpectedEOF
+	}
+	var dim uint32
+	if err := binary.Read(r, binary.LittleEndian, &dim); err != nil {
+		return "", nil, 0, io.ErrUnexpectedEOF
+	}
+	buf := make([]byte, 4*int(dim))
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return "", nil, 0, io.ErrUnexpectedEOF
+	}
+	vec := make([]float32, dim)
+	for i := range vec {
+		vec[i] = math.Float32frombits(binary.LittleEndian.Uint32(buf[4*i:]))
+	}
+	return string(key), vec, int64(8 + len(key) + len(buf)), nil
+}
+
+// Get 回傳鍵對應的向量
+func (s *Store) Get(key string) ([]float32, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	vec, ok := s.entries[key]
+	return vec, ok
+}
+
+// Put 保存向量並附加寫入檔案，已存在的鍵不會重複寫入
+// 寫入檔案失敗時記憶體中的資料仍會保留
+func (s *Store) Put(entries map[string][]float32) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var buf []byte
+	for key, vec := range entries {
+		if _, ok := s.entries[key]; ok {
+			continue
+		}
+		s.entries[key] = vec
+		if s.file == nil {
+			continue
+		}
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(len(key)))
+		buf = append(buf, key...)
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(len(vec)))
+		for _, v := range vec {
+			buf = binary.LittleEndian.AppendUint32(buf, math.Float32bits(v))
+		}
+	}
+	if len(buf) == 0 {
+		return nil
+	}
+	_, err := s.file.Write(buf)
+	return err
+}
+
+// Len 回傳快取的向量數
+func (s *Store) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.entries)
+}
+
+// Close 關閉快取檔案
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
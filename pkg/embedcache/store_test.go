@@ -0,0 +1,140 @@
+package embedcache
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// writeStore 建立含有 entries 的快取檔案並回傳其大小
+func writeStore(t *testing.T, path string, entries map[string][]float32) int64 {
+	t.Helper()
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put(entries); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info.Size()
+}
+
+func TestStorePersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache", "embeddings.bin")
+	writeStore(t, path, map[string][]float32{"a": {1, 2, 3}, "b": {-0.5}})
+
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if s.Len() != 2 {
+		t.Fatalf("Len() = %d, want 2", s.Len())
+	}
+	if vec, ok := s.Get("a"); !ok || !slices.Equal(vec, []float32{1, 2, 3}) {
+		t.Errorf("Get(a) = %v, %v", vec, ok)
+	}
+
+	// 已存在的鍵不重複寫入，新的鍵附加在檔案結尾
+	if err := s.Put(map[string][]float32{"a": {9}, "c": {4, 5}}); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	if vec, _ := reopened.Get("a"); !slices.Equal(vec, []float32{1, 2, 3}) {
+		t.Errorf("Get(a) = %v，已存在的鍵被覆寫", vec)
+	}
+	if vec, ok := reopened.Get("c"); !ok || !slices.Equal(vec, []float32{4, 5}) {
+		t.Errorf("Get(c) = %v, %v", vec, ok)
+	}
+}
+
+func TestStoreTruncatesPartialRecord(t *testing.T) {
+	// 紀錄 "b" 為 4+1+4+8 = 17 byte（鍵長度、鍵、維度、向量），截斷在第二筆紀錄的各個欄位中
+	dir := t.TempDir()
+	tests := []struct {
+		name string
+		cut  int64 // 從完整檔案結尾移除的 byte 數
+	}{
+		{"inside vector", 3},
+		{"inside dimension", 9},
+		{"missing key", 13},
+		{"inside key length", 15},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.name+".bin")
+			first := writeStore(t, path, map[string][]float32{"a": {1, 2}})
+			size := writeStore(t, path, map[string][]float32{"b": {3, 4}})
+			if err := os.Truncate(path, size-tt.cut); err != nil {
+				t.Fatal(err)
+			}
+
+			s, err := Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := s.Get("b"); ok || s.Len() != 1 {
+				t.Errorf("不完整的紀錄被載入: Len() = %d", s.Len())
+			}
+			if info, _ := os.Stat(path); info.Size() != first {
+				t.Errorf("檔案大小 = %d，預期截斷為 %d", info.Size(), first)
+			}
+
+			// 截斷後繼續寫入，重新開啟時所有紀錄皆完整
+			if err := s.Put(map[string][]float32{"b": {3, 4}}); err != nil {
+				t.Fatal(err)
+			}
+			s.Close()
+			recovered, err := Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer recovered.Close()
+			if vec, ok := recovered.Get("b"); recovered.Len() != 2 || !ok || !slices.Equal(vec, []float32{3, 4}) {
+				t.Errorf("恢復後 Len() = %d, Get(b) = %v", recovered.Len(), vec)
+			}
+		})
+	}
+}
+
+func TestStoreRejectsOtherFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notes.txt")
+	if err := os.WriteFile(path, []byte("not an embedding cache"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(path); err == nil {
+		t.Fatal("Open() 應拒絕格式不符的檔案")
+	}
+	if data, _ := os.ReadFile(path); string(data) != "not an embedding cache" {
+		t.Errorf("格式不符的檔案被修改: %q", data)
+	}
+}
+
+func TestStoreMemoryOnly(t *testing.T) {
+	s, err := Open("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put(map[string][]float32{"a": {1}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.Get("a"); !ok || s.Len() != 1 {
+		t.Error("記憶體快取未保存向量")
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,174 @@
+// Package grounding 檢查回答是否有檢索到的資料作為依據
+//
+// [Verifier] 將回答切分成句子，以 Genkit 模型的結構化輸出逐句判斷是否受上下文支持，
+// [Check] 依 [Policy] 標記或移除沒有依據的句子
+package grounding
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"dongstudio.live/genkit_demo/pkg/ingest"
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/genkit"
+)
+
+// Policy 為沒有依據的句子的處理方式
+type Policy string
+
+const (
+	PolicyOff   Policy = "off"   // 不檢查
+	PolicyFlag  Policy = "flag"  // 保留句子，在結果中列出
+	PolicyStrip Policy = "strip" // 從回答中移除句子
+)
+
+// ParsePolicy 解析處理方式，空字串為 off：檢查需要額外一次模型呼叫，需明確啟用
+func ParsePolicy(s string) (Policy, error) {
+	switch p := Policy(s); p {
+	case "":
+		return PolicyOff, nil
+	case PolicyOff, PolicyFlag, PolicyStrip:
+		return p, nil
+	default:
+		return "", fmt.Errorf("不支援的 grounding 政策: %s", s)
+	}
+}
+
+// Claim 為沒有依據的句子
+type Claim struct {
+	Sentence string `json:"sentence"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// Result 為檢查結果
+type Result struct {
+	Answer      string  `json:"answer"`                // 依政策處理後的回答
+	Grounded    bool    `json:"grounded"`              // 所有句子皆有依據
+	Unsupported []Claim `json:"unsupported,omitempty"` // 沒有依據的句子
+	Stripped    bool    `json:"stripped,omitempty"`    // 是否已移除沒有依據的句子
+}
+
+// Verifier 以模型逐句判斷回答是否受上下文支持
+type Verifier struct {
+	Genkit     *genkit.Genkit
+	Model      string               // 模型名稱；空字串使用預設模型
+	Middleware []ai.ModelMiddleware // 套用在檢查呼叫上的 middleware
+	// OnUsage 在每次檢查呼叫後被呼叫，可用於記錄用量與費用
+	OnUsage func(ctx context.Context, usage *ai.GenerationUsage)
+}
+
+// verdicts 為模型的結構化輸出
+type verdicts struct {
+	Sentences []struct {
+		Index     int    `json:"index"`            // 句子編號，從 0 開始
+		Supported bool   `json:"supported"`        // 句子的內容是否能由上下文推得
+		Reason    string `json:"reason,omitempty"` // 不受支持時說明缺少的依據
+	} `json:"sentences"`
+}
+
+// Verify 判斷每個句子是否受 contextText 支持，回傳與 sentences 一一對應的結果與原因
+// 模型漏掉的句子視為沒有依據
+func (v *Verifier) Verify(ctx context.Context, contextText string, sentences []string) ([]bool, []string, error) {
+	var sb strings.Builder
+	sb.WriteString("上下文:\n")
+	sb.WriteString(contextText)
+	sb.WriteString("\n\n待檢查的句子:\n")
+	for i, s := range sentences {
+		fmt.Fprintf(&sb, "(%d) %s\n", i, s)
+	}
+
+	opts := []ai.GenerateOption{
+		ai.WithSystem("你是事實查核員。逐句判斷回答中的句子是否能由上下文直接推得：" +
+			"上下文有明確依據時 supported 為 true；上下文沒有提到、與上下文矛盾或加入了上下文以外的細節時為 false，並簡短說明原因。" +
+			"沒有事實內容的句子（例如問候、轉折語或表示無法回答）視為 true。句尾的 [n] 為引用標記，判斷時忽略。" +
+			"每個句子都必須給出結果，index 為句子前方括號中的編號。"),
+		ai.WithPrompt(sb.String()),
+		ai.WithOutputType(verdicts{}),
+	}
+	if v.Model != "" {
+		opts = append(opts, ai.WithModelName(v.Model))
+	}
+	if len(v.Middleware) > 0 {
+		opts = append(opts, ai.WithMiddleware(v.Middleware...))
+	}
+
+	resp, err := genkit.Generate(ctx, v.Genkit, opts...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("grounding 檢查失敗: %w", err)
+	}
+	if v.OnUsage != nil {
+		v.OnUsage(ctx, resp.Usage)
+	}
+	var out verdicts
+	if err := resp.Output(&out); err != nil {
+		return nil, nil, fmt.Errorf("無法解析 grounding 檢查結果: %w", err)
+	}
+
+	supported := make([]bool, len(sentences))
+	reasons := make([]string, len(sentences))
+	for i := range reasons {
+		reasons[i] = "檢查結果缺少此句"
+	}
+	for _, s := range out.Sentences {
+		if s.Index >= 0 && s.Index < len(sentences) {
+			supported[s.Index] = s.Supported
+			reasons[s.Index] = s.Reason
+		}
+	}
+	return supported, reasons, nil
+}
+
+// Check 將回答切分成句子並以 verifier 檢查，依 policy 標記或移除沒有依據的句子
+// policy 為 PolicyOff 時不檢查，直接回傳 Grounded 為 true 的結果
+func Check(ctx context.Context, v *Verifier, policy Policy, contextText, answer string) (*Result, error) {
+	result := &Result{Answer: answer, Grounded: true}
+	sentences := ingest.SplitSentences(answer)
+	if policy == PolicyOff || len(sentences) == 0 {
+		return result, nil
+	}
+
+	supported, reasons, err := v.Verify(ctx, contextText, sentences)
+	if err != nil {
+		return nil, err
+	}
+	for i, ok := range supported {
+		if !ok {
+			result.Grounded = false
+			result.Unsupported = append(result.Unsupported, Claim{Sentence: sentences[i], Reason: reasons[i]})
+		}
+	}
+	if policy == PolicyStrip && !result.Grounded {
+		result.Answer, result.Stripped = strip(answer, sentences, supported)
+	}
+	return result, nil
+}
+
+// strip 從回答中移除沒有依據的句子，回傳處理後的回答與是否有句子被移除
+// 句子依序在回答中定位，不會誤刪其他句子中相同的文字；找不到的句子保留在回答中
+func strip(answer string, sentences []string, supported []bool) (string, bool) {
+	var (
+		sb       strings.Builder
+		cursor   int
+		stripped bool
+	)
+	for i, s := range sentences {
+		j := strings.Index(answer[cursor:], s)
+		if j < 0 {
+			continue
+		}
+		start := cursor + j
+		sb.WriteString(answer[cursor:start])
+		if supported[i] {
+			sb.WriteString(s)
+		} else {
+			stripped = true
+		}
+		cursor = start + len(s)
+	}
+	if !stripped {
+		return answer, false
+	}
+	sb.WriteString(answer[cursor:])
+	return strings.TrimSpace(sb.String()), true
+}
@@ -0,0 +1,232 @@
+package grounding
+
+import (
+	"context"
+	"encoding/json"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"dongstudio.live/genkit_demo/pkg/hybrid"
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/genkit"
+)
+
+// sentenceLine 比對提示詞中的 "(n) 句子"
+var sentenceLine = regexp.MustCompile(`(?m)^\((\d+)\) (.*)$`)
+
+// citation 比對句尾的 [n] 引用標記
+var citation = regexp.MustCompile(`\[\d+\]`)
+
+// defineFakeVerifier 註冊離線的查核模型：句子的詞（中日韓文字為 bigram，見 hybrid.Tokenize）
+// 全部出現在上下文中時視為有依據；含有「漏掉」的句子不回傳結果，並多回傳一個超出範圍的編號
+func defineFakeVerifier(g *genkit.Genkit) string {
+	genkit.DefineModel(g, "test", "verifier", &ai.ModelInfo{
+		Supports: &ai.ModelSupports{Multiturn: true, SystemRole: true},
+	}, func(_ context.Context, req *ai.ModelRequest, _ ai.ModelStreamCallback) (*ai.ModelResponse, error) {
+		var sb strings.Builder
+		for _, m := range req.Messages {
+			if m.Role != ai.RoleUser {
+				continue
+			}
+			for _, p := range m.Content {
+				if p.Metadata["purpose"] != "output" {
+					sb.WriteString(p.Text)
+				}
+			}
+		}
+		prompt := sb.String()
+		contextText, _, _ := strings.Cut(strings.TrimPrefix(prompt, "上下文:\n"), "\n\n待檢查的句子:\n")
+		known := make(map[string]bool)
+		for _, t := range hybrid.Tokenize(contextText) {
+			known[t] = true
+		}
+
+		type verdict struct {
+			Index     int    `json:"index"`
+			Supported bool   `json:"supported"`
+			Reason    string `json:"reason,omitempty"`
+		}
+		out := struct {
+			Sentences []verdict `json:"sentences"`
+		}{Sentences: []verdict{{Index: 99, Supported: true}}}
+		for _, m := range sentenceLine.FindAllStringSubmatch(prompt, -1) {
+			if strings.Contains(m[2], "漏掉") {
+				continue
+			}
+			i, _ := strconv.Atoi(m[1])
+			v := verdict{Index: i, Supported: true}
+			for _, t := range hybrid.Tokenize(citation.ReplaceAllString(m[2], "")) {
+				if !known[t] {
+					v.Supported, v.Reason = false, "上下文沒有提到「"+t+"」"
+					break
+				}
+			}
+			out.Sentences = append(out.Sentences, v)
+		}
+		b, err := json.Marshal(out)
+		if err != nil {
+			return nil, err
+		}
+		return &ai.ModelResponse{Request: req, Message: ai.NewModelTextMessage(string(b)), FinishReason: ai.FinishReasonStop}, nil
+	})
+	return "test/verifier"
+}
+
+func newTestVerifier(t *testing.T) (*Verifier, *int) {
+	t.Helper()
+	g, err := genkit.Init(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	calls := new(int)
+	return &Verifier{
+		Genkit:  g,
+		Model:   defineFakeVerifier(g),
+		OnUsage: func(context.Context, *ai.GenerationUsage) { *calls++ },
+	}, calls
+}
+
+const testContext = "[1] 台灣有小籠包與牛肉麵，也有夜市小吃。"
+
+func TestParsePolicy(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Policy
+		wantErr bool
+	}{
+		{"", PolicyOff, false},
+		{"off", PolicyOff, false},
+		{"flag", PolicyFlag, false},
+		{"strip", PolicyStrip, false},
+		{"block", "", true},
+	}
+	for _, tt := range tests {
+		got, err := ParsePolicy(tt.in)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("ParsePolicy(%q) = %q, %v", tt.in, got, err)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	v, calls := newTestVerifier(t)
+	tests := []struct {
+		name        string
+		policy      Policy
+		answer      string
+		want        string
+		grounded    bool
+		unsupported []string
+		stripped    bool
+		calls       int // 預期的模型呼叫次數
+	}{
+		{
+			name:     "off",
+			policy:   PolicyOff,
+			answer:   "披薩來自義大利。",
+			want:     "披薩來自義大利。",
+			grounded: true,
+		},
+		{
+			name:     "grounded",
+			policy:   PolicyStrip,
+			answer:   "台灣有小籠包 [1]。也有夜市小吃 [1]。",
+			want:     "台灣有小籠包 [1]。也有夜市小吃 [1]。",
+			grounded: true,
+			calls:    1,
+		},
+		{
+			name:        "flag keeps sentences",
+			policy:      PolicyFlag,
+			answer:      "台灣有小籠包 [1]。披薩來自義大利。",
+			want:        "台灣有小籠包 [1]。披薩來自義大利。",
+			unsupported: []string{"披薩來自義大利。"},
+			calls:       1,
+		},
+		{
+			name:        "strip removes sentences",
+			policy:      PolicyStrip,
+			answer:      "披薩來自義大利。 台灣有小籠包 [1]。",
+			want:        "台灣有小籠包 [1]。",
+			unsupported: []string{"披薩來自義大利。"},
+			stripped:    true,
+			calls:       1,
+		},
+		{
+			// 沒有依據的句子同時出現在其他句子中時，只移除該句本身
+			name:        "strip repeated text",
+			policy:      PolicyStrip,
+			answer:      "台灣有小籠包與牛肉麵。牛肉麵來自火星。來自火星。",
+			want:        "台灣有小籠包與牛肉麵。",
+			unsupported: []string{"牛肉麵來自火星。", "來自火星。"},
+			stripped:    true,
+			calls:       1,
+		},
+		{
+			name:        "missing verdict is unsupported",
+			policy:      PolicyFlag,
+			answer:      "台灣有小籠包。這句漏掉了。",
+			want:        "台灣有小籠包。這句漏掉了。",
+			unsupported: []string{"這句漏掉了。"},
+			calls:       1,
+		},
+		{
+			name:     "empty answer",
+			policy:   PolicyStrip,
+			answer:   "  ",
+			want:     "  ",
+			grounded: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := *calls
+			result, err := Check(context.Background(), v, tt.policy, testContext, tt.answer)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Answer != tt.want || result.Grounded != tt.grounded || result.Stripped != tt.stripped {
+				t.Errorf("Check() = %+v, want answer %q grounded %v stripped %v", result, tt.want, tt.grounded, tt.stripped)
+			}
+			var got []string
+			for _, c := range result.Unsupported {
+				got = append(got, c.Sentence)
+				if c.Reason == "" {
+					t.Errorf("%q 沒有原因", c.Sentence)
+				}
+			}
+			if !slices.Equal(got, tt.unsupported) {
+				t.Errorf("Unsupported = %q, want %q", got, tt.unsupported)
+			}
+			if n := *calls - before; n != tt.calls {
+				t.Errorf("模型呼叫 %d 次，want %d", n, tt.calls)
+			}
+		})
+	}
+}
+
+func TestStrip(t *testing.T) {
+	// 找不到的句子保留在回答中，沒有句子被移除時 Stripped 為 false
+	answer, stripped := strip("台灣有小籠包。", []string{"不在回答中。"}, []bool{false})
+	if answer != "台灣有小籠包。" || stripped {
+		t.Errorf("strip() = %q, %v", answer, stripped)
+	}
+}
+
+func TestVerifyInvalidOutput(t *testing.T) {
+	g, err := genkit.Init(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	genkit.DefineModel(g, "test", "broken", &ai.ModelInfo{Supports: &ai.ModelSupports{SystemRole: true}},
+		func(_ context.Context, req *ai.ModelRequest, _ ai.ModelStreamCallback) (*ai.ModelResponse, error) {
+			return &ai.ModelResponse{Request: req, Message: ai.NewModelTextMessage("無法判斷"), FinishReason: ai.FinishReasonStop}, nil
+		})
+	v := &Verifier{Genkit: g, Model: "test/broken"}
+	if _, err := Check(context.Background(), v, PolicyFlag, testContext, "台灣有小籠包。"); err == nil {
+		t.Error("無法解析的檢查結果應回傳錯誤")
+	}
+}
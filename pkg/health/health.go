@@ -0,0 +1,225 @@
+// Package health 提供 HTTP 服務共用的存活、就緒與版本資訊端點
+//
+//	GET /healthz  程序存活即回應 200
+//	GET /readyz   所有就緒檢查通過才回應 200，否則回應 503 並列出失敗原因
+//	GET /version  由 runtime/debug 讀取的建置資訊
+package health
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Check 為一個就緒檢查，回傳 nil 表示就緒
+type Check func(ctx context.Context) error
+
+// Health 管理就緒檢查
+type Health struct {
+	mu     sync.RWMutex
+	checks map[string]Check
+}
+
+// New 建立沒有任何檢查的 Health
+func New() *Health {
+	return &Health{checks: make(map[string]Check)}
+}
+
+// Register 註冊一個具名的就緒檢查
+func (h *Health) Register(name string, check Check) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.checks[name] = check
+}
+
+// Flag 為一次性的就緒狀態，例如啟動時的索引是否完成
+type Flag struct {
+	ready  atomic.Bool
+	reason atomic.Value // string
+}
+
+// NewFlag 建立尚未就緒的 Flag，reason 為未就緒時回報的原因
+func NewFlag(reason string) *Flag {
+	f := &Flag{}
+	f.reason.Store(reason)
+	return f
+}
+
+// SetReady 標記為已就緒
+func (f *Flag) SetReady() {
+	f.ready.Store(true)
+}
+
+// SetNotReady 標記為未就緒並更新原因
+func (f *Flag) SetNotReady(reason string) {
+	f.reason.Store(reason)
+	f.ready.Store(false)
+}
+
+// Check 回傳對應此 Flag 的就緒檢查
+func (f *Flag) Check() Check {
+	return func(context.Context) error {
+		if f.ready.Load() {
+			return nil
+		}
+		return errors.New(f.reason.Load().(string))
+	}
+}
+
+// TCPCheck 回傳以 TCP 連線確認外部服務（例如模型供應商）可連線的檢查
+func TCPCheck(addr string) Check {
+	return func(ctx context.Context) error {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+}
+
+// Cached 將檢查結果快取 ttl 時間，避免每次 /readyz 都連線到外部服務
+func Cached(check Check, ttl time.Duration) Check {
+	var (
+		mu      sync.Mutex
+		last    time.Time
+		lastErr error
+	)
+	return func(ctx context.Context) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if !last.IsZero() && time.Since(last) < ttl {
+			return lastErr
+		}
+		lastErr = check(ctx)
+		last = time.Now()
+		return lastErr
+	}
+}
+
+// CheckResult 為單一檢查的結果
+type CheckResult struct {
+	Name  string `json:"name"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// Ready 並行執行所有就緒檢查，回傳是否全部通過與個別結果
+func (h *Health) Ready(ctx context.Context) (bool, []CheckResult) {
+	h.mu.RLock()
+	checks := make(map[string]Check, len(h.checks))
+	for name, c := range h.checks {
+		checks[name] = c
+	}
+	h.mu.RUnlock()
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		results = make([]CheckResult, 0, len(checks))
+		ready   = true
+	)
+	for name, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r := CheckResult{Name: name, OK: true}
+			if err := check(ctx); err != nil {
+				r.OK = false
+				r.Error = err.Error()
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			results = append(results, r)
+			ready = ready && r.OK
+		}()
+	}
+	wg.Wait()
+
+	sort.Slice(results, func(i, j int) bool { return results[i].Name < results[j].Name })
+	return ready, results
+}
+
+// RegisterRoutes 註冊 /healthz、/readyz 與 /version，這些端點不需驗證
+func RegisterRoutes(r gin.IRouter, h *Health) {
+	r.GET("/healthz", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	})
+
+	r.GET("/readyz", func(c *gin.Context) {
+		ready, results := h.Ready(c.Request.Context())
+		status := http.StatusOK
+		if !ready {
+			status = http.StatusServiceUnavailable
+		}
+		c.JSON(status, gin.H{
+			"ready":  ready,
+			"checks": results,
+		})
+	})
+
+	r.GET("/version", func(c *gin.Context) {
+		c.JSON(http.StatusOK, BuildInfo())
+	})
+}
+
+// Info 為程式的建置資訊
+type Info struct {
+	Path         string            `json:"path"`
+	Version      string            `json:"version"`
+	GoVersion    string            `json:"go_version"`
+	Revision     string            `json:"revision,omitempty"`
+	CommitTime   string            `json:"commit_time,omitempty"`
+	Modified     bool              `json:"modified,omitempty"`
+	Dependencies map[string]string `json:"dependencies,omitempty"`
+}
+
+// BuildInfo 從 runtime/debug 讀取建置資訊，包含 VCS 版本與主要相依套件版本
+func BuildInfo() Info {
+	info := Info{GoVersion: runtime.Version()}
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+
+	info.Path = bi.Path
+	info.Version = bi.Main.Version
+	for _, s := range bi.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			info.Revision = s.Value
+		case "vcs.time":
+			info.CommitTime = s.Value
+		case "vcs.modified":
+			info.Modified = s.Value == "true"
+		}
+	}
+
+	// 只列出與模型呼叫及 HTTP 服務相關的套件
+	tracked := map[string]bool{
+		"github.com/firebase/genkit/go": true,
+		"github.com/gin-gonic/gin":      true,
+		"google.golang.org/genai":       true,
+	}
+	for _, dep := range bi.Deps {
+		if tracked[dep.Path] {
+			if info.Dependencies == nil {
+				info.Dependencies = make(map[string]string)
+			}
+			info.Dependencies[dep.Path] = dep.Version
+		}
+	}
+	return info
+}
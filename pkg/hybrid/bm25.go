@@ -0,0 +1,249 @@
+package hybrid
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"sync"
+
+	"dongstudio.live/genkit_demo/pkg/vectorstore"
+	"github.com/firebase/genkit/go/ai"
+)
+
+// BM25 參數
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// Entry 為關鍵字索引中的一份文檔
+type Entry struct {
+	ID       string         `json:"id"`
+	Content  string         `json:"content"`
+	Metadata map[string]any `json:"metadata,omitempty"`
+
+	terms map[string]int // 詞頻
+	size  int            // 詞數
+}
+
+// Result 為關鍵字搜尋結果
+type Result struct {
+	Entry *Entry
+	Score float64
+}
+
+// Index 為 BM25 關鍵字索引，文檔保存為 JSON 檔，載入時重建倒排索引
+// 所有方法皆可同時呼叫
+type Index struct {
+	path string
+
+	mu        sync.RWMutex
+	entries   map[string]*Entry
+	postings  map[string]map[string]int // 詞 -> 文檔 ID -> 詞頻
+	totalSize int
+}
+
+// OpenIndex 開啟關鍵字索引，檔案不存在時建立空的索引；path 為空字串時只保存在記憶體
+func OpenIndex(path string) (*Index, error) {
+	idx := &Index{
+		path:     path,
+		entries:  make(map[string]*Entry),
+		postings: make(map[string]map[string]int),
+	}
+	if path == "" {
+		return idx, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return idx, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries []*Entry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("解析關鍵字索引 %s 失敗: %w", path, err)
+	}
+	for _, e := range entries {
+		idx.put(e)
+	}
+	return idx, nil
+}
+
+// Len 回傳文檔數
+func (idx *Index) Len() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return len(idx.entries)
+}
+
+// Has 判斷文檔是否已在索引中
+func (idx *Index) Has(id string) bool {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	_, ok := idx.entries[id]
+	return ok
+}
+
+// IDs 回傳依序排列的所有文檔 ID
+func (idx *Index) IDs() []string {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return slices.Sorted(maps.Keys(idx.entries))
+}
+
+// Add 加入文檔並寫回檔案，已存在相同 ID 的文檔會被覆寫
+// 文檔 ID 取自 metadata 的 "id"，沒有時以內容的 MD5 作為 ID（與向量資料庫相同）
+func (idx *Index) Add(docs ...*ai.Document) error {
+	if len(docs) == 0 {
+		return nil
+	}
+	entries := make([]*Entry, 0, len(docs))
+	for _, doc := range docs {
+		id := vectorstore.DocID(doc)
+		entries = append(entries, &Entry{ID: id, Content: vectorstore.DocText(doc), Metadata: maps.Clone(doc.Metadata)})
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	for _, e := range entries {
+		idx.remove(e.ID)
+		idx.put(e)
+	}
+	return idx.save()
+}
+
+// Delete 依 ID 刪除文檔並寫回檔案，不存在的 ID 會被略過
+func (idx *Index) Delete(ids ...string) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	removed := false
+	for _, id := range ids {
+		removed = idx.remove(id) || removed
+	}
+	if !removed {
+		return nil
+	}
+	return idx.save()
+}
+
+// Search 回傳 BM25 分數最高的 k 份文檔，只包含至少有一個詞符合的文檔
+// filter 不為 nil 時只回傳 filter 回傳 true 的文檔
+func (idx *Index) Search(query string, k int, filter func(*Entry) bool) []Result {
+	terms := Tokenize(query)
+	if len(terms) == 0 || k <= 0 {
+		return nil
+	}
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	n := float64(len(idx.entries))
+	if n == 0 {
+		return nil
+	}
+	avgSize := float64(idx.totalSize) / n
+
+	scores := make(map[string]float64)
+	for _, term := range terms {
+		posting := idx.postings[term]
+		if len(posting) == 0 {
+			continue
+		}
+		df := float64(len(posting))
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+		for id, tf := range posting {
+			e := idx.entries[id]
+			f := float64(tf)
+			scores[id] += idf * f * (bm25K1 + 1) / (f + bm25K1*(1-bm25B+bm25B*float64(e.size)/avgSize))
+		}
+	}
+
+	results := make([]Result, 0, len(scores))
+	for id, score := range scores {
+		e := idx.entries[id]
+		if filter != nil && !filter(e) {
+			continue
+		}
+		results = append(results, Result{Entry: e, Score: score})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Entry.ID < results[j].Entry.ID
+	})
+	if len(results) > k {
+		results = results[:k]
+	}
+	return results
+}
+
+// put 加入文檔並更新倒排索引（呼叫者需持有寫入鎖）
+func (idx *Index) put(e *Entry) {
+	e.terms = make(map[string]int)
+	for _, term := range Tokenize(e.Content) {
+		e.terms[term]++
+		e.size++
+	}
+	for term, tf := range e.terms {
+		posting := idx.postings[term]
+		if posting == nil {
+			posting = make(map[string]int)
+			idx.postings[term] = posting
+		}
+		posting[e.ID] = tf
+	}
+	idx.entries[e.ID] = e
+	idx.totalSize += e.size
+}
+
+// remove 移除文檔並更新倒排索引，回傳文檔是否存在（呼叫者需持有寫入鎖）
+func (idx *Index) remove(id string) bool {
+	e, ok := idx.entries[id]
+	if !ok {
+		return false
+	}
+	for term := range e.terms {
+		delete(idx.postings[term], id)
+		if len(idx.postings[term]) == 0 {
+			delete(idx.postings, term)
+		}
+	}
+	delete(idx.entries, id)
+	idx.totalSize -= e.size
+	return true
+}
+
+// save 將文檔寫回檔案，先寫入暫存檔再改名，避免中斷時損壞（呼叫者需持有鎖）
+func (idx *Index) save() error {
+	if idx.path == "" {
+		return nil
+	}
+	if dir := filepath.Dir(idx.path); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+	}
+
+	entries := make([]*Entry, 0, len(idx.entries))
+	for _, id := range slices.Sorted(maps.Keys(idx.entries)) {
+		entries = append(entries, idx.entries[id])
+	}
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	tmp := idx.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, idx.path)
+}
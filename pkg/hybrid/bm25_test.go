@@ -0,0 +1,126 @@
+package hybrid
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"dongstudio.live/genkit_demo/pkg/vectorstore"
+	"github.com/firebase/genkit/go/ai"
+)
+
+func testDoc(id, text string, metadata map[string]any) *ai.Document {
+	md := map[string]any{"id": id}
+	for k, v := range metadata {
+		md[k] = v
+	}
+	return ai.DocumentFromText(text, md)
+}
+
+func resultIDs(results []Result) []string {
+	ids := make([]string, len(results))
+	for i, r := range results {
+		ids[i] = r.Entry.ID
+	}
+	return ids
+}
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"Hello, World", []string{"hello", "world"}},
+		{"Ａ１７ chip", []string{"a17", "chip"}},
+		{"台積電", []string{"台積", "積電"}},
+		{"晶片 A17", []string{"晶片", "a17"}},
+		{"我", []string{"我"}},
+		{"  ,. ", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			if got := Tokenize(tt.text); !slices.Equal(got, tt.want) {
+				t.Errorf("Tokenize(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIndexSearch(t *testing.T) {
+	idx, err := OpenIndex("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = idx.Add(
+		testDoc("tsmc", "台積電公布第三季財報，營收創新高", map[string]any{"category": "財經"}),
+		testDoc("apple", "Apple 發表 A17 晶片，效能提升", map[string]any{"category": "科技"}),
+		testDoc("chip", "晶片產業需求回溫，台積電與其他晶圓廠受惠", map[string]any{"category": "財經"}),
+		testDoc("food", "台南的牛肉湯與虱目魚粥", map[string]any{"category": "食物"}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		query  string
+		k      int
+		filter map[string]any
+		want   []string
+	}{
+		{name: "proper noun", query: "台積電", k: 5, want: []string{"tsmc", "chip"}},
+		{name: "code", query: "a17", k: 5, want: []string{"apple"}},
+		{name: "limit", query: "台積電", k: 1, want: []string{"tsmc"}},
+		{name: "filter", query: "晶片", k: 5, filter: map[string]any{"category": "財經"}, want: []string{"chip"}},
+		{name: "no match", query: "披薩", k: 5, want: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var filter func(*Entry) bool
+			if tt.filter != nil {
+				f, err := vectorstore.ParseFilter(tt.filter)
+				if err != nil {
+					t.Fatal(err)
+				}
+				filter = func(e *Entry) bool { return f.Match(e.Metadata) }
+			}
+			results := idx.Search(tt.query, tt.k, filter)
+			if got := resultIDs(results); !slices.Equal(got, tt.want) {
+				t.Errorf("Search(%q) = %v, want %v", tt.query, got, tt.want)
+			}
+			for i := 1; i < len(results); i++ {
+				if results[i].Score > results[i-1].Score {
+					t.Errorf("結果未依分數排序: %v", results)
+				}
+			}
+		})
+	}
+}
+
+func TestIndexPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keyword.json")
+	idx, err := OpenIndex(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := idx.Add(testDoc("a", "alpha beta", nil), testDoc("b", "beta gamma", nil)); err != nil {
+		t.Fatal(err)
+	}
+	if err := idx.Delete("a", "missing"); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := OpenIndex(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := reopened.IDs(); !slices.Equal(got, []string{"b"}) {
+		t.Fatalf("重新開啟後的文檔 = %v, want [b]", got)
+	}
+	if got := resultIDs(reopened.Search("beta", 5, nil)); !slices.Equal(got, []string{"b"}) {
+		t.Errorf("重新開啟後搜尋 beta = %v，倒排索引應已重建", got)
+	}
+	if got := reopened.Search("alpha", 5, nil); len(got) != 0 {
+		t.Errorf("已刪除的文檔仍可搜尋到: %v", resultIDs(got))
+	}
+}
@@ -0,0 +1,97 @@
+package hybrid
+
+import (
+	"maps"
+	"sort"
+
+	"dongstudio.live/genkit_demo/pkg/vectorstore"
+	"github.com/firebase/genkit/go/ai"
+)
+
+// DefaultRRFK 為 reciprocal rank fusion 的平滑常數，數值越大排名差距的影響越小
+const DefaultRRFK = 60
+
+// RankedList 為一個檢索來源的結果，依相關性由高到低排列
+type RankedList struct {
+	Name      string         // 來源名稱，合併後的 metadata 會帶上 "<Name>_rank" 與 "<Name>_score"
+	Weight    float64        // 權重，0 表示忽略此來源
+	Documents []*ai.Document // 文檔的 metadata "score" 為來源原本的分數
+	// Similarity 表示此來源的分數為相似度，合併後保留為 metadata 的 "score"，
+	// 讓相似度門檻等依賴 "score" 的判斷維持原本的意義；多個來源設定時保留最高分
+	Similarity bool
+}
+
+// Fuse 以加權的 reciprocal rank fusion 合併多個排名：
+// 每份文檔的分數為 Σ weight / (k + rank)，rank 從 1 開始，
+// 同一份文檔以 metadata 的 "id"（沒有時以內容）判斷
+// 回傳的文檔依合併分數排序，合併分數記錄在 metadata 的 "rrf_score"；
+// "score" 只保留 Similarity 來源中的最高分，未出現在這些來源的文檔沒有 "score"
+func Fuse(lists []RankedList, k int) []*ai.Document {
+	if k <= 0 {
+		k = DefaultRRFK
+	}
+
+	type fused struct {
+		doc   *ai.Document
+		score float64
+		first int // 第一次出現的順序，分數相同時的排序依據
+	}
+	byKey := make(map[string]*fused)
+	var order int
+	for _, list := range lists {
+		if list.Weight == 0 {
+			continue
+		}
+		for i, doc := range list.Documents {
+			key := docKey(doc)
+			f, ok := byKey[key]
+			if !ok {
+				metadata := maps.Clone(doc.Metadata)
+				if metadata == nil {
+					metadata = make(map[string]any)
+				}
+				delete(metadata, "score")
+				f = &fused{doc: &ai.Document{Content: doc.Content, Metadata: metadata}, first: order}
+				byKey[key] = f
+				order++
+			}
+			rank := i + 1
+			f.score += list.Weight / float64(k+rank)
+			f.doc.Metadata[list.Name+"_rank"] = rank
+			if score, ok := doc.Metadata["score"]; ok {
+				f.doc.Metadata[list.Name+"_score"] = score
+				if s, ok := score.(float64); ok && list.Similarity {
+					if prev, ok := f.doc.Metadata["score"].(float64); !ok || s > prev {
+						f.doc.Metadata["score"] = s
+					}
+				}
+			}
+		}
+	}
+
+	results := make([]*fused, 0, len(byKey))
+	for _, f := range byKey {
+		f.doc.Metadata["rrf_score"] = f.score
+		results = append(results, f)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].score != results[j].score {
+			return results[i].score > results[j].score
+		}
+		return results[i].first < results[j].first
+	})
+
+	docs := make([]*ai.Document, len(results))
+	for i, f := range results {
+		docs[i] = f.doc
+	}
+	return docs
+}
+
+// docKey 回傳判斷是否為同一份文檔的鍵
+func docKey(doc *ai.Document) string {
+	if id, ok := doc.Metadata["id"].(string); ok && id != "" {
+		return "id:" + id
+	}
+	return "text:" + vectorstore.DocText(doc)
+}
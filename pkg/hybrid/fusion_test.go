@@ -0,0 +1,160 @@
+package hybrid
+
+import (
+	"context"
+	"math"
+	"slices"
+	"testing"
+
+	"github.com/firebase/genkit/go/ai"
+)
+
+func scoredDoc(id string, score float64) *ai.Document {
+	return ai.DocumentFromText(id, map[string]any{"id": id, "score": score})
+}
+
+func docIDs(docs []*ai.Document) []string {
+	ids := make([]string, len(docs))
+	for i, doc := range docs {
+		ids[i], _ = doc.Metadata["id"].(string)
+	}
+	return ids
+}
+
+func TestFuse(t *testing.T) {
+	vector := []*ai.Document{scoredDoc("a", 0.9), scoredDoc("b", 0.8), scoredDoc("c", 0.7)}
+	keyword := []*ai.Document{scoredDoc("c", 12), scoredDoc("d", 8), scoredDoc("a", 3)}
+
+	tests := []struct {
+		name          string
+		vectorWeight  float64
+		keywordWeight float64
+		want          []string
+	}{
+		// a: 1/61 + 1/63，c: 1/63 + 1/61，同分時依第一次出現的順序
+		{name: "equal weights", vectorWeight: 1, keywordWeight: 1, want: []string{"a", "c", "b", "d"}},
+		{name: "keyword heavy", vectorWeight: 1, keywordWeight: 3, want: []string{"c", "a", "d", "b"}},
+		{name: "vector only", vectorWeight: 1, keywordWeight: 0, want: []string{"a", "b", "c"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			docs := Fuse([]RankedList{
+				{Name: "vector", Weight: tt.vectorWeight, Documents: vector, Similarity: true},
+				{Name: "keyword", Weight: tt.keywordWeight, Documents: keyword},
+			}, 0)
+			if got := docIDs(docs); !slices.Equal(got, tt.want) {
+				t.Errorf("Fuse() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFuseMetadata(t *testing.T) {
+	input := scoredDoc("a", 0.9)
+	docs := Fuse([]RankedList{
+		{Name: "vector", Weight: 1, Documents: []*ai.Document{input}, Similarity: true},
+		{Name: "keyword", Weight: 1, Documents: []*ai.Document{scoredDoc("d", 8), scoredDoc("a", 3)}},
+	}, 10)
+	byID := make(map[string]map[string]any)
+	for _, doc := range docs {
+		byID[doc.Metadata["id"].(string)] = doc.Metadata
+	}
+
+	a := byID["a"]
+	if a["score"] != 0.9 || a["vector_score"] != 0.9 || a["keyword_score"] != 3.0 ||
+		a["vector_rank"] != 1 || a["keyword_rank"] != 2 {
+		t.Errorf("a 的 metadata = %v", a)
+	}
+	if got, want := a["rrf_score"].(float64), 1.0/11+1.0/12; math.Abs(got-want) > 1e-12 {
+		t.Errorf("a 的 rrf_score = %v, want %v", got, want)
+	}
+
+	d := byID["d"]
+	if _, ok := d["score"]; ok {
+		t.Errorf("只有關鍵字命中的 d 不應有相似度 score: %v", d)
+	}
+	if d["keyword_score"] != 8.0 || d["rrf_score"] == nil {
+		t.Errorf("d 的 metadata = %v", d)
+	}
+
+	// 輸入文檔的 metadata 不應被修改
+	if _, ok := input.Metadata["rrf_score"]; ok {
+		t.Error("輸入文檔被修改")
+	}
+}
+
+func TestFuseMultipleSimilarity(t *testing.T) {
+	// 多個 Similarity 來源時 "score" 為其中的最高分
+	docs := Fuse([]RankedList{
+		{Name: "q1", Weight: 1, Documents: []*ai.Document{scoredDoc("a", 0.5), scoredDoc("b", 0.8)}, Similarity: true},
+		{Name: "q2", Weight: 1, Documents: []*ai.Document{scoredDoc("b", 0.6), scoredDoc("a", 0.7)}, Similarity: true},
+	}, 0)
+	for _, doc := range docs {
+		want := map[string]float64{"a": 0.7, "b": 0.8}[doc.Metadata["id"].(string)]
+		if doc.Metadata["score"] != want {
+			t.Errorf("%v 的 score = %v, want %v", doc.Metadata["id"], doc.Metadata["score"], want)
+		}
+	}
+}
+
+// staticRetriever 回傳固定的向量檢索結果
+type staticRetriever []*ai.Document
+
+func (staticRetriever) Name() string { return "static" }
+
+func (r staticRetriever) Retrieve(ctx context.Context, req *ai.RetrieverRequest) (*ai.RetrieverResponse, error) {
+	return &ai.RetrieverResponse{Documents: r}, nil
+}
+
+func TestRetrieveThresholds(t *testing.T) {
+	keyword, err := OpenIndex("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := keyword.Add(
+		testDoc("tsmc", "台積電公布財報", nil),
+		testDoc("noise", "聊到台積電一次，其餘都在說天氣很好，今天天氣晴朗適合出門散步走走，晚上再去吃牛肉麵", nil),
+	); err != nil {
+		t.Fatal(err)
+	}
+	strong := keyword.Search("台積電", 1, nil)[0].Score
+	cfg := Config{
+		Vector:        staticRetriever{scoredDoc("high", 0.9), scoredDoc("low", 0.2)},
+		Keyword:       keyword,
+		VectorWeight:  1,
+		KeywordWeight: 1,
+	}
+
+	tests := []struct {
+		name string
+		opts *RetrieverOptions
+		want []string
+	}{
+		{name: "no thresholds", opts: &RetrieverOptions{Count: 10}, want: []string{"high", "tsmc", "low", "noise"}},
+		{name: "min score drops low similarity", opts: &RetrieverOptions{Count: 10, MinScore: 0.5}, want: []string{"high", "tsmc", "noise"}},
+		{name: "keyword threshold", opts: &RetrieverOptions{Count: 10, MinScore: 0.5, KeywordMinScore: strong}, want: []string{"high", "tsmc"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := retrieve(context.Background(), cfg, &ai.RetrieverRequest{
+				Query:   ai.DocumentFromText("台積電", nil),
+				Options: tt.opts,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := docIDs(resp.Documents); !slices.Equal(got, tt.want) {
+				t.Errorf("retrieve() = %v, want %v", got, tt.want)
+			}
+			for _, doc := range resp.Documents {
+				score, ok := doc.Metadata["score"].(float64)
+				if _, vector := doc.Metadata["vector_rank"]; vector != ok {
+					t.Errorf("%v: 只有向量結果應帶有 score", doc.Metadata)
+				}
+				if ok && score < tt.opts.MinScore {
+					t.Errorf("%v: score 低於門檻 %v", doc.Metadata, tt.opts.MinScore)
+				}
+			}
+		})
+	}
+}
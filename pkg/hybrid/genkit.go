@@ -0,0 +1,120 @@
+package hybrid
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+
+	"dongstudio.live/genkit_demo/pkg/vectorstore"
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/genkit"
+)
+
+const provider = "hybrid"
+
+// Config 為 [DefineRetriever] 的設定
+type Config struct {
+	Vector        ai.Retriever // 向量檢索，必填
+	Keyword       *Index       // 關鍵字索引，必填
+	VectorWeight  float64      // 向量結果的權重，預設 1
+	KeywordWeight float64      // 關鍵字結果的權重，預設 1
+	RRFK          int          // reciprocal rank fusion 的平滑常數，預設 DefaultRRFK
+}
+
+// RetrieverOptions 可放在 [ai.RetrieverRequest] 的 Options 欄位
+// Options 應為 nil 或 *RetrieverOptions
+type RetrieverOptions struct {
+	Count      int                `json:"count,omitempty"`      // 回傳的文檔數，預設為 3
+	Candidates int                `json:"candidates,omitempty"` // 關鍵字搜尋的候選數，預設為 Count 的 4 倍且至少 20
+	Filter     vectorstore.Filter `json:"filter,omitempty"`     // 關鍵字結果的 metadata 過濾條件，向量結果的條件需放在 VectorOptions
+	// MinScore 為向量相似度門檻，低於此值的向量結果在合併前移除，0 表示不限制
+	MinScore float64 `json:"min_score,omitempty"`
+	// KeywordMinScore 為 BM25 分數門檻，低於此值的關鍵字結果在合併前移除，0 表示不限制；
+	// 只有關鍵字命中的文檔沒有相似度，MinScore 不會套用在這些文檔上
+	KeywordMinScore float64 `json:"keyword_min_score,omitempty"`
+	// VectorOptions 原樣傳給向量 retriever，其中的文檔數應與 Candidates 相同
+	VectorOptions any `json:"vector_options,omitempty"`
+}
+
+// DefineRetriever 註冊混合檢索的 Retriever：同時查詢向量與關鍵字索引，
+// 再以加權的 reciprocal rank fusion 合併
+// 回傳文檔的 metadata "rrf_score" 為合併分數，"score" 為向量相似度（只有關鍵字命中時沒有），
+// 並帶有 vector_rank、vector_score、keyword_rank、keyword_score
+func DefineRetriever(g *genkit.Genkit, name string, cfg Config) (ai.Retriever, error) {
+	if cfg.Vector == nil {
+		return nil, errors.New("Vector required")
+	}
+	if cfg.Keyword == nil {
+		return nil, errors.New("Keyword required")
+	}
+	if cfg.VectorWeight < 0 || cfg.KeywordWeight < 0 {
+		return nil, errors.New("weights must not be negative")
+	}
+	if cfg.VectorWeight == 0 && cfg.KeywordWeight == 0 {
+		cfg.VectorWeight, cfg.KeywordWeight = 1, 1
+	}
+	return genkit.DefineRetriever(g, provider, name, func(ctx context.Context, req *ai.RetrieverRequest) (*ai.RetrieverResponse, error) {
+		return retrieve(ctx, cfg, req)
+	}), nil
+}
+
+func retrieve(ctx context.Context, cfg Config, req *ai.RetrieverRequest) (*ai.RetrieverResponse, error) {
+	opts := &RetrieverOptions{}
+	if req.Options != nil {
+		var ok bool
+		if opts, ok = req.Options.(*RetrieverOptions); !ok {
+			return nil, fmt.Errorf("hybrid.Retrieve options have type %T, want %T", req.Options, &RetrieverOptions{})
+		}
+	}
+	count := opts.Count
+	if count <= 0 {
+		count = 3
+	}
+	candidates := opts.Candidates
+	if candidates <= 0 {
+		candidates = max(count*4, 20)
+	}
+
+	var vectorDocs []*ai.Document
+	if cfg.VectorWeight > 0 {
+		resp, err := cfg.Vector.Retrieve(ctx, &ai.RetrieverRequest{Query: req.Query, Options: opts.VectorOptions})
+		if err != nil {
+			return nil, err
+		}
+		for _, doc := range resp.Documents {
+			if score, ok := doc.Metadata["score"].(float64); ok && opts.MinScore != 0 && score < opts.MinScore {
+				continue
+			}
+			vectorDocs = append(vectorDocs, doc)
+		}
+	}
+
+	var keywordDocs []*ai.Document
+	if cfg.KeywordWeight > 0 {
+		var filter func(*Entry) bool
+		if opts.Filter != nil {
+			filter = func(e *Entry) bool { return opts.Filter.Match(e.Metadata) }
+		}
+		for _, r := range cfg.Keyword.Search(vectorstore.DocText(req.Query), candidates, filter) {
+			if opts.KeywordMinScore != 0 && r.Score < opts.KeywordMinScore {
+				continue
+			}
+			metadata := maps.Clone(r.Entry.Metadata)
+			if metadata == nil {
+				metadata = make(map[string]any)
+			}
+			metadata["score"] = r.Score
+			keywordDocs = append(keywordDocs, ai.DocumentFromText(r.Entry.Content, metadata))
+		}
+	}
+
+	docs := Fuse([]RankedList{
+		{Name: "vector", Weight: cfg.VectorWeight, Documents: vectorDocs, Similarity: true},
+		{Name: "keyword", Weight: cfg.KeywordWeight, Documents: keywordDocs},
+	}, cfg.RRFK)
+	if len(docs) > count {
+		docs = docs[:count]
+	}
+	return &ai.RetrieverResponse{Documents: docs}, nil
+}
@@ -0,0 +1,66 @@
+// Package hybrid 提供關鍵字（BM25）與向量的混合檢索
+//
+// 純 embedding 檢索容易漏掉專有名詞與代碼（例如「台積電」、「A17」），
+// [Index] 以 BM25 建立關鍵字索引，[DefineRetriever] 將向量與關鍵字的結果
+// 以加權的 reciprocal rank fusion 合併成單一 ai.Retriever
+package hybrid
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/width"
+)
+
+// Tokenize 將文字切分成 BM25 的詞：
+// 英文與數字以連續字元為一個詞並轉為小寫，全形字元先轉為半形；
+// 中日韓文字沒有空白分隔，以相鄰兩字的 bigram 為詞，單獨一個字時以該字為詞
+func Tokenize(text string) []string {
+	text = strings.ToLower(width.Fold.String(text))
+
+	var (
+		tokens []string
+		word   []rune
+		cjk    []rune
+	)
+	flushWord := func() {
+		if len(word) > 0 {
+			tokens = append(tokens, string(word))
+			word = word[:0]
+		}
+	}
+	flushCJK := func() {
+		switch len(cjk) {
+		case 0:
+		case 1:
+			tokens = append(tokens, string(cjk))
+		default:
+			for i := 0; i+1 < len(cjk); i++ {
+				tokens = append(tokens, string(cjk[i:i+2]))
+			}
+		}
+		cjk = cjk[:0]
+	}
+
+	for _, r := range text {
+		switch {
+		case isCJK(r):
+			flushWord()
+			cjk = append(cjk, r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			flushCJK()
+			word = append(word, r)
+		default:
+			flushWord()
+			flushCJK()
+		}
+	}
+	flushWord()
+	flushCJK()
+	return tokens
+}
+
+// isCJK 判斷是否為中日韓文字
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
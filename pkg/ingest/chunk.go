@@ -0,0 +1,301 @@
+// Package ingest 將長文件切分成適合索引的片段（chunk）
+//
+// 提供多種切分策略：
+//
+//   - [TokenChunker]     固定 token 數的視窗，相鄰視窗可重疊
+//   - [SentenceChunker]  依句子切分後合併到 token 上限，支援中日韓文字（句子之間沒有空白）
+//   - [ParagraphChunker] 依段落切分，過長的段落再依句子切分
+//   - [MarkdownChunker]  依 Markdown 標題階層切分，每個片段帶有標題路徑
+//   - [RecursiveChunker] 依分隔符號由大到小遞迴切分
+//
+// [SplitDocuments] 將 ai.Document 切分成多個片段，並在 metadata 記錄來源文件、位置與標題路徑
+package ingest
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Chunk 為切分後的一個片段
+type Chunk struct {
+	Text     string   // 片段內容
+	Start    int      // 在原文中的起始位置（byte）
+	End      int      // 在原文中的結束位置（byte，不含）
+	Headings []string // 所屬的標題路徑，由上層到下層，只有 MarkdownChunker 會設定
+}
+
+// Chunker 為切分策略
+type Chunker interface {
+	Chunk(text string) []Chunk
+}
+
+// DefaultMaxTokens 為未設定上限時每個片段的 token 數
+const DefaultMaxTokens = 256
+
+// TokenChunker 依固定的 token 數切分，相鄰片段重疊 Overlap 個 token
+type TokenChunker struct {
+	Size    int // 每個片段的 token 數，預設 DefaultMaxTokens
+	Overlap int // 相鄰片段重疊的 token 數
+}
+
+func (c TokenChunker) Chunk(text string) []Chunk {
+	return toChunks(text, tokenWindows(text, span{0, len(text)}, orDefault(c.Size), c.Overlap))
+}
+
+// SentenceChunker 依句子切分，再將連續的句子合併到不超過 MaxTokens
+// 超過上限的單一句子會再依 token 視窗切分
+type SentenceChunker struct {
+	MaxTokens int // 每個片段的 token 上限，預設 DefaultMaxTokens
+	Overlap   int // 相鄰片段重疊的句子數
+}
+
+func (c SentenceChunker) Chunk(text string) []Chunk {
+	return toChunks(text, pack(text, sentences(text, span{0, len(text)}), orDefault(c.MaxTokens), c.Overlap))
+}
+
+// ParagraphChunker 依空行切分段落，再將連續的段落合併到不超過 MaxTokens
+// 超過上限的段落會再依句子切分
+type ParagraphChunker struct {
+	MaxTokens int // 每個片段的 token 上限，預設 DefaultMaxTokens
+}
+
+func (c ParagraphChunker) Chunk(text string) []Chunk {
+	maxTokens := orDefault(c.MaxTokens)
+	var pieces []span
+	for _, p := range paragraphs(text, span{0, len(text)}) {
+		if CountTokens(text[p.start:p.end]) > maxTokens {
+			pieces = append(pieces, sentences(text, p)...)
+		} else {
+			pieces = append(pieces, p)
+		}
+	}
+	return toChunks(text, pack(text, pieces, maxTokens, 0))
+}
+
+// DefaultSeparators 為 RecursiveChunker 預設的分隔符號，依序為段落、換行、中英文句尾與空白
+var DefaultSeparators = []string{"\n\n", "\n", "。", "！", "？", ". ", "! ", "? ", "；", "; ", "，", ", ", " "}
+
+// RecursiveChunker 先以第一個分隔符號切分，仍超過 MaxTokens 的部分再以下一個分隔符號切分，
+// 所有分隔符號都用完時改用 token 視窗；最後將相鄰的小片段合併到不超過 MaxTokens
+type RecursiveChunker struct {
+	MaxTokens  int      // 每個片段的 token 上限，預設 DefaultMaxTokens
+	Separators []string // 分隔符號，由大到小排列，預設 DefaultSeparators
+}
+
+func (c RecursiveChunker) Chunk(text string) []Chunk {
+	seps := c.Separators
+	if seps == nil {
+		seps = DefaultSeparators
+	}
+	maxTokens := orDefault(c.MaxTokens)
+	return toChunks(text, pack(text, c.split(text, span{0, len(text)}, seps, maxTokens), maxTokens, 0))
+}
+
+func (c RecursiveChunker) split(text string, s span, seps []string, maxTokens int) []span {
+	if CountTokens(text[s.start:s.end]) <= maxTokens {
+		return appendTrimmed(nil, text, s)
+	}
+	for i, sep := range seps {
+		if !strings.Contains(text[s.start:s.end], sep) {
+			continue
+		}
+		var out []span
+		for _, piece := range splitAfter(text, s, sep) {
+			out = append(out, c.split(text, piece, seps[i+1:], maxTokens)...)
+		}
+		return out
+	}
+	return tokenWindows(text, s, maxTokens, 0)
+}
+
+// splitAfter 以 sep 切分 [start, end)，分隔符號保留在前一段的結尾
+func splitAfter(text string, s span, sep string) []span {
+	var out []span
+	start := s.start
+	for {
+		i := strings.Index(text[start:s.end], sep)
+		if i < 0 {
+			break
+		}
+		end := start + i + len(sep)
+		out = append(out, span{start, end})
+		start = end
+	}
+	if start < s.end {
+		out = append(out, span{start, s.end})
+	}
+	return out
+}
+
+// sentenceEnds 為句尾標點，其後緊接的結尾引號與括號也屬於同一句
+const (
+	sentenceEnds  = "。！？!?；;…"
+	closingQuotes = "」』”’）)\"'"
+)
+
+// sentences 依句尾標點與換行切分句子；英文句點只有在其後為空白或結尾時才視為句尾，避免切開小數與縮寫
+func sentences(text string, s span) []span {
+	var out []span
+	start := s.start
+	seg := text[s.start:s.end]
+	for i := 0; i < len(seg); {
+		r, size := utf8.DecodeRuneInString(seg[i:])
+		i += size
+		end := false
+		switch {
+		case r == '\n':
+			end = true
+		case strings.ContainsRune(sentenceEnds, r):
+			end = true
+		case r == '.':
+			next, _ := utf8.DecodeRuneInString(seg[i:])
+			end = i == len(seg) || unicode.IsSpace(next)
+		}
+		if !end {
+			continue
+		}
+		for i < len(seg) {
+			next, size := utf8.DecodeRuneInString(seg[i:])
+			if !strings.ContainsRune(closingQuotes, next) && !strings.ContainsRune(sentenceEnds, next) {
+				break
+			}
+			i += size
+		}
+		out = appendTrimmed(out, text, span{start, s.start + i})
+		start = s.start + i
+	}
+	return appendTrimmed(out, text, span{start, s.end})
+}
+
+// SplitSentences 依句尾標點與換行切分句子，回傳去除前後空白的句子
+// 規則與 SentenceChunker 相同，支援句子之間沒有空白的中日韓文字
+func SplitSentences(text string) []string {
+	spans := sentences(text, span{0, len(text)})
+	out := make([]string, len(spans))
+	for i, s := range spans {
+		out[i] = text[s.start:s.end]
+	}
+	return out
+}
+
+// paragraphs 依空行切分段落
+func paragraphs(text string, s span) []span {
+	var out []span
+	start := s.start
+	lines := splitAfter(text, s, "\n")
+	for i, line := range lines {
+		if strings.TrimSpace(text[line.start:line.end]) == "" {
+			out = appendTrimmed(out, text, span{start, line.start})
+			start = line.end
+		} else if i == len(lines)-1 {
+			out = appendTrimmed(out, text, span{start, line.end})
+		}
+	}
+	return out
+}
+
+// appendTrimmed 去除範圍前後的空白，非空時加入 out
+func appendTrimmed(out []span, text string, s span) []span {
+	seg := text[s.start:s.end]
+	trimmed := strings.TrimLeftFunc(seg, unicode.IsSpace)
+	s.start += len(seg) - len(trimmed)
+	s.end = s.start + len(strings.TrimRightFunc(trimmed, unicode.IsSpace))
+	if s.start < s.end {
+		out = append(out, s)
+	}
+	return out
+}
+
+// pack 將連續的片段合併到不超過 maxTokens，相鄰結果重疊 overlap 個片段
+// 單一片段超過上限時改以 token 視窗切分
+func pack(text string, pieces []span, maxTokens, overlap int) []span {
+	var (
+		out    []span
+		group  []span
+		tokens []int // group 中每個片段的 token 數
+		fresh  int   // group 中尚未輸出過的片段數
+	)
+	reset := func() {
+		group, tokens, fresh = nil, nil, 0
+	}
+	flush := func() {
+		if fresh == 0 {
+			return
+		}
+		out = append(out, span{group[0].start, group[len(group)-1].end})
+		// 保留最後 overlap 個片段作為下一個結果的開頭，但不超過上限的一半
+		keep := min(overlap, len(group)-1)
+		for keep > 0 && sum(tokens[len(tokens)-keep:]) > maxTokens/2 {
+			keep--
+		}
+		group = append([]span(nil), group[len(group)-keep:]...)
+		tokens = append([]int(nil), tokens[len(tokens)-keep:]...)
+		fresh = 0
+	}
+
+	for _, p := range pieces {
+		n := CountTokens(text[p.start:p.end])
+		if n > maxTokens {
+			flush()
+			reset()
+			out = append(out, tokenWindows(text, p, maxTokens, 0)...)
+			continue
+		}
+		if sum(tokens)+n > maxTokens {
+			flush()
+			// 重疊的片段加上新片段仍超過上限時捨棄重疊
+			if sum(tokens)+n > maxTokens {
+				reset()
+			}
+		}
+		group = append(group, p)
+		tokens = append(tokens, n)
+		fresh++
+	}
+	flush()
+	return out
+}
+
+func sum(ns []int) int {
+	total := 0
+	for _, n := range ns {
+		total += n
+	}
+	return total
+}
+
+func toChunks(text string, spans []span) []Chunk {
+	chunks := make([]Chunk, 0, len(spans))
+	for _, s := range spans {
+		chunks = append(chunks, Chunk{Text: text[s.start:s.end], Start: s.start, End: s.end})
+	}
+	return chunks
+}
+
+func orDefault(maxTokens int) int {
+	if maxTokens <= 0 {
+		return DefaultMaxTokens
+	}
+	return maxTokens
+}
+
+// NewChunker 依策略名稱建立 Chunker：token、sentence、paragraph、markdown 或 recursive
+// overlap 對 token 策略為重疊的 token 數，對 sentence 策略為重疊的句子數，其他策略忽略
+func NewChunker(strategy string, maxTokens, overlap int) (Chunker, error) {
+	switch strategy {
+	case "token":
+		return TokenChunker{Size: maxTokens, Overlap: overlap}, nil
+	case "sentence":
+		return SentenceChunker{MaxTokens: maxTokens, Overlap: overlap}, nil
+	case "paragraph":
+		return ParagraphChunker{MaxTokens: maxTokens}, nil
+	case "markdown":
+		return MarkdownChunker{MaxTokens: maxTokens}, nil
+	case "recursive", "":
+		return RecursiveChunker{MaxTokens: maxTokens}, nil
+	default:
+		return nil, fmt.Errorf("不支援的切分策略: %s", strategy)
+	}
+}
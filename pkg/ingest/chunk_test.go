@@ -0,0 +1,261 @@
+package ingest
+
+import (
+	"crypto/md5"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/firebase/genkit/go/ai"
+)
+
+func TestCountTokens(t *testing.T) {
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"", 0},
+		{"hello world", 2},
+		{"台灣美食", 4},
+		{"GPU 3.5倍", 5},
+		{"a_b, c", 3},
+	}
+	for _, tt := range tests {
+		if got := CountTokens(tt.text); got != tt.want {
+			t.Errorf("CountTokens(%q) = %d, want %d", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestSplitSentences(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{"cjk", "今天天氣很好。我們去散步吧！", []string{"今天天氣很好。", "我們去散步吧！"}},
+		{"decimal", "Pi is 3.14. It is irrational.", []string{"Pi is 3.14.", "It is irrational."}},
+		{"closing quote", "他說：「好。」然後離開", []string{"他說：「好。」", "然後離開"}},
+		{"repeated marks", "真的嗎？！是的。", []string{"真的嗎？！", "是的。"}},
+		{"newline", "第一行\n  第二行  ", []string{"第一行", "第二行"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SplitSentences(tt.text); !slices.Equal(got, tt.want) {
+				t.Errorf("SplitSentences(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+// chunkTexts 回傳片段的內容
+func chunkTexts(chunks []Chunk) []string {
+	out := make([]string, len(chunks))
+	for i, ch := range chunks {
+		out[i] = ch.Text
+	}
+	return out
+}
+
+func TestChunkers(t *testing.T) {
+	tests := []struct {
+		name    string
+		chunker Chunker
+		text    string
+		want    []string
+	}{
+		{
+			name:    "token overlap",
+			chunker: TokenChunker{Size: 3, Overlap: 1},
+			text:    "a b c d e f g",
+			want:    []string{"a b c", "c d e", "e f g"},
+		},
+		{
+			name:    "sentence overlap",
+			chunker: SentenceChunker{MaxTokens: 4, Overlap: 1},
+			text:    "一。二。三。四。",
+			want:    []string{"一。二。", "二。三。", "三。四。"},
+		},
+		{
+			name:    "sentence too long",
+			chunker: SentenceChunker{MaxTokens: 3},
+			text:    "一二三四五。",
+			want:    []string{"一二三", "四五。"},
+		},
+		{
+			name:    "paragraphs merged",
+			chunker: ParagraphChunker{MaxTokens: 100},
+			text:    "第一段。\n\n第二段。",
+			want:    []string{"第一段。\n\n第二段。"},
+		},
+		{
+			name:    "paragraphs split",
+			chunker: ParagraphChunker{MaxTokens: 4},
+			text:    "第一段。\n\n第二段。",
+			want:    []string{"第一段。", "第二段。"},
+		},
+		{
+			name:    "long paragraph by sentences",
+			chunker: ParagraphChunker{MaxTokens: 4},
+			text:    "甲乙。丙丁。戊己。",
+			want:    []string{"甲乙。", "丙丁。", "戊己。"},
+		},
+		{
+			name:    "recursive",
+			chunker: RecursiveChunker{MaxTokens: 6},
+			text:    "第一段很短。\n\n第二段，比較長一點。",
+			want:    []string{"第一段很短。", "第二段，", "比較長一點。"},
+		},
+		{
+			name:    "recursive falls back to tokens",
+			chunker: RecursiveChunker{MaxTokens: 2, Separators: []string{"\n"}},
+			text:    "abc def ghi",
+			want:    []string{"abc def", "ghi"},
+		},
+		{
+			name:    "empty",
+			chunker: RecursiveChunker{},
+			text:    " \n\n ",
+			want:    []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunks := tt.chunker.Chunk(tt.text)
+			if got := chunkTexts(chunks); !slices.Equal(got, tt.want) {
+				t.Fatalf("Chunk() = %q, want %q", got, tt.want)
+			}
+			for _, ch := range chunks {
+				if tt.text[ch.Start:ch.End] != ch.Text {
+					t.Errorf("片段 %q 的位置 [%d, %d) 與原文不符", ch.Text, ch.Start, ch.End)
+				}
+			}
+		})
+	}
+}
+
+// TestChunkersLimit 檢查所有策略的片段都不超過上限、依序排列且涵蓋原文所有的 token
+func TestChunkersLimit(t *testing.T) {
+	text := strings.Repeat("# 標題\n\n台灣有許多著名的美食，包括小籠包、牛肉麵與夜市小吃。"+
+		"The quick brown fox jumps over the lazy dog. Version 3.5 is out!\n\n", 8)
+	const maxTokens = 20
+	for _, strategy := range []string{"token", "sentence", "paragraph", "markdown", "recursive"} {
+		t.Run(strategy, func(t *testing.T) {
+			chunker, err := NewChunker(strategy, maxTokens, 2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			covered := make([]bool, len(text))
+			prev := 0
+			for _, ch := range chunker.Chunk(text) {
+				if n := CountTokens(ch.Text); n == 0 || n > maxTokens {
+					t.Errorf("片段 %q 有 %d 個 token", ch.Text, n)
+				}
+				if text[ch.Start:ch.End] != ch.Text || ch.Start < prev {
+					t.Errorf("片段 %q 的位置 [%d, %d) 不正確", ch.Text, ch.Start, ch.End)
+				}
+				prev = ch.Start
+				for i := ch.Start; i < ch.End; i++ {
+					covered[i] = true
+				}
+			}
+			for _, tok := range tokenize(text) {
+				if !covered[tok.start] {
+					t.Fatalf("位置 %d 的 token %q 不在任何片段中", tok.start, text[tok.start:tok.end])
+				}
+			}
+		})
+	}
+}
+
+func TestMarkdownChunker(t *testing.T) {
+	text := "# 指南\n介紹\n\n## 安裝\n```sh\n# 不是標題\n```\n\n## 使用 ##\n內容\n\n### 進階\n\n# 附錄\n"
+	chunks := MarkdownChunker{}.Chunk(text)
+	want := []struct {
+		text     string
+		headings []string
+	}{
+		{"# 指南\n介紹", []string{"指南"}},
+		{"## 安裝\n```sh\n# 不是標題\n```", []string{"指南", "安裝"}},
+		{"## 使用 ##\n內容", []string{"指南", "使用"}},
+		// 只有標題的「進階」與「附錄」沒有內容，不產生片段
+	}
+	if len(chunks) != len(want) {
+		t.Fatalf("Chunk() = %q, want %d 個片段", chunkTexts(chunks), len(want))
+	}
+	for i, w := range want {
+		if chunks[i].Text != w.text || !slices.Equal(chunks[i].Headings, w.headings) {
+			t.Errorf("第 %d 個片段 = %q %q, want %q %q", i, chunks[i].Text, chunks[i].Headings, w.text, w.headings)
+		}
+	}
+
+	// 過長的段落以 Fallback 切分，位置仍對應原文並保留標題路徑
+	long := "# 長篇\n" + strings.Repeat("一句話。", 10)
+	for _, ch := range (MarkdownChunker{MaxTokens: 8}).Chunk(long) {
+		if long[ch.Start:ch.End] != ch.Text || !slices.Equal(ch.Headings, []string{"長篇"}) {
+			t.Errorf("片段 %q [%d, %d) 標題 %q", ch.Text, ch.Start, ch.End, ch.Headings)
+		}
+	}
+}
+
+func TestNewChunker(t *testing.T) {
+	tests := []struct {
+		strategy string
+		want     Chunker
+	}{
+		{"token", TokenChunker{Size: 64, Overlap: 8}},
+		{"sentence", SentenceChunker{MaxTokens: 64, Overlap: 8}},
+		{"paragraph", ParagraphChunker{MaxTokens: 64}},
+		{"markdown", MarkdownChunker{MaxTokens: 64}},
+		{"recursive", RecursiveChunker{MaxTokens: 64}},
+		{"", RecursiveChunker{MaxTokens: 64}},
+	}
+	for _, tt := range tests {
+		got, err := NewChunker(tt.strategy, 64, 8)
+		if err != nil {
+			t.Fatalf("NewChunker(%q) error = %v", tt.strategy, err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("NewChunker(%q) = %#v, want %#v", tt.strategy, got, tt.want)
+		}
+	}
+	if _, err := NewChunker("semantic", 64, 0); err == nil {
+		t.Error("不支援的策略應回傳錯誤")
+	}
+}
+
+func TestSplitDocuments(t *testing.T) {
+	withID := ai.DocumentFromText("# 標題\n第一段。\n\n# 其他\n第二段。", map[string]any{MetaID: "guide", "category": "教學"})
+	anonymous := ai.DocumentFromText("沒有 ID 的文件", nil)
+	chunks := SplitDocuments([]*ai.Document{withID, anonymous}, MarkdownChunker{})
+	if len(chunks) != 3 {
+		t.Fatalf("SplitDocuments() 回傳 %d 個片段，want 3", len(chunks))
+	}
+
+	anonymousID := fmt.Sprintf("%x", md5.Sum([]byte("沒有 ID 的文件")))
+	tests := []struct {
+		id, sourceID, headingPath string
+		index, count              int
+	}{
+		{"guide#0", "guide", "標題", 0, 2},
+		{"guide#1", "guide", "其他", 1, 2},
+		{anonymousID + "#0", anonymousID, "", 0, 1},
+	}
+	for i, tt := range tests {
+		m := chunks[i].Metadata
+		if m[MetaID] != tt.id || m[MetaSourceID] != tt.sourceID || m[MetaChunkIndex] != tt.index || m[MetaChunkCount] != tt.count {
+			t.Errorf("第 %d 個片段的 metadata = %v", i, m)
+		}
+		if path, _ := m[MetaHeadingPath].(string); path != tt.headingPath {
+			t.Errorf("第 %d 個片段的標題路徑 = %q, want %q", i, path, tt.headingPath)
+		}
+	}
+	if chunks[0].Metadata["category"] != "教學" {
+		t.Errorf("片段未保留來源文件的 metadata: %v", chunks[0].Metadata)
+	}
+	if withID.Metadata[MetaID] != "guide" || len(withID.Metadata) != 2 {
+		t.Errorf("來源文件的 metadata 被修改: %v", withID.Metadata)
+	}
+}
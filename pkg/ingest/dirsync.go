@@ -0,0 +1,413 @@
+package ingest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"maps"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"dongstudio.live/genkit_demo/pkg/vectorstore"
+	"github.com/firebase/genkit/go/ai"
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultSyncInterval 為 [DirSyncer] 預設的掃描間隔
+const DefaultSyncInterval = 30 * time.Second
+
+// DirSyncer 讓索引與目錄保持一致：定期掃描目錄，只重新載入大小或修改時間有變更的檔案，
+// 新增或變更的檔案經由 JobQueue 重新切分並產生 embedding，已刪除的檔案從索引移除
+//
+// 掃描結果保存在狀態檔，重新啟動後只處理停機期間變更的檔案；沒有狀態檔時第一次掃描為完整同步，
+// 先前由目錄同步加入（origin 為 dir）但已不在目錄中的文件會被刪除，經由 API 或啟動時加入的文件不受影響。
+// 索引失敗的檔案會在下次掃描時重試；載入失敗（例如格式錯誤）的檔案保留先前索引的文件，
+// 等到檔案再次變更才重試
+type DirSyncer struct {
+	Root      string
+	Options   WalkOptions
+	Jobs      *JobQueue
+	StatePath string        // 狀態檔路徑，空白時只保存在記憶體
+	Interval  time.Duration // 掃描間隔，預設 DefaultSyncInterval
+	// OnSync 在每次掃描結束後呼叫，可用於更新就緒狀態；讀取狀態檔失敗時 run 為 nil
+	OnSync func(run *SyncRun, err error)
+
+	mu      sync.Mutex
+	state   *syncState
+	loaded  bool                // 是否已讀取狀態檔
+	pending map[string]struct{} // 已變更、尚未成功索引的檔案
+	failed  map[string]string   // 索引失敗的檔案與原因，下次掃描重試
+	running bool
+}
+
+// syncState 為狀態檔的內容
+type syncState struct {
+	Files   map[string]*syncedFile `json:"files"`
+	LastRun *SyncRun               `json:"last_run,omitempty"`
+}
+
+// syncedFile 為已同步的檔案
+type syncedFile struct {
+	Size        int64     `json:"size"`
+	ModTime     time.Time `json:"mod_time"`
+	DocumentIDs []string  `json:"document_ids,omitempty"` // 檔案產生的文件（PDF 每頁一份）
+	Error       string    `json:"error,omitempty"`        // 載入失敗的原因，檔案變更前不再重試
+}
+
+// SyncRun 為一次掃描的結果
+type SyncRun struct {
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	Full       bool      `json:"full"`             // 是否為完整同步（沒有狀態檔時的第一次掃描）
+	Changed    int       `json:"changed"`          // 新增或變更的檔案數
+	Removed    int       `json:"removed"`          // 已刪除的檔案數
+	JobID      string    `json:"job_id,omitempty"` // 索引工作，沒有變更時為空
+	Report     *Report   `json:"report,omitempty"`
+	Error      string    `json:"error,omitempty"` // 掃描目錄失敗的原因
+}
+
+// FileError 為單一檔案的同步錯誤
+type FileError struct {
+	File  string `json:"file"`
+	Error string `json:"error"`
+}
+
+// SyncStatus 為目錄同步的狀態
+type SyncStatus struct {
+	Root     string      `json:"root"`
+	Interval string      `json:"interval"`
+	Running  bool        `json:"running"`  // 是否正在掃描或索引
+	Files    int         `json:"files"`    // 已同步的檔案數（不含載入失敗的檔案）
+	Pending  []string    `json:"pending"`  // 已變更、等待索引或等待重試的檔案
+	Failures []FileError `json:"failures"` // 載入或索引失敗的檔案
+	LastRun  *SyncRun    `json:"last_run,omitempty"`
+}
+
+// Run 每隔 Interval 掃描一次，直到 ctx 結束；第一次同步可先呼叫 [DirSyncer.Sync] 並等待結果
+func (s *DirSyncer) Run(ctx context.Context) {
+	interval := s.Interval
+	if interval <= 0 {
+		interval = DefaultSyncInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if _, err := s.Sync(ctx); err != nil && ctx.Err() == nil {
+			slog.ErrorContext(ctx, "同步文檔目錄失敗", "dir", s.Root, "error", err)
+		}
+	}
+}
+
+// Sync 掃描目錄一次，將變更送入索引工作並等待完成，回傳這次的結果
+func (s *DirSyncer) Sync(ctx context.Context) (*SyncRun, error) {
+	s.mu.Lock()
+	if s.running {
+		s.mu.Unlock()
+		return nil, errors.New("目錄同步正在進行中")
+	}
+	s.running = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.running = false
+		s.mu.Unlock()
+	}()
+
+	if err := s.loadState(); err != nil {
+		if s.OnSync != nil {
+			s.OnSync(nil, err)
+		}
+		return nil, err
+	}
+	run := &SyncRun{StartedAt: time.Now().UTC()}
+	err := s.sync(ctx, run)
+	run.FinishedAt = time.Now().UTC()
+	if err != nil {
+		run.Error = err.Error()
+	}
+
+	s.mu.Lock()
+	s.state.LastRun = run
+	saveErr := s.saveState()
+	s.mu.Unlock()
+	if saveErr != nil {
+		slog.WarnContext(ctx, "無法保存目錄同步狀態", "path", s.StatePath, "error", saveErr)
+	}
+	if s.OnSync != nil {
+		s.OnSync(run, err)
+	}
+	return run, err
+}
+
+// sync 比對目錄與狀態，載入變更的檔案並送出索引工作
+func (s *DirSyncer) sync(ctx context.Context, run *SyncRun) error {
+	files, err := WalkFiles(s.Root, s.Options)
+	if err != nil {
+		return fmt.Errorf("掃描目錄 %s 失敗: %w", s.Root, err)
+	}
+
+	s.mu.Lock()
+	known := maps.Clone(s.state.Files)
+	last := s.state.LastRun
+	run.Full = last == nil || (last.Full && last.Error != "")
+	retry := maps.Clone(s.pending)
+	s.mu.Unlock()
+
+	// 找出新增、變更或上次索引失敗的檔案，以及已刪除的檔案
+	current := make(map[string]*syncedFile, len(files))
+	var changed []string
+	for _, rel := range files {
+		info, err := os.Stat(filepath.Join(s.Root, filepath.FromSlash(rel)))
+		if err != nil {
+			continue // 掃描後被刪除
+		}
+		f := &syncedFile{Size: info.Size(), ModTime: info.ModTime().UTC()}
+		current[rel] = f
+		old, ok := known[rel]
+		_, failed := retry[rel]
+		if run.Full || failed || !ok || old.Size != f.Size || !old.ModTime.Equal(f.ModTime) {
+			changed = append(changed, rel)
+		}
+	}
+	var removed []string
+	for rel := range known {
+		if _, ok := current[rel]; !ok {
+			removed = append(removed, rel)
+		}
+	}
+	slices.Sort(removed)
+	run.Changed, run.Removed = len(changed), len(removed)
+	if len(changed) == 0 && len(removed) == 0 {
+		return nil
+	}
+
+	s.mu.Lock()
+	for _, rel := range slices.Concat(changed, removed) {
+		s.pending[rel] = struct{}{}
+	}
+	s.mu.Unlock()
+
+	// 載入變更的檔案，文件 ID 與來源為相對於根目錄的路徑（與 LoadDir 相同）；
+	// 檔案中不再產生的文件（例如 PDF 減少的頁數）一併刪除
+	var (
+		docs      []*ai.Document
+		deleteIDs []string
+		keepIDs   []string // 載入失敗的檔案先前索引的文件，完整同步時不刪除
+	)
+	for _, rel := range changed {
+		f := current[rel]
+		data, err := os.ReadFile(filepath.Join(s.Root, filepath.FromSlash(rel)))
+		var loaded []*ai.Document
+		if err == nil {
+			loaded, err = loadFile(rel, data)
+		}
+		if err != nil {
+			// 保留先前索引的文件與其 ID，檔案修正或刪除時才能移除舊文件
+			f.Error = err.Error()
+			f.DocumentIDs = s.indexedIDs(rel, known[rel])
+			keepIDs = append(keepIDs, f.DocumentIDs...)
+			slog.WarnContext(ctx, "載入檔案失敗", "file", rel, "error", err)
+			continue
+		}
+		for _, doc := range loaded {
+			f.DocumentIDs = append(f.DocumentIDs, vectorstore.DocID(doc))
+		}
+		docs = append(docs, loaded...)
+		if old, ok := known[rel]; ok {
+			for _, id := range old.DocumentIDs {
+				if !slices.Contains(f.DocumentIDs, id) {
+					deleteIDs = append(deleteIDs, id)
+				}
+			}
+		}
+	}
+	for _, rel := range removed {
+		deleteIDs = append(deleteIDs, known[rel].DocumentIDs...)
+	}
+
+	// 完整同步時目錄即為全部的文件，否則只處理變更的部分
+	var job Job
+	if run.Full {
+		job, err = s.Jobs.SubmitSync(docs, keepIDs, OriginDir)
+	} else {
+		job, err = s.Jobs.SubmitChanges(docs, deleteIDs, OriginDir)
+	}
+	if err != nil {
+		return err // 變更的檔案仍在 pending，下次掃描重試
+	}
+	run.JobID = job.ID
+	slog.InfoContext(ctx, "正在同步文檔目錄", "dir", s.Root, "full", run.Full,
+		"changed", len(changed), "removed", len(removed), "job_id", job.ID)
+	job, err = s.Jobs.Wait(ctx, job.ID)
+	if err != nil {
+		return err
+	}
+	run.Report = job.Report
+
+	// 依索引結果更新狀態：檔案的文件全部成功才記錄，失敗的檔案保留在 pending，下次掃描重試
+	failed := make(map[string]string)
+	if job.Report != nil {
+		for _, e := range job.Report.Failed {
+			failed[e.DocumentID] = e.Error
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if run.Full {
+		s.state.Files = make(map[string]*syncedFile)
+	}
+	for _, rel := range changed {
+		f := current[rel]
+		if msg := firstFailure(f.DocumentIDs, failed); msg != "" {
+			s.failed[rel] = msg
+			continue
+		}
+		s.state.Files[rel] = f
+		delete(s.pending, rel)
+		delete(s.failed, rel)
+	}
+	for _, rel := range removed {
+		if msg := firstFailure(known[rel].DocumentIDs, failed); msg != "" {
+			s.failed[rel] = msg
+			continue
+		}
+		delete(s.state.Files, rel)
+		delete(s.pending, rel)
+		delete(s.failed, rel)
+	}
+	return nil
+}
+
+// loadFile 以 LoadBytes 載入檔案；載入器 panic 時轉為錯誤，避免單一損毀的檔案中斷背景同步
+func loadFile(rel string, data []byte) (docs []*ai.Document, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			docs, err = nil, fmt.Errorf("無法載入 %s: %v", rel, r)
+		}
+	}()
+	return LoadBytes(rel, data)
+}
+
+// indexedIDs 回傳檔案先前索引的文件 ID：有狀態時取自狀態，
+// 沒有狀態時（例如完整同步）為文件清單中由目錄同步加入且來源為此檔案的文件
+func (s *DirSyncer) indexedIDs(rel string, old *syncedFile) []string {
+	if old != nil {
+		return old.DocumentIDs
+	}
+	var ids []string
+	for _, rec := range s.Jobs.pipeline.Registry.List() {
+		if rec.Metadata[MetaOrigin] == OriginDir && rec.Metadata[MetaSource] == rel {
+			ids = append(ids, rec.ID)
+		}
+	}
+	return ids
+}
+
+// firstFailure 回傳 ids 中第一個索引失敗的錯誤，全部成功時回傳空字串
+func firstFailure(ids []string, failed map[string]string) string {
+	for _, id := range ids {
+		if msg, ok := failed[id]; ok {
+			return msg
+		}
+	}
+	return ""
+}
+
+// Status 回傳目前的同步狀態
+func (s *DirSyncer) Status() SyncStatus {
+	interval := s.Interval
+	if interval <= 0 {
+		interval = DefaultSyncInterval
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status := SyncStatus{
+		Root:     s.Root,
+		Interval: interval.String(),
+		Running:  s.running,
+		Pending:  append([]string{}, slices.Sorted(maps.Keys(s.pending))...),
+		Failures: []FileError{},
+	}
+	if s.state == nil {
+		return status
+	}
+	for _, rel := range slices.Sorted(maps.Keys(s.state.Files)) {
+		if f := s.state.Files[rel]; f.Error != "" {
+			status.Failures = append(status.Failures, FileError{File: rel, Error: f.Error})
+		} else {
+			status.Files++
+		}
+	}
+	for _, rel := range slices.Sorted(maps.Keys(s.failed)) {
+		status.Failures = append(status.Failures, FileError{File: rel, Error: s.failed[rel]})
+	}
+	status.LastRun = s.state.LastRun
+	return status
+}
+
+// StatusHandler 回傳查詢同步狀態的 gin handler
+func (s *DirSyncer) StatusHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, s.Status())
+	}
+}
+
+// loadState 第一次同步前讀取狀態檔
+func (s *DirSyncer) loadState() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.loaded {
+		return nil
+	}
+	s.state = &syncState{Files: make(map[string]*syncedFile)}
+	s.pending = make(map[string]struct{})
+	s.failed = make(map[string]string)
+	if s.StatePath != "" {
+		data, err := os.ReadFile(s.StatePath)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+		case err != nil:
+			return err
+		default:
+			if err := json.Unmarshal(data, s.state); err != nil {
+				return fmt.Errorf("解析目錄同步狀態 %s 失敗: %w", s.StatePath, err)
+			}
+			if s.state.Files == nil {
+				s.state.Files = make(map[string]*syncedFile)
+			}
+		}
+	}
+	s.loaded = true
+	return nil
+}
+
+// saveState 以暫存檔加上 rename 的方式寫入狀態檔（呼叫者需持有鎖）
+func (s *DirSyncer) saveState() error {
+	if s.StatePath == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(s.StatePath), 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(s.state, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.StatePath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.StatePath)
+}
@@ -0,0 +1,248 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/firebase/genkit/go/ai"
+)
+
+// newTestSyncer 建立同步 root 目錄的 DirSyncer，狀態保存在 statePath
+func newTestSyncer(q *JobQueue, root, statePath string) *DirSyncer {
+	return &DirSyncer{Root: root, Jobs: q, StatePath: statePath}
+}
+
+// submitAndWait 以指定來源加入文件並等待索引完成
+func submitAndWait(t *testing.T, q *JobQueue, docs []*ai.Document, origin string) {
+	t.Helper()
+	job, err := q.Submit(docs, origin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job, err = q.Wait(context.Background(), job.ID); err != nil || job.Status != JobSucceeded {
+		t.Fatalf("索引工作 = %+v, %v", job, err)
+	}
+}
+
+func TestDirSyncerIncremental(t *testing.T) {
+	ctx := context.Background()
+	root, statePath := t.TempDir(), filepath.Join(t.TempDir(), "sync.json")
+	p := newTestPipeline(t, newFakeIndexer())
+	q := NewJobQueue(t.Context(), p)
+	writeFiles(t, root, map[string]string{"a.md": "第一份", "b.md": "第二份"})
+
+	steps := []struct {
+		name    string
+		change  func()
+		full    bool
+		changed int
+		removed int
+		want    []string
+	}{
+		{name: "first sync", full: true, changed: 2, want: []string{"a.md", "b.md"}},
+		{
+			name: "modify, add and delete",
+			change: func() {
+				writeFiles(t, root, map[string]string{"a.md": "第一份（已修改）", "docs/c.md": "第三份"})
+				if err := os.Remove(filepath.Join(root, "b.md")); err != nil {
+					t.Fatal(err)
+				}
+			},
+			changed: 2, removed: 1, want: []string{"a.md", "docs/c.md"},
+		},
+		{name: "unchanged", want: []string{"a.md", "docs/c.md"}},
+	}
+	s := newTestSyncer(q, root, statePath)
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			if step.change != nil {
+				step.change()
+			}
+			run, err := s.Sync(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if run.Full != step.full || run.Changed != step.changed || run.Removed != step.removed {
+				t.Errorf("Sync() = full %v changed %d removed %d, want %v %d %d",
+					run.Full, run.Changed, run.Removed, step.full, step.changed, step.removed)
+			}
+			if (run.JobID != "") != (step.changed+step.removed > 0) {
+				t.Errorf("JobID = %q", run.JobID)
+			}
+			if got := registryIDs(p.Registry); !slices.Equal(got, step.want) {
+				t.Errorf("文件 = %v, want %v", got, step.want)
+			}
+		})
+	}
+
+	// 重新啟動後依狀態檔比對，沒有變更的檔案不重新索引
+	run, err := newTestSyncer(q, root, statePath).Sync(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run.Full || run.Changed != 0 || run.JobID != "" {
+		t.Errorf("重新啟動後的同步 = %+v，預期沒有變更", run)
+	}
+}
+
+func TestDirSyncerFullSync(t *testing.T) {
+	const badMarkdown = "---\ntitle: [unclosed\n---\n內容"
+	ctx := context.Background()
+	p := newTestPipeline(t, newFakeIndexer())
+	q := NewJobQueue(t.Context(), p)
+
+	// 先前的目錄同步、API 與啟動時加入的文件
+	dirDoc := func(rel string) *ai.Document {
+		return ai.DocumentFromText("舊內容 "+rel, map[string]any{MetaID: rel, MetaSource: rel})
+	}
+	submitAndWait(t, q, []*ai.Document{dirDoc("bad.md"), dirDoc("gone.md")}, OriginDir)
+	submitAndWait(t, q, []*ai.Document{testDoc("uploaded", "API 文件")}, OriginAPI)
+	submitAndWait(t, q, []*ai.Document{testDoc("sample", "範例文件")}, OriginStartup)
+
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{"good.md": "正常的檔案", "bad.md": badMarkdown})
+	s := newTestSyncer(q, root, "") // 沒有狀態檔，第一次掃描為完整同步
+	run, err := s.Sync(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !run.Full {
+		t.Fatalf("Sync() = %+v，預期為完整同步", run)
+	}
+
+	ids := registryIDs(p.Registry)
+	tests := []struct {
+		id   string
+		kept bool
+	}{
+		{"good.md", true},
+		{"bad.md", true}, // 載入失敗的檔案保留先前索引的文件
+		{"gone.md", false},
+		{"uploaded", true}, // 其他來源的文件不受影響
+		{"sample", true},
+	}
+	for _, tt := range tests {
+		if got := slices.Contains(ids, tt.id); got != tt.kept {
+			t.Errorf("%s 保留 = %v, want %v（文件 %v）", tt.id, got, tt.kept, ids)
+		}
+	}
+	if st := s.Status(); len(st.Failures) != 1 || st.Failures[0].File != "bad.md" {
+		t.Errorf("Failures = %+v，預期只有 bad.md", st.Failures)
+	}
+
+	// 修正後的檔案取代舊文件，刪除檔案時一併移除
+	writeFiles(t, root, map[string]string{"bad.md": "已修正的檔案內容"})
+	if _, err := s.Sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if rec, ok := p.Registry.Get("bad.md"); !ok || rec.Metadata[MetaOrigin] != OriginDir {
+		t.Errorf("修正後的 bad.md = %+v, %v", rec, ok)
+	}
+	if err := os.Remove(filepath.Join(root, "bad.md")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := p.Registry.Get("bad.md"); ok {
+		t.Error("刪除檔案後仍保留 bad.md")
+	}
+}
+
+func TestDirSyncerRetry(t *testing.T) {
+	ctx := context.Background()
+	idx := newFakeIndexer()
+	idx.fail = errors.New("向量資料庫無法連線")
+	p := newTestPipeline(t, idx)
+	q := NewJobQueue(t.Context(), p)
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{"a.md": "內容"})
+	s := newTestSyncer(q, root, "")
+
+	run, err := s.Sync(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run.Report == nil || len(run.Report.Failed) != 1 {
+		t.Fatalf("Report = %+v，預期索引失敗", run.Report)
+	}
+	if st := s.Status(); st.Files != 0 || !slices.Equal(st.Pending, []string{"a.md"}) || len(st.Failures) != 1 {
+		t.Errorf("失敗後的狀態 = %+v", st)
+	}
+
+	// 檔案沒有變更，下次掃描仍會重試
+	idx.mu.Lock()
+	idx.fail = nil
+	idx.mu.Unlock()
+	if run, err = s.Sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if run.Changed != 1 || run.Report == nil || len(run.Report.Added) != 1 {
+		t.Errorf("重試 = %+v", run)
+	}
+	if st := s.Status(); st.Files != 1 || len(st.Pending) != 0 || len(st.Failures) != 0 {
+		t.Errorf("重試後的狀態 = %+v", st)
+	}
+	if got := idx.ids(); len(got) == 0 {
+		t.Error("重試後向量資料庫沒有片段")
+	}
+}
+
+func TestDirSyncerBrokenPDF(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	p := newTestPipeline(t, newFakeIndexer())
+	q := NewJobQueue(ctx, p)
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{"a.md": "正常的檔案", "broken.pdf": string(corruptPDF(t))})
+
+	runs := make(chan *SyncRun, 10)
+	s := newTestSyncer(q, root, "")
+	s.Interval = 10 * time.Millisecond
+	s.OnSync = func(run *SyncRun, err error) {
+		if err != nil && ctx.Err() == nil {
+			t.Errorf("同步失敗: %v", err)
+		}
+		select {
+		case runs <- run:
+		default:
+		}
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.Run(ctx)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	// 第一次掃描：損毀的 PDF 記錄在狀態中並帶有錯誤，其他檔案照常索引
+	<-runs
+	s.mu.Lock()
+	f, ok := s.state.Files["broken.pdf"]
+	s.mu.Unlock()
+	if !ok || f.Error == "" {
+		t.Fatalf("broken.pdf 的狀態 = %+v, %v，預期記錄載入錯誤", f, ok)
+	}
+	if st := s.Status(); len(st.Failures) != 1 || st.Failures[0].File != "broken.pdf" || st.Files != 1 {
+		t.Errorf("Status() = %+v", st)
+	}
+
+	// 同步持續進行，之後新增的檔案仍會被索引
+	writeFiles(t, root, map[string]string{"b.md": "之後新增的檔案"})
+	deadline := time.After(5 * time.Second)
+	for !slices.Contains(registryIDs(p.Registry), "b.md") {
+		select {
+		case <-runs:
+		case <-deadline:
+			t.Fatalf("新增的檔案未被索引，文件 = %v", registryIDs(p.Registry))
+		}
+	}
+}
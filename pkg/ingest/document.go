@@ -0,0 +1,51 @@
+package ingest
+
+import (
+	"fmt"
+	"maps"
+	"strings"
+
+	"dongstudio.live/genkit_demo/pkg/vectorstore"
+	"github.com/firebase/genkit/go/ai"
+)
+
+// 片段 metadata 的欄位名稱
+const (
+	MetaID          = "id"           // 片段 ID：來源文件 ID 加上 "#" 與片段序號
+	MetaSourceID    = "source_id"    // 來源文件 ID
+	MetaChunkIndex  = "chunk_index"  // 片段在來源文件中的序號，從 0 開始
+	MetaChunkCount  = "chunk_count"  // 來源文件的片段總數
+	MetaStart       = "start"        // 片段在來源文件中的起始位置（byte）
+	MetaEnd         = "end"          // 片段在來源文件中的結束位置（byte，不含）
+	MetaHeadings    = "headings"     // 標題路徑 []string
+	MetaHeadingPath = "heading_path" // 以 " > " 串接的標題路徑，方便顯示與過濾
+)
+
+// SplitDocuments 以 chunker 切分每份文件，回傳的片段會複製來源文件的 metadata，
+// 並加上來源文件 ID、片段序號、位置與標題路徑；來源文件沒有 "id" 時以內容的 MD5 作為 ID
+func SplitDocuments(docs []*ai.Document, chunker Chunker) []*ai.Document {
+	var out []*ai.Document
+	for _, doc := range docs {
+		text := vectorstore.DocText(doc)
+		sourceID := vectorstore.DocID(doc)
+		chunks := chunker.Chunk(text)
+		for i, ch := range chunks {
+			metadata := maps.Clone(doc.Metadata)
+			if metadata == nil {
+				metadata = make(map[string]any)
+			}
+			metadata[MetaID] = fmt.Sprintf("%s#%d", sourceID, i)
+			metadata[MetaSourceID] = sourceID
+			metadata[MetaChunkIndex] = i
+			metadata[MetaChunkCount] = len(chunks)
+			metadata[MetaStart] = ch.Start
+			metadata[MetaEnd] = ch.End
+			if len(ch.Headings) > 0 {
+				metadata[MetaHeadings] = ch.Headings
+				metadata[MetaHeadingPath] = strings.Join(ch.Headings, " > ")
+			}
+			out = append(out, ai.DocumentFromText(ch.Text, metadata))
+		}
+	}
+	return out
+}
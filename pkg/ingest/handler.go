@@ -0,0 +1,269 @@
+package ingest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"dongstudio.live/genkit_demo/pkg/vectorstore"
+	"github.com/firebase/genkit/go/ai"
+	"github.com/gin-gonic/gin"
+)
+
+// maxUploadSize 為單次上傳的大小上限
+const maxUploadSize = 32 << 20
+
+// documentInput 為以 JSON 新增的文件
+type documentInput struct {
+	ID       string         `json:"id"`
+	Content  string         `json:"content"`
+	Metadata map[string]any `json:"metadata"`
+}
+
+// documentSummary 為文件列表中的一筆，不含內容
+type documentSummary struct {
+	ID        string         `json:"id"`
+	Metadata  map[string]any `json:"metadata,omitempty"`
+	Chunks    int            `json:"chunks"`
+	CreatedAt string         `json:"created_at"`
+	UpdatedAt string         `json:"updated_at"`
+}
+
+// RegisterRoutes 註冊文件管理 API，新增的文件會在背景索引，不影響檢索
+//
+//	POST   /documents      新增文件，JSON {"documents":[{"id","content","metadata"}]}
+//	                       或以 multipart/form-data 上傳檔案（欄位 file，可多個；metadata 欄位為套用到所有檔案的 JSON）
+//	                       回應 202 與工作進度，可再以 GET /jobs/:id 查詢；佇列已滿時回應 503
+//	                       上傳時的 metadata 不可包含 id、page 等載入與切分時產生的欄位
+//	GET    /documents      列出所有文件與 metadata
+//	GET    /documents/*id  取得一份文件（含內容）
+//	DELETE /documents/*id  從向量資料庫刪除文件，回應 202 與刪除工作
+//	GET    /jobs           列出索引工作
+//	GET    /jobs/:id       查詢索引工作進度
+//
+// 文件 ID 可能包含 /（例如目錄中的檔案路徑），因此使用萬用路徑參數
+func RegisterRoutes(r gin.IRouter, p *Pipeline, q *JobQueue) {
+	RegisterScopedRoutes(r, func(*gin.Context) (*Pipeline, *JobQueue, bool) { return p, q, true })
+}
+
+// Resolver 依請求選擇文件管理 API 操作的 pipeline 與工作佇列，例如依呼叫者所屬的 namespace；
+// 無法處理請求時應自行回應錯誤並回傳 false
+type Resolver func(c *gin.Context) (*Pipeline, *JobQueue, bool)
+
+// RegisterScopedRoutes 與 [RegisterRoutes] 相同，但每個請求操作的 pipeline 與工作佇列由 resolve 決定，
+// 不同 namespace 的文件與索引工作彼此隔離
+func RegisterScopedRoutes(r gin.IRouter, resolve Resolver) {
+	r.POST("/documents", func(c *gin.Context) {
+		_, q, ok := resolve(c)
+		if !ok {
+			return
+		}
+		docs, err := parseDocuments(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		job, err := q.Submit(docs, OriginAPI)
+		if err != nil {
+			queueError(c, err)
+			return
+		}
+		c.Header("Location", "/jobs/"+job.ID)
+		c.JSON(http.StatusAccepted, job)
+	})
+
+	r.GET("/documents", func(c *gin.Context) {
+		p, _, ok := resolve(c)
+		if !ok {
+			return
+		}
+		records := p.Registry.List()
+		docs := make([]documentSummary, 0, len(records))
+		for _, rec := range records {
+			docs = append(docs, documentSummary{
+				ID:        rec.ID,
+				Metadata:  rec.Metadata,
+				Chunks:    len(rec.ChunkIDs),
+				CreatedAt: rec.CreatedAt.Format(time.RFC3339),
+				UpdatedAt: rec.UpdatedAt.Format(time.RFC3339),
+			})
+		}
+		c.JSON(http.StatusOK, gin.H{"documents": docs})
+	})
+
+	r.GET("/documents/*id", func(c *gin.Context) {
+		p, _, ok := resolve(c)
+		if !ok {
+			return
+		}
+		rec, ok := p.Registry.Get(documentID(c))
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "找不到文件"})
+			return
+		}
+		withContent := *rec
+		content, err := p.Registry.Content(rec.ID)
+		if err != nil {
+			c.Error(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "無法讀取文件內容"})
+			return
+		}
+		withContent.Content = content
+		c.JSON(http.StatusOK, withContent)
+	})
+
+	r.DELETE("/documents/*id", func(c *gin.Context) {
+		p, q, ok := resolve(c)
+		if !ok {
+			return
+		}
+		id := documentID(c)
+		if _, ok := p.Registry.Get(id); !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "找不到文件"})
+			return
+		}
+		// 刪除與索引經由同一個佇列依序執行，避免與進行中的同步同時修改索引
+		job, err := q.SubmitChanges(nil, []string{id}, OriginAPI)
+		if err != nil {
+			queueError(c, err)
+			return
+		}
+		c.Header("Location", "/jobs/"+job.ID)
+		c.JSON(http.StatusAccepted, job)
+	})
+
+	r.GET("/jobs", func(c *gin.Context) {
+		_, q, ok := resolve(c)
+		if !ok {
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"jobs": q.List()})
+	})
+
+	r.GET("/jobs/:id", func(c *gin.Context) {
+		_, q, ok := resolve(c)
+		if !ok {
+			return
+		}
+		job, ok := q.Get(c.Param("id"))
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "找不到工作"})
+			return
+		}
+		c.JSON(http.StatusOK, job)
+	})
+}
+
+// queueError 回應無法加入索引工作的錯誤：佇列已滿或已停止時回應 503
+func queueError(c *gin.Context, err error) {
+	c.Error(err)
+	if errors.Is(err, ErrQueueFull) {
+		c.Header("Retry-After", "5")
+	}
+	c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+}
+
+func documentID(c *gin.Context) string {
+	return strings.TrimPrefix(c.Param("id"), "/")
+}
+
+// parseDocuments 依 Content-Type 解析 JSON 或上傳的檔案
+func parseDocuments(c *gin.Context) ([]*ai.Document, error) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxUploadSize)
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		return parseUpload(c)
+	}
+
+	var req struct {
+		Documents []documentInput `json:"documents"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		return nil, err
+	}
+	if len(req.Documents) == 0 {
+		return nil, errors.New("documents 不可為空")
+	}
+	docs := make([]*ai.Document, 0, len(req.Documents))
+	for _, in := range req.Documents {
+		if strings.TrimSpace(in.Content) == "" {
+			return nil, errors.New("文件內容不可為空")
+		}
+		if err := checkMetadata(in.Metadata, chunkMetadata); err != nil {
+			return nil, err
+		}
+		metadata := in.Metadata
+		if metadata == nil {
+			metadata = make(map[string]any)
+		}
+		if in.ID != "" {
+			metadata[MetaID] = in.ID
+		}
+		docs = append(docs, ai.DocumentFromText(in.Content, metadata))
+	}
+	return docs, nil
+}
+
+// chunkMetadata 為索引、切分與檢索時產生的 metadata 欄位，使用者不可指定
+var chunkMetadata = []string{MetaOrigin, MetaSourceID, MetaChunkIndex, MetaChunkCount, MetaStart, MetaEnd, MetaHeadings, MetaHeadingPath, vectorstore.ScoreKey}
+
+// checkMetadata 確認 metadata 不含保留欄位
+func checkMetadata(metadata map[string]any, reserved []string) error {
+	for _, key := range reserved {
+		if _, ok := metadata[key]; ok {
+			return fmt.Errorf("metadata 不可包含保留欄位 %s", key)
+		}
+	}
+	return nil
+}
+
+// parseUpload 以副檔名選擇載入器轉換上傳的檔案，PDF 會依頁數產生多份文件
+func parseUpload(c *gin.Context) ([]*ai.Document, error) {
+	form, err := c.MultipartForm()
+	if err != nil {
+		return nil, err
+	}
+	files := form.File["file"]
+	if len(files) == 0 {
+		return nil, errors.New("缺少上傳檔案欄位 file")
+	}
+
+	var extra map[string]any
+	if v := c.PostForm("metadata"); v != "" {
+		if err := json.Unmarshal([]byte(v), &extra); err != nil {
+			return nil, errors.New("metadata 必須是 JSON 物件")
+		}
+	}
+	// 套用到所有檔案的 metadata 若包含 id，PDF 的每一頁會變成同一份文件而互相覆蓋
+	if err := checkMetadata(extra, slices.Concat([]string{MetaID, MetaPage, MetaPages}, chunkMetadata)); err != nil {
+		return nil, err
+	}
+
+	var docs []*ai.Document
+	for _, fh := range files {
+		f, err := fh.Open()
+		if err != nil {
+			return nil, err
+		}
+		data, err := io.ReadAll(f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		loaded, err := LoadBytes(fh.Filename, data)
+		if err != nil {
+			return nil, err
+		}
+		for _, doc := range loaded {
+			for k, v := range extra {
+				doc.Metadata[k] = v
+			}
+		}
+		docs = append(docs, loaded...)
+	}
+	return docs, nil
+}
@@ -0,0 +1,219 @@
+package ingest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/gin-gonic/gin"
+)
+
+func newTestRouter(t *testing.T, idx Indexer) (*gin.Engine, *Pipeline, *JobQueue) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	p := newTestPipeline(t, idx)
+	q := NewJobQueue(ctx, p)
+	r := gin.New()
+	RegisterRoutes(r, p, q)
+	return r, p, q
+}
+
+func serve(r http.Handler, req *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func jsonRequest(method, target, body string) *http.Request {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	return req
+}
+
+// waitJob 解析 202 回應中的工作並等待完成
+func waitJob(t *testing.T, q *JobQueue, w *httptest.ResponseRecorder) Job {
+	t.Helper()
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body)
+	}
+	var job Job
+	if err := json.Unmarshal(w.Body.Bytes(), &job); err != nil {
+		t.Fatal(err)
+	}
+	job, err := q.Wait(context.Background(), job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return job
+}
+
+func TestDocumentsAPI(t *testing.T) {
+	idx := newFakeIndexer()
+	r, p, q := newTestRouter(t, idx)
+
+	w := serve(r, jsonRequest(http.MethodPost, "/documents",
+		`{"documents":[{"id":"guides/a","content":"alpha","metadata":{"lang":"en"}},{"id":"b","content":"beta"}]}`))
+	job := waitJob(t, q, w)
+	if job.Status != JobSucceeded || !slices.Equal(job.Report.Added, []string{"guides/a", "b"}) {
+		t.Fatalf("job = %+v, report = %+v", job, job.Report)
+	}
+
+	w = serve(r, httptest.NewRequest(http.MethodGet, "/documents/guides/a", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"lang":"en"`) {
+		t.Fatalf("GET /documents/guides/a = %d %s", w.Code, w.Body)
+	}
+
+	job = waitJob(t, q, serve(r, httptest.NewRequest(http.MethodDelete, "/documents/guides/a", nil)))
+	if !slices.Equal(job.Report.Deleted, []string{"guides/a"}) {
+		t.Fatalf("刪除工作 report = %+v", job.Report)
+	}
+	if got := registryIDs(p.Registry); !slices.Equal(got, []string{"b"}) {
+		t.Errorf("刪除後的文件 = %v", got)
+	}
+	if got := idx.ids(); !slices.Equal(got, []string{"b"}) {
+		t.Errorf("刪除後的片段 = %v", got)
+	}
+
+	w = serve(r, httptest.NewRequest(http.MethodDelete, "/documents/guides/a", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("刪除不存在的文件回應 %d, want 404", w.Code)
+	}
+}
+
+func TestDocumentsAPIRejectsBadInput(t *testing.T) {
+	r, _, _ := newTestRouter(t, newFakeIndexer())
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"empty documents", `{"documents":[]}`},
+		{"empty content", `{"documents":[{"id":"a","content":"  "}]}`},
+		{"reserved chunk metadata", `{"documents":[{"id":"a","content":"x","metadata":{"chunk_index":3}}]}`},
+		{"reserved score metadata", `{"documents":[{"id":"a","content":"x","metadata":{"score":0.9}}]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := serve(r, jsonRequest(http.MethodPost, "/documents", tt.body)); w.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want 400", w.Code)
+			}
+		})
+	}
+}
+
+// uploadRequest 建立上傳檔案的 multipart 請求
+func uploadRequest(t *testing.T, filename string, data []byte, metadata string) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, err := mw.CreateFormFile("file", filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write(data)
+	if metadata != "" {
+		mw.WriteField("metadata", metadata)
+	}
+	mw.Close()
+	req := httptest.NewRequest(http.MethodPost, "/documents", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return req
+}
+
+func TestDocumentsAPIUploadPDF(t *testing.T) {
+	data, err := os.ReadFile("../../05_mutimodal/test.pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, p, q := newTestRouter(t, newFakeIndexer())
+
+	job := waitJob(t, q, serve(r, uploadRequest(t, "test.pdf", data, `{"team":"docs"}`)))
+	if len(job.Report.Added) != 3 {
+		t.Fatalf("上傳 3 頁的 PDF 新增了 %v", job.Report.Added)
+	}
+	for _, rec := range p.Registry.List() {
+		if rec.Metadata["team"] != "docs" {
+			t.Errorf("%s 的 metadata = %v，預期包含上傳時的 team", rec.ID, rec.Metadata)
+		}
+	}
+
+	for _, key := range []string{"id", "page", "chunk_index"} {
+		w := serve(r, uploadRequest(t, "test.pdf", data, `{"`+key+`":"x"}`))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("metadata 包含 %s 時回應 %d, want 400", key, w.Code)
+		}
+	}
+}
+
+func TestJobQueueFull(t *testing.T) {
+	idx := newFakeIndexer()
+	idx.block = make(chan struct{})
+	defer close(idx.block)
+	r, _, q := newTestRouter(t, idx)
+
+	// 第一個工作被 worker 取出後卡在 Index，其餘填滿佇列
+	var err error
+	for i := 0; err == nil && i <= maxJobs+1; i++ {
+		_, err = q.Submit([]*ai.Document{testDoc("a", "alpha")}, OriginAPI)
+	}
+	if !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("佇列已滿時 Submit 回傳 %v, want ErrQueueFull", err)
+	}
+
+	w := serve(r, jsonRequest(http.MethodPost, "/documents", `{"documents":[{"id":"b","content":"beta"}]}`))
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") == "" {
+		t.Errorf("佇列已滿時回應 %d（Retry-After %q），want 503", w.Code, w.Header().Get("Retry-After"))
+	}
+}
+
+func TestJobQueueStopped(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	q := NewJobQueue(ctx, newTestPipeline(t, newFakeIndexer()))
+	cancel()
+	if _, err := q.Submit([]*ai.Document{testDoc("a", "alpha")}, OriginAPI); !errors.Is(err, ErrQueueStopped) {
+		t.Errorf("停止後 Submit 回傳 %v, want ErrQueueStopped", err)
+	}
+}
+
+func TestJobQueueDeleteAll(t *testing.T) {
+	ctx := context.Background()
+	idx := newFakeIndexer()
+	p := newTestPipeline(t, idx)
+	q := NewJobQueue(t.Context(), p)
+
+	added, err := q.Submit([]*ai.Document{testDoc("a", "alpha")}, OriginAPI)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.Wait(ctx, added.ID); err != nil {
+		t.Fatal(err)
+	}
+	// 排在刪除工作之前的文件也會被刪除
+	if _, err := q.SubmitSync([]*ai.Document{testDoc("b", "beta")}, nil, OriginStartup); err != nil {
+		t.Fatal(err)
+	}
+	job, err := q.SubmitDeleteAll(OriginAPI)
+	if err != nil {
+		t.Fatal(err)
+	}
+	job, err = q.Wait(ctx, job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != JobSucceeded || !slices.Equal(job.Report.Deleted, []string{"a", "b"}) || !slices.Equal(job.DeleteIDs, []string{"a", "b"}) {
+		t.Fatalf("job = %+v, report = %+v", job, job.Report)
+	}
+	if p.Registry.Len() != 0 || len(idx.ids()) != 0 {
+		t.Errorf("刪除後仍有文件 %v、片段 %v", registryIDs(p.Registry), idx.ids())
+	}
+}
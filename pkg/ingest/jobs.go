@@ -0,0 +1,266 @@
+package ingest
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"dongstudio.live/genkit_demo/pkg/vectorstore"
+	"github.com/firebase/genkit/go/ai"
+)
+
+// JobStatus 為索引工作的狀態
+type JobStatus string
+
+const (
+	JobQueued    JobStatus = "queued"
+	JobRunning   JobStatus = "running"
+	JobSucceeded JobStatus = "succeeded"
+	JobFailed    JobStatus = "failed" // 至少一份文件索引失敗
+)
+
+// Job 為一次背景索引工作的進度
+type Job struct {
+	ID          string     `json:"id"`
+	Status      JobStatus  `json:"status"`
+	Total       int        `json:"total"`
+	Processed   int        `json:"processed"`
+	Failed      int        `json:"failed"`
+	Origin      string     `json:"origin,omitempty"`   // 文件的來源，見 OriginStartup 等常數
+	Prune       bool       `json:"prune"`              // 是否刪除相同來源但不在此次文件集合中的已索引文件
+	KeepIDs     []string   `json:"keep_ids,omitempty"` // Prune 時保留的文件
+	DocumentIDs []string   `json:"document_ids"`
+	DeleteIDs   []string   `json:"delete_ids,omitempty"` // 要刪除的文件
+	DeleteAll   bool       `json:"delete_all,omitempty"` // 刪除所有已索引的文件，開始執行後 DeleteIDs 為實際刪除的文件
+	Report      *Report    `json:"report,omitempty"`     // 工作完成後的同步結果
+	CreatedAt   time.Time  `json:"created_at"`
+	StartedAt   *time.Time `json:"started_at,omitempty"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+}
+
+// maxJobs 為保留的工作記錄數，超過時移除最舊的已完成工作
+const maxJobs = 100
+
+// 加入工作失敗時回傳的錯誤
+var (
+	ErrQueueFull    = errors.New("索引工作佇列已滿，請稍後再試")
+	ErrQueueStopped = errors.New("索引工作佇列已停止")
+)
+
+// JobQueue 依序在背景執行索引工作，索引期間檢索不受影響
+type JobQueue struct {
+	pipeline *Pipeline
+	queue    chan *queuedJob
+	stopped  <-chan struct{} // worker 停止後關閉
+
+	mu    sync.RWMutex
+	jobs  map[string]*queuedJob
+	order []string // 工作 ID，依建立時間排序
+}
+
+type queuedJob struct {
+	Job
+	docs []*ai.Document
+	done chan struct{}
+}
+
+// NewJobQueue 建立工作佇列並啟動背景 worker，ctx 結束時停止
+func NewJobQueue(ctx context.Context, pipeline *Pipeline) *JobQueue {
+	q := &JobQueue{
+		pipeline: pipeline,
+		queue:    make(chan *queuedJob, maxJobs),
+		stopped:  ctx.Done(),
+		jobs:     make(map[string]*queuedJob),
+	}
+	go q.run(ctx)
+	return q
+}
+
+// Submit 加入一個索引工作並立即回傳，工作會在背景執行，origin 為文件的來源
+// 內容未變更的文件會被略過，其他已索引的文件不受影響
+// 佇列已滿時回傳 [ErrQueueFull]，worker 已停止時回傳 [ErrQueueStopped]，以下各 Submit 方法相同
+func (q *JobQueue) Submit(docs []*ai.Document, origin string) (Job, error) {
+	return q.submit(docs, Job{Origin: origin})
+}
+
+// SubmitSync 加入一個完整同步工作：docs 視為來源 origin 全部的文件，
+// 除了索引新增與變更的文件，也會刪除相同來源但不在 docs 與 keepIDs 中的已索引文件，其他來源的文件不受影響
+func (q *JobQueue) SubmitSync(docs []*ai.Document, keepIDs []string, origin string) (Job, error) {
+	return q.submit(docs, Job{Origin: origin, Prune: true, KeepIDs: slices.Clone(keepIDs)})
+}
+
+// SubmitChanges 加入一個工作：索引 docs 中新增與變更的文件，並刪除 deleteIDs 指定的文件，
+// 其他已索引的文件不受影響；所有寫入都經由佇列依序執行，不會與其他工作同時修改索引
+func (q *JobQueue) SubmitChanges(docs []*ai.Document, deleteIDs []string, origin string) (Job, error) {
+	return q.submit(docs, Job{Origin: origin, DeleteIDs: slices.Clone(deleteIDs)})
+}
+
+// SubmitDeleteAll 加入一個刪除所有已索引文件（不分來源）的工作；
+// 要刪除的文件在工作開始執行時才決定，排在前面的工作加入的文件也會被刪除
+func (q *JobQueue) SubmitDeleteAll(origin string) (Job, error) {
+	return q.submit(nil, Job{Origin: origin, DeleteAll: true})
+}
+
+// submit 以 job 的 Origin、Prune、KeepIDs、DeleteIDs 與 DeleteAll 建立工作並加入佇列
+func (q *JobQueue) submit(docs []*ai.Document, job Job) (Job, error) {
+	select {
+	case <-q.stopped:
+		return Job{}, ErrQueueStopped
+	default:
+	}
+
+	b := make([]byte, 8)
+	rand.Read(b)
+	job.ID = "job_" + hex.EncodeToString(b)
+	job.Status = JobQueued
+	job.Total = len(docs)
+	job.DocumentIDs = make([]string, 0, len(docs))
+	job.CreatedAt = time.Now().UTC()
+	j := &queuedJob{Job: job, docs: docs, done: make(chan struct{})}
+	for _, doc := range docs {
+		j.DocumentIDs = append(j.DocumentIDs, vectorstore.DocID(doc))
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	select {
+	case q.queue <- j:
+	default:
+		return Job{}, ErrQueueFull
+	}
+	q.jobs[j.ID] = j
+	q.order = append(q.order, j.ID)
+	q.prune()
+	return j.snapshot(), nil
+}
+
+// Get 回傳工作目前的進度
+func (q *JobQueue) Get(id string) (Job, bool) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	j, ok := q.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return j.snapshot(), true
+}
+
+// List 回傳所有工作，最新的在前
+func (q *JobQueue) List() []Job {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	jobs := make([]Job, 0, len(q.order))
+	for _, id := range slices.Backward(q.order) {
+		jobs = append(jobs, q.jobs[id].snapshot())
+	}
+	return jobs
+}
+
+// Wait 等待工作完成並回傳結果
+func (q *JobQueue) Wait(ctx context.Context, id string) (Job, error) {
+	q.mu.RLock()
+	j, ok := q.jobs[id]
+	q.mu.RUnlock()
+	if !ok {
+		return Job{}, nil
+	}
+	select {
+	case <-j.done:
+		job, _ := q.Get(id)
+		return job, nil
+	case <-ctx.Done():
+		return Job{}, ctx.Err()
+	}
+}
+
+func (q *JobQueue) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case j := <-q.queue:
+			q.process(ctx, j)
+		}
+	}
+}
+
+// process 同步文件並更新進度，單一批次失敗不影響其他批次
+func (q *JobQueue) process(ctx context.Context, j *queuedJob) {
+	defer close(j.done)
+	deleteIDs := j.DeleteIDs
+	if j.DeleteAll {
+		deleteIDs = nil
+		for _, rec := range q.pipeline.Registry.List() {
+			deleteIDs = append(deleteIDs, rec.ID)
+		}
+	}
+	q.update(j, func(job *Job) {
+		now := time.Now().UTC()
+		job.Status = JobRunning
+		job.StartedAt = &now
+		job.DeleteIDs = deleteIDs
+	})
+	slog.InfoContext(ctx, "開始索引工作", "job_id", j.ID, "documents", j.Total, "delete", len(deleteIDs))
+
+	report := q.pipeline.Sync(ctx, j.docs, SyncOptions{
+		Origin: j.Origin,
+		Prune:  j.Prune,
+		Keep:   j.KeepIDs,
+		Delete: deleteIDs,
+		Progress: func(processed, failed int) {
+			q.update(j, func(job *Job) {
+				job.Processed = processed
+				job.Failed = failed
+			})
+		},
+	})
+	for _, e := range report.Failed {
+		slog.ErrorContext(ctx, "索引文件失敗", "job_id", j.ID, "document_id", e.DocumentID, "error", e.Error)
+	}
+
+	q.update(j, func(job *Job) {
+		now := time.Now().UTC()
+		job.FinishedAt = &now
+		job.Report = report
+		job.Status = JobSucceeded
+		if len(report.Failed) > 0 {
+			job.Status = JobFailed
+		}
+	})
+	j.docs = nil
+	slog.InfoContext(ctx, "索引工作完成", "job_id", j.ID,
+		"added", len(report.Added), "updated", len(report.Updated), "skipped", len(report.Skipped),
+		"deleted", len(report.Deleted), "failed", len(report.Failed))
+}
+
+func (q *JobQueue) update(j *queuedJob, fn func(*Job)) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	fn(&j.Job)
+}
+
+// prune 移除超過上限的最舊已完成工作（呼叫者需持有鎖）
+func (q *JobQueue) prune() {
+	for len(q.order) > maxJobs {
+		idx := slices.IndexFunc(q.order, func(id string) bool { return q.jobs[id].FinishedAt != nil })
+		if idx < 0 {
+			return
+		}
+		delete(q.jobs, q.order[idx])
+		q.order = slices.Delete(q.order, idx, idx+1)
+	}
+}
+
+// snapshot 複製工作狀態，避免呼叫者讀取時與 worker 同時修改（呼叫者需持有鎖）
+func (j *queuedJob) snapshot() Job {
+	job := j.Job
+	job.DocumentIDs = slices.Clone(j.DocumentIDs)
+	job.KeepIDs = slices.Clone(j.KeepIDs)
+	job.DeleteIDs = slices.Clone(j.DeleteIDs)
+	return job
+}
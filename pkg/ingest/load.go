@@ -0,0 +1,116 @@
+package ingest
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/firebase/genkit/go/ai"
+)
+
+// 載入文件時加上的 metadata 欄位
+const (
+	MetaSource   = "source"    // 檔案路徑（以 / 分隔）
+	MetaFileName = "file_name" // 檔名
+	MetaFormat   = "format"    // 文件格式: markdown / html / text / pdf
+	MetaTitle    = "title"     // 標題，來自 front-matter、第一個標題或 <title>
+	MetaEncoding = "encoding"  // 純文字檔偵測到的編碼
+	MetaPage     = "page"      // PDF 頁碼，從 1 開始
+	MetaPages    = "pages"     // PDF 總頁數
+	MetaOrigin   = "origin"    // 文件由哪個管道加入索引，見 OriginStartup 等常數（與檔案路徑 source 不同）
+)
+
+// 文件的來源，記錄在 metadata 的 origin 欄位；完整同步（Prune）只會刪除相同來源的文件，
+// 例如重新啟動時同步內建文件不會刪除經由 API 上傳的文件
+const (
+	OriginStartup = "startup" // 服務啟動時載入的文件
+	OriginAPI     = "api"     // 經由 POST /documents 新增的文件
+	OriginDir     = "dir"     // 目錄同步（DirSyncer）的文件
+)
+
+// ErrUnsupported 表示沒有對應副檔名的載入器
+var ErrUnsupported = errors.New("不支援的檔案格式")
+
+// Loader 將檔案內容轉為文件，name 為檔案路徑，會作為文件的 ID 與來源
+type Loader func(name string, data []byte) ([]*ai.Document, error)
+
+// loaders 依副檔名（小寫）對應的載入器
+var loaders = map[string]Loader{
+	".md":       LoadMarkdown,
+	".markdown": LoadMarkdown,
+	".html":     LoadHTML,
+	".htm":      LoadHTML,
+	".txt":      LoadText,
+	".text":     LoadText,
+	".pdf":      LoadPDF,
+}
+
+// Supported 回傳是否有對應檔名副檔名的載入器
+func Supported(name string) bool {
+	_, ok := loaders[strings.ToLower(path.Ext(name))]
+	return ok
+}
+
+// LoadFile 讀取檔案並依副檔名轉為文件
+func LoadFile(name string) ([]*ai.Document, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return LoadBytes(filepath.ToSlash(name), data)
+}
+
+// LoadBytes 依檔名的副檔名將內容轉為文件，適用於上傳的檔案
+func LoadBytes(name string, data []byte) ([]*ai.Document, error) {
+	load, ok := loaders[strings.ToLower(path.Ext(name))]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", name, ErrUnsupported)
+	}
+	docs, err := load(name, data)
+	if err != nil {
+		return nil, fmt.Errorf("載入 %s 失敗: %w", name, err)
+	}
+	return docs, nil
+}
+
+// frontMatterPrefix 為與保留欄位同名的 front-matter 欄位改名後的前綴，例如 id 改為 front_matter_id
+const frontMatterPrefix = "front_matter_"
+
+// reservedMetadata 回傳載入、索引、切分與檢索時產生的 metadata 欄位，檔案內容不可指定
+func reservedMetadata() []string {
+	return append([]string{MetaID, MetaSource, MetaFileName, MetaFormat, MetaEncoding, MetaPage, MetaPages}, chunkMetadata...)
+}
+
+// renameReserved 將檔案內容（例如 front-matter）中與保留欄位同名的欄位加上 frontMatterPrefix，
+// 避免覆寫以路徑產生的 ID 或來源等欄位，原本的值仍可查詢
+func renameReserved(metadata map[string]any) {
+	for _, key := range reservedMetadata() {
+		if v, ok := metadata[key]; ok {
+			delete(metadata, key)
+			metadata[frontMatterPrefix+key] = v
+		}
+	}
+}
+
+// newDocument 建立帶有共用 metadata 的文件，載入器已設定的欄位（例如 PDF 每頁的 ID）不會被覆寫；
+// metadata 中來自檔案內容的欄位（例如 front-matter）需先經過 renameReserved
+func newDocument(name, format, text string, metadata map[string]any) *ai.Document {
+	if metadata == nil {
+		metadata = make(map[string]any)
+	}
+	defaults := map[string]any{
+		MetaID:       name,
+		MetaSource:   name,
+		MetaFileName: path.Base(name),
+		MetaFormat:   format,
+	}
+	for k, v := range defaults {
+		if _, ok := metadata[k]; !ok {
+			metadata[k] = v
+		}
+	}
+	return ai.DocumentFromText(text, metadata)
+}
@@ -0,0 +1,215 @@
+package ingest
+
+import (
+	"bytes"
+	"iter"
+	"strings"
+
+	"github.com/firebase/genkit/go/ai"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"golang.org/x/net/html/charset"
+)
+
+// boilerplateTags 為導覽列、頁首頁尾、側欄等與內文無關的元素
+var boilerplateTags = map[atom.Atom]bool{
+	atom.Script: true, atom.Style: true, atom.Noscript: true, atom.Template: true,
+	atom.Nav: true, atom.Header: true, atom.Footer: true, atom.Aside: true,
+	atom.Form: true, atom.Button: true, atom.Iframe: true, atom.Svg: true,
+}
+
+// boilerplateHints 出現在 class、id 或 role 中時視為與內文無關的元素
+var boilerplateHints = []string{"nav", "menu", "footer", "sidebar", "breadcrumb", "cookie", "banner", "advert", "share", "comment"}
+
+// contentTags 為內文的容器元素，不套用 boilerplateHints
+var contentTags = map[atom.Atom]bool{atom.Html: true, atom.Body: true, atom.Main: true, atom.Article: true}
+
+// blockTags 為區塊元素，前後需換行
+var blockTags = map[atom.Atom]bool{
+	atom.P: true, atom.Div: true, atom.Section: true, atom.Article: true, atom.Main: true,
+	atom.Br: true, atom.Li: true, atom.Tr: true, atom.Table: true, atom.Blockquote: true,
+	atom.Pre: true, atom.Ul: true, atom.Ol: true, atom.Dl: true, atom.Dt: true, atom.Dd: true,
+	atom.Figure: true, atom.Figcaption: true, atom.Hr: true,
+}
+
+// headingLevels 將 HTML 標題轉為 Markdown 標題層級，方便之後以 MarkdownChunker 依標題切分
+var headingLevels = map[atom.Atom]int{
+	atom.H1: 1, atom.H2: 2, atom.H3: 3, atom.H4: 4, atom.H5: 5, atom.H6: 6,
+}
+
+// LoadHTML 載入 HTML 並去除導覽列、頁首頁尾、腳本等樣板內容，只保留內文
+// 有 <article> 或 <main> 時只取其中的內容；標題會轉為 Markdown 的 # 標題，
+// <pre> 轉為 Markdown 的程式碼區塊並保留原本的空白與換行
+func LoadHTML(name string, data []byte) ([]*ai.Document, error) {
+	enc, _, _ := charset.DetermineEncoding(data, "text/html")
+	decoded, err := enc.NewDecoder().Bytes(data)
+	if err != nil {
+		return nil, err
+	}
+	root, err := html.Parse(bytes.NewReader(decoded))
+	if err != nil {
+		return nil, err
+	}
+
+	metadata := make(map[string]any)
+	if title := findElement(root, atom.Title); title != nil {
+		if t := strings.TrimSpace(textContent(title)); t != "" {
+			metadata[MetaTitle] = t
+		}
+	}
+	if h := findElement(root, atom.Html); h != nil {
+		if lang := attr(h, "lang"); lang != "" {
+			metadata["lang"] = lang
+		}
+	}
+	for meta := range findElements(root, atom.Meta) {
+		if attr(meta, "name") == "description" {
+			metadata["description"] = attr(meta, "content")
+		}
+	}
+
+	content := findElement(root, atom.Article)
+	if content == nil {
+		content = findElement(root, atom.Main)
+	}
+	if content == nil {
+		content = findElement(root, atom.Body)
+	}
+	if content == nil {
+		content = root
+	}
+
+	var sb strings.Builder
+	renderText(&sb, content)
+	return []*ai.Document{newDocument(name, "html", cleanLines(sb.String()), metadata)}, nil
+}
+
+// renderText 輸出節點中的文字，略過樣板元素
+func renderText(sb *strings.Builder, n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		sb.WriteString(n.Data)
+		return
+	case html.ElementNode:
+		if isBoilerplate(n) {
+			return
+		}
+	}
+
+	if n.DataAtom == atom.Pre {
+		sb.WriteString("\n" + codeFence + "\n" + strings.TrimRight(textContent(n), "\n") + "\n" + codeFence + "\n")
+		return
+	}
+	if level, ok := headingLevels[n.DataAtom]; ok {
+		sb.WriteString("\n\n" + strings.Repeat("#", level) + " " + strings.Join(strings.Fields(textContent(n)), " ") + "\n\n")
+		return
+	}
+	block := blockTags[n.DataAtom]
+	if block {
+		sb.WriteString("\n")
+	}
+	if n.DataAtom == atom.Li {
+		sb.WriteString("- ")
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		renderText(sb, c)
+	}
+	if block {
+		sb.WriteString("\n")
+	}
+}
+
+// isBoilerplate 判斷元素是否為與內文無關的樣板內容
+// body、main、article 本身就是內文的容器，不依 class 或 id 判斷（例如 <body class="nav-open">）
+func isBoilerplate(n *html.Node) bool {
+	if boilerplateTags[n.DataAtom] || hasAttr(n, "hidden") || attr(n, "aria-hidden") == "true" {
+		return true
+	}
+	if contentTags[n.DataAtom] {
+		return false
+	}
+	hints := strings.ToLower(attr(n, "class") + " " + attr(n, "id") + " " + attr(n, "role"))
+	for _, word := range strings.FieldsFunc(hints, func(r rune) bool { return r == ' ' || r == '-' || r == '_' }) {
+		for _, h := range boilerplateHints {
+			if word == h {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// codeFence 為 <pre> 轉成的 Markdown 程式碼區塊圍欄
+const codeFence = "```"
+
+// cleanLines 合併每行多餘的空白，並將連續的空行縮減為一行；程式碼區塊內的行保持原樣
+func cleanLines(s string) string {
+	var lines []string
+	blank, code := true, false
+	for _, line := range strings.Split(s, "\n") {
+		if line == codeFence {
+			code = !code
+		} else if code {
+			lines = append(lines, line)
+			blank = false
+			continue
+		}
+		line = strings.Join(strings.Fields(line), " ")
+		if line == "" {
+			if !blank {
+				lines = append(lines, "")
+			}
+			blank = true
+			continue
+		}
+		lines = append(lines, line)
+		blank = false
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+func textContent(n *html.Node) string {
+	var sb strings.Builder
+	for d := range n.Descendants() {
+		if d.Type == html.TextNode {
+			sb.WriteString(d.Data)
+		}
+	}
+	return sb.String()
+}
+
+func findElement(root *html.Node, a atom.Atom) *html.Node {
+	for n := range findElements(root, a) {
+		return n
+	}
+	return nil
+}
+
+func findElements(root *html.Node, a atom.Atom) iter.Seq[*html.Node] {
+	return func(yield func(*html.Node) bool) {
+		for n := range root.Descendants() {
+			if n.Type == html.ElementNode && n.DataAtom == a && !yield(n) {
+				return
+			}
+		}
+	}
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// hasAttr 判斷元素是否帶有屬性，包含沒有值的布林屬性（例如 <div hidden>）
+func hasAttr(n *html.Node, key string) bool {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return true
+		}
+	}
+	return false
+}
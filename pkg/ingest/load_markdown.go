@@ -0,0 +1,43 @@
+package ingest
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+
+	"github.com/firebase/genkit/go/ai"
+	"gopkg.in/yaml.v3"
+)
+
+// frontMatter 比對檔案開頭以 --- 包圍的 YAML front-matter
+var frontMatter = regexp.MustCompile(`(?s)\A---[ \t]*\r?\n(.*?)\r?\n---[ \t]*(?:\r?\n|\z)`)
+
+// LoadMarkdown 載入 Markdown，內容保留原本的標題，方便之後以 MarkdownChunker 依標題切分；
+// front-matter 的欄位會放入 metadata，與 id、origin 等保留欄位同名的欄位改名為 front_matter_<欄位>；
+// title 取自 front-matter 或第一個標題
+func LoadMarkdown(name string, data []byte) ([]*ai.Document, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	metadata := make(map[string]any)
+
+	if m := frontMatter.FindSubmatchIndex(data); m != nil {
+		if err := yaml.Unmarshal(data[m[2]:m[3]], &metadata); err != nil {
+			return nil, fmt.Errorf("front-matter 格式錯誤: %w", err)
+		}
+		if metadata == nil {
+			metadata = make(map[string]any)
+		}
+		renameReserved(metadata)
+		data = data[m[1]:]
+	}
+
+	text := string(data)
+	if _, ok := metadata[MetaTitle]; !ok {
+		for _, sec := range markdownSections(text) {
+			if len(sec.headings) > 0 {
+				metadata[MetaTitle] = sec.headings[0]
+				break
+			}
+		}
+	}
+	return []*ai.Document{newDocument(name, "markdown", text, metadata)}, nil
+}
@@ -0,0 +1,72 @@
+package ingest
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/ledongthuc/pdf"
+)
+
+// LoadPDF 逐頁擷取 PDF 的文字，每一頁為一份文件，metadata 帶有頁碼與總頁數
+// 沒有文字的頁面（例如掃描圖片）會被略過；pdf 套件遇到損毀的檔案時會 panic，此時改為回傳錯誤
+func LoadPDF(name string, data []byte) (docs []*ai.Document, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			docs, err = nil, fmt.Errorf("無法解析 PDF %s: %v", name, r)
+		}
+	}()
+
+	r, err := pdf.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+
+	pages := r.NumPage()
+	for i := 1; i <= pages; i++ {
+		page := r.Page(i)
+		if page.V.IsNull() {
+			continue
+		}
+		raw, err := page.GetPlainText(nil)
+		if err != nil {
+			return nil, err
+		}
+		text := joinPDFLines(raw)
+		if text == "" {
+			continue
+		}
+		docs = append(docs, newDocument(name, "pdf", text, map[string]any{
+			MetaID:    name + "#page=" + strconv.Itoa(i),
+			MetaPage:  i,
+			MetaPages: pages,
+		}))
+	}
+	return docs, nil
+}
+
+// joinPDFLines 將 PDF 擷取出的零碎文字行接回句子：
+// 兩側都是中日韓文字時直接相接，否則以空白分隔，並合併多餘的空白
+func joinPDFLines(raw string) string {
+	var (
+		sb   strings.Builder
+		last rune // 目前結果的最後一個字元
+	)
+	for _, field := range strings.Fields(raw) {
+		first, _ := utf8.DecodeRuneInString(field)
+		if sb.Len() > 0 && !(isCJK(last) && isCJK(first)) && !isClosingPunct(first) {
+			sb.WriteByte(' ')
+		}
+		sb.WriteString(field)
+		last, _ = utf8.DecodeLastRuneInString(field)
+	}
+	return sb.String()
+}
+
+// isClosingPunct 判斷是否為前面不需空白的標點
+func isClosingPunct(r rune) bool {
+	return strings.ContainsRune(".,;:!?)]}’”。，、；：！？）」』", r)
+}
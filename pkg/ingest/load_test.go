@@ -0,0 +1,273 @@
+package ingest
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/firebase/genkit/go/ai"
+	"golang.org/x/text/encoding/traditionalchinese"
+)
+
+func documentContent(doc *ai.Document) string {
+	var sb strings.Builder
+	for _, p := range doc.Content {
+		sb.WriteString(p.Text)
+	}
+	return sb.String()
+}
+
+func TestLoadPDF(t *testing.T) {
+	data, err := os.ReadFile("../../05_mutimodal/test.pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	docs, err := LoadBytes("guides/test.pdf", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(docs) != 3 {
+		t.Fatalf("載入 %d 頁，want 3", len(docs))
+	}
+	for i, doc := range docs {
+		page := i + 1
+		want := map[string]any{
+			MetaID:       "guides/test.pdf#page=" + string(rune('0'+page)),
+			MetaPage:     page,
+			MetaPages:    3,
+			MetaSource:   "guides/test.pdf",
+			MetaFileName: "test.pdf",
+			MetaFormat:   "pdf",
+		}
+		for k, v := range want {
+			if doc.Metadata[k] != v {
+				t.Errorf("第 %d 頁 metadata[%s] = %v, want %v", page, k, doc.Metadata[k], v)
+			}
+		}
+		if documentContent(doc) == "" {
+			t.Errorf("第 %d 頁沒有文字", page)
+		}
+	}
+	if text := documentContent(docs[0]); !strings.Contains(text, "Sample PDF") {
+		t.Errorf("第 1 頁內容為 %q，預期包含 Sample PDF", text)
+	}
+}
+
+// corruptPDF 回傳將第一個 "2 0 obj" 改為 "x 0 obj" 的範例 PDF，pdf 套件解析時會 panic
+func corruptPDF(t *testing.T) []byte {
+	t.Helper()
+	data, err := os.ReadFile("../../05_mutimodal/test.pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	i := bytes.Index(data, []byte("\n2 0 obj"))
+	if i < 0 {
+		t.Fatal("範例 PDF 中找不到物件 2")
+	}
+	data[i+1] = 'x'
+	return data
+}
+
+func TestLoadPDFMalformed(t *testing.T) {
+	data, err := os.ReadFile("../../05_mutimodal/test.pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"corrupted object", corruptPDF(t)},
+		{"truncated", data[:len(data)/2]},
+		{"not a pdf", []byte("%PDF-1.4\nhello")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			docs, err := LoadBytes("broken.pdf", tt.data)
+			if err == nil {
+				t.Fatalf("LoadBytes() = %d 份文件，預期回傳錯誤", len(docs))
+			}
+			if docs != nil {
+				t.Errorf("失敗時仍回傳文件: %v", docs)
+			}
+		})
+	}
+}
+
+func TestLoadHTML(t *testing.T) {
+	tests := []struct {
+		name    string
+		html    string
+		want    string
+		notWant []string
+	}{
+		{
+			name: "strips boilerplate",
+			html: `<html lang="zh-TW"><head><title>標題</title><script>var x = 1;</script></head>
+<body><nav>首頁 | 關於</nav><header>網站名稱</header>
+<main><h1>介紹</h1><p>第一段內文</p><ul><li>項目</li></ul></main>
+<footer>版權所有</footer></body></html>`,
+			want:    "# 介紹\n\n第一段內文\n\n- 項目",
+			notWant: []string{"首頁", "網站名稱", "版權所有", "var x"},
+		},
+		{
+			name:    "boolean hidden attribute",
+			html:    `<body><div hidden>SECRET HIDDEN</div><p>Visible text</p></body>`,
+			want:    "Visible text",
+			notWant: []string{"SECRET"},
+		},
+		{
+			name:    "aria-hidden and class hints",
+			html:    `<body><div aria-hidden="true">icon</div><div class="site-sidebar">links</div><p>Body</p></body>`,
+			want:    "Body",
+			notWant: []string{"icon", "links"},
+		},
+		{
+			name: "hints ignored on content root",
+			html: `<body class="nav-open"><p>Visible text</p></body>`,
+			want: "Visible text",
+		},
+		{
+			name: "pre keeps whitespace",
+			html: "<body><p>範例   程式</p><pre>\nfunc main() {\n    fmt.Println(\"hi\")\n\n\n}\n</pre><p>結尾</p></body>",
+			want: "範例 程式\n\n```\nfunc main() {\n    fmt.Println(\"hi\")\n\n\n}\n```\n\n結尾",
+		},
+		{
+			name: "hints ignored on article",
+			html: `<body><div class="menu">選單</div><article id="comment-thread"><p>文章內容</p></article></body>`,
+			want: "文章內容",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			docs, err := LoadHTML("page.html", []byte(tt.html))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(docs) != 1 {
+				t.Fatalf("回傳 %d 份文件，want 1", len(docs))
+			}
+			text := documentContent(docs[0])
+			if !strings.Contains(text, tt.want) {
+				t.Errorf("內容為 %q，預期包含 %q", text, tt.want)
+			}
+			for _, s := range tt.notWant {
+				if strings.Contains(text, s) {
+					t.Errorf("內容為 %q，不應包含 %q", text, s)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadHTMLMetadata(t *testing.T) {
+	docs, err := LoadHTML("page.html", []byte(`<html lang="en"><head><title> Guide </title>
+<meta name="description" content="How to"></head><body><p>x</p></body></html>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	md := docs[0].Metadata
+	if md[MetaTitle] != "Guide" || md["lang"] != "en" || md["description"] != "How to" || md[MetaFormat] != "html" {
+		t.Errorf("metadata = %v", md)
+	}
+}
+
+func TestLoadMarkdown(t *testing.T) {
+	tests := []struct {
+		name  string
+		data  string
+		title string
+		extra map[string]any
+	}{
+		{
+			name:  "front-matter",
+			data:  "---\ntitle: 安裝指南\ntags: [setup]\nversion: 2\n---\n# 第一章\n內容",
+			title: "安裝指南",
+			extra: map[string]any{"version": 2},
+		},
+		{
+			// 與保留欄位同名的 front-matter 欄位不可覆寫以路徑產生的 ID 與來源
+			name:  "reserved front-matter keys",
+			data:  "---\nid: custom\norigin: api\nsource: elsewhere\nscore: 5\n---\n# 標題\n內容",
+			title: "標題",
+			extra: map[string]any{
+				MetaID: "docs/guide.md", MetaSource: "docs/guide.md",
+				"front_matter_id": "custom", "front_matter_origin": "api", "front_matter_source": "elsewhere", "front_matter_score": 5,
+			},
+		},
+		{
+			name:  "first heading",
+			data:  "\xef\xbb\xbf前言\n\n## 開始使用\n內容",
+			title: "開始使用",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			docs, err := LoadMarkdown("docs/guide.md", []byte(tt.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			md := docs[0].Metadata
+			if md[MetaTitle] != tt.title {
+				t.Errorf("title = %v, want %v", md[MetaTitle], tt.title)
+			}
+			for k, v := range tt.extra {
+				if md[k] != v {
+					t.Errorf("metadata[%s] = %v, want %v", k, md[k], v)
+				}
+			}
+			for _, k := range []string{MetaOrigin, "score"} {
+				if _, ok := md[k]; ok {
+					t.Errorf("metadata 不應包含保留欄位 %s: %v", k, md)
+				}
+			}
+			if strings.HasPrefix(documentContent(docs[0]), "---") {
+				t.Error("內容不應包含 front-matter")
+			}
+		})
+	}
+}
+
+func TestLoadMarkdownBadFrontMatter(t *testing.T) {
+	if _, err := LoadMarkdown("bad.md", []byte("---\ntitle: [unclosed\n---\n內容")); err == nil {
+		t.Error("front-matter 格式錯誤時應回傳錯誤")
+	}
+}
+
+func TestDecodeText(t *testing.T) {
+	big5, err := traditionalchinese.Big5.NewEncoder().String("這是我們的文件，台灣的教育制度")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		data []byte
+		text string
+		enc  string
+	}{
+		{"utf-8", []byte("中文 text"), "中文 text", "utf-8"},
+		{"utf-8 bom", []byte("\xef\xbb\xbfhello"), "hello", "utf-8"},
+		{"utf-16le bom", []byte{0xff, 0xfe, 'h', 0, 'i', 0}, "hi", "utf-16le"},
+		{"utf-16be bom", []byte{0xfe, 0xff, 0, 'h', 0, 'i'}, "hi", "utf-16be"},
+		{"big5", []byte(big5), "這是我們的文件，台灣的教育制度", "big5"},
+		{"windows-1252", []byte("caf\xe9"), "café", "windows-1252"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text, enc, err := DecodeText(tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if text != tt.text || enc != tt.enc {
+				t.Errorf("DecodeText() = %q, %q; want %q, %q", text, enc, tt.text, tt.enc)
+			}
+		})
+	}
+}
+
+func TestLoadBytesUnsupported(t *testing.T) {
+	if _, err := LoadBytes("image.png", []byte{0x89, 'P', 'N', 'G'}); err == nil {
+		t.Error("不支援的格式應回傳錯誤")
+	}
+}
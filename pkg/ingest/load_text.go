@@ -0,0 +1,98 @@
+package ingest
+
+import (
+	"bytes"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/firebase/genkit/go/ai"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/korean"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/traditionalchinese"
+	xunicode "golang.org/x/text/encoding/unicode"
+)
+
+// LoadText 載入純文字檔，自動偵測編碼並轉為 UTF-8，偵測到的編碼記錄在 metadata 的 encoding 欄位
+func LoadText(name string, data []byte) ([]*ai.Document, error) {
+	text, enc, err := DecodeText(data)
+	if err != nil {
+		return nil, err
+	}
+	return []*ai.Document{newDocument(name, "text", text, map[string]any{MetaEncoding: enc})}, nil
+}
+
+// legacyEncodings 為非 Unicode 檔案依序嘗試的編碼，繁體中文的 Big5 優先
+var legacyEncodings = []struct {
+	name string
+	enc  encoding.Encoding
+}{
+	{"big5", traditionalchinese.Big5},
+	{"gb18030", simplifiedchinese.GB18030},
+	{"shift_jis", japanese.ShiftJIS},
+	{"euc-kr", korean.EUCKR},
+}
+
+// DecodeText 偵測文字的編碼並轉為 UTF-8，回傳轉換後的文字與編碼名稱
+//
+// 偵測順序：BOM（UTF-8、UTF-16）、合法的 UTF-8、常見的中日韓編碼（取常用字比例最高者），
+// 都不適合時視為 windows-1252
+func DecodeText(data []byte) (string, string, error) {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xef, 0xbb, 0xbf}):
+		return string(data[3:]), "utf-8", nil
+	case bytes.HasPrefix(data, []byte{0xff, 0xfe}):
+		return decode(xunicode.UTF16(xunicode.LittleEndian, xunicode.ExpectBOM), data, "utf-16le")
+	case bytes.HasPrefix(data, []byte{0xfe, 0xff}):
+		return decode(xunicode.UTF16(xunicode.BigEndian, xunicode.ExpectBOM), data, "utf-16be")
+	case utf8.Valid(data):
+		return string(data), "utf-8", nil
+	}
+
+	best, bestName, bestScore := "", "", 0
+	for _, c := range legacyEncodings {
+		text, err := c.enc.NewDecoder().String(string(data))
+		if err != nil {
+			continue
+		}
+		if score := textScore(text); bestName == "" || score > bestScore {
+			best, bestName, bestScore = text, c.name, score
+		}
+	}
+	if bestName != "" && bestScore > 0 {
+		return best, bestName, nil
+	}
+	return decode(charmap.Windows1252, data, "windows-1252")
+}
+
+// commonHan 為繁體與簡體中文最常用的字，用錯誤的編碼解碼時幾乎不會出現
+const commonHan = "的一是不了人我在有他這这中大來来上國国個个到說说們们為为子和你地出道也時时年得就那要下以生會会自著着去之過过家學学對对可她裡里後后小麼么心多天而能好都然沒没日於于起還还發发成事只作當当想看文無无開开手十用主行方又如前所本見见經经頭头面公同三已老從从動动兩两長长"
+
+// textScore 評估解碼結果的合理程度：常用漢字、假名與韓文字母加分，無法解碼的字元與半形片假名扣分
+func textScore(text string) int {
+	score := 0
+	for _, r := range text {
+		switch {
+		case r == utf8.RuneError:
+			score -= 10
+		case strings.ContainsRune(commonHan, r):
+			score += 2
+		case r >= 0xff61 && r <= 0xff9f:
+			score-- // 半形片假名，多半是錯誤的編碼解碼出來的
+		case isCJK(r) && !unicode.Is(unicode.Han, r):
+			score++ // 假名、韓文
+		}
+	}
+	return score
+}
+
+func decode(enc encoding.Encoding, data []byte, name string) (string, string, error) {
+	text, err := enc.NewDecoder().Bytes(data)
+	if err != nil {
+		return "", "", err
+	}
+	return string(text), name, nil
+}
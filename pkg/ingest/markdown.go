@@ -0,0 +1,105 @@
+package ingest
+
+import (
+	"regexp"
+	"strings"
+)
+
+// atxHeading 比對 Markdown 的 ATX 標題，例如 "## 安裝步驟"
+var atxHeading = regexp.MustCompile(`^ {0,3}(#{1,6})[ \t]+(.*?)(?:[ \t]+#+)?[ \t]*$`)
+
+// MarkdownChunker 依 Markdown 標題階層切分，每個標題與其下的內容為一個段落，
+// 超過 MaxTokens 的段落再以 Fallback 切分；程式碼區塊中的 # 不會被當成標題
+type MarkdownChunker struct {
+	MaxTokens int     // 每個片段的 token 上限，預設 DefaultMaxTokens
+	Fallback  Chunker // 段落過長時使用的切分策略，預設為 RecursiveChunker
+}
+
+func (c MarkdownChunker) Chunk(text string) []Chunk {
+	maxTokens := orDefault(c.MaxTokens)
+	fallback := c.Fallback
+	if fallback == nil {
+		fallback = RecursiveChunker{MaxTokens: maxTokens}
+	}
+
+	var chunks []Chunk
+	for _, sec := range markdownSections(text) {
+		body := text[sec.start:sec.end]
+		if CountTokens(body) <= maxTokens {
+			for _, s := range appendTrimmed(nil, text, sec.span) {
+				chunks = append(chunks, Chunk{Text: text[s.start:s.end], Start: s.start, End: s.end, Headings: sec.headings})
+			}
+			continue
+		}
+		for _, ch := range fallback.Chunk(body) {
+			ch.Start += sec.start
+			ch.End += sec.start
+			ch.Headings = sec.headings
+			chunks = append(chunks, ch)
+		}
+	}
+	return chunks
+}
+
+// section 為一個標題（含）到下一個標題之前的範圍
+type section struct {
+	span
+	headings []string
+}
+
+// markdownSections 依標題切分 Markdown，只有標題而沒有內容的段落會被略過
+func markdownSections(text string) []section {
+	var (
+		out     []section
+		path    []string // 目前的標題路徑
+		levels  []int    // path 中每個標題的層級
+		cur     = section{span: span{0, 0}}
+		hasBody bool
+		fence   string // 目前所在程式碼區塊的圍欄，例如 ``` 或 ~~~
+	)
+	closeSection := func(end int) {
+		cur.end = end
+		if hasBody {
+			out = append(out, cur)
+		}
+	}
+
+	for _, line := range splitAfter(text, span{0, len(text)}, "\n") {
+		content := strings.TrimRight(text[line.start:line.end], "\r\n")
+		trimmed := strings.TrimSpace(content)
+
+		if fence != "" {
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+			hasBody = true
+			continue
+		}
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			fence = trimmed[:3]
+			hasBody = true
+			continue
+		}
+
+		m := atxHeading.FindStringSubmatch(content)
+		if m == nil {
+			if trimmed != "" {
+				hasBody = true
+			}
+			continue
+		}
+
+		closeSection(line.start)
+		level := len(m[1])
+		for len(levels) > 0 && levels[len(levels)-1] >= level {
+			levels = levels[:len(levels)-1]
+			path = path[:len(path)-1]
+		}
+		levels = append(levels, level)
+		path = append(path, m[2])
+		cur = section{span: span{line.start, line.start}, headings: append([]string(nil), path...)}
+		hasBody = false
+	}
+	closeSection(len(text))
+	return out
+}
@@ -0,0 +1,305 @@
+package ingest
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"time"
+
+	"dongstudio.live/genkit_demo/pkg/retry"
+	"dongstudio.live/genkit_demo/pkg/vectorstore"
+	"github.com/firebase/genkit/go/ai"
+)
+
+// Indexer 為向量資料庫的寫入介面，文件 ID 取自 metadata 的 "id"
+type Indexer interface {
+	Index(ctx context.Context, docs []*ai.Document) error
+	Delete(ctx context.Context, ids []string) error
+}
+
+// RetryPolicy 為批次寫入失敗時的重試設定，每次重試的等待時間加倍並加上隨機抖動
+type RetryPolicy struct {
+	Attempts       int           // 最多嘗試次數（含第一次），預設 4
+	InitialBackoff time.Duration // 第一次重試前的等待時間，預設 500ms
+	MaxBackoff     time.Duration // 等待時間上限，預設 10s
+}
+
+// DefaultBatchSize 為每批寫入的片段數
+const DefaultBatchSize = 32
+
+// Pipeline 將文件切分後寫入向量資料庫，並在 Registry 記錄每份文件的內容雜湊與片段
+// Registry 即為索引的 manifest：內容與 metadata 都沒變的文件不會重新產生 embedding
+type Pipeline struct {
+	Indexer   Indexer
+	Chunker   Chunker // 為 nil 時整份文件作為一個片段
+	Registry  *Registry
+	BatchSize int // 每批寫入的片段數，預設 DefaultBatchSize
+	Retry     RetryPolicy
+}
+
+// SyncOptions 為 [Pipeline.Sync] 的選項
+type SyncOptions struct {
+	// Origin 為文件的來源，不為空時寫入每份文件 metadata 的 origin 欄位
+	Origin string
+	// Prune 為 true 時表示 docs 是此來源（Origin）完整的文件集合，相同來源但不在其中的已索引文件會被刪除，
+	// 其他來源的文件不受影響；Origin 為空時只會刪除沒有來源的文件
+	Prune bool
+	// Keep 為 Prune 時保留的文件 ID，例如來源檔案暫時無法載入、不在 docs 中但不應刪除的文件
+	Keep []string
+	// Delete 為要刪除的文件 ID，不存在的 ID 會被忽略
+	Delete []string
+	// Progress 在每份文件處理完成（含略過與失敗）後呼叫
+	Progress func(processed, failed int)
+}
+
+// DocumentError 為單一文件的索引錯誤
+type DocumentError struct {
+	DocumentID string `json:"document_id"`
+	Error      string `json:"error"`
+}
+
+// Report 為一次同步的結果
+type Report struct {
+	Added   []string        `json:"added"`   // 新增的文件
+	Updated []string        `json:"updated"` // 內容或 metadata 有變更而重新索引的文件
+	Skipped []string        `json:"skipped"` // 內容未變更而略過的文件
+	Deleted []string        `json:"deleted"` // 已不在此來源的文件集合中（Prune）或指定刪除（Delete）的文件
+	Failed  []DocumentError `json:"failed"`  // 重試後仍失敗的文件
+}
+
+// pendingDoc 為需要重新索引的文件
+type pendingDoc struct {
+	record  *Record
+	chunks  []*ai.Document
+	updated bool
+	stale   []string // 舊版本中不再使用的片段 ID
+}
+
+// Sync 將文件同步到向量資料庫：只有新增或變更的文件會重新切分並產生 embedding，
+// 以批次寫入並在失敗時依 RetryPolicy 重試，單一批次失敗不影響其他批次
+func (p *Pipeline) Sync(ctx context.Context, docs []*ai.Document, opts SyncOptions) *Report {
+	report := &Report{}
+	// 所有文件處理完才保存一次 manifest；中途中斷時已寫入向量資料庫的文件會在下次同步重新寫入
+	release := p.Registry.Hold()
+	defer func() {
+		if err := release(); err != nil {
+			slog.ErrorContext(ctx, "無法保存文件清單", "error", err)
+		}
+	}()
+	var processed, failed int
+	progress := func(n, f int) {
+		processed += n
+		failed += f
+		if opts.Progress != nil {
+			opts.Progress(processed, failed)
+		}
+	}
+
+	seen := make(map[string]bool, len(docs))
+	var pending []*pendingDoc
+	for _, doc := range docs {
+		rec := p.newRecord(doc, opts.Origin)
+		seen[rec.ID] = true
+		// metadata 無效的文件單獨失敗，不影響同一批次的其他文件
+		if err := vectorstore.CheckMetadata(doc); err != nil {
+			report.Failed = append(report.Failed, DocumentError{DocumentID: rec.ID, Error: err.Error()})
+			progress(1, 1)
+			continue
+		}
+		old, exists := p.Registry.Get(rec.ID)
+		if exists && old.Hash == rec.Hash {
+			report.Skipped = append(report.Skipped, rec.ID)
+			progress(1, 0)
+			continue
+		}
+
+		pd := &pendingDoc{record: rec, chunks: p.split(rec.Content, rec.Metadata), updated: exists}
+		for _, ch := range pd.chunks {
+			rec.ChunkIDs = append(rec.ChunkIDs, ch.Metadata[MetaID].(string))
+		}
+		if exists {
+			for _, id := range old.ChunkIDs {
+				if !slices.Contains(rec.ChunkIDs, id) {
+					pd.stale = append(pd.stale, id)
+				}
+			}
+		}
+		pending = append(pending, pd)
+	}
+
+	for _, batch := range p.batches(pending) {
+		var chunks []*ai.Document
+		for _, pd := range batch {
+			chunks = append(chunks, pd.chunks...)
+		}
+		if err := p.retry(ctx, "index", func() error { return p.Indexer.Index(ctx, chunks) }); err != nil {
+			for _, pd := range batch {
+				report.Failed = append(report.Failed, DocumentError{DocumentID: pd.record.ID, Error: err.Error()})
+			}
+			progress(len(batch), len(batch))
+			continue
+		}
+
+		for _, pd := range batch {
+			if err := p.commit(ctx, pd); err != nil {
+				report.Failed = append(report.Failed, DocumentError{DocumentID: pd.record.ID, Error: err.Error()})
+				progress(1, 1)
+				continue
+			}
+			if pd.updated {
+				report.Updated = append(report.Updated, pd.record.ID)
+			} else {
+				report.Added = append(report.Added, pd.record.ID)
+			}
+			progress(1, 0)
+		}
+	}
+
+	for _, id := range opts.Delete {
+		if seen[id] {
+			continue
+		}
+		found, err := p.DeleteDocument(ctx, id)
+		if err != nil {
+			report.Failed = append(report.Failed, DocumentError{DocumentID: id, Error: err.Error()})
+			continue
+		}
+		if found {
+			report.Deleted = append(report.Deleted, id)
+		}
+	}
+
+	if opts.Prune {
+		for _, rec := range p.Registry.List() {
+			if origin, _ := rec.Metadata[MetaOrigin].(string); seen[rec.ID] || origin != opts.Origin || slices.Contains(opts.Keep, rec.ID) {
+				continue
+			}
+			if _, err := p.DeleteDocument(ctx, rec.ID); err != nil {
+				report.Failed = append(report.Failed, DocumentError{DocumentID: rec.ID, Error: err.Error()})
+				continue
+			}
+			report.Deleted = append(report.Deleted, rec.ID)
+		}
+	}
+	return report
+}
+
+// commit 刪除文件舊版本的多餘片段並更新 manifest
+func (p *Pipeline) commit(ctx context.Context, pd *pendingDoc) error {
+	if len(pd.stale) > 0 {
+		if err := p.retry(ctx, "delete", func() error { return p.Indexer.Delete(ctx, pd.stale) }); err != nil {
+			return fmt.Errorf("刪除舊片段失敗: %w", err)
+		}
+	}
+	return p.Registry.Put(pd.record)
+}
+
+// DeleteDocument 從向量資料庫刪除文件的所有片段並移除記錄，回傳文件是否存在
+func (p *Pipeline) DeleteDocument(ctx context.Context, id string) (bool, error) {
+	rec, ok := p.Registry.Get(id)
+	if !ok {
+		return false, nil
+	}
+	if err := p.retry(ctx, "delete", func() error { return p.Indexer.Delete(ctx, rec.ChunkIDs) }); err != nil {
+		return true, fmt.Errorf("刪除文件 %s 失敗: %w", id, err)
+	}
+	return true, p.Registry.Delete(id)
+}
+
+// newRecord 建立文件的 manifest 記錄，雜湊涵蓋內容、metadata（含來源）與切分策略，
+// 任一項變更都會讓文件重新索引
+func (p *Pipeline) newRecord(doc *ai.Document, origin string) *Record {
+	text := vectorstore.DocText(doc)
+	id := vectorstore.DocID(doc)
+	metadata := maps.Clone(doc.Metadata)
+	if metadata == nil {
+		metadata = make(map[string]any)
+	}
+	metadata[MetaID] = id
+	if origin != "" {
+		metadata[MetaOrigin] = origin
+	}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%T%+v\x00", p.Chunker, p.Chunker)
+	meta, _ := json.Marshal(metadata) // map 的 key 會依序輸出，結果穩定
+	h.Write(meta)
+	h.Write([]byte{0})
+	h.Write([]byte(text))
+
+	return &Record{ID: id, Hash: hex.EncodeToString(h.Sum(nil)), Metadata: metadata, Content: text}
+}
+
+// Chunks 依切分策略產生文件的片段，片段 ID 與索引時相同，可用來重建其他索引
+// rec 不含內容時（例如由 Registry.List 取得）從 Registry 讀取
+func (p *Pipeline) Chunks(rec *Record) ([]*ai.Document, error) {
+	content := rec.Content
+	if content == "" {
+		var err error
+		if content, err = p.Registry.Content(rec.ID); err != nil {
+			return nil, err
+		}
+	}
+	return p.split(content, rec.Metadata), nil
+}
+
+// split 依切分策略切分內容
+func (p *Pipeline) split(content string, metadata map[string]any) []*ai.Document {
+	doc := ai.DocumentFromText(content, maps.Clone(metadata))
+	if p.Chunker == nil {
+		return []*ai.Document{doc}
+	}
+	return SplitDocuments([]*ai.Document{doc}, p.Chunker)
+}
+
+// batches 將文件分組，每組的片段數不超過 BatchSize；單一文件的片段超過上限時自成一組
+func (p *Pipeline) batches(pending []*pendingDoc) [][]*pendingDoc {
+	size := p.BatchSize
+	if size <= 0 {
+		size = DefaultBatchSize
+	}
+	var (
+		out    [][]*pendingDoc
+		cur    []*pendingDoc
+		chunks int
+	)
+	for _, pd := range pending {
+		if len(cur) > 0 && chunks+len(pd.chunks) > size {
+			out = append(out, cur)
+			cur, chunks = nil, 0
+		}
+		cur = append(cur, pd)
+		chunks += len(pd.chunks)
+	}
+	if len(cur) > 0 {
+		out = append(out, cur)
+	}
+	return out
+}
+
+// retry 依 RetryPolicy 重試 fn，context 取消時立即停止
+func (p *Pipeline) retry(ctx context.Context, op string, fn func() error) error {
+	policy := retry.Policy{
+		Attempts:       p.Retry.Attempts,
+		InitialBackoff: p.Retry.InitialBackoff,
+		MaxBackoff:     p.Retry.MaxBackoff,
+		OnRetry: func(attempt int, wait time.Duration, err error) {
+			slog.WarnContext(ctx, "寫入向量資料庫失敗，稍後重試", "op", op, "attempt", attempt, "wait", wait, "error", err)
+		},
+	}
+	if policy.Attempts <= 0 {
+		policy.Attempts = 4
+	}
+	if policy.InitialBackoff <= 0 {
+		policy.InitialBackoff = 500 * time.Millisecond
+	}
+	if policy.MaxBackoff <= 0 {
+		policy.MaxBackoff = 10 * time.Second
+	}
+	return retry.Do(ctx, policy, fn)
+}
@@ -0,0 +1,182 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"dongstudio.live/genkit_demo/pkg/vectorstore"
+	"github.com/firebase/genkit/go/ai"
+)
+
+// fakeIndexer 為記憶體中的向量資料庫，記錄每個片段的內容
+type fakeIndexer struct {
+	mu     sync.Mutex
+	chunks map[string]string
+	fail   error // 不為 nil 時 Index 回傳此錯誤
+	block  chan struct{}
+}
+
+func newFakeIndexer() *fakeIndexer {
+	return &fakeIndexer{chunks: make(map[string]string)}
+}
+
+func (f *fakeIndexer) Index(ctx context.Context, docs []*ai.Document) error {
+	if f.block != nil {
+		<-f.block
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.fail != nil {
+		return f.fail
+	}
+	for _, d := range docs {
+		f.chunks[d.Metadata[MetaID].(string)] = vectorstore.DocText(d)
+	}
+	return nil
+}
+
+func (f *fakeIndexer) Delete(ctx context.Context, ids []string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, id := range ids {
+		delete(f.chunks, id)
+	}
+	return nil
+}
+
+func (f *fakeIndexer) ids() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Sorted(maps.Keys(f.chunks))
+}
+
+func newTestPipeline(t *testing.T, idx Indexer) *Pipeline {
+	t.Helper()
+	reg, err := OpenRegistry("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Pipeline{Indexer: idx, Registry: reg, Retry: RetryPolicy{Attempts: 2, InitialBackoff: time.Millisecond}}
+}
+
+func testDoc(id, text string) *ai.Document {
+	return ai.DocumentFromText(text, map[string]any{MetaID: id})
+}
+
+func registryIDs(r *Registry) []string {
+	var ids []string
+	for _, rec := range r.List() {
+		ids = append(ids, rec.ID)
+	}
+	return ids
+}
+
+func TestPipelineSync(t *testing.T) {
+	ctx := context.Background()
+	idx := newFakeIndexer()
+	p := newTestPipeline(t, idx)
+
+	report := p.Sync(ctx, []*ai.Document{testDoc("a", "alpha"), testDoc("b", "beta")}, SyncOptions{})
+	if !slices.Equal(report.Added, []string{"a", "b"}) || len(report.Failed) > 0 {
+		t.Fatalf("第一次同步 report = %+v", report)
+	}
+
+	report = p.Sync(ctx, []*ai.Document{testDoc("a", "alpha"), testDoc("b", "beta v2"), testDoc("c", "gamma")},
+		SyncOptions{})
+	if !slices.Equal(report.Skipped, []string{"a"}) || !slices.Equal(report.Updated, []string{"b"}) ||
+		!slices.Equal(report.Added, []string{"c"}) {
+		t.Fatalf("第二次同步 report = %+v", report)
+	}
+	if got := idx.chunks["b"]; got != "beta v2" {
+		t.Errorf("b 的內容為 %q，預期已更新", got)
+	}
+
+	report = p.Sync(ctx, []*ai.Document{testDoc("d", "delta")}, SyncOptions{Delete: []string{"a", "d", "missing"}})
+	if !slices.Equal(report.Deleted, []string{"a"}) || !slices.Equal(report.Added, []string{"d"}) {
+		t.Fatalf("指定刪除 report = %+v", report)
+	}
+	if got, want := idx.ids(), []string{"b", "c", "d"}; !slices.Equal(got, want) {
+		t.Errorf("向量資料庫中的片段 = %v, want %v", got, want)
+	}
+}
+
+func TestPipelineSyncRemovesStaleChunks(t *testing.T) {
+	ctx := context.Background()
+	idx := newFakeIndexer()
+	p := newTestPipeline(t, idx)
+	p.Chunker = ParagraphChunker{MaxTokens: 4}
+
+	p.Sync(ctx, []*ai.Document{testDoc("a", "one two three\n\nfour five six\n\nseven eight nine")}, SyncOptions{})
+	if got := len(idx.ids()); got != 3 {
+		t.Fatalf("索引了 %d 個片段，want 3", got)
+	}
+	p.Sync(ctx, []*ai.Document{testDoc("a", "one two three")}, SyncOptions{})
+	if got, want := idx.ids(), []string{"a#0"}; !slices.Equal(got, want) {
+		t.Errorf("更新後的片段 = %v, want %v", got, want)
+	}
+}
+
+func TestPipelineSyncFailure(t *testing.T) {
+	ctx := context.Background()
+	idx := newFakeIndexer()
+	idx.fail = errors.New("unavailable")
+	p := newTestPipeline(t, idx)
+
+	report := p.Sync(ctx, []*ai.Document{testDoc("a", "alpha")}, SyncOptions{})
+	if len(report.Failed) != 1 || report.Failed[0].DocumentID != "a" {
+		t.Fatalf("report = %+v", report)
+	}
+	if p.Registry.Len() != 0 {
+		t.Error("索引失敗的文件不應記錄在 manifest")
+	}
+
+	// 恢復後重新同步應重新索引，而不是視為未變更
+	idx.fail = nil
+	report = p.Sync(ctx, []*ai.Document{testDoc("a", "alpha")}, SyncOptions{})
+	if !slices.Equal(report.Added, []string{"a"}) {
+		t.Fatalf("重試 report = %+v", report)
+	}
+}
+
+func TestPipelineSyncReservedMetadata(t *testing.T) {
+	idx := newFakeIndexer()
+	p := newTestPipeline(t, idx)
+	bad := testDoc("bad", "beta")
+	bad.Metadata["score"] = 5
+
+	// 使用保留欄位的文件單獨失敗，同一批次的其他文件照常索引
+	report := p.Sync(context.Background(), []*ai.Document{testDoc("a", "alpha"), bad}, SyncOptions{})
+	if !slices.Equal(report.Added, []string{"a"}) || len(report.Failed) != 1 || report.Failed[0].DocumentID != "bad" {
+		t.Fatalf("report = %+v", report)
+	}
+	if got := idx.ids(); !slices.Equal(got, []string{"a"}) {
+		t.Errorf("向量資料庫中的片段 = %v", got)
+	}
+}
+
+func TestPipelineSyncPrunesOnlySameOrigin(t *testing.T) {
+	ctx := context.Background()
+	idx := newFakeIndexer()
+	p := newTestPipeline(t, idx)
+
+	p.Sync(ctx, []*ai.Document{testDoc("s1", "startup one"), testDoc("s2", "startup two")}, SyncOptions{Origin: OriginStartup, Prune: true})
+	p.Sync(ctx, []*ai.Document{testDoc("u1", "uploaded")}, SyncOptions{Origin: OriginAPI})
+	p.Sync(ctx, []*ai.Document{testDoc("d1", "from dir")}, SyncOptions{Origin: OriginDir, Prune: true})
+
+	// 重新啟動時內建文件少了 s2：只刪除 s2，API 與目錄同步的文件保留
+	report := p.Sync(ctx, []*ai.Document{testDoc("s1", "startup one")}, SyncOptions{Origin: OriginStartup, Prune: true})
+	if !slices.Equal(report.Deleted, []string{"s2"}) || !slices.Equal(report.Skipped, []string{"s1"}) {
+		t.Fatalf("report = %+v", report)
+	}
+	if got, want := registryIDs(p.Registry), []string{"d1", "s1", "u1"}; !slices.Equal(got, want) {
+		t.Errorf("文件 = %v, want %v", got, want)
+	}
+	if rec, _ := p.Registry.Get("u1"); rec.Metadata[MetaOrigin] != OriginAPI {
+		t.Errorf("u1 的 metadata = %v，預期記錄來源", rec.Metadata)
+	}
+}
@@ -0,0 +1,242 @@
+package ingest
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Record 為已索引的一份來源文件
+type Record struct {
+	ID        string         `json:"id"`
+	Hash      string         `json:"hash"` // 內容、metadata 與切分策略的 SHA-256，用於判斷是否需要重新索引
+	Metadata  map[string]any `json:"metadata,omitempty"`
+	Content   string         `json:"content,omitempty"` // 只在記憶體中；有檔案時另存於內容目錄，以 [Registry.Content] 讀取
+	ChunkIDs  []string       `json:"chunk_ids"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+}
+
+// Registry 為已索引文件的 manifest，記錄每份文件的內容雜湊與片段 ID，
+// 保存為 JSON 檔，重新啟動後仍可判斷哪些文件需要重新索引，並可列出與刪除
+//
+// 文件內容不寫入 manifest，而是每份文件一個檔案，保存在 manifest 旁的 <path>.content 目錄，
+// 新增或更新一份文件只需寫入它自己的內容；manifest 可用 [Registry.Hold] 在批次寫入後只保存一次
+type Registry struct {
+	path string
+
+	mu      sync.RWMutex
+	records map[string]*Record
+	held    int  // Hold 的次數，大於 0 時暫停保存 manifest
+	dirty   bool // 暫停期間是否有變更
+}
+
+// OpenRegistry 開啟（或建立）指定路徑的文件清單，path 為空時只保存在記憶體
+func OpenRegistry(path string) (*Registry, error) {
+	r := &Registry{path: path, records: make(map[string]*Record)}
+	if path == "" {
+		return r, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var records []*Record
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, fmt.Errorf("解析文件清單 %s 失敗: %w", path, err)
+	}
+	// 舊版 manifest 直接包含文件內容，改為另存到內容目錄
+	migrated := false
+	for _, rec := range records {
+		if rec.Content != "" {
+			if err := r.writeContent(rec.ID, rec.Content); err != nil {
+				return nil, err
+			}
+			rec.Content = ""
+			migrated = true
+		}
+		r.records[rec.ID] = rec
+	}
+	if migrated {
+		if err := r.save(); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// Get 依 ID 取得文件
+func (r *Registry) Get(id string) (*Record, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	rec, ok := r.records[id]
+	return rec, ok
+}
+
+// List 回傳依 ID 排序的所有文件
+func (r *Registry) List() []*Record {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.sorted()
+}
+
+// Len 回傳文件數
+func (r *Registry) Len() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.records)
+}
+
+// Content 回傳文件的內容
+func (r *Registry) Content(id string) (string, error) {
+	r.mu.RLock()
+	rec, ok := r.records[id]
+	r.mu.RUnlock()
+	if !ok {
+		return "", fmt.Errorf("找不到文件 %s", id)
+	}
+	if r.path == "" {
+		return rec.Content, nil
+	}
+	data, err := os.ReadFile(r.contentPath(id))
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// Put 新增或更新文件並保存，更新時保留原本的建立時間
+func (r *Registry) Put(rec *Record) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now().UTC()
+	rec.UpdatedAt = now
+	if old, ok := r.records[rec.ID]; ok {
+		rec.CreatedAt = old.CreatedAt
+	} else {
+		rec.CreatedAt = now
+	}
+	if r.path != "" {
+		if err := r.writeContent(rec.ID, rec.Content); err != nil {
+			return err
+		}
+		stored := *rec
+		stored.Content = ""
+		rec = &stored
+	}
+	r.records[rec.ID] = rec
+	return r.changed()
+}
+
+// Delete 刪除文件並保存，不存在的 ID 會被忽略
+func (r *Registry) Delete(ids ...string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, id := range ids {
+		if _, ok := r.records[id]; !ok {
+			continue
+		}
+		delete(r.records, id)
+		if r.path != "" {
+			if err := os.Remove(r.contentPath(id)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+		}
+	}
+	return r.changed()
+}
+
+// Hold 暫停每次變更後保存 manifest，直到呼叫回傳的 release；release 時若有變更只保存一次
+// 用於一次同步多份文件，避免每份文件都重寫整個 manifest
+func (r *Registry) Hold() (release func() error) {
+	r.mu.Lock()
+	r.held++
+	r.mu.Unlock()
+	var once sync.Once
+	return func() error {
+		var err error
+		once.Do(func() {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			if r.held--; r.held == 0 && r.dirty {
+				err = r.save()
+			}
+		})
+		return err
+	}
+}
+
+// changed 在變更後保存 manifest，Hold 期間只記錄有變更（呼叫者需持有鎖）
+func (r *Registry) changed() error {
+	if r.held > 0 {
+		r.dirty = true
+		return nil
+	}
+	return r.save()
+}
+
+// sorted 回傳依 ID 排序的所有文件（呼叫者需持有鎖）
+func (r *Registry) sorted() []*Record {
+	records := make([]*Record, 0, len(r.records))
+	for _, rec := range r.records {
+		records = append(records, rec)
+	}
+	slices.SortFunc(records, func(a, b *Record) int { return cmp.Compare(a.ID, b.ID) })
+	return records
+}
+
+// save 以暫存檔加上 rename 的方式寫入（呼叫者需持有鎖）
+func (r *Registry) save() error {
+	if r.path == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(r.path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(r.sorted(), "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(r.path, data); err != nil {
+		return err
+	}
+	r.dirty = false
+	return nil
+}
+
+// writeContent 將文件內容寫入內容目錄
+func (r *Registry) writeContent(id, content string) error {
+	if err := os.MkdirAll(r.path+".content", 0o755); err != nil {
+		return err
+	}
+	return writeFileAtomic(r.contentPath(id), []byte(content))
+}
+
+// contentPath 回傳文件內容的檔案路徑，以 ID 的 SHA-256 作為檔名，避免 ID 中的 / 等字元
+func (r *Registry) contentPath(id string) string {
+	sum := sha256.Sum256([]byte(id))
+	return filepath.Join(r.path+".content", hex.EncodeToString(sum[:])+".txt")
+}
+
+// writeFileAtomic 以暫存檔加上 rename 的方式寫入
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,94 @@
+package ingest
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRegistryContentOutsideManifest(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "documents.json")
+	r, err := OpenRegistry(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Put(&Record{ID: "guides/a", Hash: "h1", Content: "alpha content", ChunkIDs: []string{"guides/a#0"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	manifest, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(manifest), "alpha content") {
+		t.Errorf("manifest 不應包含文件內容: %s", manifest)
+	}
+	if rec, _ := r.Get("guides/a"); rec.Content != "" {
+		t.Errorf("Get 回傳的記錄不應帶有內容: %q", rec.Content)
+	}
+
+	reopened, err := OpenRegistry(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content, err := reopened.Content("guides/a"); err != nil || content != "alpha content" {
+		t.Fatalf("Content() = %q, %v", content, err)
+	}
+
+	if err := reopened.Delete("guides/a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(reopened.contentPath("guides/a")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("刪除文件後內容檔仍存在: %v", err)
+	}
+}
+
+func TestRegistryMigratesInlineContent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "documents.json")
+	legacy, _ := json.Marshal([]*Record{{ID: "a", Hash: "h", Content: "legacy content"}})
+	if err := os.WriteFile(path, legacy, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	r, err := OpenRegistry(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content, err := r.Content("a"); err != nil || content != "legacy content" {
+		t.Fatalf("Content() = %q, %v", content, err)
+	}
+	manifest, _ := os.ReadFile(path)
+	if strings.Contains(string(manifest), "legacy content") {
+		t.Errorf("移轉後 manifest 不應包含文件內容: %s", manifest)
+	}
+}
+
+func TestRegistryHold(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "documents.json")
+	r, err := OpenRegistry(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	release := r.Hold()
+	for _, id := range []string{"a", "b", "c"} {
+		if err := r.Put(&Record{ID: id, Content: id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := os.Stat(path); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("Hold 期間不應保存 manifest: %v", err)
+	}
+	if err := release(); err != nil {
+		t.Fatal(err)
+	}
+	reopened, err := OpenRegistry(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reopened.Len() != 3 {
+		t.Errorf("release 後 manifest 有 %d 份文件，want 3", reopened.Len())
+	}
+}
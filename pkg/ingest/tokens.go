@@ -0,0 +1,73 @@
+package ingest
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// span 為原文中的一段範圍 [start, end)，以 byte 位置表示
+type span struct {
+	start, end int
+}
+
+// tokenize 以近似 LLM tokenizer 的方式切分 token，回傳每個 token 在原文中的位置：
+// 英文與數字以連續字元為一個 token，中日韓文字每個字為一個 token，標點符號各自為一個 token，空白會被略過
+func tokenize(text string) []span {
+	var tokens []span
+	wordStart := -1
+	for i, r := range text {
+		switch {
+		case isWordRune(r):
+			if wordStart < 0 {
+				wordStart = i
+			}
+			continue
+		case wordStart >= 0:
+			tokens = append(tokens, span{wordStart, i})
+			wordStart = -1
+		}
+		if !unicode.IsSpace(r) {
+			tokens = append(tokens, span{i, i + utf8.RuneLen(r)})
+		}
+	}
+	if wordStart >= 0 {
+		tokens = append(tokens, span{wordStart, len(text)})
+	}
+	return tokens
+}
+
+// CountTokens 回傳文字的近似 token 數
+func CountTokens(text string) int {
+	return len(tokenize(text))
+}
+
+// isWordRune 判斷字元是否屬於以空白分隔的單字（非中日韓文字的字母與數字）
+func isWordRune(r rune) bool {
+	return (unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_') && !isCJK(r)
+}
+
+// isCJK 判斷是否為中日韓文字，這些文字之間沒有空白，每個字視為一個 token
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
+
+// tokenWindows 將 [start, end) 範圍依固定 token 數切成多個視窗，相鄰視窗重疊 overlap 個 token
+func tokenWindows(text string, s span, size, overlap int) []span {
+	tokens := tokenize(text[s.start:s.end])
+	if len(tokens) == 0 {
+		return nil
+	}
+	if size <= 0 {
+		size = len(tokens)
+	}
+	overlap = max(min(overlap, size-1), 0)
+
+	var out []span
+	for i := 0; ; i += size - overlap {
+		j := min(i+size, len(tokens))
+		out = append(out, span{s.start + tokens[i].start, s.start + tokens[j-1].end})
+		if j == len(tokens) {
+			return out
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package ingest
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/firebase/genkit/go/ai"
+)
+
+// WalkOptions 為走訪目錄時的過濾條件，glob 以相對於根目錄、/ 分隔的路徑比對
+// 支援 *（不跨目錄）、**（跨任意層目錄）、? 與 [abc]，例如 "docs/**/*.md"
+type WalkOptions struct {
+	Include []string // 只載入符合的檔案，空白表示所有支援的格式
+	Exclude []string // 略過符合的檔案或目錄，例如 "**/node_modules" 或 "drafts/**"
+}
+
+// WalkFiles 走訪目錄，回傳符合條件且有對應載入器的檔案（相對於 root、以 / 分隔），依路徑排序
+func WalkFiles(root string, opts WalkOptions) ([]string, error) {
+	include, err := compileGlobs(opts.Include)
+	if err != nil {
+		return nil, err
+	}
+	exclude, err := compileGlobs(opts.Exclude)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	err = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == "." {
+			return nil
+		}
+		if matchAny(exclude, rel) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() || !Supported(rel) {
+			return nil
+		}
+		if len(include) == 0 || matchAny(include, rel) {
+			files = append(files, rel)
+		}
+		return nil
+	})
+	return files, err
+}
+
+// LoadDir 載入目錄中符合條件的所有檔案，文件 ID 與來源為相對於 root 的路徑
+func LoadDir(root string, opts WalkOptions) ([]*ai.Document, error) {
+	files, err := WalkFiles(root, opts)
+	if err != nil {
+		return nil, err
+	}
+	var docs []*ai.Document
+	for _, rel := range files {
+		data, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(rel)))
+		if err != nil {
+			return nil, err
+		}
+		loaded, err := LoadBytes(rel, data)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, loaded...)
+	}
+	return docs, nil
+}
+
+// compileGlobs 將 glob 轉為正規表示式
+func compileGlobs(patterns []string) ([]*regexp.Regexp, error) {
+	out := make([]*regexp.Regexp, 0, len(patterns))
+	for _, p := range patterns {
+		re, err := regexp.Compile(globToRegexp(p))
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, re)
+	}
+	return out, nil
+}
+
+// globToRegexp 將 glob 轉為正規表示式；"**/" 可比對零或多層目錄，結尾的 "/**" 比對目錄下所有內容
+func globToRegexp(glob string) string {
+	glob = strings.TrimPrefix(filepath.ToSlash(glob), "./")
+	var sb strings.Builder
+	sb.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case strings.HasPrefix(glob[i:], "**/"):
+			sb.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			sb.WriteString(".*")
+			i++
+		case c == '*':
+			sb.WriteString("[^/]*")
+		case c == '?':
+			sb.WriteString("[^/]")
+		case c == '[':
+			if j := strings.IndexByte(glob[i:], ']'); j > 0 {
+				class := glob[i+1 : i+j]
+				if strings.HasPrefix(class, "!") {
+					class = "^" + class[1:]
+				}
+				sb.WriteString("[" + class + "]")
+				i += j
+			} else {
+				sb.WriteString(`\[`)
+			}
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	sb.WriteString("$")
+	return sb.String()
+}
+
+func matchAny(globs []*regexp.Regexp, p string) bool {
+	for _, re := range globs {
+		if re.MatchString(p) {
+			return true
+		}
+	}
+	return false
+}
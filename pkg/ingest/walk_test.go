@@ -0,0 +1,107 @@
+package ingest
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// writeFiles 在 root 下建立檔案，路徑以 / 分隔
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestWalkFiles(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"README.md":                   "# root",
+		"notes.txt":                   "notes",
+		"image.png":                   "png",
+		"guides/setup.md":             "# setup",
+		"guides/deep/advanced.md":     "# advanced",
+		"guides/page.html":            "<p>page</p>",
+		"drafts/wip.md":               "# wip",
+		"web/node_modules/pkg/doc.md": "# vendored",
+	})
+
+	tests := []struct {
+		name string
+		opts WalkOptions
+		want []string
+	}{
+		{
+			name: "all supported files",
+			want: []string{"README.md", "drafts/wip.md", "guides/deep/advanced.md", "guides/page.html", "guides/setup.md", "notes.txt", "web/node_modules/pkg/doc.md"},
+		},
+		{
+			name: "double star matches any depth",
+			opts: WalkOptions{Include: []string{"**/*.md"}},
+			want: []string{"README.md", "drafts/wip.md", "guides/deep/advanced.md", "guides/setup.md", "web/node_modules/pkg/doc.md"},
+		},
+		{
+			name: "single star stays in one directory",
+			opts: WalkOptions{Include: []string{"guides/*.md"}},
+			want: []string{"guides/setup.md"},
+		},
+		{
+			name: "trailing double star matches directory contents",
+			opts: WalkOptions{Include: []string{"guides/**"}},
+			want: []string{"guides/deep/advanced.md", "guides/page.html", "guides/setup.md"},
+		},
+		{
+			name: "exclude directories",
+			opts: WalkOptions{Exclude: []string{"drafts/**", "**/node_modules"}},
+			want: []string{"README.md", "guides/deep/advanced.md", "guides/page.html", "guides/setup.md", "notes.txt"},
+		},
+		{
+			name: "exclude wins over include",
+			opts: WalkOptions{Include: []string{"**/*.md"}, Exclude: []string{"guides/deep/**", "./drafts/*"}},
+			want: []string{"README.md", "guides/setup.md", "web/node_modules/pkg/doc.md"},
+		},
+		{
+			name: "question mark and character class",
+			opts: WalkOptions{Include: []string{"[Rn]*.???", "guides/pag?.html"}},
+			want: []string{"guides/page.html", "notes.txt"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := WalkFiles(root, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("WalkFiles() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadDir(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"a.md":       "# A\n內容",
+		"sub/b.html": "<title>B</title><p>b</p>",
+	})
+	docs, err := LoadDir(root, WalkOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, doc := range docs {
+		ids = append(ids, doc.Metadata[MetaID].(string))
+	}
+	if want := []string{"a.md", "sub/b.html"}; !slices.Equal(ids, want) {
+		t.Errorf("文件 ID = %v, want %v", ids, want)
+	}
+}
@@ -0,0 +1,81 @@
+package logging
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/firebase/genkit/go/core"
+	"google.golang.org/genai"
+)
+
+// ErrorClass 將錯誤歸類為固定的幾種類別，方便在日誌中彙整與告警
+//
+//	timeout / canceled / rate_limited / provider_unavailable /
+//	provider_rejected / invalid_argument / internal
+func ErrorClass(err error) string {
+	if err == nil {
+		return ""
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return "timeout"
+	}
+	if errors.Is(err, context.Canceled) {
+		return "canceled"
+	}
+
+	var apiErr genai.APIError
+	if errors.As(err, &apiErr) {
+		return providerErrorClass(apiErr.Code)
+	}
+	var ptrAPIErr *genai.APIError
+	if errors.As(err, &ptrAPIErr) {
+		return providerErrorClass(ptrAPIErr.Code)
+	}
+
+	var gErr *core.GenkitError
+	if errors.As(err, &gErr) {
+		switch gErr.Status {
+		case core.DEADLINE_EXCEEDED:
+			return "timeout"
+		case core.RESOURCE_EXHAUSTED:
+			return "rate_limited"
+		case core.UNAVAILABLE:
+			return "provider_unavailable"
+		case core.INVALID_ARGUMENT, core.FAILED_PRECONDITION:
+			return "invalid_argument"
+		}
+	}
+	return "internal"
+}
+
+func providerErrorClass(code int) string {
+	switch {
+	case code == http.StatusTooManyRequests:
+		return "rate_limited"
+	case code >= 500:
+		return "provider_unavailable"
+	default:
+		return "provider_rejected"
+	}
+}
+
+// statusErrorClass 將 HTTP 狀態碼歸類，2xx/3xx 回傳空字串
+func statusErrorClass(status int) string {
+	switch {
+	case status < 400:
+		return ""
+	case status == http.StatusUnauthorized:
+		return "unauthenticated"
+	case status == http.StatusForbidden:
+		return "forbidden"
+	case status == http.StatusNotFound:
+		return "not_found"
+	case status == http.StatusTooManyRequests:
+		return "rate_limited"
+	case status < 500:
+		return "invalid_argument"
+	default:
+		return "internal"
+	}
+}
@@ -0,0 +1,120 @@
+// Package logging 提供所有服務共用的 slog JSON 日誌設定
+// 每個請求的日誌都會帶有 request_id，handler 可再附加 session_id、model 等欄位，
+// 日誌等級可透過 LOG_LEVEL 設定，並可在執行期間調整
+package logging
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// level 為全域日誌等級，可在執行期間調整
+var level = new(slog.LevelVar)
+
+// Setup 設定 JSON 格式的預設 logger，初始等級取自 LOG_LEVEL（debug/info/warn/error，預設 info）
+// 標準函式庫 log 套件與 Genkit 的 logger.FromContext 也會改為輸出到這個 logger
+func Setup() {
+	if err := SetLevel(os.Getenv("LOG_LEVEL")); err != nil {
+		level.Set(slog.LevelInfo)
+	}
+
+	handler := slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: level})
+	slog.SetDefault(slog.New(&contextHandler{Handler: handler}))
+}
+
+// SetLevel 調整日誌等級，空字串視為 info
+func SetLevel(name string) error {
+	if name == "" {
+		name = "info"
+	}
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(strings.ToUpper(name))); err != nil {
+		return fmt.Errorf("無效的日誌等級: %s", name)
+	}
+	level.Set(l)
+	return nil
+}
+
+// Level 回傳目前的日誌等級
+func Level() slog.Level {
+	return level.Level()
+}
+
+// Fatal 記錄錯誤後結束程式
+func Fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+// attrBag 為單一請求共用的日誌欄位，handler 可在處理過程中持續附加
+type attrBag struct {
+	mu    sync.Mutex
+	attrs []slog.Attr
+}
+
+type bagKey struct{}
+
+// NewContext 回傳帶有日誌欄位的 context，之後以此 context 記錄的日誌都會帶上這些欄位
+func NewContext(ctx context.Context, attrs ...slog.Attr) context.Context {
+	bag := &attrBag{attrs: attrs}
+	if parent, ok := ctx.Value(bagKey{}).(*attrBag); ok {
+		parent.mu.Lock()
+		bag.attrs = append(append([]slog.Attr(nil), parent.attrs...), attrs...)
+		parent.mu.Unlock()
+	}
+	return context.WithValue(ctx, bagKey{}, bag)
+}
+
+// AddAttrs 將欄位附加到 ctx 所屬請求的日誌欄位（例如 session_id、model），
+// 請求結束時的存取日誌也會包含這些欄位
+func AddAttrs(ctx context.Context, attrs ...slog.Attr) {
+	if bag, ok := ctx.Value(bagKey{}).(*attrBag); ok {
+		bag.mu.Lock()
+		defer bag.mu.Unlock()
+		for _, a := range attrs {
+			bag.set(a)
+		}
+	}
+}
+
+// set 新增或覆寫同名欄位（呼叫者需持有鎖）
+func (b *attrBag) set(a slog.Attr) {
+	for i := range b.attrs {
+		if b.attrs[i].Key == a.Key {
+			b.attrs[i] = a
+			return
+		}
+	}
+	b.attrs = append(b.attrs, a)
+}
+
+// contextHandler 在輸出日誌前加上 context 中的請求欄位與 trace ID
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h *contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		r.AddAttrs(slog.String("trace_id", sc.TraceID().String()))
+	}
+	if bag, ok := ctx.Value(bagKey{}).(*attrBag); ok {
+		bag.mu.Lock()
+		r.AddAttrs(bag.attrs...)
+		bag.mu.Unlock()
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,122 @@
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/gin-gonic/gin"
+)
+
+// RequestIDHeader 為請求ID使用的標頭，沿用上游傳入的值或自動產生
+const RequestIDHeader = "X-Request-ID"
+
+// Middleware 回傳記錄存取日誌的 gin 中介層，取代 gin.Default 的文字 logger
+// 每個請求都會帶有 request_id，並在結束時輸出 latency_ms、status 與 error_class
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		requestID := c.GetHeader(RequestIDHeader)
+		if requestID == "" || len(requestID) > 128 {
+			requestID = newRequestID()
+		}
+		c.Header(RequestIDHeader, requestID)
+
+		ctx := NewContext(c.Request.Context(), slog.String("request_id", requestID))
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+
+		status := c.Writer.Status()
+		attrs := []slog.Attr{
+			slog.String("method", c.Request.Method),
+			slog.String("route", c.FullPath()),
+			slog.String("path", c.Request.URL.Path),
+			slog.Int("status", status),
+			slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.String("client_ip", c.ClientIP()),
+		}
+		if class := statusErrorClass(status); class != "" {
+			attrs = append(attrs, slog.String("error_class", class))
+		}
+		if len(c.Errors) > 0 {
+			attrs = append(attrs, slog.String("error", c.Errors.String()))
+		}
+
+		lvl := slog.LevelInfo
+		switch {
+		case status >= 500:
+			lvl = slog.LevelError
+		case status >= 400:
+			lvl = slog.LevelWarn
+		}
+		slog.LogAttrs(c.Request.Context(), lvl, "http request", attrs...)
+	}
+}
+
+// ModelMiddleware 回傳記錄每次模型呼叫的 Genkit 模型中介層，
+// 並將 model 欄位附加到所屬請求的日誌
+func ModelMiddleware(model string) ai.ModelMiddleware {
+	return func(next ai.ModelFunc) ai.ModelFunc {
+		return func(ctx context.Context, req *ai.ModelRequest, cb ai.ModelStreamCallback) (*ai.ModelResponse, error) {
+			AddAttrs(ctx, slog.String("model", model))
+
+			start := time.Now()
+			resp, err := next(ctx, req, cb)
+			attrs := []slog.Attr{
+				slog.String("model", model),
+				slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+			}
+			if err != nil {
+				attrs = append(attrs, slog.String("error_class", ErrorClass(err)), slog.String("error", err.Error()))
+				slog.LogAttrs(ctx, slog.LevelError, "model call failed", attrs...)
+				return resp, err
+			}
+			if resp != nil && resp.Usage != nil {
+				attrs = append(attrs,
+					slog.Int("input_tokens", resp.Usage.InputTokens),
+					slog.Int("output_tokens", resp.Usage.OutputTokens),
+				)
+			}
+			slog.LogAttrs(ctx, slog.LevelDebug, "model call", attrs...)
+			return resp, nil
+		}
+	}
+}
+
+// LevelHandler 回傳查詢與調整日誌等級的 handler
+//
+//	GET /log-level              回傳目前等級
+//	PUT /log-level {"level":"debug"}  調整等級
+func LevelHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method == http.MethodGet {
+			c.JSON(http.StatusOK, gin.H{"level": Level().String()})
+			return
+		}
+
+		var req struct {
+			Level string `json:"level" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "無效的請求格式"})
+			return
+		}
+		if err := SetLevel(req.Level); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		slog.InfoContext(c.Request.Context(), "log level changed", "level", Level().String())
+		c.JSON(http.StatusOK, gin.H{"level": Level().String()})
+	}
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,221 @@
+// Package metrics 提供 HTTP 服務共用的 Prometheus 指標
+//
+// 指標名稱與標籤屬於對外介面，修改前請先確認監控面板與告警規則：
+//
+//	genkit_demo_http_requests_total{route,method,status}         HTTP 請求數
+//	genkit_demo_http_request_duration_seconds{route,method}      HTTP 請求延遲
+//	genkit_demo_model_request_duration_seconds{model}            模型呼叫延遲
+//	genkit_demo_model_errors_total{model}                        模型呼叫錯誤數
+//	genkit_demo_model_tokens_total{model,type}                   模型 token 用量，type 為 input 或 output
+//	genkit_demo_chat_active_sessions                             ChatManager 中的會話數
+//	genkit_demo_retriever_duration_seconds{retriever}            檢索延遲
+//	genkit_demo_retriever_documents{retriever}                   每次檢索回傳的文檔數
+//	genkit_demo_retriever_errors_total{retriever}                檢索錯誤數
+//	genkit_demo_embedder_request_duration_seconds{embedder}      embedding 模型呼叫延遲
+//	genkit_demo_embedder_documents_total{embedder}               送往 embedding 模型的文件數
+//	genkit_demo_embedder_errors_total{embedder}                  embedding 模型呼叫錯誤數
+//	genkit_demo_embedding_cache_lookups_total{embedder,result}   embedding 快取查詢的文件數，result 為 hit 或 miss
+package metrics
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "genkit_demo"
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP 請求數，依路由、方法與狀態碼區分",
+	}, []string{"route", "method", "status"})
+
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP 請求處理時間（秒）",
+		Buckets:   []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"route", "method"})
+
+	modelDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "model_request_duration_seconds",
+		Help:      "模型呼叫時間（秒）",
+		Buckets:   []float64{0.25, 0.5, 1, 2, 4, 8, 16, 32, 64},
+	}, []string{"model"})
+
+	modelErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "model_errors_total",
+		Help:      "模型呼叫失敗次數",
+	}, []string{"model"})
+
+	modelTokens = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "model_tokens_total",
+		Help:      "模型 token 用量，type 為 input 或 output",
+	}, []string{"model", "type"})
+
+	retrieverDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "retriever_duration_seconds",
+		Help:      "檢索時間（秒），包含查詢向量的 embedding",
+		Buckets:   []float64{0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5},
+	}, []string{"retriever"})
+
+	retrieverDocuments = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "retriever_documents",
+		Help:      "每次檢索回傳的文檔數",
+		Buckets:   []float64{0, 1, 2, 3, 5, 10, 20, 50},
+	}, []string{"retriever"})
+
+	retrieverErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "retriever_errors_total",
+		Help:      "檢索失敗次數",
+	}, []string{"retriever"})
+
+	embedderDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "embedder_request_duration_seconds",
+		Help:      "embedding 模型呼叫時間（秒）",
+		Buckets:   []float64{0.05, 0.1, 0.25, 0.5, 1, 2, 4, 8, 16},
+	}, []string{"embedder"})
+
+	embedderDocuments = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "embedder_documents_total",
+		Help:      "送往 embedding 模型的文件數",
+	}, []string{"embedder"})
+
+	embedderErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "embedder_errors_total",
+		Help:      "embedding 模型呼叫失敗次數（含會重試的錯誤）",
+	}, []string{"embedder"})
+
+	embeddingCacheLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "embedding_cache_lookups_total",
+		Help:      "embedding 快取查詢的文件數，result 為 hit 或 miss；命中率為 hit / (hit + miss)",
+	}, []string{"embedder", "result"})
+)
+
+// Handler 回傳輸出 Prometheus 指標的 gin handler，掛在 /metrics
+func Handler() gin.HandlerFunc {
+	return gin.WrapH(promhttp.Handler())
+}
+
+// Middleware 回傳記錄 HTTP 請求數與延遲的 gin 中介層
+// 路由標籤使用路由樣板（例如 /chat/:session_id/history）以避免標籤數量無限成長
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		method := c.Request.Method
+		httpRequests.WithLabelValues(route, method, strconv.Itoa(c.Writer.Status())).Inc()
+		httpDuration.WithLabelValues(route, method).Observe(time.Since(start).Seconds())
+	}
+}
+
+// ModelMiddleware 回傳記錄模型呼叫延遲、錯誤數與 token 用量的 Genkit 模型中介層
+// 使用方式: genkit.Generate(ctx, g, ai.WithMiddleware(metrics.ModelMiddleware(modelName)), ...)
+func ModelMiddleware(model string) ai.ModelMiddleware {
+	return func(next ai.ModelFunc) ai.ModelFunc {
+		return func(ctx context.Context, req *ai.ModelRequest, cb ai.ModelStreamCallback) (*ai.ModelResponse, error) {
+			start := time.Now()
+			resp, err := next(ctx, req, cb)
+			modelDuration.WithLabelValues(model).Observe(time.Since(start).Seconds())
+			if err != nil {
+				modelErrors.WithLabelValues(model).Inc()
+				return resp, err
+			}
+			if resp != nil && resp.Usage != nil {
+				modelTokens.WithLabelValues(model, "input").Add(float64(resp.Usage.InputTokens))
+				modelTokens.WithLabelValues(model, "output").Add(float64(resp.Usage.OutputTokens))
+			}
+			return resp, nil
+		}
+	}
+}
+
+// RegisterActiveSessions 註冊回報目前會話數的 gauge，fn 會在每次抓取指標時呼叫
+func RegisterActiveSessions(fn func() int) {
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "chat_active_sessions",
+		Help:      "ChatManager 中目前的會話數",
+	}, func() float64 { return float64(fn()) })
+}
+
+// instrumentedRetriever 包裝 ai.Retriever 以記錄檢索延遲與回傳文檔數
+type instrumentedRetriever struct {
+	ai.Retriever
+}
+
+// InstrumentRetriever 回傳會記錄檢索指標的 Retriever
+func InstrumentRetriever(r ai.Retriever) ai.Retriever {
+	return instrumentedRetriever{r}
+}
+
+// Retrieve 執行檢索並記錄指標
+func (r instrumentedRetriever) Retrieve(ctx context.Context, req *ai.RetrieverRequest) (*ai.RetrieverResponse, error) {
+	name := r.Name()
+	start := time.Now()
+	resp, err := r.Retriever.Retrieve(ctx, req)
+	retrieverDuration.WithLabelValues(name).Observe(time.Since(start).Seconds())
+	if err != nil {
+		retrieverErrors.WithLabelValues(name).Inc()
+		return resp, err
+	}
+	retrieverDocuments.WithLabelValues(name).Observe(float64(len(resp.Documents)))
+	return resp, nil
+}
+
+// instrumentedEmbedder 包裝 ai.Embedder 以記錄呼叫延遲、文件數與錯誤數
+type instrumentedEmbedder struct {
+	ai.Embedder
+}
+
+// InstrumentEmbedder 回傳會記錄 embedding 指標的 Embedder
+// 包在快取內層時只會記錄實際送往模型的呼叫
+func InstrumentEmbedder(e ai.Embedder) ai.Embedder {
+	return instrumentedEmbedder{e}
+}
+
+// Embed 執行 embedding 並記錄指標
+func (e instrumentedEmbedder) Embed(ctx context.Context, req *ai.EmbedRequest) (*ai.EmbedResponse, error) {
+	name := e.Name()
+	start := time.Now()
+	resp, err := e.Embedder.Embed(ctx, req)
+	embedderDuration.WithLabelValues(name).Observe(time.Since(start).Seconds())
+	embedderDocuments.WithLabelValues(name).Add(float64(len(req.Input)))
+	if err != nil {
+		embedderErrors.WithLabelValues(name).Inc()
+	}
+	return resp, err
+}
+
+// EmbeddingCacheObserver 回傳記錄 embedding 快取命中數的函式，可作為 embedcache.Config 的 OnLookup
+func EmbeddingCacheObserver(embedder string) func(hits, misses int) {
+	hit := embeddingCacheLookups.WithLabelValues(embedder, "hit")
+	miss := embeddingCacheLookups.WithLabelValues(embedder, "miss")
+	return func(hits, misses int) {
+		hit.Add(float64(hits))
+		miss.Add(float64(misses))
+	}
+}
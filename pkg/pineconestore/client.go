@@ -0,0 +1,247 @@
+// Package pineconestore 是 Pinecone 的精簡 REST 客戶端與 Genkit 索引／檢索實作
+//
+// Genkit 的 pinecone plugin 只提供新增與檢索，沒有刪除、metadata 過濾與分數；
+// 本套件補上這些功能，並以文件 metadata 中的 "id" 作為向量 ID，方便之後更新或刪除同一份文件
+package pineconestore
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+const (
+	apiServer  = "api.pinecone.io"
+	apiVersion = "2025-01"
+
+	// requestTimeout 為單一請求（含讀取回應）的時間上限，避免連線卡住時呼叫端無限等待
+	requestTimeout = 30 * time.Second
+
+	upsertBatchSize = 100  // Pinecone 建議每次 upsert 不超過 100 筆
+	deleteBatchSize = 1000 // 每次刪除最多 1000 個 ID
+)
+
+// APIError 為 Pinecone 回傳的錯誤，StatusCode 可用於判斷是否重試
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("pinecone: HTTP %d: %s", e.StatusCode, e.Message)
+}
+
+// Client 為 Pinecone 控制平面的客戶端
+type Client struct {
+	apiKey  string
+	baseURL string // 控制平面的網址
+	http    *http.Client
+}
+
+// NewClient 建立客戶端，apiKey 為空時讀取 PINECONE_API_KEY
+func NewClient(apiKey string) (*Client, error) {
+	if apiKey == "" {
+		apiKey = os.Getenv("PINECONE_API_KEY")
+	}
+	if apiKey == "" {
+		return nil, errors.New("pinecone: 未設定 PINECONE_API_KEY")
+	}
+	return &Client{
+		apiKey:  apiKey,
+		baseURL: "https://" + apiServer,
+		http:    &http.Client{Timeout: requestTimeout},
+	}, nil
+}
+
+// Index 查詢索引的 host 並回傳可讀寫該索引的 IndexClient
+func (c *Client) Index(ctx context.Context, name string) (*IndexClient, error) {
+	var data struct {
+		Host      string `json:"host"`
+		Dimension int    `json:"dimension"`
+		Metric    string `json:"metric"`
+	}
+	if err := c.do(ctx, http.MethodGet, c.baseURL+"/indexes/"+url.PathEscape(name), nil, &data); err != nil {
+		return nil, err
+	}
+	return &IndexClient{client: c, Name: name, Host: data.Host, Dimension: data.Dimension, Metric: data.Metric}, nil
+}
+
+// do 送出請求並解析 JSON 回應，非 2xx 回應轉為 *APIError
+func (c *Client) do(ctx context.Context, method, url string, body, result any) error {
+	var reader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Api-Key", c.apiKey)
+	req.Header.Set("X-Pinecone-API-Version", apiVersion)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &APIError{StatusCode: resp.StatusCode, Message: errorMessage(data)}
+	}
+	if result == nil || len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, result)
+}
+
+// errorMessage 取出錯誤回應中的訊息，格式不明時回傳原始內容
+func errorMessage(data []byte) string {
+	var e struct {
+		Message string `json:"message"`
+		Error   struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(data, &e) == nil {
+		if e.Error.Message != "" {
+			return e.Error.Message
+		}
+		if e.Message != "" {
+			return e.Message
+		}
+	}
+	return string(data)
+}
+
+// IndexClient 為單一 Pinecone 索引的資料平面客戶端
+type IndexClient struct {
+	client    *Client
+	Name      string
+	Host      string
+	Dimension int
+	Metric    string
+}
+
+// Vector 為一筆向量資料
+type Vector struct {
+	ID       string         `json:"id"`
+	Values   []float32      `json:"values"`
+	Metadata map[string]any `json:"metadata,omitempty"`
+}
+
+// Upsert 新增或覆寫向量，超過 100 筆時分批送出
+func (idx *IndexClient) Upsert(ctx context.Context, vectors []Vector, namespace string) error {
+	for start := 0; start < len(vectors); start += upsertBatchSize {
+		body := map[string]any{
+			"vectors":   vectors[start:min(start+upsertBatchSize, len(vectors))],
+			"namespace": namespace,
+		}
+		if err := idx.client.do(ctx, http.MethodPost, idx.url("/vectors/upsert"), body, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Query 為查詢條件
+type Query struct {
+	Vector    []float32
+	TopK      int
+	Namespace string
+	Filter    map[string]any // Pinecone 的 metadata 過濾語法，例如 {"category": {"$eq": "科技"}}
+}
+
+// Match 為查詢結果
+type Match struct {
+	ID       string         `json:"id"`
+	Score    float32        `json:"score"`
+	Metadata map[string]any `json:"metadata"`
+}
+
+// Query 查詢最相似的向量，結果依分數由高到低排序
+func (idx *IndexClient) Query(ctx context.Context, q Query) ([]Match, error) {
+	body := map[string]any{
+		"vector":          q.Vector,
+		"topK":            q.TopK,
+		"namespace":       q.Namespace,
+		"includeMetadata": true,
+	}
+	if len(q.Filter) > 0 {
+		body["filter"] = q.Filter
+	}
+	var result struct {
+		Matches []Match `json:"matches"`
+	}
+	if err := idx.client.do(ctx, http.MethodPost, idx.url("/query"), body, &result); err != nil {
+		return nil, err
+	}
+	return result.Matches, nil
+}
+
+// Delete 依 ID 刪除向量，不存在的 ID 會被忽略
+func (idx *IndexClient) Delete(ctx context.Context, ids []string, namespace string) error {
+	for start := 0; start < len(ids); start += deleteBatchSize {
+		body := map[string]any{
+			"ids":       ids[start:min(start+deleteBatchSize, len(ids))],
+			"namespace": namespace,
+		}
+		if err := idx.client.do(ctx, http.MethodPost, idx.url("/vectors/delete"), body, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteAll 刪除 namespace 中的所有向量
+func (idx *IndexClient) DeleteAll(ctx context.Context, namespace string) error {
+	body := map[string]any{"deleteAll": true, "namespace": namespace}
+	err := idx.client.do(ctx, http.MethodPost, idx.url("/vectors/delete"), body, nil)
+	// namespace 不存在時 Pinecone 回應 404，視為已刪除
+	if apiErr, ok := err.(*APIError); ok && apiErr.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	return err
+}
+
+// Stats 為索引的統計資訊
+type Stats struct {
+	Dimension        int                       `json:"dimension"`
+	TotalVectorCount int                       `json:"totalVectorCount"`
+	Namespaces       map[string]NamespaceStats `json:"namespaces"`
+}
+
+// NamespaceStats 為單一 namespace 的統計資訊
+type NamespaceStats struct {
+	VectorCount int `json:"vectorCount"`
+}
+
+// Stats 回傳索引與各 namespace 的向量數
+func (idx *IndexClient) Stats(ctx context.Context) (*Stats, error) {
+	var result Stats
+	if err := idx.client.do(ctx, http.MethodPost, idx.url("/describe_index_stats"), map[string]any{}, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (idx *IndexClient) url(path string) string {
+	return "https://" + idx.Host + path
+}
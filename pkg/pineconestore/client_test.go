@@ -0,0 +1,220 @@
+package pineconestore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// request 為測試伺服器收到的請求
+type request struct {
+	path string
+	body map[string]any
+}
+
+// fakePinecone 記錄收到的請求，並以 handle 回應（為 nil 時回應 {}）
+type fakePinecone struct {
+	mu       sync.Mutex
+	requests []request
+	handle   func(w http.ResponseWriter, path string, body map[string]any)
+}
+
+// newTestIndex 啟動 HTTPS 測試伺服器並回傳指向它的 IndexClient
+func newTestIndex(t *testing.T, f *fakePinecone) *IndexClient {
+	t.Helper()
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Api-Key") != "test-key" || r.Header.Get("X-Pinecone-API-Version") != apiVersion {
+			http.Error(w, `{"error":{"message":"unauthorized"}}`, http.StatusUnauthorized)
+			return
+		}
+		body := make(map[string]any)
+		if r.Method == http.MethodPost {
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		f.mu.Lock()
+		f.requests = append(f.requests, request{path: r.URL.Path, body: body})
+		f.mu.Unlock()
+		if f.handle != nil {
+			f.handle(w, r.URL.Path, body)
+			return
+		}
+		fmt.Fprint(w, "{}")
+	}))
+	t.Cleanup(srv.Close)
+	client := &Client{apiKey: "test-key", baseURL: srv.URL, http: srv.Client()}
+	return &IndexClient{client: client, Name: "test", Host: strings.TrimPrefix(srv.URL, "https://")}
+}
+
+func TestClientIndex(t *testing.T) {
+	f := &fakePinecone{handle: func(w http.ResponseWriter, path string, _ map[string]any) {
+		fmt.Fprint(w, `{"host":"test-abc.svc.pinecone.io","dimension":768,"metric":"cosine"}`)
+	}}
+	idx, err := newTestIndex(t, f).client.Index(context.Background(), "docs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if idx.Host != "test-abc.svc.pinecone.io" || idx.Dimension != 768 || idx.Metric != "cosine" {
+		t.Errorf("Index() = %+v", idx)
+	}
+	if f.requests[0].path != "/indexes/docs" {
+		t.Errorf("path = %s, want /indexes/docs", f.requests[0].path)
+	}
+}
+
+func TestBatching(t *testing.T) {
+	tests := []struct {
+		name  string
+		run   func(idx *IndexClient) error
+		path  string
+		field string
+		sizes []int
+	}{
+		{
+			name: "upsert",
+			run: func(idx *IndexClient) error {
+				vectors := make([]Vector, 250)
+				for i := range vectors {
+					vectors[i] = Vector{ID: fmt.Sprint(i), Values: []float32{1}}
+				}
+				return idx.Upsert(context.Background(), vectors, "ns")
+			},
+			path:  "/vectors/upsert",
+			field: "vectors",
+			sizes: []int{100, 100, 50},
+		},
+		{
+			name: "delete",
+			run: func(idx *IndexClient) error {
+				ids := make([]string, 2500)
+				for i := range ids {
+					ids[i] = fmt.Sprint(i)
+				}
+				return idx.Delete(context.Background(), ids, "ns")
+			},
+			path:  "/vectors/delete",
+			field: "ids",
+			sizes: []int{1000, 1000, 500},
+		},
+		{
+			name:  "empty",
+			run:   func(idx *IndexClient) error { return idx.Upsert(context.Background(), nil, "ns") },
+			sizes: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &fakePinecone{}
+			if err := tt.run(newTestIndex(t, f)); err != nil {
+				t.Fatal(err)
+			}
+			var sizes []int
+			for _, r := range f.requests {
+				if r.path != tt.path || r.body["namespace"] != "ns" {
+					t.Errorf("請求 %s %v", r.path, r.body["namespace"])
+				}
+				sizes = append(sizes, len(r.body[tt.field].([]any)))
+			}
+			if !reflect.DeepEqual(sizes, tt.sizes) {
+				t.Errorf("批次大小 = %v, want %v", sizes, tt.sizes)
+			}
+		})
+	}
+}
+
+func TestBatchingStopsOnError(t *testing.T) {
+	f := &fakePinecone{handle: func(w http.ResponseWriter, _ string, _ map[string]any) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}}
+	err := newTestIndex(t, f).Upsert(context.Background(), make([]Vector, 150), "")
+	if err == nil || len(f.requests) != 1 {
+		t.Errorf("Upsert() error = %v，送出 %d 個請求，want 失敗後停止", err, len(f.requests))
+	}
+}
+
+func TestQuery(t *testing.T) {
+	f := &fakePinecone{handle: func(w http.ResponseWriter, _ string, _ map[string]any) {
+		fmt.Fprint(w, `{"matches":[{"id":"a","score":0.9,"metadata":{"category":"科技"}}]}`)
+	}}
+	idx := newTestIndex(t, f)
+	filter := map[string]any{"category": map[string]any{"$eq": "科技"}}
+	matches, err := idx.Query(context.Background(), Query{Vector: []float32{0.5}, TopK: 3, Namespace: "ns", Filter: filter})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 1 || matches[0].ID != "a" || matches[0].Score != 0.9 || matches[0].Metadata["category"] != "科技" {
+		t.Errorf("Query() = %+v", matches)
+	}
+	body := f.requests[0].body
+	if f.requests[0].path != "/query" || body["namespace"] != "ns" || body["topK"] != 3.0 || body["includeMetadata"] != true {
+		t.Errorf("請求 %s %v", f.requests[0].path, body)
+	}
+	if !reflect.DeepEqual(body["filter"], filter) {
+		t.Errorf("filter = %v, want %v", body["filter"], filter)
+	}
+
+	// 沒有過濾條件時不送出 filter
+	if _, err := idx.Query(context.Background(), Query{Vector: []float32{0.5}, TopK: 3}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := f.requests[1].body["filter"]; ok {
+		t.Errorf("空的過濾條件被送出: %v", f.requests[1].body)
+	}
+}
+
+func TestAPIError(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		message string
+	}{
+		{name: "nested message", status: http.StatusTooManyRequests, body: `{"error":{"code":"RESOURCE_EXHAUSTED","message":"too many requests"}}`, message: "too many requests"},
+		{name: "top-level message", status: http.StatusBadRequest, body: `{"code":3,"message":"invalid vector"}`, message: "invalid vector"},
+		{name: "plain text", status: http.StatusBadGateway, body: "bad gateway", message: "bad gateway"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &fakePinecone{handle: func(w http.ResponseWriter, _ string, _ map[string]any) {
+				w.WriteHeader(tt.status)
+				fmt.Fprint(w, tt.body)
+			}}
+			_, err := newTestIndex(t, f).Stats(context.Background())
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("Stats() error = %v，want *APIError", err)
+			}
+			if apiErr.StatusCode != tt.status || apiErr.Message != tt.message {
+				t.Errorf("APIError = %+v, want %d %q", apiErr, tt.status, tt.message)
+			}
+		})
+	}
+}
+
+func TestDeleteAllMissingNamespace(t *testing.T) {
+	status := http.StatusNotFound
+	f := &fakePinecone{handle: func(w http.ResponseWriter, _ string, _ map[string]any) {
+		w.WriteHeader(status)
+		fmt.Fprint(w, `{"message":"namespace not found"}`)
+	}}
+	idx := newTestIndex(t, f)
+	if err := idx.DeleteAll(context.Background(), "missing"); err != nil {
+		t.Errorf("namespace 不存在時 DeleteAll() error = %v", err)
+	}
+	if body := f.requests[0].body; body["deleteAll"] != true || body["namespace"] != "missing" {
+		t.Errorf("請求 %v", body)
+	}
+	status = http.StatusInternalServerError
+	if err := idx.DeleteAll(context.Background(), "missing"); err == nil {
+		t.Error("其他錯誤應回傳")
+	}
+}
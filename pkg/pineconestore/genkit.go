@@ -0,0 +1,201 @@
+package pineconestore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+
+	"dongstudio.live/genkit_demo/pkg/vectorstore"
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/genkit"
+)
+
+const (
+	provider       = "pinecone"
+	defaultTextKey = "_content"
+)
+
+// Config 為 [DefineRetriever] 的設定
+type Config struct {
+	APIKey          string      // Pinecone API Key，預設讀取 PINECONE_API_KEY
+	IndexID         string      // 索引名稱，必填
+	Embedder        ai.Embedder // 用於產生向量的 embedder，必填
+	EmbedderOptions any         // 傳給 embedder 的選項
+	TextKey         string      // 存放文件內容的 metadata 欄位，預設 "_content"（與 Genkit pinecone plugin 相同）
+}
+
+// DocStore 結合 Pinecone 索引與 embedder，提供 Genkit 的索引與檢索
+type DocStore struct {
+	Index           *IndexClient
+	Embedder        ai.Embedder
+	EmbedderOptions any
+	TextKey         string
+}
+
+// DefineRetriever 連線到 Pinecone 索引並註冊對應的 Retriever，
+// 用法與 Genkit 的 pinecone.DefineRetriever 相同，但不需要註冊 pinecone plugin
+func DefineRetriever(ctx context.Context, g *genkit.Genkit, cfg Config) (*DocStore, ai.Retriever, error) {
+	if cfg.IndexID == "" {
+		return nil, nil, errors.New("IndexID required")
+	}
+	if cfg.Embedder == nil {
+		return nil, nil, errors.New("Embedder required")
+	}
+	client, err := NewClient(cfg.APIKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	index, err := client.Index(ctx, cfg.IndexID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if cfg.TextKey == "" {
+		cfg.TextKey = defaultTextKey
+	}
+	ds := &DocStore{
+		Index:           index,
+		Embedder:        cfg.Embedder,
+		EmbedderOptions: cfg.EmbedderOptions,
+		TextKey:         cfg.TextKey,
+	}
+	return ds, genkit.DefineRetriever(g, provider, cfg.IndexID, ds.Retrieve), nil
+}
+
+// RetrieverOptions 可放在 [ai.RetrieverRequest] 的 Options 欄位
+// Options 應為 nil 或 *RetrieverOptions
+type RetrieverOptions struct {
+	Namespace string         `json:"namespace,omitempty"` // 查詢的 namespace
+	Count     int            `json:"count,omitempty"`     // 回傳的文檔數，預設為 3
+	Filter    map[string]any `json:"filter,omitempty"`    // Pinecone 的 metadata 過濾條件
+	MinScore  float64        `json:"min_score,omitempty"` // 相似度低於此值的文檔不回傳，0 表示不限制
+}
+
+// Retrieve 實作 Genkit Retriever，回傳與查詢最相似的文檔
+// 每份文檔的 metadata 會帶上 "score" 欄位
+func (ds *DocStore) Retrieve(ctx context.Context, req *ai.RetrieverRequest) (*ai.RetrieverResponse, error) {
+	opts := &RetrieverOptions{}
+	if req.Options != nil {
+		var ok bool
+		if opts, ok = req.Options.(*RetrieverOptions); !ok {
+			return nil, fmt.Errorf("pineconestore.Retrieve options have type %T, want %T", req.Options, &RetrieverOptions{})
+		}
+	}
+	count := opts.Count
+	if count <= 0 {
+		count = 3
+	}
+
+	eres, err := ds.Embedder.Embed(ctx, &ai.EmbedRequest{
+		Input:   []*ai.Document{req.Query},
+		Options: ds.EmbedderOptions,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("pinecone retrieve embedding failed: %w", err)
+	}
+	if len(eres.Embeddings) == 0 {
+		return nil, errors.New("pinecone retrieve: embedder returned no embeddings")
+	}
+
+	matches, err := ds.Index.Query(ctx, Query{
+		Vector:    eres.Embeddings[0].Embedding,
+		TopK:      count,
+		Namespace: opts.Namespace,
+		Filter:    opts.Filter,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	docs := make([]*ai.Document, 0, len(matches))
+	for _, m := range matches {
+		if opts.MinScore != 0 && float64(m.Score) < opts.MinScore {
+			continue
+		}
+		metadata := maps.Clone(m.Metadata)
+		if metadata == nil {
+			metadata = make(map[string]any)
+		}
+		text, _ := metadata[ds.TextKey].(string)
+		delete(metadata, ds.TextKey)
+		metadata[vectorstore.ScoreKey] = float64(m.Score)
+		docs = append(docs, ai.DocumentFromText(text, metadata))
+	}
+	return &ai.RetrieverResponse{Documents: docs}, nil
+}
+
+// Index 將文檔轉為向量後寫入 namespace，已存在相同 ID 的文檔會被覆寫
+// 文檔 ID 取自 metadata 的 "id"，沒有時以內容的 MD5 作為 ID（見 vectorstore.DocID）；
+// metadata 使用保留欄位（見 vectorstore.CheckMetadata）時整批不寫入
+func Index(ctx context.Context, docs []*ai.Document, ds *DocStore, namespace string) error {
+	if len(docs) == 0 {
+		return nil
+	}
+	for _, doc := range docs {
+		if err := vectorstore.CheckMetadata(doc); err != nil {
+			return err
+		}
+	}
+
+	eres, err := ds.Embedder.Embed(ctx, &ai.EmbedRequest{
+		Input:   docs,
+		Options: ds.EmbedderOptions,
+	})
+	if err != nil {
+		return fmt.Errorf("pinecone index embedding failed: %w", err)
+	}
+	if len(eres.Embeddings) != len(docs) {
+		return fmt.Errorf("pinecone index: got %d embeddings for %d documents", len(eres.Embeddings), len(docs))
+	}
+
+	vectors := make([]Vector, 0, len(docs))
+	for i, doc := range docs {
+		id := vectorstore.DocID(doc)
+		metadata := sanitizeMetadata(doc.Metadata)
+		metadata[ds.TextKey] = vectorstore.DocText(doc)
+		vectors = append(vectors, Vector{
+			ID:       id,
+			Values:   eres.Embeddings[i].Embedding,
+			Metadata: metadata,
+		})
+	}
+	return ds.Index.Upsert(ctx, vectors, namespace)
+}
+
+// Delete 依 ID 刪除 namespace 中的文檔
+func Delete(ctx context.Context, ids []string, ds *DocStore, namespace string) error {
+	return ds.Index.Delete(ctx, ids, namespace)
+}
+
+// sanitizeMetadata 轉換成 Pinecone 接受的 metadata：字串、數字、布林與字串陣列，
+// 其他型別（例如巢狀物件）轉為 JSON 字串，nil 值會被移除
+func sanitizeMetadata(in map[string]any) map[string]any {
+	out := make(map[string]any, len(in)+1)
+	for k, v := range in {
+		switch v := v.(type) {
+		case nil:
+		case string, bool, int, int32, int64, float32, float64:
+			out[k] = v
+		case []string:
+			out[k] = v
+		case []any:
+			strs := make([]string, 0, len(v))
+			for _, item := range v {
+				if s, ok := item.(string); ok {
+					strs = append(strs, s)
+				}
+			}
+			if len(strs) == len(v) {
+				out[k] = strs
+			} else if b, err := json.Marshal(v); err == nil {
+				out[k] = string(b)
+			}
+		default:
+			if b, err := json.Marshal(v); err == nil {
+				out[k] = string(b)
+			}
+		}
+	}
+	return out
+}
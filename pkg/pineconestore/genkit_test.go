@@ -0,0 +1,51 @@
+package pineconestore
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/genkit"
+)
+
+func TestRetrieve(t *testing.T) {
+	f := &fakePinecone{handle: func(w http.ResponseWriter, _ string, _ map[string]any) {
+		fmt.Fprint(w, `{"matches":[
+			{"id":"a","score":0.9,"metadata":{"_content":"台積電","category":"科技"}},
+			{"id":"b","score":0.2,"metadata":{"_content":"夜市","category":"科技"}}]}`)
+	}}
+	g, err := genkit.Init(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	embedder := genkit.DefineEmbedder(g, "test", "embedder", func(_ context.Context, req *ai.EmbedRequest) (*ai.EmbedResponse, error) {
+		return &ai.EmbedResponse{Embeddings: []*ai.Embedding{{Embedding: []float32{1, 0}}}}, nil
+	})
+	ds := &DocStore{Index: newTestIndex(t, f), Embedder: embedder, TextKey: defaultTextKey}
+
+	filter := map[string]any{"category": "科技"}
+	resp, err := ds.Retrieve(context.Background(), &ai.RetrieverRequest{
+		Query:   ai.DocumentFromText("半導體", nil),
+		Options: &RetrieverOptions{Namespace: "ns", Count: 5, Filter: filter, MinScore: 0.5},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := f.requests[0].body
+	if body["namespace"] != "ns" || body["topK"] != 5.0 || !reflect.DeepEqual(body["filter"], filter) {
+		t.Errorf("查詢請求 = %v", body)
+	}
+	if len(resp.Documents) != 1 {
+		t.Fatalf("回傳 %d 份文檔，低於 min_score 的文檔應被過濾", len(resp.Documents))
+	}
+	doc := resp.Documents[0]
+	if doc.Content[0].Text != "台積電" || doc.Metadata["category"] != "科技" {
+		t.Errorf("文檔 = %q %v", doc.Content[0].Text, doc.Metadata)
+	}
+	if _, ok := doc.Metadata[defaultTextKey]; ok || doc.Metadata["score"] != float64(float32(0.9)) {
+		t.Errorf("metadata = %v", doc.Metadata)
+	}
+}
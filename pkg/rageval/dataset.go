@@ -0,0 +1,80 @@
+// Package rageval 離線評估 RAG 的檢索與回答品質
+//
+// 評估資料集為 JSONL，每行一個問題、預期應檢索到的文件 ID 與參考答案：
+//
+//	{"id": "q1", "question": "台灣有什麼著名的美食？", "expected": ["food.md"], "reference": "牛肉麵、小籠包…"}
+//
+// [Score] 依檢索結果的文件 ID 排名計算 recall@k、precision@k、MRR 與 nDCG@k，
+// [DefineHashEmbedder] 提供不需網路、結果固定的 embedder，讓評估可以離線重現
+//
+// [Judge] 以模型評審（LLM-as-judge）為回答的忠實度、切題程度與正確性評分，
+// 並可註冊為 Genkit evaluator 在開發介面中使用；[DefineFakeJudge] 提供結果固定的評審模型
+package rageval
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Example 為評估資料集中的一個問題
+type Example struct {
+	ID       string   `json:"id,omitempty"` // 問題 ID，未設定時為行號
+	Question string   `json:"question"`
+	Expected []string `json:"expected"` // 預期應檢索到的文件 ID（片段的 source_id 或文件的 id）
+
+	// 以下欄位只用於回答評估（見 [Judge]）
+	Reference string   `json:"reference,omitempty"` // 參考答案
+	Answer    string   `json:"answer,omitempty"`    // 已產生的回答，未設定時由評估工具呼叫服務取得
+	Contexts  []string `json:"contexts,omitempty"`  // 產生回答時使用的上下文
+}
+
+// LoadDataset 讀取 JSONL 格式的檢索評估資料集，略過空行與 # 開頭的註解
+// 每個問題都必須有 expected
+func LoadDataset(path string) ([]Example, error) {
+	return loadJSONL(path, func(ex *Example) bool { return ex.Question != "" && len(ex.Expected) > 0 }, "question 與 expected 為必填")
+}
+
+// LoadAnswerDataset 讀取回答評估的資料集，格式與 [LoadDataset] 相同，但只有 question 為必填
+func LoadAnswerDataset(path string) ([]Example, error) {
+	return loadJSONL(path, func(ex *Example) bool { return ex.Question != "" }, "question 為必填")
+}
+
+func loadJSONL(path string, valid func(*Example) bool, invalid string) ([]Example, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var examples []Example
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		var ex Example
+		if err := json.Unmarshal([]byte(text), &ex); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		if !valid(&ex) {
+			return nil, fmt.Errorf("%s:%d: %s", path, line, invalid)
+		}
+		if ex.ID == "" {
+			ex.ID = fmt.Sprintf("line-%d", line)
+		}
+		examples = append(examples, ex)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(examples) == 0 {
+		return nil, errors.New("評估資料集沒有任何問題")
+	}
+	return examples, nil
+}
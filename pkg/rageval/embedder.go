@@ -0,0 +1,64 @@
+package rageval
+
+import (
+	"context"
+	"hash/fnv"
+	"math"
+
+	"dongstudio.live/genkit_demo/pkg/hybrid"
+	"dongstudio.live/genkit_demo/pkg/vectorstore"
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/genkit"
+)
+
+// DefineHashEmbedder 註冊以 feature hashing 產生向量的 embedder：
+// 將文字切成詞（中日韓文字為 bigram，見 hybrid.Tokenize），每個詞雜湊到 dim 維中的一維並以雜湊決定正負號，
+// 詞頻取平方根後正規化為單位向量
+//
+// 結果只取決於文字內容，不需網路也不會變動，適合離線比較切分與檢索設定；
+// 語意相近但用詞不同的文字不會相似，數值不能與真實 embedding 模型比較
+func DefineHashEmbedder(g *genkit.Genkit, name string, dim int) ai.Embedder {
+	if dim <= 0 {
+		dim = 512
+	}
+	return genkit.DefineEmbedder(g, "rageval", name, func(_ context.Context, req *ai.EmbedRequest) (*ai.EmbedResponse, error) {
+		resp := &ai.EmbedResponse{Embeddings: make([]*ai.Embedding, len(req.Input))}
+		for i, doc := range req.Input {
+			resp.Embeddings[i] = &ai.Embedding{Embedding: HashVector(vectorstore.DocText(doc), dim)}
+		}
+		return resp, nil
+	})
+}
+
+// HashVector 以 feature hashing 將文字轉為 dim 維的單位向量，沒有任何詞時回傳零向量
+func HashVector(text string, dim int) []float32 {
+	counts := make(map[string]int)
+	for _, t := range hybrid.Tokenize(text) {
+		counts[t]++
+	}
+	vec := make([]float64, dim)
+	for term, n := range counts {
+		h := fnv.New64a()
+		h.Write([]byte(term))
+		sum := h.Sum64()
+		sign := 1.0
+		if sum>>63 == 1 {
+			sign = -1
+		}
+		vec[sum%uint64(dim)] += sign * math.Sqrt(float64(n))
+	}
+
+	var norm float64
+	for _, v := range vec {
+		norm += v * v
+	}
+	out := make([]float32, dim)
+	if norm == 0 {
+		return out
+	}
+	norm = math.Sqrt(norm)
+	for i, v := range vec {
+		out[i] = float32(v / norm)
+	}
+	return out
+}
@@ -0,0 +1,119 @@
+package rageval
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+
+	"dongstudio.live/genkit_demo/pkg/hybrid"
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/genkit"
+)
+
+// FakeJudgeModel 為 [DefineFakeJudge] 註冊的模型名稱
+const FakeJudgeModel = "rageval/fake-judge"
+
+// sectionHeader 比對 [Judge] 提示詞中的【區段】標題
+var sectionHeader = regexp.MustCompile(`(?m)^【(.+?)】$`)
+
+// citationMarker 比對回答中的 [n] 引用標記，評分時忽略
+var citationMarker = regexp.MustCompile(`\[\d+\]`)
+
+// DefineFakeJudge 註冊結果固定、不需網路的評審模型，供離線執行與驗證評估流程
+//
+// 模型只看 [Judge] 提示詞中的區段，以詞的重疊程度（中日韓文字為 bigram，見 hybrid.Tokenize）代替真正的判斷：
+// 有參考答案時為參考答案的詞出現在回答中的比例，有上下文時為回答的詞出現在上下文中的比例，
+// 否則為問題的詞出現在回答中的比例；比例對應到 1–5 分
+//
+// 分數不代表真實的回答品質，只適合確認資料集、評估流程與輸出格式
+func DefineFakeJudge(g *genkit.Genkit) ai.Model {
+	provider, name, _ := strings.Cut(FakeJudgeModel, "/")
+	return genkit.DefineModel(g, provider, name, &ai.ModelInfo{
+		Label:    "Fake judge",
+		Supports: &ai.ModelSupports{Multiturn: true, SystemRole: true},
+	}, func(_ context.Context, req *ai.ModelRequest, _ ai.ModelStreamCallback) (*ai.ModelResponse, error) {
+		sections := promptSections(req)
+		answer := citationMarker.ReplaceAllString(sections["回答"], "")
+		var (
+			ratio  float64
+			reason string
+		)
+		switch {
+		case sections["參考答案"] != "":
+			ratio = coverage(sections["參考答案"], answer)
+			reason = "參考答案的詞出現在回答中的比例"
+		case sections["上下文"] != "":
+			ratio = coverage(answer, sections["上下文"])
+			reason = "回答的詞出現在上下文中的比例"
+		default:
+			ratio = coverage(sections["問題"], answer)
+			reason = "問題的詞出現在回答中的比例"
+		}
+
+		b, err := json.Marshal(judgement{
+			Reasoning: fmt.Sprintf("%s為 %.0f%%", reason, ratio*100),
+			Rating:    1 + int(math.Round(ratio*4)),
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &ai.ModelResponse{
+			Request:      req,
+			Message:      ai.NewModelTextMessage(string(b)),
+			FinishReason: ai.FinishReasonStop,
+		}, nil
+	})
+}
+
+// promptSections 從使用者訊息取出各區段的內容，略過 Genkit 加入的輸出格式說明
+func promptSections(req *ai.ModelRequest) map[string]string {
+	var sb strings.Builder
+	for _, m := range req.Messages {
+		if m.Role != ai.RoleUser {
+			continue
+		}
+		for _, p := range m.Content {
+			if p.Metadata["purpose"] == "output" {
+				continue
+			}
+			sb.WriteString(p.Text)
+		}
+	}
+	text := sb.String()
+
+	sections := make(map[string]string)
+	headers := sectionHeader.FindAllStringSubmatchIndex(text, -1)
+	for i, h := range headers {
+		end := len(text)
+		if i+1 < len(headers) {
+			end = headers[i+1][0]
+		}
+		sections[text[h[2]:h[3]]] = strings.TrimSpace(text[h[1]:end])
+	}
+	return sections
+}
+
+// coverage 回傳 from 的詞出現在 in 中的比例，from 沒有任何詞時為 0
+func coverage(from, in string) float64 {
+	terms := make(map[string]bool)
+	for _, t := range hybrid.Tokenize(from) {
+		terms[t] = true
+	}
+	if len(terms) == 0 {
+		return 0
+	}
+	present := make(map[string]bool)
+	for _, t := range hybrid.Tokenize(in) {
+		present[t] = true
+	}
+	hits := 0
+	for t := range terms {
+		if present[t] {
+			hits++
+		}
+	}
+	return float64(hits) / float64(len(terms))
+}
@@ -0,0 +1,352 @@
+package rageval
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/genkit"
+)
+
+// Criterion 為回答評估的項目
+type Criterion string
+
+const (
+	Faithfulness      Criterion = "faithfulness"       // 回答是否都能由上下文推得，需要上下文
+	AnswerRelevance   Criterion = "answer_relevance"   // 回答是否切題、完整回應問題
+	AnswerCorrectness Criterion = "answer_correctness" // 回答與參考答案是否一致，需要參考答案
+)
+
+// Criteria 為所有評估項目
+var Criteria = []Criterion{Faithfulness, AnswerRelevance, AnswerCorrectness}
+
+// ParseCriteria 解析以逗號分隔的評估項目，空字串為全部
+func ParseCriteria(s string) ([]Criterion, error) {
+	if strings.TrimSpace(s) == "" {
+		return Criteria, nil
+	}
+	var out []Criterion
+	for _, name := range strings.Split(s, ",") {
+		c := Criterion(strings.TrimSpace(name))
+		if !slices.Contains(Criteria, c) {
+			return nil, fmt.Errorf("不支援的評估項目: %s", name)
+		}
+		out = append(out, c)
+	}
+	return out, nil
+}
+
+// DefaultPassThreshold 為未設定門檻時判定通過的最低分數
+const DefaultPassThreshold = 0.6
+
+// DefaultJudgeConcurrency 為未設定時同時進行的評審呼叫數
+const DefaultJudgeConcurrency = 4
+
+// Sample 為一筆待評估的回答
+type Sample struct {
+	Question  string
+	Answer    string
+	Contexts  []string
+	Reference string
+}
+
+// Verdict 為一個評估項目的結果
+type Verdict struct {
+	Rating    int     `json:"rating"`    // 評審給的 1–5 分
+	Score     float64 `json:"score"`     // 正規化到 0–1 的分數
+	Pass      bool    `json:"pass"`      // 分數是否達到門檻
+	Reasoning string  `json:"reasoning"` // 評審的理由
+}
+
+// ErrMissingInput 表示樣本缺少評估項目需要的欄位（例如忠實度沒有上下文）
+var ErrMissingInput = errors.New("缺少評估需要的欄位")
+
+// Judge 以模型評審回答的品質
+type Judge struct {
+	Genkit        *genkit.Genkit
+	Model         string               // 評審模型名稱；空字串使用預設模型
+	Middleware    []ai.ModelMiddleware // 套用在評審呼叫上的 middleware
+	PassThreshold float64              // 判定通過的最低分數（0–1），預設 DefaultPassThreshold
+	Concurrency   int                  // evaluator 同時進行的評審呼叫數，預設 DefaultJudgeConcurrency
+	// OnUsage 在每次評審呼叫後被呼叫，可用於記錄用量與費用
+	OnUsage func(ctx context.Context, usage *ai.GenerationUsage)
+}
+
+// judgement 為評審模型的結構化輸出
+type judgement struct {
+	Reasoning string `json:"reasoning"` // 先說明理由再給分
+	Rating    int    `json:"rating"`    // 1–5 分
+}
+
+// rubrics 為各評估項目的評分標準
+var rubrics = map[Criterion]string{
+	Faithfulness: "評估【回答】是否忠於【上下文】：回答中的每個事實陳述都必須能由上下文直接推得。" +
+		"5 分：全部有依據；3 分：部分陳述沒有依據或加入了上下文以外的細節；1 分：主要內容沒有依據或與上下文矛盾。" +
+		"回答表示無法回答時，若上下文確實沒有答案給 5 分，否則給 2 分。句尾的 [n] 為引用標記，評分時忽略。",
+	AnswerRelevance: "評估【回答】是否切題：是否直接且完整地回應【問題】，而不是答非所問或充斥無關內容。" +
+		"不需判斷內容是否正確。5 分：完整回應；3 分：只回應一部分或夾雜大量無關內容；1 分：沒有回應問題。",
+	AnswerCorrectness: "評估【回答】與【參考答案】是否一致：參考答案中的重點是否都有涵蓋，且沒有與參考答案矛盾的內容。" +
+		"用詞不同但意思相同視為一致。5 分：涵蓋所有重點且沒有錯誤；3 分：涵蓋部分重點或有次要錯誤；1 分：錯誤或沒有涵蓋任何重點。",
+}
+
+// prompt 依評估項目組成評審的提示詞，缺少必要欄位時回傳 ErrMissingInput
+func prompt(c Criterion, s Sample) (string, error) {
+	if strings.TrimSpace(s.Answer) == "" {
+		return "", fmt.Errorf("%w: answer", ErrMissingInput)
+	}
+	var sb strings.Builder
+	section := func(name, text string) {
+		fmt.Fprintf(&sb, "【%s】\n%s\n\n", name, strings.TrimSpace(text))
+	}
+	switch c {
+	case Faithfulness:
+		if len(s.Contexts) == 0 {
+			return "", fmt.Errorf("%w: contexts", ErrMissingInput)
+		}
+		section("問題", s.Question)
+		section("上下文", strings.Join(s.Contexts, "\n\n"))
+	case AnswerRelevance:
+		if strings.TrimSpace(s.Question) == "" {
+			return "", fmt.Errorf("%w: question", ErrMissingInput)
+		}
+		section("問題", s.Question)
+	case AnswerCorrectness:
+		if strings.TrimSpace(s.Reference) == "" {
+			return "", fmt.Errorf("%w: reference", ErrMissingInput)
+		}
+		section("問題", s.Question)
+		section("參考答案", s.Reference)
+	default:
+		return "", fmt.Errorf("不支援的評估項目: %s", c)
+	}
+	section("回答", s.Answer)
+	return sb.String(), nil
+}
+
+// Assess 以評審模型評估一個項目
+func (j *Judge) Assess(ctx context.Context, c Criterion, s Sample) (*Verdict, error) {
+	text, err := prompt(c, s)
+	if err != nil {
+		return nil, err
+	}
+	opts := []ai.GenerateOption{
+		ai.WithSystem("你是嚴格、公正的評審，依評分標準為回答評分。先簡短說明理由，再給 1 到 5 的整數分數。\n\n評分標準: " + rubrics[c]),
+		ai.WithPrompt(text),
+		ai.WithOutputType(judgement{}),
+	}
+	if j.Model != "" {
+		opts = append(opts, ai.WithModelName(j.Model))
+	}
+	if len(j.Middleware) > 0 {
+		opts = append(opts, ai.WithMiddleware(j.Middleware...))
+	}
+
+	resp, err := genkit.Generate(ctx, j.Genkit, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("評審 %s 失敗: %w", c, err)
+	}
+	if j.OnUsage != nil {
+		j.OnUsage(ctx, resp.Usage)
+	}
+	var out judgement
+	if err := resp.Output(&out); err != nil {
+		return nil, fmt.Errorf("無法解析評審 %s 的結果: %w", c, err)
+	}
+	if out.Rating < 1 || out.Rating > 5 {
+		return nil, fmt.Errorf("評審 %s 給出無效的分數: %d", c, out.Rating)
+	}
+
+	threshold := j.PassThreshold
+	if threshold <= 0 {
+		threshold = DefaultPassThreshold
+	}
+	score := float64(out.Rating-1) / 4
+	return &Verdict{Rating: out.Rating, Score: score, Pass: score >= threshold, Reasoning: out.Reasoning}, nil
+}
+
+// DefineEvaluators 將評估項目註冊為 Genkit evaluator（名稱為 rageval/<項目>），criteria 為空時註冊全部
+// 每個 evaluator 以最多 Concurrency 個評審呼叫同時評估資料集，
+// 缺少必要欄位或評審失敗的樣本狀態為 UNKNOWN，理由與錯誤記錄在 Score 中
+func (j *Judge) DefineEvaluators(criteria ...Criterion) ([]ai.Evaluator, error) {
+	if len(criteria) == 0 {
+		criteria = Criteria
+	}
+	evaluators := make([]ai.Evaluator, 0, len(criteria))
+	for _, c := range criteria {
+		if !slices.Contains(Criteria, c) {
+			return nil, fmt.Errorf("不支援的評估項目: %s", c)
+		}
+		e, err := genkit.DefineBatchEvaluator(j.Genkit, "rageval", string(c), &ai.EvaluatorOptions{
+			DisplayName: string(c),
+			Definition:  rubrics[c],
+			IsBilled:    true,
+		}, func(ctx context.Context, req *ai.EvaluatorRequest) (*ai.EvaluatorResponse, error) {
+			return j.evaluate(ctx, c, req.Dataset), nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		evaluators = append(evaluators, e)
+	}
+	return evaluators, nil
+}
+
+// evaluate 以有上限的並行數評估資料集，結果順序與 dataset 相同
+func (j *Judge) evaluate(ctx context.Context, c Criterion, dataset []*ai.Example) *ai.EvaluatorResponse {
+	concurrency := j.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultJudgeConcurrency
+	}
+	results := make(ai.EvaluatorResponse, len(dataset))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, ex := range dataset {
+		id := ex.TestCaseId
+		if id == "" {
+			id = fmt.Sprintf("case-%d", i+1)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			results[i] = ai.EvaluationResult{TestCaseId: id, Evaluation: []ai.Score{j.score(ctx, c, ex)}}
+		}()
+	}
+	wg.Wait()
+	return &results
+}
+
+func (j *Judge) score(ctx context.Context, c Criterion, ex *ai.Example) ai.Score {
+	v, err := j.Assess(ctx, c, SampleFromExample(ex))
+	if err != nil {
+		return ai.Score{Id: string(c), Status: ai.ScoreStatusUnknown.String(), Error: err.Error()}
+	}
+	status := ai.ScoreStatusFail
+	if v.Pass {
+		status = ai.ScoreStatusPass
+	}
+	return ai.Score{
+		Id:      string(c),
+		Score:   v.Score,
+		Status:  status.String(),
+		Details: map[string]any{"reasoning": v.Reasoning, "rating": v.Rating},
+	}
+}
+
+// SampleFromExample 從 Genkit 評估資料取出問題、回答、上下文與參考答案
+//
+// Input、Output 與 Reference 可以是字串，或 flow 的輸入輸出物件：
+// 問題取 question、message 或 query 欄位，回答取 answer、message、content 或 text 欄位；
+// Context 沒有資料時改用輸出中 debug.contexts 的內容（08_rag 的 /ask 帶 debug 時回傳）
+func SampleFromExample(ex *ai.Example) Sample {
+	s := Sample{
+		Question:  textOf(ex.Input, "question", "message", "query"),
+		Answer:    textOf(ex.Output, "answer", "message", "content", "text"),
+		Reference: textOf(ex.Reference, "reference", "answer", "content", "text"),
+	}
+	for _, c := range ex.Context {
+		if t := textOf(c, "content", "text"); t != "" {
+			s.Contexts = append(s.Contexts, t)
+		}
+	}
+	if len(s.Contexts) == 0 {
+		if out, ok := normalize(ex.Output).(map[string]any); ok {
+			if debug, ok := out["debug"].(map[string]any); ok {
+				if list, ok := debug["contexts"].([]any); ok {
+					for _, c := range list {
+						if t := textOf(c, "content", "text"); t != "" {
+							s.Contexts = append(s.Contexts, t)
+						}
+					}
+				}
+			}
+		}
+	}
+	return s
+}
+
+// textOf 將任意值轉為文字：物件依序取第一個存在的欄位，陣列串接每個元素，其他值轉為 JSON
+func textOf(v any, keys ...string) string {
+	switch x := normalize(v).(type) {
+	case nil:
+		return ""
+	case string:
+		return x
+	case []any:
+		parts := make([]string, 0, len(x))
+		for _, item := range x {
+			if t := textOf(item, keys...); t != "" {
+				parts = append(parts, t)
+			}
+		}
+		return strings.Join(parts, "\n")
+	case map[string]any:
+		for _, k := range keys {
+			if field, ok := x[k]; ok {
+				return textOf(field, keys...)
+			}
+		}
+		b, _ := json.Marshal(x)
+		return string(b)
+	default:
+		b, _ := json.Marshal(x)
+		return string(b)
+	}
+}
+
+// normalize 將 struct 等型別經由 JSON 轉為 map[string]any 或 []any
+func normalize(v any) any {
+	switch v.(type) {
+	case nil, string, []any, map[string]any, float64, bool:
+		return v
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+	var out any
+	if err := json.Unmarshal(b, &out); err != nil {
+		return v
+	}
+	return out
+}
+
+// JudgeFromEnv 依環境變數建立 [Judge]：
+//
+//	EVAL_JUDGE_MODEL        評審模型，預設為 defaultModel；fake 使用 [DefineFakeJudge] 的離線模型
+//	EVAL_JUDGE_CONCURRENCY  evaluator 同時進行的評審呼叫數，預設 DefaultJudgeConcurrency
+//	EVAL_PASS_THRESHOLD     判定通過的最低分數（0–1），預設 DefaultPassThreshold
+func JudgeFromEnv(g *genkit.Genkit, defaultModel string) (*Judge, error) {
+	j := &Judge{Genkit: g, Model: defaultModel}
+	switch model := os.Getenv("EVAL_JUDGE_MODEL"); model {
+	case "":
+	case "fake":
+		DefineFakeJudge(g)
+		j.Model = FakeJudgeModel
+	default:
+		j.Model = model
+	}
+	if v := os.Getenv("EVAL_JUDGE_CONCURRENCY"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("無效的 EVAL_JUDGE_CONCURRENCY: %s", v)
+		}
+		j.Concurrency = n
+	}
+	if v := os.Getenv("EVAL_PASS_THRESHOLD"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f <= 0 || f > 1 {
+			return nil, fmt.Errorf("無效的 EVAL_PASS_THRESHOLD: %s", v)
+		}
+		j.PassThreshold = f
+	}
+	return j, nil
+}
@@ -0,0 +1,240 @@
+package rageval
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/genkit"
+)
+
+// newFakeJudge 回傳使用離線評審模型的 Judge
+func newFakeJudge(t *testing.T) *Judge {
+	t.Helper()
+	g, err := genkit.Init(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	DefineFakeJudge(g)
+	return &Judge{Genkit: g, Model: FakeJudgeModel}
+}
+
+const (
+	testQuestion  = "台灣有什麼著名的美食？"
+	testReference = "台灣著名的美食有小籠包、牛肉麵與夜市小吃。"
+	testContext   = "台灣有許多著名的美食，包括小籠包、牛肉麵、夜市小吃等。"
+)
+
+func TestParseCriteria(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    []Criterion
+		wantErr bool
+	}{
+		{in: "", want: Criteria},
+		{in: "faithfulness", want: []Criterion{Faithfulness}},
+		{in: " answer_correctness , answer_relevance", want: []Criterion{AnswerCorrectness, AnswerRelevance}},
+		{in: "faithfulness,unknown", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseCriteria(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseCriteria(%q) error = %v", tt.in, err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("ParseCriteria(%q) = %v, want %v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJudgeAssess(t *testing.T) {
+	j := newFakeJudge(t)
+	tests := []struct {
+		name       string
+		criterion  Criterion
+		sample     Sample
+		wantRating int
+		wantErr    error
+	}{
+		{
+			name:       "correct answer",
+			criterion:  AnswerCorrectness,
+			sample:     Sample{Question: testQuestion, Answer: testReference + " [1]", Reference: testReference},
+			wantRating: 5,
+		},
+		{
+			name:       "wrong answer",
+			criterion:  AnswerCorrectness,
+			sample:     Sample{Question: testQuestion, Answer: "I don't know.", Reference: testReference},
+			wantRating: 1,
+		},
+		{
+			name:       "faithful answer",
+			criterion:  Faithfulness,
+			sample:     Sample{Question: testQuestion, Answer: "台灣有許多著名的美食，包括小籠包、牛肉麵 [1]。", Contexts: []string{testContext}},
+			wantRating: 5,
+		},
+		{
+			name:       "hallucinated answer",
+			criterion:  Faithfulness,
+			sample:     Sample{Question: testQuestion, Answer: "Pizza and sushi.", Contexts: []string{testContext}},
+			wantRating: 1,
+		},
+		{
+			name:       "relevant answer",
+			criterion:  AnswerRelevance,
+			sample:     Sample{Question: testQuestion, Answer: "台灣有什麼著名的美食？小籠包。"},
+			wantRating: 5,
+		},
+		{
+			name:      "missing contexts",
+			criterion: Faithfulness,
+			sample:    Sample{Question: testQuestion, Answer: "小籠包"},
+			wantErr:   ErrMissingInput,
+		},
+		{
+			name:      "missing reference",
+			criterion: AnswerCorrectness,
+			sample:    Sample{Question: testQuestion, Answer: "小籠包"},
+			wantErr:   ErrMissingInput,
+		},
+		{
+			name:      "missing answer",
+			criterion: AnswerRelevance,
+			sample:    Sample{Question: testQuestion, Answer: "  "},
+			wantErr:   ErrMissingInput,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := j.Assess(context.Background(), tt.criterion, tt.sample)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Assess() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if v.Rating != tt.wantRating {
+				t.Errorf("Rating = %d, want %d（%s）", v.Rating, tt.wantRating, v.Reasoning)
+			}
+			if want := float64(tt.wantRating-1) / 4; v.Score != want {
+				t.Errorf("Score = %v, want %v", v.Score, want)
+			}
+			if v.Pass != (v.Score >= DefaultPassThreshold) {
+				t.Errorf("Pass = %v，分數 %v 與預設門檻不符", v.Pass, v.Score)
+			}
+			if v.Reasoning == "" {
+				t.Error("缺少評審理由")
+			}
+		})
+	}
+}
+
+func TestJudgeEvaluators(t *testing.T) {
+	j := newFakeJudge(t)
+	j.Concurrency = 2
+	evaluators, err := j.DefineEvaluators(Faithfulness, AnswerCorrectness)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := j.DefineEvaluators("unknown"); err == nil {
+		t.Error("不支援的評估項目應回傳錯誤")
+	}
+
+	dataset := []*ai.Example{
+		{TestCaseId: "good", Input: map[string]any{"question": testQuestion}, Output: testReference,
+			Context: []any{testContext}, Reference: testReference},
+		{TestCaseId: "bad", Input: testQuestion, Output: "Pizza and sushi.",
+			Context: []any{testContext}, Reference: testReference},
+		// 沒有 Context 時取 08_rag 除錯輸出中的 debug.contexts；沒有參考答案時無法評估正確性
+		{Input: testQuestion, Output: map[string]any{"answer": testReference, "debug": map[string]any{"contexts": []any{testContext}}}},
+	}
+	tests := []struct {
+		criterion Criterion
+		ids       []string
+		statuses  []ai.ScoreStatus
+	}{
+		{Faithfulness, []string{"good", "bad", "case-3"}, []ai.ScoreStatus{ai.ScoreStatusPass, ai.ScoreStatusFail, ai.ScoreStatusPass}},
+		{AnswerCorrectness, []string{"good", "bad", "case-3"}, []ai.ScoreStatus{ai.ScoreStatusPass, ai.ScoreStatusFail, ai.ScoreStatusUnknown}},
+	}
+	for i, tt := range tests {
+		t.Run(string(tt.criterion), func(t *testing.T) {
+			e := evaluators[i]
+			if e.Name() != "rageval/"+string(tt.criterion) {
+				t.Errorf("Name() = %s", e.Name())
+			}
+			resp, err := e.Evaluate(context.Background(), &ai.EvaluatorRequest{Dataset: dataset, EvaluationId: "test"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(*resp) != len(dataset) {
+				t.Fatalf("回傳 %d 筆結果，want %d", len(*resp), len(dataset))
+			}
+			for k, r := range *resp {
+				if r.TestCaseId != tt.ids[k] {
+					t.Errorf("第 %d 筆 TestCaseId = %s, want %s", k, r.TestCaseId, tt.ids[k])
+				}
+				s := r.Evaluation[0]
+				if s.Status != tt.statuses[k].String() {
+					t.Errorf("%s 的狀態 = %s, want %s（%s）", r.TestCaseId, s.Status, tt.statuses[k], s.Error)
+				}
+				if s.Status == ai.ScoreStatusUnknown.String() && s.Error == "" {
+					t.Errorf("%s 未評估但沒有錯誤訊息", r.TestCaseId)
+				}
+			}
+		})
+	}
+}
+
+func TestSampleFromExample(t *testing.T) {
+	type askOutput struct {
+		Answer string `json:"answer"`
+		Debug  struct {
+			Contexts []string `json:"contexts"`
+		} `json:"debug"`
+	}
+	out := askOutput{Answer: "答案"}
+	out.Debug.Contexts = []string{"上下文一", "上下文二"}
+
+	tests := []struct {
+		name string
+		ex   *ai.Example
+		want Sample
+	}{
+		{
+			name: "strings",
+			ex:   &ai.Example{Input: "問題", Output: "答案", Context: []any{"上下文"}, Reference: "參考"},
+			want: Sample{Question: "問題", Answer: "答案", Contexts: []string{"上下文"}, Reference: "參考"},
+		},
+		{
+			name: "flow objects",
+			ex: &ai.Example{
+				Input:   map[string]any{"message": "問題"},
+				Output:  map[string]any{"message": map[string]any{"content": "答案"}},
+				Context: []any{map[string]any{"content": "上下文"}},
+			},
+			want: Sample{Question: "問題", Answer: "答案", Contexts: []string{"上下文"}},
+		},
+		{
+			name: "debug contexts from struct output",
+			ex:   &ai.Example{Input: map[string]any{"question": "問題"}, Output: out},
+			want: Sample{Question: "問題", Answer: "答案", Contexts: []string{"上下文一", "上下文二"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := SampleFromExample(tt.ex)
+			if got.Question != tt.want.Question || got.Answer != tt.want.Answer ||
+				got.Reference != tt.want.Reference || !slices.Equal(got.Contexts, tt.want.Contexts) {
+				t.Errorf("SampleFromExample() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
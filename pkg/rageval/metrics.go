@@ -0,0 +1,72 @@
+package rageval
+
+import (
+	"math"
+	"slices"
+)
+
+// Metrics 為檢索品質指標，以二元相關性計算（文件在 expected 中即為相關）
+type Metrics struct {
+	Recall    map[int]float64 `json:"recall"`    // recall@k：前 k 份中找到的相關文件占所有相關文件的比例
+	Precision map[int]float64 `json:"precision"` // precision@k：前 k 份中相關文件的比例
+	NDCG      map[int]float64 `json:"ndcg"`      // nDCG@k：考慮排名位置的累積增益，1 表示相關文件都排在最前面
+	MRR       float64         `json:"mrr"`       // 第一份相關文件排名的倒數
+}
+
+// Score 依檢索結果的文件 ID 排名（已去除重複）計算各 k 的指標
+func Score(ranked, expected []string, ks []int) Metrics {
+	relevant := make(map[string]bool, len(expected))
+	for _, id := range expected {
+		relevant[id] = true
+	}
+
+	m := Metrics{
+		Recall:    make(map[int]float64, len(ks)),
+		Precision: make(map[int]float64, len(ks)),
+		NDCG:      make(map[int]float64, len(ks)),
+	}
+	if i := slices.IndexFunc(ranked, func(id string) bool { return relevant[id] }); i >= 0 {
+		m.MRR = 1 / float64(i+1)
+	}
+	for _, k := range ks {
+		var hits int
+		var dcg, idcg float64
+		for i := range k {
+			if i < len(ranked) && relevant[ranked[i]] {
+				hits++
+				dcg += 1 / math.Log2(float64(i+2))
+			}
+			if i < len(relevant) {
+				idcg += 1 / math.Log2(float64(i+2))
+			}
+		}
+		m.Recall[k] = float64(hits) / float64(len(relevant))
+		m.Precision[k] = float64(hits) / float64(k)
+		if idcg > 0 {
+			m.NDCG[k] = dcg / idcg
+		}
+	}
+	return m
+}
+
+// Mean 回傳多個問題指標的平均
+func Mean(all []Metrics, ks []int) Metrics {
+	mean := Metrics{
+		Recall:    make(map[int]float64, len(ks)),
+		Precision: make(map[int]float64, len(ks)),
+		NDCG:      make(map[int]float64, len(ks)),
+	}
+	if len(all) == 0 {
+		return mean
+	}
+	n := float64(len(all))
+	for _, m := range all {
+		mean.MRR += m.MRR / n
+		for _, k := range ks {
+			mean.Recall[k] += m.Recall[k] / n
+			mean.Precision[k] += m.Precision[k] / n
+			mean.NDCG[k] += m.NDCG[k] / n
+		}
+	}
+	return mean
+}
@@ -0,0 +1,89 @@
+package rageval
+
+import (
+	"math"
+	"testing"
+)
+
+func TestScore(t *testing.T) {
+	ks := []int{1, 3}
+	tests := []struct {
+		name      string
+		ranked    []string
+		expected  []string
+		recall    map[int]float64
+		precision map[int]float64
+		ndcg      map[int]float64
+		mrr       float64
+	}{
+		{
+			name:      "perfect",
+			ranked:    []string{"a", "b", "c"},
+			expected:  []string{"a", "b"},
+			recall:    map[int]float64{1: 0.5, 3: 1},
+			precision: map[int]float64{1: 1, 3: 2.0 / 3},
+			ndcg:      map[int]float64{1: 1, 3: 1},
+			mrr:       1,
+		},
+		{
+			name:      "second position",
+			ranked:    []string{"x", "a", "y"},
+			expected:  []string{"a"},
+			recall:    map[int]float64{1: 0, 3: 1},
+			precision: map[int]float64{1: 0, 3: 1.0 / 3},
+			ndcg:      map[int]float64{1: 0, 3: 1 / math.Log2(3)},
+			mrr:       0.5,
+		},
+		{
+			name:      "fewer results than k",
+			ranked:    []string{"b"},
+			expected:  []string{"a", "b"},
+			recall:    map[int]float64{1: 0.5, 3: 0.5},
+			precision: map[int]float64{1: 1, 3: 1.0 / 3},
+			ndcg:      map[int]float64{1: 1, 3: 1 / (1 + 1/math.Log2(3))},
+			mrr:       1,
+		},
+		{
+			name:      "no hits",
+			ranked:    []string{"x", "y"},
+			expected:  []string{"a"},
+			recall:    map[int]float64{1: 0, 3: 0},
+			precision: map[int]float64{1: 0, 3: 0},
+			ndcg:      map[int]float64{1: 0, 3: 0},
+		},
+	}
+	near := func(a, b float64) bool { return math.Abs(a-b) < 1e-9 }
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := Score(tt.ranked, tt.expected, ks)
+			for _, k := range ks {
+				if !near(m.Recall[k], tt.recall[k]) {
+					t.Errorf("recall@%d = %v, want %v", k, m.Recall[k], tt.recall[k])
+				}
+				if !near(m.Precision[k], tt.precision[k]) {
+					t.Errorf("precision@%d = %v, want %v", k, m.Precision[k], tt.precision[k])
+				}
+				if !near(m.NDCG[k], tt.ndcg[k]) {
+					t.Errorf("ndcg@%d = %v, want %v", k, m.NDCG[k], tt.ndcg[k])
+				}
+			}
+			if !near(m.MRR, tt.mrr) {
+				t.Errorf("MRR = %v, want %v", m.MRR, tt.mrr)
+			}
+		})
+	}
+}
+
+func TestMean(t *testing.T) {
+	ks := []int{1}
+	m := Mean([]Metrics{
+		Score([]string{"a"}, []string{"a"}, ks),
+		Score([]string{"x", "a"}, []string{"a"}, ks),
+	}, ks)
+	if m.Recall[1] != 0.5 || m.MRR != 0.75 {
+		t.Errorf("Mean() = %+v", m)
+	}
+	if empty := Mean(nil, ks); empty.MRR != 0 || empty.Recall[1] != 0 {
+		t.Errorf("Mean(nil) = %+v", empty)
+	}
+}
@@ -0,0 +1,132 @@
+package ratelimit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+)
+
+// Rate 描述一個 token bucket：每秒補充 PerSecond 個，最多累積 Burst 個
+// PerSecond 為 0 表示不限制
+type Rate struct {
+	PerSecond float64 `json:"per_second"`
+	Burst     int     `json:"burst"`
+}
+
+// Quota 描述每日用量上限，0 表示不限制
+type Quota struct {
+	Requests int `json:"requests"` // 每日請求數上限
+	Tokens   int `json:"tokens"`   // 每日模型 token 數上限（輸入加輸出）
+}
+
+// Limits 為單一 API Key 的限制設定
+type Limits struct {
+	Rate  Rate  `json:"rate"`
+	Daily Quota `json:"daily"`
+}
+
+// Config 速率限制與配額設定，可從 JSON 檔案載入並在執行期間重新載入
+type Config struct {
+	PerIP  Rate              `json:"per_ip"`  // 每個來源 IP 的速率限制
+	PerKey Limits            `json:"per_key"` // 每個 API Key 的預設限制
+	Keys   map[string]Limits `json:"keys"`    // 個別使用者ID的覆寫設定
+}
+
+// DefaultConfig 為未提供設定檔時使用的預設值
+func DefaultConfig() *Config {
+	return &Config{
+		PerIP: Rate{PerSecond: 2, Burst: 10},
+		PerKey: Limits{
+			Rate:  Rate{PerSecond: 1, Burst: 5},
+			Daily: Quota{Requests: 1000, Tokens: 500000},
+		},
+	}
+}
+
+// limitsFor 回傳指定使用者ID適用的限制
+func (c *Config) limitsFor(key string) Limits {
+	if l, ok := c.Keys[key]; ok {
+		return l
+	}
+	return c.PerKey
+}
+
+// LoadConfig 從 JSON 檔案載入設定，未設定的欄位沿用預設值
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg := DefaultConfig()
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("解析速率限制設定 %s 失敗: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// NewFromEnv 依 RATE_LIMIT_CONFIG 環境變數指定的設定檔建立 Limiter，
+// 並在背景每 5 秒檢查設定檔是否變更；未指定時使用預設值
+func NewFromEnv(ctx context.Context) (*Limiter, error) {
+	path := os.Getenv("RATE_LIMIT_CONFIG")
+	if path == "" {
+		return NewLimiter(DefaultConfig()), nil
+	}
+
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	l := NewLimiter(cfg)
+	go WatchConfig(ctx, l, path, 5*time.Second)
+	return l, nil
+}
+
+// WatchConfig 定期檢查設定檔的修改時間，變更時重新載入並套用到 Limiter
+// 載入失敗時保留原本的設定，直到 ctx 結束為止
+func WatchConfig(ctx context.Context, l *Limiter, path string, interval time.Duration) {
+	var lastMod time.Time
+	if info, err := os.Stat(path); err == nil {
+		lastMod = info.ModTime()
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		info, err := os.Stat(path)
+		if err != nil || !info.ModTime().After(lastMod) {
+			continue
+		}
+		lastMod = info.ModTime()
+
+		cfg, err := LoadConfig(path)
+		if err != nil {
+			slog.Error("重新載入速率限制設定失敗", "path", path, "error", err)
+			continue
+		}
+		l.SetConfig(cfg)
+		slog.Info("已重新載入速率限制設定", "path", path)
+	}
+}
+
+// TrustedProxiesFromEnv 讀取 TRUSTED_PROXIES（以逗號分隔的 IP 或 CIDR），供 gin 的 SetTrustedProxies 使用
+// 只有來自這些位址的請求才會採用 X-Forwarded-For 作為來源 IP；未設定時回傳 nil，一律使用連線的來源位址，
+// 避免用戶端自行帶入 X-Forwarded-For 繞過來源 IP 的速率限制
+func TrustedProxiesFromEnv() []string {
+	var proxies []string
+	for _, p := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			proxies = append(proxies, p)
+		}
+	}
+	return proxies
+}
@@ -0,0 +1,45 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+
+	"dongstudio.live/genkit_demo/pkg/auth"
+	"github.com/gin-gonic/gin"
+)
+
+type keyContextKey struct{}
+
+// Middleware 回傳 gin 速率限制中介層
+// 已驗證的請求以使用者ID作為 API Key 限制，並一律套用來源 IP 限制；
+// 超過限制時回應 429 並附上 Retry-After 標頭
+func Middleware(l *Limiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var key string
+		if p := auth.FromGin(c); p != nil {
+			key = p.ID
+		}
+
+		d := l.Allow(key, c.ClientIP())
+		if !d.Allowed {
+			seconds := int(math.Ceil(d.RetryAfter.Seconds()))
+			c.Header("Retry-After", strconv.Itoa(max(seconds, 1)))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+				"error":       d.Reason,
+				"retry_after": max(seconds, 1),
+			})
+			return
+		}
+
+		c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), keyContextKey{}, key))
+		c.Next()
+	}
+}
+
+// RecordTokens 將模型回應的 token 數累計到目前請求所屬 API Key 的每日配額
+func (l *Limiter) RecordTokens(ctx context.Context, tokens int) {
+	key, _ := ctx.Value(keyContextKey{}).(string)
+	l.AddTokens(key, tokens)
+}
@@ -0,0 +1,193 @@
+// Package ratelimit 提供 HTTP API 的速率限制與每日用量配額
+// 以 token bucket 分別限制每個 API Key 與每個來源 IP，
+// 並依日期累計每個 API Key 的請求數與模型 token 用量
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// bucket 是一個 token bucket 的狀態
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// check 依經過的時間補充 token 並檢查是否還有一個可用，沒有時回傳需等待的時間；
+// 通過時不會取出 token，所有檢查都通過後才呼叫 take，被其他限制拒絕的請求不會消耗此 bucket
+func (b *bucket) check(r Rate, now time.Time) (bool, time.Duration) {
+	burst := float64(max(r.Burst, 1))
+	if b.last.IsZero() {
+		b.tokens = burst
+	} else {
+		b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*r.PerSecond)
+	}
+	b.last = now
+
+	if b.tokens >= 1 {
+		return true, 0
+	}
+	wait := time.Duration((1 - b.tokens) / r.PerSecond * float64(time.Second))
+	return false, wait
+}
+
+// take 取出一個 token，呼叫前需先以 check 確認可用；b 為 nil 表示不限制
+func (b *bucket) take() {
+	if b != nil {
+		b.tokens--
+	}
+}
+
+// usage 為單一 API Key 在某一天的累計用量
+type usage struct {
+	day      string
+	requests int
+	tokens   int
+}
+
+// Decision 為一次檢查的結果
+type Decision struct {
+	Allowed    bool
+	Reason     string        // 拒絕原因
+	RetryAfter time.Duration // 建議的重試等待時間
+}
+
+// Limiter 管理所有 bucket 與每日配額，可安全地並發使用
+type Limiter struct {
+	config atomic.Pointer[Config]
+
+	mu        sync.Mutex
+	ipBuckets map[string]*bucket
+	keyBucket map[string]*bucket
+	usages    map[string]*usage
+	lastSweep time.Time
+
+	now func() time.Time
+}
+
+// NewLimiter 以指定設定建立 Limiter
+func NewLimiter(cfg *Config) *Limiter {
+	l := &Limiter{
+		ipBuckets: make(map[string]*bucket),
+		keyBucket: make(map[string]*bucket),
+		usages:    make(map[string]*usage),
+		now:       time.Now,
+	}
+	l.SetConfig(cfg)
+	return l
+}
+
+// SetConfig 替換目前的設定，已存在的 bucket 會在下次檢查時套用新速率
+func (l *Limiter) SetConfig(cfg *Config) {
+	l.config.Store(cfg)
+}
+
+// Config 回傳目前的設定
+func (l *Limiter) Config() *Config {
+	return l.config.Load()
+}
+
+// Allow 檢查一個請求是否可以通過，key 為空時只檢查 IP 限制
+// 所有限制都通過時才會消耗 IP 與 API Key 的 bucket，並累計該 API Key 當日的請求數
+func (l *Limiter) Allow(key, ip string) Decision {
+	cfg := l.Config()
+	now := l.now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sweep(now)
+
+	var ipBucket, keyBucket *bucket
+	if cfg.PerIP.PerSecond > 0 {
+		ipBucket = getBucket(l.ipBuckets, ip)
+		if ok, wait := ipBucket.check(cfg.PerIP, now); !ok {
+			return Decision{Reason: "來源 IP 請求過於頻繁", RetryAfter: wait}
+		}
+	}
+	if key == "" {
+		ipBucket.take()
+		return Decision{Allowed: true}
+	}
+
+	limits := cfg.limitsFor(key)
+	u := l.usageFor(key, now)
+	if limits.Daily.Requests > 0 && u.requests >= limits.Daily.Requests {
+		return Decision{Reason: "已達每日請求數上限", RetryAfter: untilTomorrow(now)}
+	}
+	if limits.Daily.Tokens > 0 && u.tokens >= limits.Daily.Tokens {
+		return Decision{Reason: "已達每日 token 用量上限", RetryAfter: untilTomorrow(now)}
+	}
+	if limits.Rate.PerSecond > 0 {
+		keyBucket = getBucket(l.keyBucket, key)
+		if ok, wait := keyBucket.check(limits.Rate, now); !ok {
+			return Decision{Reason: "API Key 請求過於頻繁", RetryAfter: wait}
+		}
+	}
+
+	ipBucket.take()
+	keyBucket.take()
+	u.requests++
+	return Decision{Allowed: true}
+}
+
+// AddTokens 累計 API Key 當日使用的模型 token 數
+func (l *Limiter) AddTokens(key string, tokens int) {
+	if key == "" || tokens <= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.usageFor(key, l.now()).tokens += tokens
+}
+
+// Usage 回傳 API Key 當日已使用的請求數與 token 數
+func (l *Limiter) Usage(key string) (requests, tokens int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	u := l.usageFor(key, l.now())
+	return u.requests, u.tokens
+}
+
+// usageFor 取得 API Key 當日的用量記錄，跨日時自動歸零（呼叫者需持有鎖）
+func (l *Limiter) usageFor(key string, now time.Time) *usage {
+	day := now.Format(time.DateOnly)
+	u, ok := l.usages[key]
+	if !ok || u.day != day {
+		u = &usage{day: day}
+		l.usages[key] = u
+	}
+	return u
+}
+
+// sweep 每分鐘清除一次閒置超過十分鐘的 bucket，避免記憶體無限成長（呼叫者需持有鎖）
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+	for _, buckets := range []map[string]*bucket{l.ipBuckets, l.keyBucket} {
+		for k, b := range buckets {
+			if now.Sub(b.last) > 10*time.Minute {
+				delete(buckets, k)
+			}
+		}
+	}
+}
+
+func getBucket(buckets map[string]*bucket, key string) *bucket {
+	b, ok := buckets[key]
+	if !ok {
+		b = &bucket{}
+		buckets[key] = b
+	}
+	return b
+}
+
+// untilTomorrow 回傳距離隔天零點的時間
+func untilTomorrow(now time.Time) time.Duration {
+	y, m, d := now.Date()
+	return time.Date(y, m, d+1, 0, 0, 0, 0, now.Location()).Sub(now)
+}
@@ -0,0 +1,275 @@
+package ratelimit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"dongstudio.live/genkit_demo/pkg/auth"
+	"github.com/gin-gonic/gin"
+)
+
+// fakeClock 為可手動前進的時鐘
+type fakeClock struct{ now time.Time }
+
+func (c *fakeClock) advance(d time.Duration) { c.now = c.now.Add(d) }
+
+func newTestLimiter(cfg *Config) (*Limiter, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2026, 1, 1, 23, 0, 0, 0, time.UTC)}
+	l := NewLimiter(cfg)
+	l.now = func() time.Time { return clock.now }
+	return l, clock
+}
+
+// step 為一次檢查：先前進 advance、累計 tokens，再以 key 與 ip 呼叫 Allow
+type step struct {
+	advance time.Duration
+	tokens  int
+	key, ip string
+	allowed bool
+	reason  string
+	retry   time.Duration // 拒絕時預期的 RetryAfter，0 表示不檢查
+}
+
+func TestLimiterAllow(t *testing.T) {
+	tests := []struct {
+		name  string
+		cfg   *Config
+		steps []step
+	}{
+		{
+			name: "ip burst and refill",
+			cfg:  &Config{PerIP: Rate{PerSecond: 2, Burst: 2}},
+			steps: []step{
+				{ip: "1.1.1.1", allowed: true},
+				{ip: "1.1.1.1", allowed: true},
+				{ip: "1.1.1.1", reason: "來源 IP 請求過於頻繁", retry: 500 * time.Millisecond},
+				{ip: "2.2.2.2", allowed: true}, // 每個 IP 各自計算
+				{advance: 500 * time.Millisecond, ip: "1.1.1.1", allowed: true},
+				{ip: "1.1.1.1", reason: "來源 IP 請求過於頻繁"},
+			},
+		},
+		{
+			name: "key rate with override",
+			cfg: &Config{
+				PerKey: Limits{Rate: Rate{PerSecond: 1, Burst: 1}},
+				Keys:   map[string]Limits{"vip": {Rate: Rate{PerSecond: 10, Burst: 3}}},
+			},
+			steps: []step{
+				{key: "alice", ip: "1.1.1.1", allowed: true},
+				{key: "alice", ip: "1.1.1.1", reason: "API Key 請求過於頻繁", retry: time.Second},
+				{key: "vip", ip: "1.1.1.1", allowed: true},
+				{key: "vip", ip: "1.1.1.1", allowed: true},
+				{key: "vip", ip: "1.1.1.1", allowed: true},
+				{key: "vip", ip: "1.1.1.1", reason: "API Key 請求過於頻繁"},
+				{advance: time.Second, key: "alice", ip: "1.1.1.1", allowed: true},
+			},
+		},
+		{
+			name: "rejected requests do not charge other buckets",
+			cfg:  &Config{PerIP: Rate{PerSecond: 1, Burst: 2}, PerKey: Limits{Rate: Rate{PerSecond: 1, Burst: 1}}},
+			steps: []step{
+				{key: "alice", ip: "1.1.1.1", allowed: true},
+				{key: "alice", ip: "1.1.1.1", reason: "API Key 請求過於頻繁"},
+				{key: "bob", ip: "1.1.1.1", allowed: true}, // alice 被拒絕的請求沒有消耗 IP 額度
+				{key: "carol", ip: "1.1.1.1", reason: "來源 IP 請求過於頻繁"},
+			},
+		},
+		{
+			name: "daily requests reset at midnight",
+			cfg:  &Config{PerKey: Limits{Daily: Quota{Requests: 2}}},
+			steps: []step{
+				{key: "alice", allowed: true},
+				{key: "alice", allowed: true},
+				{key: "alice", reason: "已達每日請求數上限", retry: time.Hour},
+				{key: "bob", allowed: true},
+				{advance: time.Hour, key: "alice", allowed: true},
+			},
+		},
+		{
+			name: "daily tokens",
+			cfg:  &Config{PerKey: Limits{Daily: Quota{Tokens: 100}}},
+			steps: []step{
+				{key: "alice", allowed: true},
+				{tokens: 60, key: "alice", allowed: true},
+				{tokens: 40, key: "alice", reason: "已達每日 token 用量上限", retry: time.Hour},
+				{advance: time.Hour, key: "alice", allowed: true},
+			},
+		},
+		{
+			name: "zero rate is unlimited",
+			cfg:  &Config{},
+			steps: []step{
+				{key: "alice", ip: "1.1.1.1", allowed: true},
+				{key: "alice", ip: "1.1.1.1", allowed: true},
+				{key: "alice", ip: "1.1.1.1", allowed: true},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, clock := newTestLimiter(tt.cfg)
+			for i, s := range tt.steps {
+				clock.advance(s.advance)
+				l.AddTokens(s.key, s.tokens)
+				d := l.Allow(s.key, s.ip)
+				if d.Allowed != s.allowed || d.Reason != s.reason {
+					t.Fatalf("第 %d 步 Allow(%q, %q) = %+v, want allowed=%v reason=%q", i, s.key, s.ip, d, s.allowed, s.reason)
+				}
+				if s.retry > 0 && d.RetryAfter != s.retry {
+					t.Errorf("第 %d 步 RetryAfter = %v, want %v", i, d.RetryAfter, s.retry)
+				}
+			}
+		})
+	}
+}
+
+func TestLimiterUsage(t *testing.T) {
+	l, clock := newTestLimiter(&Config{})
+	l.Allow("alice", "")
+	l.Allow("alice", "")
+	l.AddTokens("alice", 30)
+	l.AddTokens("alice", -5) // 忽略無效的 token 數
+	l.AddTokens("", 100)     // 未驗證的請求不累計
+	if requests, tokens := l.Usage("alice"); requests != 2 || tokens != 30 {
+		t.Errorf("Usage() = %d, %d, want 2, 30", requests, tokens)
+	}
+	clock.advance(time.Hour)
+	if requests, tokens := l.Usage("alice"); requests != 0 || tokens != 0 {
+		t.Errorf("跨日後 Usage() = %d, %d, want 0, 0", requests, tokens)
+	}
+}
+
+func TestLimiterSetConfig(t *testing.T) {
+	l, _ := newTestLimiter(&Config{PerKey: Limits{Daily: Quota{Requests: 1}}})
+	l.Allow("alice", "")
+	if d := l.Allow("alice", ""); d.Allowed {
+		t.Fatal("超過配額的請求被允許")
+	}
+	// 新設定立即生效，當日已累計的用量保留
+	l.SetConfig(&Config{PerKey: Limits{Daily: Quota{Requests: 3}}})
+	if d := l.Allow("alice", ""); !d.Allowed {
+		t.Errorf("提高配額後 Allow() = %+v", d)
+	}
+	if requests, _ := l.Usage("alice"); requests != 2 {
+		t.Errorf("Usage() = %d, want 2", requests)
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "ratelimit.json")
+	if err := os.WriteFile(path, []byte(`{"per_ip":{"per_second":5,"burst":20},"keys":{"vip":{"daily":{"requests":10}}}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.PerIP != (Rate{PerSecond: 5, Burst: 20}) {
+		t.Errorf("PerIP = %+v", cfg.PerIP)
+	}
+	// 未設定的欄位沿用預設值
+	if cfg.PerKey != DefaultConfig().PerKey {
+		t.Errorf("PerKey = %+v, want %+v", cfg.PerKey, DefaultConfig().PerKey)
+	}
+	if got := cfg.limitsFor("vip").Daily.Requests; got != 10 {
+		t.Errorf("vip 的每日請求數 = %d, want 10", got)
+	}
+
+	bad := filepath.Join(dir, "bad.json")
+	if err := os.WriteFile(bad, []byte(`{"per_ip":`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadConfig(bad); err == nil {
+		t.Error("格式錯誤的設定檔應回傳錯誤")
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	l, _ := newTestLimiter(&Config{
+		PerIP:  Rate{PerSecond: 1, Burst: 3},
+		PerKey: Limits{Daily: Quota{Tokens: 10}},
+	})
+	t.Setenv("TRUSTED_PROXIES", "")
+	r := gin.New()
+	if err := r.SetTrustedProxies(TrustedProxiesFromEnv()); err != nil {
+		t.Fatal(err)
+	}
+	r.Use(func(c *gin.Context) {
+		if user := c.GetHeader("X-User"); user != "" {
+			c.Request = c.Request.WithContext(auth.NewContext(c.Request.Context(), &auth.Principal{ID: user}))
+		}
+	})
+	r.Use(Middleware(l))
+	r.POST("/ask", func(c *gin.Context) {
+		l.RecordTokens(c.Request.Context(), 10)
+		c.Status(http.StatusOK)
+	})
+
+	tests := []struct {
+		user         string
+		forwardedFor string
+		status       int
+		retry        string
+	}{
+		{user: "alice", status: http.StatusOK},
+		{user: "alice", status: http.StatusTooManyRequests, retry: "3600"}, // 已用完每日 token 配額，不消耗 IP 額度
+		{user: "bob", status: http.StatusOK},
+		{status: http.StatusOK},
+		{status: http.StatusTooManyRequests, retry: "1"},                              // 同一個 IP 已用完 burst
+		{forwardedFor: "203.0.113.9", status: http.StatusTooManyRequests, retry: "1"}, // 未信任代理時忽略 X-Forwarded-For
+	}
+	for i, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/ask", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		if tt.user != "" {
+			req.Header.Set("X-User", tt.user)
+		}
+		if tt.forwardedFor != "" {
+			req.Header.Set("X-Forwarded-For", tt.forwardedFor)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tt.status {
+			t.Fatalf("第 %d 個請求 status = %d, want %d（%s）", i, w.Code, tt.status, w.Body)
+		}
+		if got := w.Header().Get("Retry-After"); got != tt.retry {
+			t.Errorf("第 %d 個請求 Retry-After = %q, want %q", i, got, tt.retry)
+		}
+	}
+	if _, tokens := l.Usage("alice"); tokens != 10 {
+		t.Errorf("alice 的 token 用量 = %d, want 10", tokens)
+	}
+}
+
+func TestRecordTokensOutsideMiddleware(t *testing.T) {
+	l, _ := newTestLimiter(&Config{})
+	l.RecordTokens(context.Background(), 50) // 沒有 API Key 時不累計，也不會 panic
+	if _, tokens := l.Usage(""); tokens != 0 {
+		t.Errorf("Usage(\"\") tokens = %d, want 0", tokens)
+	}
+}
+
+func TestTrustedProxiesFromEnv(t *testing.T) {
+	tests := []struct {
+		env  string
+		want []string
+	}{
+		{"", nil},
+		{"10.0.0.1", []string{"10.0.0.1"}},
+		{" 10.0.0.0/8 , ,192.168.1.1", []string{"10.0.0.0/8", "192.168.1.1"}},
+	}
+	for _, tt := range tests {
+		t.Setenv("TRUSTED_PROXIES", tt.env)
+		if got := TrustedProxiesFromEnv(); !slices.Equal(got, tt.want) {
+			t.Errorf("TrustedProxiesFromEnv(%q) = %q, want %q", tt.env, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package rerank
+
+import (
+	"context"
+	"math"
+
+	"dongstudio.live/genkit_demo/pkg/hybrid"
+	"dongstudio.live/genkit_demo/pkg/vectorstore"
+	"github.com/firebase/genkit/go/ai"
+)
+
+// LexicalReranker 在本機以啟發式規則評分，分數介於 0 與 1：
+//
+//   - 覆蓋率：問題中的詞出現在文檔中的比例，以候選文檔間的 IDF 加權，常見詞的影響較小
+//   - 密集度：問題的詞在文檔中最短的涵蓋視窗越短，表示相關內容越集中
+//   - 標題：問題的詞出現在 metadata 的 "title" 中時加分
+//
+// 詞的切分與 BM25 關鍵字索引相同（見 hybrid.Tokenize），中日韓文字以 bigram 比對
+type LexicalReranker struct{}
+
+// 各項分數的權重
+const (
+	coverageWeight  = 0.7
+	proximityWeight = 0.2
+	titleWeight     = 0.1
+)
+
+func (LexicalReranker) Score(_ context.Context, query string, docs []*ai.Document) ([]float64, error) {
+	terms := unique(hybrid.Tokenize(query))
+	scores := make([]float64, len(docs))
+	if len(terms) == 0 {
+		return scores, nil
+	}
+
+	docTokens := make([][]string, len(docs))
+	df := make(map[string]int)
+	for i, doc := range docs {
+		docTokens[i] = hybrid.Tokenize(vectorstore.DocText(doc))
+		for _, t := range unique(docTokens[i]) {
+			df[t]++
+		}
+	}
+	idf := make(map[string]float64, len(terms))
+	var totalIDF float64
+	for _, t := range terms {
+		idf[t] = math.Log(1 + float64(len(docs)+1)/float64(df[t]+1))
+		totalIDF += idf[t]
+	}
+
+	for i, doc := range docs {
+		present := make(map[string]bool)
+		for _, t := range docTokens[i] {
+			if _, ok := idf[t]; ok {
+				present[t] = true
+			}
+		}
+		var covered float64
+		for t := range present {
+			covered += idf[t]
+		}
+		coverage := covered / totalIDF
+
+		proximity := 0.0
+		if len(present) > 1 {
+			if window := shortestWindow(docTokens[i], present); window > 0 {
+				proximity = float64(len(present)) / float64(window)
+			}
+		} else if len(present) == 1 {
+			proximity = 1
+		}
+
+		title := 0.0
+		if t, ok := doc.Metadata["title"].(string); ok {
+			for _, tt := range hybrid.Tokenize(t) {
+				if _, ok := idf[tt]; ok {
+					title = 1
+					break
+				}
+			}
+		}
+
+		scores[i] = coverageWeight*coverage + proximityWeight*proximity*coverage + titleWeight*title
+	}
+	return scores, nil
+}
+
+// shortestWindow 回傳涵蓋 want 中所有詞的最短連續 token 數
+func shortestWindow(tokens []string, want map[string]bool) int {
+	counts := make(map[string]int)
+	have, best := 0, 0
+	left := 0
+	for right, t := range tokens {
+		if !want[t] {
+			continue
+		}
+		if counts[t] == 0 {
+			have++
+		}
+		counts[t]++
+		for have == len(want) {
+			if size := right - left + 1; best == 0 || size < best {
+				best = size
+			}
+			if lt := tokens[left]; want[lt] {
+				counts[lt]--
+				if counts[lt] == 0 {
+					have--
+				}
+			}
+			left++
+		}
+	}
+	return best
+}
+
+func unique(tokens []string) []string {
+	seen := make(map[string]bool, len(tokens))
+	out := tokens[:0:0]
+	for _, t := range tokens {
+		if !seen[t] {
+			seen[t] = true
+			out = append(out, t)
+		}
+	}
+	return out
+}
@@ -0,0 +1,107 @@
+package rerank
+
+import (
+	"context"
+	"testing"
+
+	"github.com/firebase/genkit/go/ai"
+)
+
+func TestLexicalRerankerScore(t *testing.T) {
+	doc := func(text, title string) *ai.Document {
+		metadata := map[string]any{}
+		if title != "" {
+			metadata["title"] = title
+		}
+		return ai.DocumentFromText(text, metadata)
+	}
+	tests := []struct {
+		name   string
+		query  string
+		docs   []*ai.Document
+		higher int // 分數應較高的文檔
+		lower  int
+	}{
+		{
+			name:   "coverage",
+			query:  "台積電 營收",
+			docs:   []*ai.Document{doc("台積電公布本季營收創新高", ""), doc("台積電位於新竹科學園區", "")},
+			higher: 0, lower: 1,
+		},
+		{
+			name:  "rare terms weigh more",
+			query: "pinecone index",
+			docs: []*ai.Document{
+				doc("create a pinecone client", ""),
+				doc("rebuild the index", ""),
+				doc("the index is stale", ""),
+			},
+			higher: 0, lower: 1,
+		},
+		{
+			name:  "proximity",
+			query: "vector database",
+			docs: []*ai.Document{
+				doc("a vector database stores embeddings", ""),
+				doc("a vector of numbers is stored in some other place called a database", ""),
+			},
+			higher: 0, lower: 1,
+		},
+		{
+			name:   "title",
+			query:  "牛肉麵",
+			docs:   []*ai.Document{doc("推薦的牛肉麵店家", "牛肉麵"), doc("推薦的牛肉麵店家", "小吃")},
+			higher: 0, lower: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scores, err := LexicalReranker{}.Score(context.Background(), tt.query, tt.docs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(scores) != len(tt.docs) {
+				t.Fatalf("回傳 %d 個分數，want %d", len(scores), len(tt.docs))
+			}
+			for i, s := range scores {
+				if s < 0 || s > 1 {
+					t.Errorf("第 %d 份文檔的分數 %v 不在 0 與 1 之間", i, s)
+				}
+			}
+			if scores[tt.higher] <= scores[tt.lower] {
+				t.Errorf("分數 = %v，預期第 %d 份高於第 %d 份", scores, tt.higher, tt.lower)
+			}
+		})
+	}
+}
+
+func TestLexicalRerankerNoMatch(t *testing.T) {
+	docs := []*ai.Document{ai.DocumentFromText("完全無關的內容", nil)}
+	for _, query := range []string{"", "？", "kubernetes"} {
+		scores, err := LexicalReranker{}.Score(context.Background(), query, docs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(scores) != 1 || scores[0] != 0 {
+			t.Errorf("Score(%q) = %v, want [0]", query, scores)
+		}
+	}
+}
+
+func TestShortestWindow(t *testing.T) {
+	tests := []struct {
+		tokens []string
+		want   map[string]bool
+		size   int
+	}{
+		{[]string{"a", "x", "b", "a", "b"}, map[string]bool{"a": true, "b": true}, 2},
+		{[]string{"a", "x", "x", "b"}, map[string]bool{"a": true, "b": true}, 4},
+		{[]string{"a", "x"}, map[string]bool{"a": true, "b": true}, 0},
+		{[]string{"x", "a", "x"}, map[string]bool{"a": true}, 1},
+	}
+	for _, tt := range tests {
+		if got := shortestWindow(tt.tokens, tt.want); got != tt.size {
+			t.Errorf("shortestWindow(%v) = %d, want %d", tt.tokens, got, tt.size)
+		}
+	}
+}
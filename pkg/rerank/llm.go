@@ -0,0 +1,83 @@
+package rerank
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"dongstudio.live/genkit_demo/pkg/vectorstore"
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/genkit"
+)
+
+// maxDocumentRunes 為送給模型評分時每份文檔的字數上限，避免 prompt 過長
+const maxDocumentRunes = 1500
+
+// LLMReranker 以 Genkit 模型評估每份文檔與問題的相關性（0 到 10 分），
+// 所有候選在一次呼叫中評分，使用結構化輸出取得分數
+type LLMReranker struct {
+	Genkit     *genkit.Genkit
+	Model      string               // 模型名稱，例如 googleai/gemini-2.5-flash；空字串使用預設模型
+	Middleware []ai.ModelMiddleware // 套用在評分呼叫上的 middleware，例如記錄指標與日誌
+	// OnUsage 在每次評分呼叫後被呼叫，可用於記錄用量與費用
+	OnUsage func(ctx context.Context, usage *ai.GenerationUsage)
+}
+
+// relevance 為模型的結構化輸出
+type relevance struct {
+	Scores []struct {
+		Index int     `json:"index"` // 文檔編號，從 0 開始
+		Score float64 `json:"score"` // 相關性，0 表示完全無關，10 表示直接回答問題
+	} `json:"scores"`
+}
+
+func (r *LLMReranker) Score(ctx context.Context, query string, docs []*ai.Document) ([]float64, error) {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "問題: %s\n\n", query)
+	for i, doc := range docs {
+		text := []rune(vectorstore.DocText(doc))
+		if len(text) > maxDocumentRunes {
+			text = append(text[:maxDocumentRunes], '…')
+		}
+		fmt.Fprintf(&sb, "[%d]\n%s\n\n", i, string(text))
+	}
+	sb.WriteString("請為每份文檔評分。")
+
+	opts := []ai.GenerateOption{
+		ai.WithSystem("你是搜尋結果的相關性評審。根據文檔內容能否回答使用者的問題，為每份文檔打 0 到 10 分：" +
+			"10 分表示直接回答問題，5 分表示部分相關，0 分表示完全無關。只根據文檔內容判斷，不要使用外部知識。" +
+			"每份文檔都必須給分，index 為文檔前方方括號中的編號。"),
+		ai.WithPrompt(sb.String()),
+		ai.WithOutputType(relevance{}),
+	}
+	if r.Model != "" {
+		opts = append(opts, ai.WithModelName(r.Model))
+	}
+	if len(r.Middleware) > 0 {
+		opts = append(opts, ai.WithMiddleware(r.Middleware...))
+	}
+
+	resp, err := genkit.Generate(ctx, r.Genkit, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("LLM 評分失敗: %w", err)
+	}
+	if r.OnUsage != nil {
+		r.OnUsage(ctx, resp.Usage)
+	}
+	var out relevance
+	if err := resp.Output(&out); err != nil {
+		return nil, fmt.Errorf("無法解析 LLM 評分: %w", err)
+	}
+
+	// 模型漏掉的文檔給 -1 分，排在所有已評分的文檔之後
+	scores := make([]float64, len(docs))
+	for i := range scores {
+		scores[i] = -1
+	}
+	for _, s := range out.Scores {
+		if s.Index >= 0 && s.Index < len(docs) {
+			scores[s.Index] = min(max(s.Score, 0), 10)
+		}
+	}
+	return scores, nil
+}
@@ -0,0 +1,111 @@
+// Package rerank 在檢索與生成之間重新排序候選文檔
+//
+// 檢索時先多取一些候選（over-fetch），再以 [Reranker] 對每份文檔評分並保留前 N 份：
+//
+//   - [LLMReranker]     以 Genkit 模型的結構化輸出評估每份文檔與問題的相關性
+//   - [LexicalReranker] 在本機以詞彙重疊與位置等啟發式規則評分，不需呼叫模型
+package rerank
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"sort"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/genkit"
+)
+
+// Reranker 對候選文檔評分，回傳的分數與 docs 一一對應，分數越高越相關
+type Reranker interface {
+	Score(ctx context.Context, query string, docs []*ai.Document) ([]float64, error)
+}
+
+// Scored 為一份文檔的重新排序結果，會記錄在 trace 中
+type Scored struct {
+	ID            string  `json:"id,omitempty"`    // 文檔 metadata 的 "id"
+	Title         string  `json:"title,omitempty"` // 文檔 metadata 的 "title"
+	RetrievalRank int     `json:"retrieval_rank"`  // 重新排序前的名次，從 1 開始
+	Score         float64 `json:"score"`           // reranker 的分數
+	Kept          bool    `json:"kept"`            // 是否保留在前 N 份
+}
+
+// Rerank 在 flow 中以名為 "rerank" 的 trace 步驟執行 [Apply]，每份候選的分數與名次會記錄在 trace
+// 必須在 Genkit flow 中呼叫，flow 以外請直接使用 [Apply]
+func Rerank(ctx context.Context, r Reranker, query string, docs []*ai.Document, topN int) ([]*ai.Document, error) {
+	var kept []*ai.Document
+	_, err := genkit.Run(ctx, "rerank", func() ([]Scored, error) {
+		var (
+			scored []Scored
+			err    error
+		)
+		kept, scored, err = Apply(ctx, r, query, docs, topN)
+		return scored, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("重新排序失敗: %w", err)
+	}
+	return kept, nil
+}
+
+// Apply 以 reranker 對 docs 評分並依分數排序，保留前 topN 份（topN <= 0 時全部保留），
+// 分數相同時維持檢索的順序；保留的文檔 metadata 會帶上 "rerank_score" 與 "retrieval_rank"
+// 第二個回傳值為所有候選依新順序排列的評分結果
+func Apply(ctx context.Context, r Reranker, query string, docs []*ai.Document, topN int) ([]*ai.Document, []Scored, error) {
+	if len(docs) == 0 {
+		return docs, nil, nil
+	}
+	if topN <= 0 || topN > len(docs) {
+		topN = len(docs)
+	}
+
+	scores, err := r.Score(ctx, query, docs)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(scores) != len(docs) {
+		return nil, nil, fmt.Errorf("reranker 回傳 %d 個分數，但有 %d 份文檔", len(scores), len(docs))
+	}
+
+	order := make([]int, len(docs))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return scores[order[a]] > scores[order[b]] })
+
+	kept := make([]*ai.Document, 0, topN)
+	scored := make([]Scored, 0, len(docs))
+	for rank, i := range order {
+		doc := docs[i]
+		s := Scored{RetrievalRank: i + 1, Score: scores[i], Kept: rank < topN}
+		s.ID, _ = doc.Metadata["id"].(string)
+		s.Title, _ = doc.Metadata["title"].(string)
+		scored = append(scored, s)
+		if !s.Kept {
+			continue
+		}
+		metadata := maps.Clone(doc.Metadata)
+		if metadata == nil {
+			metadata = make(map[string]any)
+		}
+		metadata["rerank_score"] = scores[i]
+		metadata["retrieval_rank"] = i + 1
+		kept = append(kept, &ai.Document{Content: doc.Content, Metadata: metadata})
+	}
+	return kept, scored, nil
+}
+
+// New 依名稱建立 Reranker：llm 或 lexical；none 或空字串回傳 nil 表示不重新排序
+// llm 需要 g 與 model
+func New(name string, g *genkit.Genkit, model string) (Reranker, error) {
+	switch name {
+	case "", "none":
+		return nil, nil
+	case "llm":
+		return &LLMReranker{Genkit: g, Model: model}, nil
+	case "lexical":
+		return LexicalReranker{}, nil
+	default:
+		return nil, fmt.Errorf("不支援的 reranker: %s", name)
+	}
+}
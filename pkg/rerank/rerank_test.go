@@ -0,0 +1,112 @@
+package rerank
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/firebase/genkit/go/ai"
+)
+
+// staticReranker 回傳固定的分數
+type staticReranker struct {
+	scores []float64
+	err    error
+}
+
+func (r staticReranker) Score(context.Context, string, []*ai.Document) ([]float64, error) {
+	return r.scores, r.err
+}
+
+func TestApply(t *testing.T) {
+	newDocs := func() []*ai.Document {
+		var docs []*ai.Document
+		for _, id := range []string{"a", "b", "c", "d"} {
+			docs = append(docs, ai.DocumentFromText(id, map[string]any{"id": id}))
+		}
+		return docs
+	}
+	tests := []struct {
+		name    string
+		scores  []float64
+		topN    int
+		kept    []string
+		order   []string // 所有候選的新順序
+		wantErr bool
+	}{
+		{name: "reorder", scores: []float64{0.1, 0.9, 0.5, 0.3}, topN: 2, kept: []string{"b", "c"}, order: []string{"b", "c", "d", "a"}},
+		{name: "ties keep retrieval order", scores: []float64{0.5, 0.5, 0.9, 0.5}, topN: 3, kept: []string{"c", "a", "b"}, order: []string{"c", "a", "b", "d"}},
+		{name: "topN zero keeps all", scores: []float64{0.4, 0.3, 0.2, 0.1}, kept: []string{"a", "b", "c", "d"}, order: []string{"a", "b", "c", "d"}},
+		{name: "topN larger than docs", scores: []float64{0.1, 0.2, 0.3, 0.4}, topN: 10, kept: []string{"d", "c", "b", "a"}, order: []string{"d", "c", "b", "a"}},
+		{name: "wrong number of scores", scores: []float64{1}, topN: 2, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			docs := newDocs()
+			kept, scored, err := Apply(context.Background(), staticReranker{scores: tt.scores}, "q", docs, tt.topN)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Apply() error = %v", err)
+			}
+			if tt.wantErr {
+				return
+			}
+			var keptIDs, order []string
+			for _, d := range kept {
+				keptIDs = append(keptIDs, d.Metadata["id"].(string))
+			}
+			for _, s := range scored {
+				order = append(order, s.ID)
+				if s.Kept != slices.Contains(tt.kept, s.ID) {
+					t.Errorf("%s 的 Kept = %v", s.ID, s.Kept)
+				}
+			}
+			if !slices.Equal(keptIDs, tt.kept) || !slices.Equal(order, tt.order) {
+				t.Fatalf("保留 %v、順序 %v, want %v、%v", keptIDs, order, tt.kept, tt.order)
+			}
+			for _, d := range kept {
+				rank := d.Metadata["retrieval_rank"].(int)
+				if d.Metadata["rerank_score"] != tt.scores[rank-1] || docs[rank-1].Metadata["id"] != d.Metadata["id"] {
+					t.Errorf("%s 的 metadata = %v", d.Metadata["id"], d.Metadata)
+				}
+			}
+			for _, d := range docs {
+				if _, ok := d.Metadata["rerank_score"]; ok {
+					t.Errorf("輸入的文檔 %s 被修改", d.Metadata["id"])
+				}
+			}
+		})
+	}
+
+	wantErr := errors.New("模型無法使用")
+	if _, _, err := Apply(context.Background(), staticReranker{err: wantErr}, "q", newDocs(), 2); !errors.Is(err, wantErr) {
+		t.Errorf("Apply() error = %v, want %v", err, wantErr)
+	}
+	if kept, _, err := Apply(context.Background(), staticReranker{err: wantErr}, "q", nil, 2); err != nil || len(kept) != 0 {
+		t.Errorf("沒有候選時 Apply() = %v, %v", kept, err)
+	}
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    Reranker
+		wantErr bool
+	}{
+		{name: "", want: nil},
+		{name: "none", want: nil},
+		{name: "lexical", want: LexicalReranker{}},
+		{name: "cohere", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := New(tt.name, nil, "")
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("New(%q) = %v, %v", tt.name, got, err)
+		}
+	}
+	if r, err := New("llm", nil, "googleai/gemini-2.5-flash"); err != nil {
+		t.Fatal(err)
+	} else if llm, ok := r.(*LLMReranker); !ok || llm.Model != "googleai/gemini-2.5-flash" {
+		t.Errorf("New(llm) = %#v", r)
+	}
+}
@@ -0,0 +1,45 @@
+// Package retry 以指數退避重試失敗的操作，每次重試的等待時間加倍並加上隨機抖動
+package retry
+
+import (
+	"context"
+	"math/rand/v2"
+	"time"
+)
+
+// Policy 為重試設定，Attempts 與 InitialBackoff 需為正值
+type Policy struct {
+	Attempts       int           // 最多嘗試次數（含第一次）
+	InitialBackoff time.Duration // 第一次重試前的等待時間
+	MaxBackoff     time.Duration // 等待時間上限，0 表示不限制
+	// Retryable 判斷錯誤是否應重試，為 nil 時所有錯誤都重試
+	Retryable func(error) bool
+	// OnRetry 在每次等待重試前被呼叫，可用於記錄
+	OnRetry func(attempt int, wait time.Duration, err error)
+}
+
+// Do 呼叫 fn 直到成功、錯誤不可重試或達到嘗試次數，回傳最後一次的錯誤
+// 等待期間 context 取消時立即回傳 ctx.Err()
+func Do(ctx context.Context, p Policy, fn func() error) error {
+	backoff := p.InitialBackoff
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= p.Attempts || ctx.Err() != nil || (p.Retryable != nil && !p.Retryable(err)) {
+			return err
+		}
+		// 等待 backoff 的 50%~100%，避免多個批次同時重試
+		wait := backoff/2 + rand.N(backoff/2+1)
+		if p.OnRetry != nil {
+			p.OnRetry(attempt, wait, err)
+		}
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		backoff *= 2
+		if p.MaxBackoff > 0 {
+			backoff = min(backoff, p.MaxBackoff)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+var errTemporary = errors.New("temporary")
+
+func TestDo(t *testing.T) {
+	tests := []struct {
+		name      string
+		failures  int // fn 在前幾次呼叫失敗
+		retryable func(error) bool
+		calls     int
+		wantErr   bool
+	}{
+		{name: "success", calls: 1},
+		{name: "retry until success", failures: 2, calls: 3},
+		{name: "give up after attempts", failures: 5, calls: 3, wantErr: true},
+		{name: "not retryable", failures: 1, retryable: func(err error) bool { return !errors.Is(err, errTemporary) }, calls: 1, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls, retries := 0, 0
+			p := Policy{
+				Attempts:       3,
+				InitialBackoff: time.Millisecond,
+				MaxBackoff:     2 * time.Millisecond,
+				Retryable:      tt.retryable,
+				OnRetry: func(attempt int, wait time.Duration, err error) {
+					retries++
+					if attempt != retries || wait > 2*time.Millisecond || !errors.Is(err, errTemporary) {
+						t.Errorf("OnRetry(%d, %v, %v)", attempt, wait, err)
+					}
+				},
+			}
+			err := Do(context.Background(), p, func() error {
+				calls++
+				if calls <= tt.failures {
+					return errTemporary
+				}
+				return nil
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Do() error = %v", err)
+			}
+			if calls != tt.calls || retries != calls-1 {
+				t.Errorf("呼叫 %d 次、重試 %d 次，want %d 次", calls, retries, tt.calls)
+			}
+		})
+	}
+}
+
+func TestDoCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := Policy{Attempts: 5, InitialBackoff: time.Hour, OnRetry: func(int, time.Duration, error) { cancel() }}
+	start := time.Now()
+	err := Do(ctx, p, func() error { return errTemporary })
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Do() error = %v, want context.Canceled", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Error("context 取消後仍在等待重試")
+	}
+}
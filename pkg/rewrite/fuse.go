@@ -0,0 +1,19 @@
+package rewrite
+
+import (
+	"strconv"
+
+	"dongstudio.live/genkit_demo/pkg/hybrid"
+	"github.com/firebase/genkit/go/ai"
+)
+
+// Fuse 以 reciprocal rank fusion（見 [hybrid.Fuse]）合併各個查詢變體的檢索結果，回傳依合併分數排序的文檔
+// 每個變體的權重相同，metadata 帶有合併分數 "rrf_score" 與各變體的名次 "query<n>_rank"（n 從 1 開始），
+// "score" 為各變體中的最高相似度，以維持相似度門檻的意義
+func Fuse(results [][]*ai.Document) []*ai.Document {
+	lists := make([]hybrid.RankedList, len(results))
+	for i, docs := range results {
+		lists[i] = hybrid.RankedList{Name: "query" + strconv.Itoa(i+1), Weight: 1, Documents: docs, Similarity: true}
+	}
+	return hybrid.Fuse(lists, hybrid.DefaultRRFK)
+}
@@ -0,0 +1,46 @@
+package rewrite
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/firebase/genkit/go/ai"
+)
+
+func scoredDoc(id string, score float64) *ai.Document {
+	return ai.DocumentFromText(id, map[string]any{"id": id, "score": score})
+}
+
+func TestFuse(t *testing.T) {
+	docs := Fuse([][]*ai.Document{
+		{scoredDoc("a", 0.6), scoredDoc("b", 0.5)},
+		{scoredDoc("b", 0.9), scoredDoc("c", 0.4)},
+		nil, // 檢索失敗的變體
+		{scoredDoc("b", 0.7), scoredDoc("a", 0.3)},
+	})
+	var ids []string
+	for _, doc := range docs {
+		ids = append(ids, doc.Metadata["id"].(string))
+	}
+	// b: 1/62 + 1/61 + 1/61，a: 1/61 + 1/62，c: 1/62
+	if want := []string{"b", "a", "c"}; !slices.Equal(ids, want) {
+		t.Fatalf("Fuse() = %v, want %v", ids, want)
+	}
+
+	b := docs[0].Metadata
+	if b["score"] != 0.9 {
+		t.Errorf("b 的 score = %v，want 各變體中的最高分 0.9", b["score"])
+	}
+	if b["query1_rank"] != 2 || b["query2_rank"] != 1 || b["query4_rank"] != 1 {
+		t.Errorf("b 的 metadata = %v", b)
+	}
+	if _, ok := b["query3_rank"]; ok {
+		t.Errorf("b 不應有未命中變體的名次: %v", b)
+	}
+	if a := docs[1].Metadata; a["score"] != 0.6 {
+		t.Errorf("a 的 score = %v, want 0.6", a["score"])
+	}
+	if _, ok := docs[0].Metadata["rrf_score"].(float64); !ok {
+		t.Errorf("缺少 rrf_score: %v", docs[0].Metadata)
+	}
+}
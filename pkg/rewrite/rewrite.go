@@ -0,0 +1,144 @@
+// Package rewrite 在檢索前改寫查詢，改善簡短或模糊問題的檢索效果
+//
+// [Rewriter] 以 Genkit 模型的結構化輸出產生查詢的變體：
+//
+//   - rewrite      補上上下文、改寫成完整明確的問題
+//   - paraphrase   換句話說的改寫
+//   - translation  中英互譯，語料混合中英文時可找到另一種語言的文檔
+//   - hyde         假設性回答（HyDE），以「答案的樣子」檢索
+//
+// 每個變體各自檢索後以 [Fuse] 合併
+package rewrite
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/genkit"
+)
+
+// Kind 為查詢變體的種類
+type Kind string
+
+const (
+	KindOriginal    Kind = "original"
+	KindRewrite     Kind = "rewrite"
+	KindParaphrase  Kind = "paraphrase"
+	KindTranslation Kind = "translation"
+	KindHyDE        Kind = "hyde"
+)
+
+// Query 為一個查詢變體
+type Query struct {
+	Kind Kind   `json:"kind"`
+	Text string `json:"text"`
+}
+
+// Rewriter 以模型產生查詢變體
+type Rewriter struct {
+	Genkit      *genkit.Genkit
+	Model       string               // 模型名稱；空字串使用預設模型
+	Middleware  []ai.ModelMiddleware // 套用在改寫呼叫上的 middleware
+	Kinds       []Kind               // 要產生的變體種類，不含 original
+	Paraphrases int                  // paraphrase 的數量，預設 2
+	// OnUsage 在每次改寫呼叫後被呼叫，可用於記錄用量與費用
+	OnUsage func(ctx context.Context, usage *ai.GenerationUsage)
+}
+
+// ParseKinds 解析以逗號分隔的變體種類，例如 "rewrite,paraphrase,translation,hyde"
+func ParseKinds(s string) ([]Kind, error) {
+	var kinds []Kind
+	for _, item := range strings.Split(s, ",") {
+		switch k := Kind(strings.TrimSpace(item)); k {
+		case "":
+		case KindRewrite, KindParaphrase, KindTranslation, KindHyDE:
+			if !slices.Contains(kinds, k) {
+				kinds = append(kinds, k)
+			}
+		default:
+			return nil, fmt.Errorf("不支援的查詢變體: %s", item)
+		}
+	}
+	return kinds, nil
+}
+
+// expansion 為模型的結構化輸出
+type expansion struct {
+	Rewritten          string   `json:"rewritten,omitempty"`           // 完整明確的問題
+	Paraphrases        []string `json:"paraphrases,omitempty"`         // 換句話說的改寫
+	Translation        string   `json:"translation,omitempty"`         // 翻譯成另一種語言（中文譯為英文，英文譯為中文）
+	HypotheticalAnswer string   `json:"hypothetical_answer,omitempty"` // 一段可能出現在文檔中的假設性回答
+}
+
+// Expand 回傳原始查詢與模型產生的變體，原始查詢一定是第一個，重複的變體會被移除
+func (r *Rewriter) Expand(ctx context.Context, query string) ([]Query, error) {
+	queries := []Query{{Kind: KindOriginal, Text: query}}
+	if len(r.Kinds) == 0 {
+		return queries, nil
+	}
+	paraphrases := r.Paraphrases
+	if paraphrases <= 0 {
+		paraphrases = 2
+	}
+
+	var tasks []string
+	for _, k := range r.Kinds {
+		switch k {
+		case KindRewrite:
+			tasks = append(tasks, "rewritten: 將問題改寫成完整、明確、適合搜尋的問題，補上省略的主詞與關鍵字，不要加入問題沒有的假設")
+		case KindParaphrase:
+			tasks = append(tasks, fmt.Sprintf("paraphrases: %d 個意思相同但用詞不同的問法", paraphrases))
+		case KindTranslation:
+			tasks = append(tasks, "translation: 將問題翻譯成另一種語言，中文翻譯成英文，英文翻譯成繁體中文")
+		case KindHyDE:
+			tasks = append(tasks, "hypothetical_answer: 寫一段 2 到 3 句、可能出現在參考文件中的回答，用於檢索，內容不需保證正確")
+		}
+	}
+
+	opts := []ai.GenerateOption{
+		ai.WithSystem("你協助搜尋系統改寫使用者的問題，以提高文件檢索的召回率。只輸出要求的欄位，除了翻譯以外使用與問題相同的語言。"),
+		ai.WithPrompt(fmt.Sprintf("問題: %s\n\n請產生:\n- %s", query, strings.Join(tasks, "\n- "))),
+		ai.WithOutputType(expansion{}),
+	}
+	if r.Model != "" {
+		opts = append(opts, ai.WithModelName(r.Model))
+	}
+	if len(r.Middleware) > 0 {
+		opts = append(opts, ai.WithMiddleware(r.Middleware...))
+	}
+
+	resp, err := genkit.Generate(ctx, r.Genkit, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("改寫查詢失敗: %w", err)
+	}
+	if r.OnUsage != nil {
+		r.OnUsage(ctx, resp.Usage)
+	}
+	var out expansion
+	if err := resp.Output(&out); err != nil {
+		return nil, fmt.Errorf("無法解析改寫結果: %w", err)
+	}
+
+	add := func(kind Kind, text string) {
+		text = strings.TrimSpace(text)
+		if text == "" || !slices.Contains(r.Kinds, kind) {
+			return
+		}
+		if slices.ContainsFunc(queries, func(q Query) bool { return strings.EqualFold(q.Text, text) }) {
+			return
+		}
+		queries = append(queries, Query{Kind: kind, Text: text})
+	}
+	add(KindRewrite, out.Rewritten)
+	for i, p := range out.Paraphrases {
+		if i < paraphrases {
+			add(KindParaphrase, p)
+		}
+	}
+	add(KindTranslation, out.Translation)
+	add(KindHyDE, out.HypotheticalAnswer)
+	return queries, nil
+}
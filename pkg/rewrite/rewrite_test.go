@@ -0,0 +1,169 @@
+package rewrite
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/genkit"
+)
+
+func TestParseKinds(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    []Kind
+		wantErr bool
+	}{
+		{in: "", want: nil},
+		{in: "rewrite", want: []Kind{KindRewrite}},
+		{in: " hyde, rewrite ,,hyde,translation", want: []Kind{KindHyDE, KindRewrite, KindTranslation}},
+		{in: "rewrite,original", wantErr: true},
+		{in: "summary", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseKinds(tt.in)
+		if (err != nil) != tt.wantErr || !slices.Equal(got, tt.want) {
+			t.Errorf("ParseKinds(%q) = %v, %v, want %v", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+// fakeModel 為離線的改寫模型，回傳固定的 output 並記錄每次呼叫的提示詞
+type fakeModel struct {
+	output  string
+	prompts []string
+}
+
+func (f *fakeModel) define(g *genkit.Genkit) string {
+	genkit.DefineModel(g, "test", "rewriter", &ai.ModelInfo{
+		Supports: &ai.ModelSupports{Multiturn: true, SystemRole: true},
+	}, func(_ context.Context, req *ai.ModelRequest, _ ai.ModelStreamCallback) (*ai.ModelResponse, error) {
+		var sb strings.Builder
+		for _, m := range req.Messages {
+			if m.Role != ai.RoleUser {
+				continue
+			}
+			for _, p := range m.Content {
+				if p.Metadata["purpose"] != "output" {
+					sb.WriteString(p.Text)
+				}
+			}
+		}
+		f.prompts = append(f.prompts, sb.String())
+		return &ai.ModelResponse{Request: req, Message: ai.NewModelTextMessage(f.output), FinishReason: ai.FinishReasonStop}, nil
+	})
+	return "test/rewriter"
+}
+
+func newTestRewriter(t *testing.T, output string) (*Rewriter, *fakeModel) {
+	t.Helper()
+	g, err := genkit.Init(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeModel{output: output}
+	return &Rewriter{Genkit: g, Model: f.define(g)}, f
+}
+
+func TestExpand(t *testing.T) {
+	out, err := json.Marshal(expansion{
+		Rewritten:          "台北有哪些著名的夜市？",
+		Paraphrases:        []string{"台北夜市推薦", "台北有哪些著名的夜市？", "台北哪裡可以逛夜市", "第三個改寫"},
+		Translation:        "  What are the famous night markets in Taipei?  ",
+		HypotheticalAnswer: "台北著名的夜市包括士林夜市與饒河街夜市。",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		kinds       []Kind
+		paraphrases int
+		want        []Query
+		task        string // 提示詞應包含的要求
+	}{
+		{
+			name:  "all kinds",
+			kinds: []Kind{KindRewrite, KindParaphrase, KindTranslation, KindHyDE},
+			// 與其他變體重複的 paraphrase 被移除，預設最多 2 個
+			want: []Query{
+				{KindOriginal, "台北 夜市"},
+				{KindRewrite, "台北有哪些著名的夜市？"},
+				{KindParaphrase, "台北夜市推薦"},
+				{KindTranslation, "What are the famous night markets in Taipei?"},
+				{KindHyDE, "台北著名的夜市包括士林夜市與饒河街夜市。"},
+			},
+			task: "paraphrases: 2 個",
+		},
+		{
+			name:        "paraphrase count",
+			kinds:       []Kind{KindParaphrase},
+			paraphrases: 4,
+			want: []Query{
+				{KindOriginal, "台北 夜市"},
+				{KindParaphrase, "台北夜市推薦"},
+				{KindParaphrase, "台北有哪些著名的夜市？"},
+				{KindParaphrase, "台北哪裡可以逛夜市"},
+				{KindParaphrase, "第三個改寫"},
+			},
+			task: "paraphrases: 4 個",
+		},
+		{
+			// 模型多回傳的欄位不採用
+			name:  "only requested kinds",
+			kinds: []Kind{KindTranslation},
+			want: []Query{
+				{KindOriginal, "台北 夜市"},
+				{KindTranslation, "What are the famous night markets in Taipei?"},
+			},
+			task: "translation:",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, f := newTestRewriter(t, string(out))
+			r.Kinds, r.Paraphrases = tt.kinds, tt.paraphrases
+			calls := 0
+			r.OnUsage = func(context.Context, *ai.GenerationUsage) { calls++ }
+			got, err := r.Expand(context.Background(), "台北 夜市")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Expand() = %v, want %v", got, tt.want)
+			}
+			if len(f.prompts) != 1 || calls != 1 {
+				t.Fatalf("模型呼叫 %d 次、OnUsage %d 次，want 各 1 次", len(f.prompts), calls)
+			}
+			if !strings.Contains(f.prompts[0], tt.task) {
+				t.Errorf("提示詞缺少 %q: %s", tt.task, f.prompts[0])
+			}
+		})
+	}
+}
+
+func TestExpandOriginalOnly(t *testing.T) {
+	r, f := newTestRewriter(t, "{}")
+	got, err := r.Expand(context.Background(), "夜市")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []Query{{KindOriginal, "夜市"}}; !slices.Equal(got, want) {
+		t.Errorf("Expand() = %v, want %v", got, want)
+	}
+	if len(f.prompts) != 0 {
+		t.Errorf("未設定變體時不應呼叫模型，實際呼叫 %d 次", len(f.prompts))
+	}
+}
+
+func TestExpandInvalidOutput(t *testing.T) {
+	r, _ := newTestRewriter(t, "無法改寫")
+	r.Kinds = []Kind{KindRewrite}
+	if _, err := r.Expand(context.Background(), "夜市"); err == nil {
+		t.Error("無法解析的改寫結果應回傳錯誤")
+	}
+}
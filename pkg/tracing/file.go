@@ -0,0 +1,103 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// spanRecord 為寫入檔案的單一 span 格式
+type spanRecord struct {
+	TraceID      string         `json:"trace_id"`
+	SpanID       string         `json:"span_id"`
+	ParentSpanID string         `json:"parent_span_id,omitempty"`
+	Name         string         `json:"name"`
+	Kind         string         `json:"kind"`
+	StartTime    time.Time      `json:"start_time"`
+	EndTime      time.Time      `json:"end_time"`
+	DurationMs   float64        `json:"duration_ms"`
+	Status       string         `json:"status"`
+	StatusMsg    string         `json:"status_message,omitempty"`
+	Service      string         `json:"service,omitempty"`
+	Attributes   map[string]any `json:"attributes,omitempty"`
+	Events       []spanEvent    `json:"events,omitempty"`
+}
+
+type spanEvent struct {
+	Name       string         `json:"name"`
+	Time       time.Time      `json:"time"`
+	Attributes map[string]any `json:"attributes,omitempty"`
+}
+
+// FileExporter 將 span 以 JSON Lines 格式附加寫入檔案，每行一個 span
+type FileExporter struct {
+	mu   sync.Mutex
+	file *os.File
+	enc  *json.Encoder
+}
+
+// NewFileExporter 建立寫入指定檔案的 exporter，檔案已存在時附加在後面
+func NewFileExporter(path string) (*FileExporter, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &FileExporter{file: f, enc: json.NewEncoder(f)}, nil
+}
+
+// ExportSpans 實作 sdktrace.SpanExporter
+func (e *FileExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, s := range spans {
+		r := spanRecord{
+			TraceID:    s.SpanContext().TraceID().String(),
+			SpanID:     s.SpanContext().SpanID().String(),
+			Name:       s.Name(),
+			Kind:       s.SpanKind().String(),
+			StartTime:  s.StartTime(),
+			EndTime:    s.EndTime(),
+			DurationMs: float64(s.EndTime().Sub(s.StartTime()).Microseconds()) / 1000,
+			Status:     s.Status().Code.String(),
+			StatusMsg:  s.Status().Description,
+			Attributes: make(map[string]any, len(s.Attributes())),
+		}
+		if s.Parent().IsValid() {
+			r.ParentSpanID = s.Parent().SpanID().String()
+		}
+		if res := s.Resource(); res != nil {
+			if v, ok := res.Set().Value("service.name"); ok {
+				r.Service = v.AsString()
+			}
+		}
+		for _, kv := range s.Attributes() {
+			r.Attributes[string(kv.Key)] = kv.Value.AsInterface()
+		}
+		for _, ev := range s.Events() {
+			se := spanEvent{Name: ev.Name, Time: ev.Time}
+			if len(ev.Attributes) > 0 {
+				se.Attributes = make(map[string]any, len(ev.Attributes))
+				for _, kv := range ev.Attributes {
+					se.Attributes[string(kv.Key)] = kv.Value.AsInterface()
+				}
+			}
+			r.Events = append(r.Events, se)
+		}
+		if err := e.enc.Encode(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Shutdown 實作 sdktrace.SpanExporter，關閉檔案
+func (e *FileExporter) Shutdown(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.file.Close()
+}
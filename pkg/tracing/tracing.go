@@ -0,0 +1,67 @@
+// Package tracing 設定 OpenTelemetry 追蹤匯出
+// HTTP handler 的 span 與其下 Genkit flow/model/tool 的 span 會屬於同一條 trace，
+// 並可透過 OTLP 匯出到 collector，或寫入 JSON Lines 檔案供離線分析
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/firebase/genkit/go/genkit"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// Setup 依環境變數設定追蹤匯出，回傳的 shutdown 需在程式結束前呼叫以送出剩餘的 span
+//
+//	TRACE_EXPORTER=otlp  透過 OTLP/HTTP 匯出，端點由 OTEL_EXPORTER_OTLP_ENDPOINT 設定（預設 localhost:4318）
+//	TRACE_EXPORTER=file  寫入 TRACE_FILE 指定的 JSON Lines 檔案（預設 traces.jsonl）
+//	未設定時不匯出
+func Setup(ctx context.Context, g *genkit.Genkit, serviceName string) (func(context.Context) error, error) {
+	var exporter sdktrace.SpanExporter
+	switch mode := os.Getenv("TRACE_EXPORTER"); mode {
+	case "":
+		return func(context.Context) error { return nil }, nil
+	case "otlp":
+		var err error
+		exporter, err = otlptracehttp.New(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("無法建立 OTLP exporter: %w", err)
+		}
+	case "file":
+		path := os.Getenv("TRACE_FILE")
+		if path == "" {
+			path = "traces.jsonl"
+		}
+		var err error
+		exporter, err = NewFileExporter(path)
+		if err != nil {
+			return nil, fmt.Errorf("無法建立追蹤檔案 %s: %w", path, err)
+		}
+	default:
+		return nil, fmt.Errorf("不支援的 TRACE_EXPORTER: %s", mode)
+	}
+
+	// 同一個 processor 同時處理本程式與 Genkit 產生的 span
+	processor := sdktrace.NewBatchSpanProcessor(exporter)
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithSpanProcessor(processor),
+		sdktrace.WithResource(resource.NewWithAttributes(
+			semconv.SchemaURL,
+			semconv.ServiceName(serviceName),
+		)),
+	)
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+	genkit.RegisterSpanProcessor(g, processor)
+
+	return tp.Shutdown, nil
+}
@@ -0,0 +1,130 @@
+package usage
+
+import (
+	"encoding/csv"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"dongstudio.live/genkit_demo/pkg/auth"
+	"github.com/gin-gonic/gin"
+)
+
+// RegisterRoutes 註冊用量查詢 API
+//
+//	GET /usage         以 JSON 回傳彙總結果
+//	GET /usage/export  以 CSV 下載彙總結果
+//
+// 查詢參數: group_by=model,user,session,flow、from、to (RFC 3339 或 YYYY-MM-DD)、user
+// 一般使用者只能查詢自己的用量，admins 中的使用者可以查詢所有人；未通過驗證的請求回應 403
+func RegisterRoutes(r gin.IRouter, a *Accountant, admins []string) {
+	r.GET("/usage", func(c *gin.Context) {
+		groupBy, filter, ok := parseQuery(c, admins)
+		if !ok {
+			return
+		}
+		totals, err := a.Totals(groupBy, filter)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"group_by": groupBy,
+			"totals":   totals,
+		})
+	})
+
+	r.GET("/usage/export", func(c *gin.Context) {
+		groupBy, filter, ok := parseQuery(c, admins)
+		if !ok {
+			return
+		}
+		totals, err := a.Totals(groupBy, filter)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		filename := "usage_" + time.Now().Format("20060102") + ".csv"
+		c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		c.Status(http.StatusOK)
+		writeCSV(c.Writer, groupBy, totals)
+	})
+}
+
+// parseQuery 解析查詢參數並套用權限限制，失敗時已寫入錯誤回應
+func parseQuery(c *gin.Context, admins []string) ([]string, Filter, bool) {
+	var groupBy []string
+	for _, dim := range strings.Split(c.Query("group_by"), ",") {
+		if dim = strings.TrimSpace(dim); dim != "" {
+			groupBy = append(groupBy, dim)
+		}
+	}
+
+	var filter Filter
+	for name, t := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+		if v := c.Query(name); v != "" {
+			parsed, err := parseTime(v)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "無效的時間參數 " + name})
+				return nil, Filter{}, false
+			}
+			*t = parsed
+		}
+	}
+
+	filter.User = c.Query("user")
+	p := auth.FromGin(c)
+	if p == nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "需要驗證才能查詢用量"})
+		return nil, Filter{}, false
+	}
+	if !slices.Contains(admins, p.ID) {
+		if filter.User != "" && filter.User != p.ID {
+			c.JSON(http.StatusForbidden, gin.H{"error": "無權查詢其他使用者的用量"})
+			return nil, Filter{}, false
+		}
+		filter.User = p.ID
+	}
+	return groupBy, filter, true
+}
+
+func parseTime(v string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation(time.DateOnly, v, time.Local)
+}
+
+// writeCSV 將彙總結果寫成 CSV，欄位為分組維度加上用量與費用
+func writeCSV(w http.ResponseWriter, groupBy []string, totals []Total) {
+	cw := csv.NewWriter(w)
+	header := append(slices.Clone(groupBy), "requests", "input_tokens", "output_tokens", "cost_usd")
+	cw.Write(header)
+	for _, t := range totals {
+		row := make([]string, 0, len(header))
+		for _, dim := range groupBy {
+			switch dim {
+			case "model":
+				row = append(row, t.Model)
+			case "user":
+				row = append(row, t.User)
+			case "session":
+				row = append(row, t.Session)
+			case "flow":
+				row = append(row, t.Flow)
+			}
+		}
+		row = append(row,
+			strconv.Itoa(t.Requests),
+			strconv.Itoa(t.InputTokens),
+			strconv.Itoa(t.OutputTokens),
+			strconv.FormatFloat(t.Cost, 'f', 6, 64),
+		)
+		cw.Write(row)
+	}
+	cw.Flush()
+}
@@ -0,0 +1,74 @@
+package usage
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"dongstudio.live/genkit_demo/pkg/auth"
+	"github.com/firebase/genkit/go/ai"
+	"github.com/gin-gonic/gin"
+)
+
+func TestUsageRoutesPermissions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	a, err := NewAccountant(DefaultPriceTable(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, user := range []string{"alice", "bob"} {
+		ctx := auth.NewContext(context.Background(), &auth.Principal{ID: user})
+		a.Record(ctx, "googleai/gemini-2.5-flash", "rag-flow", &ai.GenerationUsage{InputTokens: 10, OutputTokens: 5})
+	}
+	r := gin.New()
+	RegisterRoutes(r, a, []string{"admin"})
+
+	tests := []struct {
+		name   string
+		user   string // 空字串表示未驗證
+		query  string
+		status int
+		users  []string // group_by=user 時預期回傳的使用者
+	}{
+		{name: "unauthenticated", query: "?group_by=user", status: http.StatusForbidden},
+		{name: "own usage", user: "alice", query: "?group_by=user", status: http.StatusOK, users: []string{"alice"}},
+		{name: "other user", user: "alice", query: "?user=bob", status: http.StatusForbidden},
+		{name: "admin", user: "admin", query: "?group_by=user", status: http.StatusOK, users: []string{"alice", "bob"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/usage"+tt.query, nil)
+			if tt.user != "" {
+				req = req.WithContext(auth.NewContext(req.Context(), &auth.Principal{ID: tt.user}))
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d（%s）", w.Code, tt.status, w.Body)
+			}
+			if tt.users == nil {
+				return
+			}
+			var resp struct {
+				Totals []Total `json:"totals"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			got := make(map[string]bool)
+			for _, total := range resp.Totals {
+				got[total.User] = true
+			}
+			if len(got) != len(tt.users) {
+				t.Errorf("使用者 = %v, want %v", got, tt.users)
+			}
+			for _, u := range tt.users {
+				if !got[u] {
+					t.Errorf("缺少使用者 %s 的用量: %v", u, got)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package usage
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Price 為模型每百萬 token 的價格（美元）
+type Price struct {
+	InputPerMillion  float64 `json:"input_per_million"`
+	OutputPerMillion float64 `json:"output_per_million"`
+}
+
+// PriceTable 以模型名稱（例如 "googleai/gemini-2.5-flash"）對應價格
+type PriceTable map[string]Price
+
+// DefaultPriceTable 回傳內建的參考價格，實際計費請以設定檔覆寫
+func DefaultPriceTable() PriceTable {
+	return PriceTable{
+		"googleai/gemini-2.5-flash": {InputPerMillion: 0.30, OutputPerMillion: 2.50},
+		"googleai/gemini-2.5-pro":   {InputPerMillion: 1.25, OutputPerMillion: 10.00},
+		"googleai/gemini-1.5-flash": {InputPerMillion: 0.075, OutputPerMillion: 0.30},
+		"openai/gpt-4o-mini":        {InputPerMillion: 0.15, OutputPerMillion: 0.60},
+	}
+}
+
+// LoadPriceTable 從 JSON 檔案載入價格表，檔案中的模型會覆寫內建價格
+func LoadPriceTable(path string) (PriceTable, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var overrides PriceTable
+	if err := json.Unmarshal(data, &overrides); err != nil {
+		return nil, fmt.Errorf("解析價格表 %s 失敗: %w", path, err)
+	}
+
+	prices := DefaultPriceTable()
+	for model, p := range overrides {
+		prices[model] = p
+	}
+	return prices, nil
+}
+
+// Cost 計算指定模型的費用，價格表中沒有的模型費用為 0
+func (pt PriceTable) Cost(model string, inputTokens, outputTokens int) float64 {
+	p, ok := pt[model]
+	if !ok {
+		return 0
+	}
+	return (float64(inputTokens)*p.InputPerMillion + float64(outputTokens)*p.OutputPerMillion) / 1e6
+}
@@ -0,0 +1,244 @@
+// Package usage 記錄所有模型呼叫的 token 用量與費用
+// 可依模型、使用者、會話與 flow 彙總，作為內部團隊分攤費用的依據
+package usage
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"dongstudio.live/genkit_demo/pkg/auth"
+	"github.com/firebase/genkit/go/ai"
+)
+
+// Record 為一次模型呼叫的用量記錄
+type Record struct {
+	Time         time.Time `json:"time"`
+	Model        string    `json:"model"`
+	User         string    `json:"user,omitempty"`
+	Session      string    `json:"session,omitempty"`
+	Flow         string    `json:"flow,omitempty"`
+	InputTokens  int       `json:"input_tokens"`
+	OutputTokens int       `json:"output_tokens"`
+	Cost         float64   `json:"cost"`
+}
+
+// Accountant 累計用量記錄，並可選擇將每筆記錄附加寫入 JSONL 檔案，
+// 重新啟動時會從檔案還原先前的記錄
+type Accountant struct {
+	prices PriceTable
+
+	mu      sync.RWMutex
+	records []Record
+	file    *os.File
+}
+
+// NewAccountant 建立用量記錄器，logPath 為空時只保存在記憶體中
+func NewAccountant(prices PriceTable, logPath string) (*Accountant, error) {
+	a := &Accountant{prices: prices}
+	if logPath == "" {
+		return a, nil
+	}
+
+	records, err := readRecords(logPath)
+	if err != nil {
+		return nil, err
+	}
+	a.records = records
+
+	a.file, err = os.OpenFile(logPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// NewFromEnv 依環境變數建立用量記錄器
+//
+//	USAGE_PRICE_TABLE  價格表 JSON 檔案路徑（可選）
+//	USAGE_LOG_FILE     用量記錄 JSONL 檔案路徑（可選）
+func NewFromEnv() (*Accountant, error) {
+	prices := DefaultPriceTable()
+	if path := os.Getenv("USAGE_PRICE_TABLE"); path != "" {
+		var err error
+		if prices, err = LoadPriceTable(path); err != nil {
+			return nil, err
+		}
+	}
+	return NewAccountant(prices, os.Getenv("USAGE_LOG_FILE"))
+}
+
+// readRecords 讀取既有的 JSONL 用量記錄，檔案不存在時回傳空列表
+func readRecords(path string) ([]Record, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var records []Record
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var r Record
+		if err := json.Unmarshal([]byte(line), &r); err != nil {
+			return nil, fmt.Errorf("解析用量記錄 %s 失敗: %w", path, err)
+		}
+		records = append(records, r)
+	}
+	return records, scanner.Err()
+}
+
+// Close 關閉用量記錄檔
+func (a *Accountant) Close() error {
+	if a.file == nil {
+		return nil
+	}
+	return a.file.Close()
+}
+
+type sessionKey struct{}
+
+// WithSession 回傳帶有會話ID的 context，之後的用量記錄會歸屬到該會話
+func WithSession(ctx context.Context, sessionID string) context.Context {
+	return context.WithValue(ctx, sessionKey{}, sessionID)
+}
+
+// Record 記錄一次模型呼叫的用量，使用者與會話從 ctx 取得
+func (a *Accountant) Record(ctx context.Context, model, flow string, u *ai.GenerationUsage) Record {
+	r := Record{
+		Time:  time.Now(),
+		Model: model,
+		Flow:  flow,
+	}
+	if p := auth.FromContext(ctx); p != nil {
+		r.User = p.ID
+	}
+	r.Session, _ = ctx.Value(sessionKey{}).(string)
+	if u != nil {
+		r.InputTokens = u.InputTokens
+		r.OutputTokens = u.OutputTokens
+	}
+	r.Cost = a.prices.Cost(model, r.InputTokens, r.OutputTokens)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.records = append(a.records, r)
+	if a.file != nil {
+		// 寫入失敗不影響這次的呼叫，記憶體中的統計仍然正確，但重新啟動後這筆記錄會遺失
+		line, err := json.Marshal(r)
+		if err == nil {
+			_, err = a.file.Write(append(line, '\n'))
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "無法寫入用量記錄", "path", a.file.Name(), "model", model, "error", err)
+		}
+	}
+	return r
+}
+
+// Filter 為查詢用量時的條件，零值欄位表示不限制
+type Filter struct {
+	User string
+	From time.Time
+	To   time.Time
+}
+
+func (f Filter) match(r Record) bool {
+	if f.User != "" && r.User != f.User {
+		return false
+	}
+	if !f.From.IsZero() && r.Time.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && !r.Time.Before(f.To) {
+		return false
+	}
+	return true
+}
+
+// Dimensions 為可用於彙總的維度
+var Dimensions = []string{"model", "user", "session", "flow"}
+
+// Total 為一組維度值的彙總結果，未參與分組的維度為空字串
+type Total struct {
+	Model        string  `json:"model,omitempty"`
+	User         string  `json:"user,omitempty"`
+	Session      string  `json:"session,omitempty"`
+	Flow         string  `json:"flow,omitempty"`
+	Requests     int     `json:"requests"`
+	InputTokens  int     `json:"input_tokens"`
+	OutputTokens int     `json:"output_tokens"`
+	Cost         float64 `json:"cost"`
+}
+
+// Totals 依 groupBy 指定的維度彙總符合條件的記錄
+// groupBy 為空時回傳單一筆總計；每次查詢都會掃描所有記錄，記錄數隨時間增加時查詢成本也隨之增加
+func (a *Accountant) Totals(groupBy []string, f Filter) ([]Total, error) {
+	for _, dim := range groupBy {
+		if !slices.Contains(Dimensions, dim) {
+			return nil, fmt.Errorf("不支援的彙總維度: %s", dim)
+		}
+	}
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	index := make(map[Total]int)
+	var totals []Total
+	for _, r := range a.records {
+		if !f.match(r) {
+			continue
+		}
+		var key Total
+		for _, dim := range groupBy {
+			switch dim {
+			case "model":
+				key.Model = r.Model
+			case "user":
+				key.User = r.User
+			case "session":
+				key.Session = r.Session
+			case "flow":
+				key.Flow = r.Flow
+			}
+		}
+		i, ok := index[key]
+		if !ok {
+			i = len(totals)
+			index[key] = i
+			totals = append(totals, key)
+		}
+		totals[i].Requests++
+		totals[i].InputTokens += r.InputTokens
+		totals[i].OutputTokens += r.OutputTokens
+		totals[i].Cost += r.Cost
+	}
+
+	// 依費用由高到低排序
+	slices.SortStableFunc(totals, func(x, y Total) int {
+		switch {
+		case x.Cost > y.Cost:
+			return -1
+		case x.Cost < y.Cost:
+			return 1
+		}
+		return 0
+	})
+	return totals, nil
+}
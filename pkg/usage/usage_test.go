@@ -0,0 +1,59 @@
+package usage
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/firebase/genkit/go/ai"
+)
+
+func TestAccountantPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "usage.jsonl")
+	a, err := NewAccountant(DefaultPriceTable(), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.Record(context.Background(), "googleai/gemini-2.5-flash", "rag-flow", &ai.GenerationUsage{InputTokens: 10, OutputTokens: 5})
+	if err := a.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := NewAccountant(DefaultPriceTable(), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	totals, err := reopened.Totals(nil, Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(totals) != 1 || totals[0].Requests != 1 || totals[0].InputTokens != 10 {
+		t.Errorf("重新開啟後 Totals() = %+v", totals)
+	}
+}
+
+func TestAccountantWriteFailure(t *testing.T) {
+	var logs bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+
+	a, err := NewAccountant(DefaultPriceTable(), filepath.Join(t.TempDir(), "usage.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.file.Close() // 之後的寫入都會失敗
+	a.Record(context.Background(), "googleai/gemini-2.5-flash", "rag-flow", &ai.GenerationUsage{InputTokens: 10})
+
+	if !strings.Contains(logs.String(), "無法寫入用量記錄") {
+		t.Errorf("寫入失敗沒有記錄錯誤，日誌: %s", logs.String())
+	}
+	// 記憶體中的統計不受影響
+	if totals, _ := a.Totals(nil, Filter{}); len(totals) != 1 || totals[0].Requests != 1 {
+		t.Errorf("Totals() = %+v", totals)
+	}
+}
@@ -0,0 +1,214 @@
+package vectorstore
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// Filter 為 metadata 過濾條件，語法與 Pinecone 相同，兩種向量資料庫可共用同一份條件：
+//
+//	{"category": "食物"}                              等於
+//	{"category": {"$in": ["食物", "旅遊"]}}            屬於其中之一
+//	{"year": {"$gte": 2020}, "lang": {"$ne": "en"}}   多個欄位同時成立
+//	{"$or": [{"category": "食物"}, {"tags": "台灣"}]}  任一條件成立
+//
+// 支援的運算子：$eq $ne $gt $gte $lt $lte $in $nin $exists $and $or
+// metadata 值為陣列時，$eq 與 $in 只要陣列中任一元素符合即成立（與 Pinecone 相同）
+type Filter map[string]any
+
+// ParseFilter 驗證過濾條件並轉為標準形式：欄位值為陣列時視為 $in
+// 回傳的條件可直接傳給 Pinecone，或以 [Filter.Match] 在本機比對
+func ParseFilter(raw map[string]any) (Filter, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+	f := make(Filter, len(raw))
+	for key, value := range raw {
+		switch key {
+		case "$and", "$or":
+			list, ok := value.([]any)
+			if !ok || len(list) == 0 {
+				return nil, fmt.Errorf("%s 必須是非空陣列", key)
+			}
+			subs := make([]any, 0, len(list))
+			for _, item := range list {
+				m, ok := item.(map[string]any)
+				if !ok {
+					return nil, fmt.Errorf("%s 的元素必須是物件", key)
+				}
+				sub, err := ParseFilter(m)
+				if err != nil {
+					return nil, err
+				}
+				subs = append(subs, map[string]any(sub))
+			}
+			f[key] = subs
+		default:
+			if strings.HasPrefix(key, "$") {
+				return nil, fmt.Errorf("不支援的運算子: %s", key)
+			}
+			cond, err := parseCondition(key, value)
+			if err != nil {
+				return nil, err
+			}
+			f[key] = cond
+		}
+	}
+	return f, nil
+}
+
+// parseCondition 將單一欄位的條件轉為 {"$op": value} 形式
+func parseCondition(field string, value any) (map[string]any, error) {
+	switch v := value.(type) {
+	case []any:
+		return map[string]any{"$in": v}, nil
+	case map[string]any:
+		if len(v) == 0 {
+			return nil, fmt.Errorf("欄位 %s 的條件不可為空", field)
+		}
+		for op, arg := range v {
+			switch op {
+			case "$eq", "$ne":
+				if !isScalar(arg) {
+					return nil, fmt.Errorf("欄位 %s 的 %s 必須是字串、數字或布林值", field, op)
+				}
+			case "$gt", "$gte", "$lt", "$lte":
+				if _, ok := toFloat(arg); !ok {
+					return nil, fmt.Errorf("欄位 %s 的 %s 必須是數字", field, op)
+				}
+			case "$in", "$nin":
+				list, ok := arg.([]any)
+				if !ok || slices.ContainsFunc(list, func(v any) bool { return !isScalar(v) }) {
+					return nil, fmt.Errorf("欄位 %s 的 %s 必須是字串、數字或布林值的陣列", field, op)
+				}
+			case "$exists":
+				if _, ok := arg.(bool); !ok {
+					return nil, fmt.Errorf("欄位 %s 的 $exists 必須是布林值", field)
+				}
+			default:
+				return nil, fmt.Errorf("欄位 %s 使用了不支援的運算子: %s", field, op)
+			}
+		}
+		return v, nil
+	default:
+		if !isScalar(v) {
+			return nil, fmt.Errorf("欄位 %s 的條件型別不支援: %T", field, value)
+		}
+		return map[string]any{"$eq": v}, nil
+	}
+}
+
+// Match 判斷 metadata 是否符合過濾條件，nil 條件符合所有文檔
+// 條件應先經過 [ParseFilter] 驗證
+func (f Filter) Match(metadata map[string]any) bool {
+	for key, value := range f {
+		switch key {
+		case "$and":
+			for _, sub := range value.([]any) {
+				if !Filter(sub.(map[string]any)).Match(metadata) {
+					return false
+				}
+			}
+		case "$or":
+			if !slices.ContainsFunc(value.([]any), func(sub any) bool {
+				return Filter(sub.(map[string]any)).Match(metadata)
+			}) {
+				return false
+			}
+		default:
+			actual, exists := metadata[key]
+			for op, arg := range value.(map[string]any) {
+				if !matchOp(op, actual, exists, arg) {
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
+
+func matchOp(op string, actual any, exists bool, arg any) bool {
+	switch op {
+	case "$exists":
+		return exists == arg.(bool)
+	case "$eq":
+		return exists && anyValue(actual, func(v any) bool { return equal(v, arg) })
+	case "$ne":
+		return !exists || !anyValue(actual, func(v any) bool { return equal(v, arg) })
+	case "$in":
+		return exists && anyValue(actual, func(v any) bool {
+			return slices.ContainsFunc(arg.([]any), func(a any) bool { return equal(v, a) })
+		})
+	case "$nin":
+		return !exists || !anyValue(actual, func(v any) bool {
+			return slices.ContainsFunc(arg.([]any), func(a any) bool { return equal(v, a) })
+		})
+	case "$gt", "$gte", "$lt", "$lte":
+		x, ok := toFloat(actual)
+		if !ok {
+			return false
+		}
+		y, _ := toFloat(arg)
+		switch op {
+		case "$gt":
+			return x > y
+		case "$gte":
+			return x >= y
+		case "$lt":
+			return x < y
+		default:
+			return x <= y
+		}
+	}
+	return false
+}
+
+// anyValue 對純量值直接判斷，對陣列判斷是否有任一元素成立
+func anyValue(v any, fn func(any) bool) bool {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Slice {
+		for i := range rv.Len() {
+			if fn(rv.Index(i).Interface()) {
+				return true
+			}
+		}
+		return false
+	}
+	return fn(v)
+}
+
+// equal 比較兩個純量值，數字不分型別（metadata 從 JSON 讀回時為 float64）
+func equal(a, b any) bool {
+	if x, ok := toFloat(a); ok {
+		y, ok := toFloat(b)
+		return ok && x == y
+	}
+	return a == b
+}
+
+func isScalar(v any) bool {
+	switch v.(type) {
+	case string, bool:
+		return true
+	}
+	_, ok := toFloat(v)
+	return ok
+}
+
+func toFloat(v any) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	}
+	return 0, false
+}
@@ -0,0 +1,112 @@
+package vectorstore
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// parseJSON 解析 JSON 格式的過濾條件，與 HTTP 請求中的 filter 相同
+func parseJSON(t *testing.T, s string) map[string]any {
+	t.Helper()
+	var raw map[string]any
+	if err := json.Unmarshal([]byte(s), &raw); err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+func TestParseFilter(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    string // 標準形式，空字串表示 nil
+		wantErr bool
+	}{
+		{name: "empty", in: `{}`},
+		{name: "scalar becomes $eq", in: `{"category":"食物"}`, want: `{"category":{"$eq":"食物"}}`},
+		{name: "array becomes $in", in: `{"category":["食物","旅遊"]}`, want: `{"category":{"$in":["食物","旅遊"]}}`},
+		{name: "operators kept", in: `{"year":{"$gte":2020,"$lt":2025}}`, want: `{"year":{"$gte":2020,"$lt":2025}}`},
+		{
+			name: "nested $or",
+			in:   `{"$or":[{"category":"食物"},{"tags":["台灣"]}]}`,
+			want: `{"$or":[{"category":{"$eq":"食物"}},{"tags":{"$in":["台灣"]}}]}`,
+		},
+		{name: "unknown operator", in: `{"year":{"$regex":"20.."}}`, wantErr: true},
+		{name: "unknown top-level operator", in: `{"$not":{"a":1}}`, wantErr: true},
+		{name: "empty condition", in: `{"year":{}}`, wantErr: true},
+		{name: "$gte needs number", in: `{"year":{"$gte":"2020"}}`, wantErr: true},
+		{name: "$in needs scalars", in: `{"tags":{"$in":[{"a":1}]}}`, wantErr: true},
+		{name: "$exists needs bool", in: `{"tags":{"$exists":1}}`, wantErr: true},
+		{name: "empty $and", in: `{"$and":[]}`, wantErr: true},
+		{name: "$or element not object", in: `{"$or":["食物"]}`, wantErr: true},
+		{name: "invalid nested condition", in: `{"$and":[{"year":{"$gt":true}}]}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseFilter(parseJSON(t, tt.in))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseFilter(%s) error = %v", tt.in, err)
+			}
+			if tt.wantErr {
+				return
+			}
+			var want Filter
+			if tt.want != "" {
+				want = Filter(parseJSON(t, tt.want))
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("ParseFilter(%s) = %v, want %v", tt.in, got, want)
+			}
+		})
+	}
+}
+
+func TestFilterMatch(t *testing.T) {
+	metadata := map[string]any{
+		"category": "食物",
+		"year":     2023, // 程式產生的 metadata 為 int，從 JSON 讀回時為 float64
+		"rating":   4.5,
+		"tags":     []any{"台灣", "夜市"},
+		"draft":    false,
+	}
+	tests := []struct {
+		filter string
+		want   bool
+	}{
+		{`{}`, true},
+		{`{"category":"食物"}`, true},
+		{`{"category":"旅遊"}`, false},
+		{`{"category":["旅遊","食物"]}`, true},
+		{`{"category":{"$nin":["旅遊","食物"]}}`, false},
+		{`{"category":{"$ne":"旅遊"}}`, true},
+		{`{"year":2023}`, true},
+		{`{"year":{"$gte":2023}}`, true},
+		{`{"year":{"$gt":2023}}`, false},
+		{`{"year":{"$gte":2020,"$lt":2023}}`, false},
+		{`{"rating":{"$lte":4.5}}`, true},
+		{`{"category":{"$gt":1}}`, false}, // 非數字欄位不符合大小比較
+		{`{"tags":"夜市"}`, true},           // 陣列中任一元素符合即成立
+		{`{"tags":["日本","台灣"]}`, true},
+		{`{"tags":{"$ne":"台灣"}}`, false},
+		{`{"tags":{"$nin":["日本"]}}`, true},
+		{`{"draft":false}`, true},
+		{`{"author":{"$exists":false}}`, true},
+		{`{"author":{"$ne":"小明"}}`, true}, // 欄位不存在時 $ne 成立
+		{`{"author":"小明"}`, false},
+		{`{"$and":[{"category":"食物"},{"year":{"$gte":2024}}]}`, false},
+		{`{"$and":[{"category":"食物"},{"tags":"台灣"}]}`, true},
+		{`{"$or":[{"category":"旅遊"},{"year":{"$lt":2024}}]}`, true},
+		{`{"$or":[{"category":"旅遊"},{"draft":true}]}`, false},
+		{`{"$or":[{"category":"旅遊"},{"tags":"夜市"}],"year":2023}`, true},
+	}
+	for _, tt := range tests {
+		f, err := ParseFilter(parseJSON(t, tt.filter))
+		if err != nil {
+			t.Fatalf("ParseFilter(%s) error = %v", tt.filter, err)
+		}
+		if got := f.Match(metadata); got != tt.want {
+			t.Errorf("Match(%s) = %v, want %v", tt.filter, got, tt.want)
+		}
+	}
+}
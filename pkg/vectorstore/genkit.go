@@ -0,0 +1,180 @@
+package vectorstore
+
+import (
+	"context"
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"maps"
+	"strings"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/genkit"
+)
+
+const provider = "localVectorStore"
+
+// Config 為 [DefineRetriever] 的設定
+type Config struct {
+	Path            string      // 資料庫檔案路徑，必填
+	Metric          Metric      // 相似度計算方式，預設為 cosine
+	Embedder        ai.Embedder // 用於產生向量的 embedder，必填
+	EmbedderOptions any         // 傳給 embedder 的選項
+	HNSW            *HNSWConfig // 不為 nil 時使用 HNSW 近似最近鄰索引，否則使用精確搜尋
+}
+
+// DocStore 結合向量資料庫與 embedder，提供 Genkit 的索引與檢索
+type DocStore struct {
+	Store           *Store
+	Embedder        ai.Embedder
+	EmbedderOptions any
+}
+
+// DefineRetriever 開啟本機向量資料庫並註冊對應的 Retriever，
+// 用法與 pinecone.DefineRetriever 相同，可直接替換
+func DefineRetriever(g *genkit.Genkit, name string, cfg Config) (*DocStore, ai.Retriever, error) {
+	if cfg.Path == "" {
+		return nil, nil, errors.New("Path required")
+	}
+	if cfg.Embedder == nil {
+		return nil, nil, errors.New("Embedder required")
+	}
+
+	store, err := Open(cfg.Path, cfg.Metric)
+	if err != nil {
+		return nil, nil, err
+	}
+	if cfg.HNSW != nil {
+		if err := store.UseHNSW(*cfg.HNSW); err != nil {
+			return nil, nil, err
+		}
+	}
+	ds := &DocStore{
+		Store:           store,
+		Embedder:        cfg.Embedder,
+		EmbedderOptions: cfg.EmbedderOptions,
+	}
+	return ds, genkit.DefineRetriever(g, provider, name, ds.Retrieve), nil
+}
+
+// RetrieverOptions 可放在 [ai.RetrieverRequest] 的 Options 欄位
+// Options 應為 nil 或 *RetrieverOptions
+type RetrieverOptions struct {
+	K        int     `json:"k,omitempty"`         // 回傳的文檔數，預設為 3
+	Filter   Filter  `json:"filter,omitempty"`    // metadata 過濾條件，語法與 Pinecone 相同（見 [Filter]）
+	MinScore float64 `json:"min_score,omitempty"` // 相似度低於此值的文檔不回傳，0 表示不限制
+}
+
+// ScoreKey 為檢索結果中相似度的 metadata 欄位，由 retriever 寫入，文檔本身的 metadata 不可使用
+const ScoreKey = "score"
+
+// CheckMetadata 確認文檔的 metadata 沒有使用保留欄位 [ScoreKey]，否則檢索時會被相似度覆蓋
+func CheckMetadata(doc *ai.Document) error {
+	if _, ok := doc.Metadata[ScoreKey]; ok {
+		return fmt.Errorf("metadata 的 %s 為保留欄位，檢索時會被相似度覆蓋", ScoreKey)
+	}
+	return nil
+}
+
+// Retrieve 實作 Genkit Retriever，回傳與查詢最相似的文檔
+// 每份文檔的 metadata 會帶上 "score" 欄位
+func (ds *DocStore) Retrieve(ctx context.Context, req *ai.RetrieverRequest) (*ai.RetrieverResponse, error) {
+	opts := &RetrieverOptions{}
+	if req.Options != nil {
+		var ok bool
+		if opts, ok = req.Options.(*RetrieverOptions); !ok {
+			return nil, fmt.Errorf("vectorstore.Retrieve options have type %T, want %T", req.Options, &RetrieverOptions{})
+		}
+	}
+	k := opts.K
+	if k <= 0 {
+		k = 3
+	}
+	var filter func(*Entry) bool
+	if opts.Filter != nil {
+		filter = func(e *Entry) bool { return opts.Filter.Match(e.Metadata) }
+	}
+
+	eres, err := ds.Embedder.Embed(ctx, &ai.EmbedRequest{
+		Input:   []*ai.Document{req.Query},
+		Options: ds.EmbedderOptions,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("vectorstore retrieve embedding failed: %w", err)
+	}
+	if len(eres.Embeddings) == 0 {
+		return nil, errors.New("vectorstore retrieve: embedder returned no embeddings")
+	}
+
+	results, err := ds.Store.Search(eres.Embeddings[0].Embedding, k, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	docs := make([]*ai.Document, 0, len(results))
+	for _, r := range results {
+		if opts.MinScore != 0 && r.Score < opts.MinScore {
+			continue
+		}
+		metadata := maps.Clone(r.Entry.Metadata)
+		if metadata == nil {
+			metadata = make(map[string]any)
+		}
+		metadata[ScoreKey] = r.Score
+		docs = append(docs, ai.DocumentFromText(r.Entry.Content, metadata))
+	}
+	return &ai.RetrieverResponse{Documents: docs}, nil
+}
+
+// Index 將文檔轉為向量後寫入資料庫，已存在相同 ID 的文檔會被覆寫
+// metadata 使用保留欄位（見 [CheckMetadata]）時整批不寫入
+func Index(ctx context.Context, docs []*ai.Document, ds *DocStore) error {
+	if len(docs) == 0 {
+		return nil
+	}
+	for _, doc := range docs {
+		if err := CheckMetadata(doc); err != nil {
+			return err
+		}
+	}
+
+	eres, err := ds.Embedder.Embed(ctx, &ai.EmbedRequest{
+		Input:   docs,
+		Options: ds.EmbedderOptions,
+	})
+	if err != nil {
+		return fmt.Errorf("vectorstore index embedding failed: %w", err)
+	}
+	if len(eres.Embeddings) != len(docs) {
+		return fmt.Errorf("vectorstore index: got %d embeddings for %d documents", len(eres.Embeddings), len(docs))
+	}
+
+	entries := make([]*Entry, 0, len(docs))
+	for i, doc := range docs {
+		entries = append(entries, &Entry{
+			ID:       DocID(doc),
+			Content:  DocText(doc),
+			Metadata: maps.Clone(doc.Metadata),
+			Vector:   eres.Embeddings[i].Embedding,
+		})
+	}
+	return ds.Store.Upsert(entries...)
+}
+
+// DocID 回傳文檔的 ID：優先使用 metadata 中的 "id"，否則以文字內容（見 [DocText]）的 MD5 作為 ID，
+// 內容相同的文檔不論 metadata 是否相同都會得到同一個 ID
+func DocID(doc *ai.Document) string {
+	if id, ok := doc.Metadata["id"].(string); ok && id != "" {
+		return id
+	}
+	return fmt.Sprintf("%x", md5.Sum([]byte(DocText(doc))))
+}
+
+// DocText 串接文檔中所有文字部分
+func DocText(doc *ai.Document) string {
+	var sb strings.Builder
+	for _, p := range doc.Content {
+		sb.WriteString(p.Text)
+	}
+	return sb.String()
+}
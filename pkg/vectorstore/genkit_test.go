@@ -0,0 +1,23 @@
+package vectorstore
+
+import (
+	"testing"
+
+	"github.com/firebase/genkit/go/ai"
+)
+
+func TestDocID(t *testing.T) {
+	withID := ai.DocumentFromText("內容", map[string]any{"id": "doc-1"})
+	if got := DocID(withID); got != "doc-1" {
+		t.Errorf("DocID() = %q, want doc-1", got)
+	}
+	// 沒有 id 時只依文字內容決定，metadata 不影響 ID
+	a := DocID(ai.DocumentFromText("內容", map[string]any{"category": "食物"}))
+	b := DocID(ai.DocumentFromText("內容", nil))
+	if want := "84c609ad19a9d168ef84aa4862333ba4"; a != want || b != want {
+		t.Errorf("DocID() = %q, %q, want %q", a, b, want)
+	}
+	if DocID(ai.DocumentFromText("其他內容", nil)) == a {
+		t.Error("不同內容的 DocID 相同")
+	}
+}
@@ -0,0 +1,512 @@
+package vectorstore
+
+import (
+	"container/heap"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"sync"
+)
+
+// HNSWConfig 為 HNSW 索引的參數
+type HNSWConfig struct {
+	M              int `json:"m"`               // 每個節點在第 1 層以上的鄰居數上限，第 0 層為 2*M
+	EfConstruction int `json:"ef_construction"` // 插入時的候選數，越大圖的品質越好但建立越慢
+	EfSearch       int `json:"ef_search"`       // 查詢時的候選數，越大召回率越高但查詢越慢
+}
+
+// DefaultHNSWConfig 回傳常用的預設參數
+func DefaultHNSWConfig() HNSWConfig {
+	return HNSWConfig{M: 16, EfConstruction: 200, EfSearch: 64}
+}
+
+// withDefaults 將未設定的參數補上預設值
+func (c HNSWConfig) withDefaults() HNSWConfig {
+	d := DefaultHNSWConfig()
+	if c.M <= 0 {
+		c.M = d.M
+	}
+	if c.EfConstruction <= 0 {
+		c.EfConstruction = d.EfConstruction
+	}
+	if c.EfSearch <= 0 {
+		c.EfSearch = d.EfSearch
+	}
+	return c
+}
+
+// Neighbor 為近鄰搜尋的結果
+type Neighbor struct {
+	ID    string
+	Score float64
+}
+
+// hnswNode 為圖中的一個節點，neighbors[l] 為第 l 層的鄰居
+type hnswNode struct {
+	id        string
+	vector    []float32
+	norm      float32
+	neighbors [][]uint32
+}
+
+// HNSW 為 Hierarchical Navigable Small World 近似最近鄰索引
+// 支援逐筆插入與刪除，可保存到檔案並以 mmap 載入（見 [LoadHNSW]）
+type HNSW struct {
+	cfg       HNSWConfig
+	metric    Metric
+	levelMult float64
+
+	mu       sync.RWMutex
+	nodes    []*hnswNode // 已刪除的節點為 nil
+	ids      map[string]uint32
+	entry    int64 // 入口節點，-1 表示索引為空
+	maxLevel int
+	dim      int
+	rng      *rand.Rand
+
+	unmap    func() error      // 以 mmap 載入時用於釋放對應的記憶體
+	fileHash [sha256.Size]byte // 載入時索引檔記錄的內容雜湊
+}
+
+// NewHNSW 建立空的 HNSW 索引
+func NewHNSW(metric Metric, cfg HNSWConfig) (*HNSW, error) {
+	switch metric {
+	case "":
+		metric = Cosine
+	case Cosine, DotProduct:
+	default:
+		return nil, fmt.Errorf("不支援的相似度計算方式: %s", metric)
+	}
+	cfg = cfg.withDefaults()
+	return &HNSW{
+		cfg:       cfg,
+		metric:    metric,
+		levelMult: 1 / math.Log(float64(cfg.M)),
+		ids:       make(map[string]uint32),
+		entry:     -1,
+		rng:       rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64())),
+	}, nil
+}
+
+// Config 回傳索引參數
+func (h *HNSW) Config() HNSWConfig {
+	return h.cfg
+}
+
+// SetEfSearch 調整查詢時的候選數
+func (h *HNSW) SetEfSearch(ef int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if ef > 0 {
+		h.cfg.EfSearch = ef
+	}
+}
+
+// Len 回傳索引中的資料筆數
+func (h *HNSW) Len() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.ids)
+}
+
+// Tombstones 回傳已刪除（含被覆寫）但仍佔用位置的節點數
+func (h *HNSW) Tombstones() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.nodes) - len(h.ids)
+}
+
+// Compact 移除已刪除的節點並將存活節點重新編號，釋放刪除或覆寫累積的空位
+func (h *HNSW) Compact() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	live, remap := h.liveNodes()
+	if len(live) == len(h.nodes) {
+		return
+	}
+	nodes := make([]*hnswNode, len(live))
+	for i, old := range live {
+		n := h.nodes[old]
+		for l, neighbors := range n.neighbors {
+			kept := neighbors[:0]
+			for _, nb := range neighbors {
+				if j, ok := remap[nb]; ok {
+					kept = append(kept, j)
+				}
+			}
+			n.neighbors[l] = kept
+		}
+		nodes[i] = n
+		h.ids[n.id] = uint32(i)
+	}
+	if h.entry >= 0 {
+		h.entry = int64(remap[uint32(h.entry)])
+	}
+	h.nodes = nodes
+}
+
+// Close 釋放以 mmap 載入的記憶體，之後不可再使用此索引
+func (h *HNSW) Close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.unmap == nil {
+		return nil
+	}
+	err := h.unmap()
+	h.unmap = nil
+	h.nodes = nil
+	h.ids = make(map[string]uint32)
+	h.entry = -1
+	return err
+}
+
+// Insert 將向量加入索引，已存在相同 ID 時會先刪除舊資料
+func (h *HNSW) Insert(id string, vector []float32) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.dim == 0 {
+		h.dim = len(vector)
+	}
+	if len(vector) != h.dim || h.dim == 0 {
+		return fmt.Errorf("向量維度不一致: %s 為 %d，索引為 %d", id, len(vector), h.dim)
+	}
+	if old, ok := h.ids[id]; ok {
+		h.remove(old)
+	}
+
+	level := int(-math.Log(1-h.rng.Float64()) * h.levelMult)
+	node := &hnswNode{
+		id:        id,
+		vector:    vector,
+		norm:      vectorNorm(vector),
+		neighbors: make([][]uint32, level+1),
+	}
+	idx := uint32(len(h.nodes))
+	h.nodes = append(h.nodes, node)
+	h.ids[id] = idx
+
+	if h.entry < 0 {
+		h.entry = int64(idx)
+		h.maxLevel = level
+		return nil
+	}
+
+	q := query{vector: vector, norm: node.norm}
+	ep := candidate{idx: uint32(h.entry), dist: h.distance(q, uint32(h.entry))}
+	for l := h.maxLevel; l > level; l-- {
+		ep = h.greedy(q, ep, l)
+	}
+	for l := min(level, h.maxLevel); l >= 0; l-- {
+		cands := h.searchLayer(q, ep, h.cfg.EfConstruction, l, nil)
+		selected := h.selectNeighbors(cands, h.maxConn(l))
+		node.neighbors[l] = make([]uint32, 0, len(selected))
+		for _, c := range selected {
+			node.neighbors[l] = append(node.neighbors[l], c.idx)
+			h.connect(c.idx, idx, l)
+		}
+		if len(cands) > 0 {
+			ep = cands[0]
+		}
+	}
+	if level > h.maxLevel {
+		h.maxLevel = level
+		h.entry = int64(idx)
+	}
+	return nil
+}
+
+// Delete 從索引刪除指定 ID，並修補原本經由它相連的鄰居，不存在的 ID 會被忽略
+func (h *HNSW) Delete(ids ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, id := range ids {
+		if idx, ok := h.ids[id]; ok {
+			h.remove(idx)
+		}
+	}
+}
+
+// remove 刪除節點並重新連接它的鄰居（呼叫者需持有鎖）
+func (h *HNSW) remove(idx uint32) {
+	node := h.nodes[idx]
+	h.nodes[idx] = nil
+	delete(h.ids, node.id)
+
+	for l, neighbors := range node.neighbors {
+		for _, nb := range neighbors {
+			nbNode := h.nodes[nb]
+			if nbNode == nil || l >= len(nbNode.neighbors) {
+				continue
+			}
+			// 以原本的鄰居加上被刪除節點的鄰居作為候選，重新挑選連線
+			q := query{vector: nbNode.vector, norm: nbNode.norm}
+			var cands []candidate
+			seen := map[uint32]bool{nb: true}
+			for _, c := range slices.Concat(nbNode.neighbors[l], neighbors) {
+				if seen[c] || h.nodes[c] == nil {
+					continue
+				}
+				seen[c] = true
+				cands = append(cands, candidate{idx: c, dist: h.distance(q, c)})
+			}
+			slices.SortFunc(cands, compareCandidates)
+			nbNode.neighbors[l] = candidateIndexes(h.selectNeighbors(cands, h.maxConn(l)))
+		}
+	}
+
+	if h.entry == int64(idx) {
+		h.resetEntry()
+	}
+}
+
+// resetEntry 以層級最高的節點作為新的入口（呼叫者需持有鎖）
+func (h *HNSW) resetEntry() {
+	h.entry = -1
+	h.maxLevel = 0
+	for i, n := range h.nodes {
+		if n != nil && (h.entry < 0 || len(n.neighbors)-1 > h.maxLevel) {
+			h.entry = int64(i)
+			h.maxLevel = len(n.neighbors) - 1
+		}
+	}
+}
+
+// Search 回傳與 query 最相似的 k 筆資料，依分數由高到低排序
+// filter 不為 nil 時只回傳 filter 回傳 true 的資料；符合條件的資料很少時會走訪較多節點
+func (h *HNSW) Search(vector []float32, k int, filter func(id string) bool) ([]Neighbor, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if h.entry < 0 || k <= 0 {
+		return nil, nil
+	}
+	if len(vector) != h.dim {
+		return nil, fmt.Errorf("查詢向量維度為 %d，索引為 %d", len(vector), h.dim)
+	}
+
+	q := query{vector: vector, norm: vectorNorm(vector)}
+	ep := candidate{idx: uint32(h.entry), dist: h.distance(q, uint32(h.entry))}
+	for l := h.maxLevel; l > 0; l-- {
+		ep = h.greedy(q, ep, l)
+	}
+
+	var accept func(uint32) bool
+	if filter != nil {
+		accept = func(idx uint32) bool { return filter(h.nodes[idx].id) }
+	}
+	cands := h.searchLayer(q, ep, max(h.cfg.EfSearch, k), 0, accept)
+
+	results := make([]Neighbor, 0, min(k, len(cands)))
+	for _, c := range cands[:min(k, len(cands))] {
+		results = append(results, Neighbor{ID: h.nodes[c.idx].id, Score: -float64(c.dist)})
+	}
+	return results, nil
+}
+
+// query 為查詢向量與其長度
+type query struct {
+	vector []float32
+	norm   float32
+}
+
+// distance 回傳查詢與節點的距離，越小越相似（相似度取負值）
+func (h *HNSW) distance(q query, idx uint32) float32 {
+	n := h.nodes[idx]
+	var dot float32
+	for i, x := range q.vector {
+		dot += x * n.vector[i]
+	}
+	if h.metric == DotProduct {
+		return -dot
+	}
+	if q.norm == 0 || n.norm == 0 {
+		return 0
+	}
+	return -dot / (q.norm * n.norm)
+}
+
+// maxConn 回傳第 l 層的鄰居數上限
+func (h *HNSW) maxConn(l int) int {
+	if l == 0 {
+		return 2 * h.cfg.M
+	}
+	return h.cfg.M
+}
+
+// greedy 在第 l 層從 ep 貪婪地走向離 query 最近的節點
+func (h *HNSW) greedy(q query, ep candidate, l int) candidate {
+	for changed := true; changed; {
+		changed = false
+		for _, nb := range h.nodes[ep.idx].neighbors[l] {
+			if h.nodes[nb] == nil {
+				continue
+			}
+			if d := h.distance(q, nb); d < ep.dist {
+				ep = candidate{idx: nb, dist: d}
+				changed = true
+			}
+		}
+	}
+	return ep
+}
+
+// searchLayer 在第 l 層以 best-first 搜尋 ef 個最近的節點，回傳依距離由近到遠排序的結果
+// accept 不為 nil 時，只有 accept 回傳 true 的節點會放入結果，但所有節點都會被走訪
+func (h *HNSW) searchLayer(q query, ep candidate, ef, l int, accept func(uint32) bool) []candidate {
+	visited := map[uint32]bool{ep.idx: true}
+	cands := &minHeap{ep}
+	results := &maxHeap{}
+	if accept == nil || accept(ep.idx) {
+		heap.Push(results, ep)
+	}
+
+	for cands.Len() > 0 {
+		c := heap.Pop(cands).(candidate)
+		if results.Len() >= ef && c.dist > (*results)[0].dist {
+			break
+		}
+		for _, nb := range h.nodes[c.idx].neighbors[l] {
+			if visited[nb] || h.nodes[nb] == nil {
+				continue
+			}
+			visited[nb] = true
+			d := h.distance(q, nb)
+			if results.Len() < ef || d < (*results)[0].dist {
+				heap.Push(cands, candidate{idx: nb, dist: d})
+				if accept == nil || accept(nb) {
+					heap.Push(results, candidate{idx: nb, dist: d})
+					if results.Len() > ef {
+						heap.Pop(results)
+					}
+				}
+			}
+		}
+	}
+
+	out := []candidate(*results)
+	slices.SortFunc(out, compareCandidates)
+	return out
+}
+
+// selectNeighbors 以啟發式方法從依距離排序的候選中挑選最多 m 個鄰居：
+// 優先保留彼此方向不同的節點，讓圖能連到不同的群集，不足時再以最近的節點補滿
+func (h *HNSW) selectNeighbors(cands []candidate, m int) []candidate {
+	if len(cands) <= m {
+		return cands
+	}
+	selected := make([]candidate, 0, m)
+	var pruned []candidate
+	for _, c := range cands {
+		if len(selected) >= m {
+			break
+		}
+		cNode := h.nodes[c.idx]
+		q := query{vector: cNode.vector, norm: cNode.norm}
+		good := true
+		for _, s := range selected {
+			if h.distance(q, s.idx) < c.dist {
+				good = false
+				break
+			}
+		}
+		if good {
+			selected = append(selected, c)
+		} else {
+			pruned = append(pruned, c)
+		}
+	}
+	for _, c := range pruned {
+		if len(selected) >= m {
+			break
+		}
+		selected = append(selected, c)
+	}
+	return selected
+}
+
+// connect 在第 l 層加入 from -> to 的連線，超過上限時重新挑選 from 的鄰居
+func (h *HNSW) connect(from, to uint32, l int) {
+	node := h.nodes[from]
+	node.neighbors[l] = append(node.neighbors[l], to)
+	if len(node.neighbors[l]) <= h.maxConn(l) {
+		return
+	}
+
+	q := query{vector: node.vector, norm: node.norm}
+	cands := make([]candidate, 0, len(node.neighbors[l]))
+	for _, nb := range node.neighbors[l] {
+		if h.nodes[nb] != nil {
+			cands = append(cands, candidate{idx: nb, dist: h.distance(q, nb)})
+		}
+	}
+	slices.SortFunc(cands, compareCandidates)
+	node.neighbors[l] = candidateIndexes(h.selectNeighbors(cands, h.maxConn(l)))
+}
+
+func vectorNorm(v []float32) float32 {
+	var sum float32
+	for _, x := range v {
+		sum += x * x
+	}
+	return float32(math.Sqrt(float64(sum)))
+}
+
+// candidate 為搜尋過程中的節點與距離
+type candidate struct {
+	idx  uint32
+	dist float32
+}
+
+func compareCandidates(a, b candidate) int {
+	switch {
+	case a.dist < b.dist:
+		return -1
+	case a.dist > b.dist:
+		return 1
+	}
+	return 0
+}
+
+func candidateIndexes(cands []candidate) []uint32 {
+	out := make([]uint32, len(cands))
+	for i, c := range cands {
+		out[i] = c.idx
+	}
+	return out
+}
+
+// minHeap 依距離由近到遠取出候選
+type minHeap []candidate
+
+func (h minHeap) Len() int           { return len(h) }
+func (h minHeap) Less(i, j int) bool { return h[i].dist < h[j].dist }
+func (h minHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *minHeap) Push(x any)        { *h = append(*h, x.(candidate)) }
+func (h *minHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// maxHeap 讓目前結果中最遠的節點位於頂端，方便淘汰
+type maxHeap []candidate
+
+func (h maxHeap) Len() int           { return len(h) }
+func (h maxHeap) Less(i, j int) bool { return h[i].dist > h[j].dist }
+func (h maxHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *maxHeap) Push(x any)        { *h = append(*h, x.(candidate)) }
+func (h *maxHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// errBadIndexFile 表示索引檔格式錯誤
+var errBadIndexFile = errors.New("HNSW 索引檔格式錯誤")
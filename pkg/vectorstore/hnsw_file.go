@@ -0,0 +1,284 @@
+package vectorstore
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"slices"
+	"unsafe"
+)
+
+// 索引檔格式（little-endian）：
+//
+//	"HNSW" 版本 | metric | M efConstruction efSearch | dim count entry maxLevel | 內容雜湊 (32 bytes)
+//	所有向量 (count*dim float32) | 所有向量長度 (count float32)
+//	每個節點: ID | 層數 | 每層的鄰居
+//
+// 向量區段固定從 4 bytes 對齊的位置開始，載入時可直接對應到 mmap 的記憶體，不需複製
+// 內容雜湊涵蓋所有資料的 ID 與向量（見 hashEntries），載入時用來確認索引與資料庫檔案一致
+const (
+	hnswMagic   = "HNSW"
+	hnswVersion = 2
+)
+
+// hashEntries 計算資料內容的雜湊，依 ID 排序後涵蓋每筆資料的 ID 與向量，與插入順序無關；
+// vector 回傳指定 ID 的向量
+func hashEntries(ids []string, vector func(id string) []float32) [sha256.Size]byte {
+	ids = slices.Clone(ids)
+	slices.Sort(ids)
+	h := sha256.New()
+	buf := make([]byte, 4)
+	for _, id := range ids {
+		binary.LittleEndian.PutUint32(buf, uint32(len(id)))
+		h.Write(buf)
+		h.Write([]byte(id))
+		v := vector(id)
+		binary.LittleEndian.PutUint32(buf, uint32(len(v)))
+		h.Write(buf)
+		for _, x := range v {
+			binary.LittleEndian.PutUint32(buf, math.Float32bits(x))
+			h.Write(buf)
+		}
+	}
+	var sum [sha256.Size]byte
+	h.Sum(sum[:0])
+	return sum
+}
+
+// contentHash 由存活的節點計算內容雜湊（呼叫者需持有鎖）
+func (h *HNSW) contentHash() [sha256.Size]byte {
+	ids := make([]string, 0, len(h.ids))
+	for id := range h.ids {
+		ids = append(ids, id)
+	}
+	return hashEntries(ids, func(id string) []float32 { return h.nodes[h.ids[id]].vector })
+}
+
+// Save 將索引保存到檔案，已刪除的節點不會寫入
+// 以暫存檔加上 rename 的方式寫入，正在以 mmap 使用舊檔的索引不受影響
+func (h *HNSW) Save(path string) error {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	live, remap := h.liveNodes()
+	entry := int32(-1)
+	if h.entry >= 0 {
+		entry = int32(remap[uint32(h.entry)])
+	}
+
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+
+	w := bufio.NewWriter(f)
+	u32 := func(v uint32) { binary.Write(w, binary.LittleEndian, v) }
+	f32 := func(v float32) { u32(math.Float32bits(v)) }
+
+	w.WriteString(hnswMagic)
+	u32(hnswVersion)
+	u32(uint32(len(h.metric)))
+	w.WriteString(string(h.metric))
+	w.Write(make([]byte, padding(len(h.metric))))
+	u32(uint32(h.cfg.M))
+	u32(uint32(h.cfg.EfConstruction))
+	u32(uint32(h.cfg.EfSearch))
+	u32(uint32(h.dim))
+	u32(uint32(len(live)))
+	u32(uint32(entry))
+	u32(uint32(h.maxLevel))
+	hash := h.contentHash()
+	w.Write(hash[:])
+
+	for _, i := range live {
+		for _, x := range h.nodes[i].vector {
+			f32(x)
+		}
+	}
+	for _, i := range live {
+		f32(h.nodes[i].norm)
+	}
+	for _, i := range live {
+		n := h.nodes[i]
+		u32(uint32(len(n.id)))
+		w.WriteString(n.id)
+		u32(uint32(len(n.neighbors)))
+		for _, neighbors := range n.neighbors {
+			kept := make([]uint32, 0, len(neighbors))
+			for _, nb := range neighbors {
+				if j, ok := remap[nb]; ok {
+					kept = append(kept, j)
+				}
+			}
+			u32(uint32(len(kept)))
+			for _, j := range kept {
+				u32(j)
+			}
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// LoadHNSW 以 mmap 載入 [HNSW.Save] 保存的索引，向量資料直接使用對應的記憶體而不複製，
+// 載入後仍可繼續插入與刪除；不再使用時應呼叫 Close
+func LoadHNSW(path string) (*HNSW, error) {
+	data, unmap, err := mmapFile(path)
+	if err != nil {
+		return nil, err
+	}
+	h, err := decodeHNSW(data)
+	if err != nil {
+		unmap()
+		return nil, fmt.Errorf("載入 HNSW 索引 %s 失敗: %w", path, err)
+	}
+	h.unmap = unmap
+	return h, nil
+}
+
+// decodeHNSW 解析索引檔內容，little-endian 的平台上向量會直接引用 data
+func decodeHNSW(data []byte) (*HNSW, error) {
+	r := &byteReader{data: data}
+	if string(r.bytes(4)) != hnswMagic || r.u32() != hnswVersion {
+		return nil, errBadIndexFile
+	}
+	metricLen := int(r.u32())
+	metric := Metric(r.bytes(metricLen))
+	r.bytes(padding(metricLen))
+
+	cfg := HNSWConfig{M: int(r.u32()), EfConstruction: int(r.u32()), EfSearch: int(r.u32())}
+	dim, count := int(r.u32()), int(r.u32())
+	entry, maxLevel := int32(r.u32()), int(r.u32())
+	var hash [sha256.Size]byte
+	copy(hash[:], r.bytes(sha256.Size))
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	h, err := NewHNSW(metric, cfg)
+	if err != nil {
+		return nil, err
+	}
+	h.dim = dim
+	h.fileHash = hash
+	h.entry = int64(entry)
+	h.maxLevel = maxLevel
+
+	vectors := r.float32s(count * dim)
+	norms := r.float32s(count)
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	h.nodes = make([]*hnswNode, count)
+	for i := range count {
+		n := &hnswNode{
+			id:     string(r.bytes(int(r.u32()))),
+			vector: vectors[i*dim : (i+1)*dim : (i+1)*dim],
+			norm:   norms[i],
+		}
+		levels := int(r.u32())
+		if r.err != nil || levels > 64 {
+			return nil, errBadIndexFile
+		}
+		n.neighbors = make([][]uint32, levels)
+		for l := range levels {
+			m := int(r.u32())
+			if r.err != nil || m > len(r.data) {
+				return nil, errBadIndexFile
+			}
+			n.neighbors[l] = make([]uint32, m)
+			for j := range m {
+				nb := r.u32()
+				if int(nb) >= count {
+					return nil, errBadIndexFile
+				}
+				n.neighbors[l][j] = nb
+			}
+		}
+		h.nodes[i] = n
+		h.ids[n.id] = uint32(i)
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	if count == 0 {
+		h.entry = -1
+	} else if entry < 0 || int(entry) >= count {
+		return nil, errBadIndexFile
+	}
+	return h, nil
+}
+
+// liveNodes 回傳存活節點的位置，以及由原位置對應到連續新編號的映射（呼叫者需持有鎖）
+func (h *HNSW) liveNodes() ([]uint32, map[uint32]uint32) {
+	live := make([]uint32, 0, len(h.ids))
+	remap := make(map[uint32]uint32, len(h.ids))
+	for i, n := range h.nodes {
+		if n != nil {
+			remap[uint32(i)] = uint32(len(live))
+			live = append(live, uint32(i))
+		}
+	}
+	return live, remap
+}
+
+// byteReader 依序讀取索引檔內容，超出範圍時記錄錯誤
+type byteReader struct {
+	data []byte
+	off  int
+	err  error
+}
+
+func (r *byteReader) bytes(n int) []byte {
+	if r.err != nil || n < 0 || r.off+n > len(r.data) {
+		r.err = errBadIndexFile
+		return nil
+	}
+	b := r.data[r.off : r.off+n]
+	r.off += n
+	return b
+}
+
+func (r *byteReader) u32() uint32 {
+	b := r.bytes(4)
+	if b == nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint32(b)
+}
+
+// float32s 讀取 n 個 float32，平台為 little-endian 時直接引用原始資料
+func (r *byteReader) float32s(n int) []float32 {
+	b := r.bytes(n * 4)
+	if b == nil || n == 0 {
+		return nil
+	}
+	if nativeLittleEndian {
+		return unsafe.Slice((*float32)(unsafe.Pointer(&b[0])), n)
+	}
+	out := make([]float32, n)
+	for i := range out {
+		out[i] = math.Float32frombits(binary.LittleEndian.Uint32(b[i*4:]))
+	}
+	return out
+}
+
+var nativeLittleEndian = binary.NativeEndian.Uint16([]byte{1, 0}) == 1
+
+// padding 回傳補齊到 4 bytes 對齊所需的長度
+func padding(n int) int {
+	return (4 - n%4) % 4
+}
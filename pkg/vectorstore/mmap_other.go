@@ -0,0 +1,14 @@
+//go:build !unix
+
+package vectorstore
+
+import "os"
+
+// mmapFile 在不支援 mmap 的平台上直接讀取整個檔案
+func mmapFile(path string) ([]byte, func() error, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, func() error { return nil }, nil
+}
@@ -0,0 +1,323 @@
+// Package vectorstore 是儲存在本機檔案的向量資料庫，可在沒有 Pinecone 時離線開發與測試
+// 預設以精確的暴力搜尋（brute-force）計算 cosine 或內積相似度，
+// 資料量大時可呼叫 [Store.UseHNSW] 改用 HNSW 近似最近鄰索引
+//
+// 所有資料保存在單一 JSON 檔案，每次寫入都會重寫整個檔案，適合開發與數萬筆以內的資料量；
+// 更大的資料量或頻繁的小量寫入請改用 Pinecone
+package vectorstore
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+)
+
+// Metric 為相似度計算方式
+type Metric string
+
+const (
+	Cosine     Metric = "cosine"      // cosine 相似度
+	DotProduct Metric = "dot_product" // 內積，適用於已正規化的向量
+)
+
+// Entry 為儲存的一筆資料
+type Entry struct {
+	ID       string         `json:"id"`
+	Content  string         `json:"content"`
+	Metadata map[string]any `json:"metadata,omitempty"`
+	Vector   []float32      `json:"vector"`
+}
+
+// Result 為搜尋結果
+type Result struct {
+	Entry *Entry
+	Score float64
+}
+
+// Store 為記憶體中的向量資料，寫入時同步保存到檔案
+type Store struct {
+	path   string
+	metric Metric
+
+	mu      sync.RWMutex
+	entries map[string]*Entry
+	dim     int
+	index   *HNSW // 為 nil 時使用暴力搜尋
+}
+
+// Open 開啟（或建立）指定路徑的向量資料庫
+func Open(path string, metric Metric) (*Store, error) {
+	switch metric {
+	case "":
+		metric = Cosine
+	case Cosine, DotProduct:
+	default:
+		return nil, fmt.Errorf("不支援的相似度計算方式: %s", metric)
+	}
+
+	s := &Store{
+		path:    path,
+		metric:  metric,
+		entries: make(map[string]*Entry),
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []*Entry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("解析向量資料庫 %s 失敗: %w", path, err)
+	}
+	for _, e := range entries {
+		s.entries[e.ID] = e
+		s.dim = len(e.Vector)
+	}
+	return s, nil
+}
+
+// UseHNSW 改用 HNSW 索引搜尋，索引保存在資料庫檔案旁的 .hnsw 檔
+// 索引檔存在且內容雜湊與資料一致時以 mmap 載入，省去重新建立索引的時間；否則由現有資料重新建立
+// 向量仍保存在資料庫檔案並載入記憶體，使用索引不會減少記憶體用量
+func (s *Store) UseHNSW(cfg HNSWConfig) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cfg = cfg.withDefaults()
+	if index, err := LoadHNSW(s.indexPath()); err == nil {
+		if index.metric == s.metric && index.cfg.M == cfg.M && s.indexMatches(index) {
+			index.SetEfSearch(cfg.EfSearch)
+			s.index = index
+			return nil
+		}
+		index.Close()
+	}
+
+	index, err := NewHNSW(s.metric, cfg)
+	if err != nil {
+		return err
+	}
+	// 依 ID 排序插入，讓同一份資料建立的索引較為穩定
+	for _, e := range s.sortedEntries() {
+		if err := index.Insert(e.ID, e.Vector); err != nil {
+			return err
+		}
+	}
+	s.index = index
+	return s.index.Save(s.indexPath())
+}
+
+// indexMatches 確認索引檔記錄的內容雜湊與資料一致（呼叫者需持有鎖）
+// 寫入資料庫檔案後、寫入索引檔前中斷，或同一 ID 的向量已更新時，雜湊會不同
+func (s *Store) indexMatches(index *HNSW) bool {
+	if index.Len() != len(s.entries) {
+		return false
+	}
+	ids := make([]string, 0, len(s.entries))
+	for id := range s.entries {
+		ids = append(ids, id)
+	}
+	return index.fileHash == hashEntries(ids, func(id string) []float32 { return s.entries[id].Vector })
+}
+
+func (s *Store) indexPath() string {
+	return s.path + ".hnsw"
+}
+
+// Close 釋放 HNSW 索引佔用的資源
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.index == nil {
+		return nil
+	}
+	return s.index.Close()
+}
+
+// Metric 回傳此資料庫使用的相似度計算方式
+func (s *Store) Metric() Metric {
+	return s.metric
+}
+
+// Len 回傳資料筆數
+func (s *Store) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.entries)
+}
+
+// Get 依 ID 取得資料
+func (s *Store) Get(id string) (*Entry, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	e, ok := s.entries[id]
+	return e, ok
+}
+
+// Upsert 新增或覆寫資料並保存到檔案，所有向量維度必須一致
+// 先驗證整批資料，任一筆無效時不會寫入任何資料
+// 每次呼叫都會重寫整個資料庫檔案（與 HNSW 索引檔），寫入成本與資料總量成正比，應盡量整批寫入；
+// 保存失敗時記憶體中的資料已更新，下次成功保存時一併寫入檔案
+func (s *Store) Upsert(entries ...*Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dim := s.dim
+	if dim == 0 && s.index != nil {
+		dim = s.index.dim
+	}
+	for _, e := range entries {
+		if e.ID == "" {
+			return errors.New("資料缺少 ID")
+		}
+		if len(e.Vector) == 0 {
+			return fmt.Errorf("資料 %s 缺少向量", e.ID)
+		}
+		if dim == 0 {
+			dim = len(e.Vector)
+		}
+		if len(e.Vector) != dim {
+			return fmt.Errorf("向量維度不一致: %s 為 %d，資料庫為 %d", e.ID, len(e.Vector), dim)
+		}
+	}
+
+	// 驗證通過後索引不會因維度拒絕插入
+	s.dim = dim
+	for _, e := range entries {
+		if s.index != nil {
+			if err := s.index.Insert(e.ID, e.Vector); err != nil {
+				return err
+			}
+		}
+		s.entries[e.ID] = e
+	}
+	return s.save()
+}
+
+// Delete 刪除指定 ID 的資料並保存到檔案，不存在的 ID 會被忽略；與 [Store.Upsert] 相同會重寫整個檔案
+func (s *Store) Delete(ids ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, id := range ids {
+		delete(s.entries, id)
+	}
+	if s.index != nil {
+		s.index.Delete(ids...)
+	}
+	return s.save()
+}
+
+// Search 回傳與 query 最相似的 k 筆資料，依分數由高到低排序
+// filter 不為 nil 時只考慮 filter 回傳 true 的資料
+func (s *Store) Search(query []float32, k int, filter func(*Entry) bool) ([]Result, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.dim != 0 && len(query) != s.dim {
+		return nil, fmt.Errorf("查詢向量維度為 %d，資料庫為 %d", len(query), s.dim)
+	}
+	if s.index != nil {
+		return s.searchIndex(query, k, filter)
+	}
+
+	results := make([]Result, 0, len(s.entries))
+	for _, e := range s.entries {
+		if filter != nil && !filter(e) {
+			continue
+		}
+		results = append(results, Result{Entry: e, Score: Similarity(s.metric, query, e.Vector)})
+	}
+
+	slices.SortFunc(results, func(a, b Result) int {
+		return cmp.Compare(b.Score, a.Score)
+	})
+	return results[:min(k, len(results))], nil
+}
+
+// searchIndex 以 HNSW 索引搜尋（呼叫者需持有鎖）
+func (s *Store) searchIndex(query []float32, k int, filter func(*Entry) bool) ([]Result, error) {
+	var idFilter func(string) bool
+	if filter != nil {
+		idFilter = func(id string) bool { return filter(s.entries[id]) }
+	}
+	neighbors, err := s.index.Search(query, k, idFilter)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]Result, 0, len(neighbors))
+	for _, n := range neighbors {
+		if e, ok := s.entries[n.ID]; ok {
+			results = append(results, Result{Entry: e, Score: n.Score})
+		}
+	}
+	return results, nil
+}
+
+// sortedEntries 回傳依 ID 排序的所有資料（呼叫者需持有鎖）
+func (s *Store) sortedEntries() []*Entry {
+	entries := make([]*Entry, 0, len(s.entries))
+	for _, e := range s.entries {
+		entries = append(entries, e)
+	}
+	slices.SortFunc(entries, func(a, b *Entry) int { return cmp.Compare(a.ID, b.ID) })
+	return entries
+}
+
+// save 以暫存檔加上 rename 的方式寫入，避免寫到一半時損毀原檔（呼叫者需持有鎖）
+func (s *Store) save() error {
+	if dir := filepath.Dir(s.path); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+	}
+
+	data, err := json.Marshal(s.sortedEntries())
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return err
+	}
+	if s.index != nil {
+		// 刪除或覆寫留下的空位多於存活節點時先壓縮索引
+		if t := s.index.Tombstones(); t > 0 && t >= s.index.Len() {
+			s.index.Compact()
+		}
+		return s.index.Save(s.indexPath())
+	}
+	return nil
+}
+
+// Similarity 依 metric 計算兩個向量的相似度
+func Similarity(metric Metric, a, b []float32) float64 {
+	var dot, normA, normB float64
+	for i := range a {
+		x, y := float64(a[i]), float64(b[i])
+		dot += x * y
+		normA += x * x
+		normB += y * y
+	}
+	if metric == DotProduct {
+		return dot
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
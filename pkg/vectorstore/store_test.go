@@ -0,0 +1,256 @@
+package vectorstore
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func randomVector(rng *rand.Rand, dim int) []float32 {
+	v := make([]float32, dim)
+	for i := range v {
+		v[i] = rng.Float32()*2 - 1
+	}
+	return v
+}
+
+func openHNSWStore(t *testing.T, path string) *Store {
+	t.Helper()
+	s, err := Open(path, Cosine)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.UseHNSW(HNSWConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestUseHNSWRebuildsStaleIndex(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	path := filepath.Join(t.TempDir(), "store.json")
+
+	s := openHNSWStore(t, path)
+	for _, id := range []string{"a", "b", "c"} {
+		if err := s.Upsert(&Entry{ID: id, Vector: randomVector(rng, 8)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	staleIndex, err := os.ReadFile(s.indexPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 同一 ID 重新產生 embedding 後，模擬寫入資料庫檔案後、寫入索引檔前中斷
+	updated := randomVector(rng, 8)
+	if err := s.Upsert(&Entry{ID: "b", Vector: updated}); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+	if err := os.WriteFile(s.indexPath(), staleIndex, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened := openHNSWStore(t, path)
+	results, err := reopened.Search(updated, 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Entry.ID != "b" || results[0].Score < 0.999 {
+		t.Fatalf("Search 回傳 %+v，預期以更新後的向量找到 b", results)
+	}
+}
+
+func TestUseHNSWLoadsMatchingIndex(t *testing.T) {
+	rng := rand.New(rand.NewPCG(3, 4))
+	path := filepath.Join(t.TempDir(), "store.json")
+
+	s := openHNSWStore(t, path)
+	for _, id := range []string{"a", "b", "c"} {
+		if err := s.Upsert(&Entry{ID: id, Vector: randomVector(rng, 8)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.Close()
+
+	reopened := openHNSWStore(t, path)
+	if reopened.index.unmap == nil {
+		t.Fatal("內容一致的索引應以 mmap 載入而不是重新建立")
+	}
+}
+
+func TestHNSWCompact(t *testing.T) {
+	rng := rand.New(rand.NewPCG(5, 6))
+	index, err := NewHNSW(Cosine, HNSWConfig{M: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	vectors := make(map[string][]float32)
+	for i := range 50 {
+		id := string(rune('A' + i))
+		vectors[id] = randomVector(rng, 8)
+		if err := index.Insert(id, vectors[id]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 覆寫與刪除都會留下空位
+	for i := range 20 {
+		id := string(rune('A' + i))
+		vectors[id] = randomVector(rng, 8)
+		if err := index.Insert(id, vectors[id]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 40; i < 50; i++ {
+		id := string(rune('A' + i))
+		index.Delete(id)
+		delete(vectors, id)
+	}
+	if got := index.Tombstones(); got != 30 {
+		t.Fatalf("Tombstones() = %d, want 30", got)
+	}
+
+	index.Compact()
+	if got := index.Tombstones(); got != 0 {
+		t.Fatalf("壓縮後 Tombstones() = %d, want 0", got)
+	}
+	if got := index.Len(); got != len(vectors) {
+		t.Fatalf("Len() = %d, want %d", got, len(vectors))
+	}
+	for id, v := range vectors {
+		results, err := index.Search(v, 1, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) == 0 || results[0].ID != id {
+			t.Fatalf("壓縮後查詢 %s 的向量回傳 %+v", id, results)
+		}
+	}
+}
+
+func TestStoreSaveCompactsIndex(t *testing.T) {
+	rng := rand.New(rand.NewPCG(7, 8))
+	s := openHNSWStore(t, filepath.Join(t.TempDir(), "store.json"))
+	for range 3 {
+		for _, id := range []string{"a", "b"} {
+			if err := s.Upsert(&Entry{ID: id, Vector: randomVector(rng, 8)}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if got := s.index.Tombstones(); got >= s.index.Len() {
+		t.Fatalf("保存後仍有 %d 個空位（存活 %d 個）", got, s.index.Len())
+	}
+}
+
+func TestStoreSearch(t *testing.T) {
+	entries := []*Entry{
+		{ID: "short", Metadata: map[string]any{"lang": "zh"}, Vector: []float32{1, 0}},
+		{ID: "long", Metadata: map[string]any{"lang": "en"}, Vector: []float32{3, 3}},
+		{ID: "opposite", Metadata: map[string]any{"lang": "zh"}, Vector: []float32{-1, 0}},
+	}
+	zhOnly := func(e *Entry) bool { return e.Metadata["lang"] == "zh" }
+	tests := []struct {
+		name   string
+		metric Metric
+		k      int
+		filter func(*Entry) bool
+		want   []string
+		scores []float64
+	}{
+		// cosine 只看方向，內積也受向量長度影響
+		{name: "cosine", metric: Cosine, k: 3, want: []string{"short", "long", "opposite"}, scores: []float64{1, math.Sqrt2 / 2, -1}},
+		{name: "dot product", metric: DotProduct, k: 3, want: []string{"long", "short", "opposite"}, scores: []float64{3, 1, -1}},
+		{name: "top k", metric: Cosine, k: 1, want: []string{"short"}},
+		{name: "filter", metric: DotProduct, k: 3, filter: zhOnly, want: []string{"short", "opposite"}},
+		{name: "k larger than store", metric: Cosine, k: 10, filter: zhOnly, want: []string{"short", "opposite"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := Open(filepath.Join(t.TempDir(), "store.json"), tt.metric)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := s.Upsert(entries...); err != nil {
+				t.Fatal(err)
+			}
+			results, err := s.Search([]float32{1, 0}, tt.k, tt.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var ids []string
+			for i, r := range results {
+				ids = append(ids, r.Entry.ID)
+				if tt.scores != nil && math.Abs(r.Score-tt.scores[i]) > 1e-6 {
+					t.Errorf("%s 的分數 = %v, want %v", r.Entry.ID, r.Score, tt.scores[i])
+				}
+			}
+			if !slices.Equal(ids, tt.want) {
+				t.Errorf("Search() = %v, want %v", ids, tt.want)
+			}
+		})
+	}
+}
+
+func TestStoreSearchDimensionMismatch(t *testing.T) {
+	s, err := Open(filepath.Join(t.TempDir(), "store.json"), Cosine)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results, err := s.Search([]float32{1, 0, 0}, 3, nil); err != nil || len(results) != 0 {
+		t.Errorf("空資料庫 Search() = %v, %v", results, err)
+	}
+	if err := s.Upsert(&Entry{ID: "a", Vector: []float32{1, 0}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Search([]float32{1, 0, 0}, 3, nil); err == nil {
+		t.Error("維度不符的查詢應回傳錯誤")
+	}
+}
+
+func TestStoreUpsertValidatesBatch(t *testing.T) {
+	for _, useHNSW := range []bool{false, true} {
+		t.Run(fmt.Sprintf("hnsw=%v", useHNSW), func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "store.json")
+			s, err := Open(path, Cosine)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if useHNSW {
+				if err := s.UseHNSW(HNSWConfig{}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			defer s.Close()
+
+			// 批次中任一筆無效時整批不寫入，也不決定資料庫的維度
+			for _, batch := range [][]*Entry{
+				{{ID: "a", Vector: []float32{1, 0, 0}}, {ID: "b", Vector: []float32{1, 0}}},
+				{{ID: "a", Vector: []float32{1, 0, 0}}, {ID: "", Vector: []float32{1, 0, 0}}},
+				{{ID: "a", Vector: nil}},
+			} {
+				if err := s.Upsert(batch...); err == nil {
+					t.Errorf("Upsert(%v) 應回傳錯誤", batch)
+				}
+			}
+			if s.Len() != 0 {
+				t.Fatalf("無效的批次寫入了 %d 筆資料", s.Len())
+			}
+			if _, err := os.Stat(path); !os.IsNotExist(err) {
+				t.Errorf("無效的批次寫入了資料庫檔案: %v", err)
+			}
+
+			if err := s.Upsert(&Entry{ID: "a", Vector: []float32{1, 0}}, &Entry{ID: "b", Vector: []float32{0, 1}}); err != nil {
+				t.Fatalf("二維的資料應可寫入: %v", err)
+			}
+			if results, err := s.Search([]float32{0, 1}, 1, nil); err != nil || len(results) != 1 || results[0].Entry.ID != "b" {
+				t.Errorf("Search() = %v, %v", results, err)
+			}
+		})
+	}
+}